@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ouz/goboilerplate/internal/adapters/repo/postgres"
+	repoAudit "github.com/ouz/goboilerplate/internal/adapters/repo/postgres/audit"
+	repoUser "github.com/ouz/goboilerplate/internal/adapters/repo/postgres/user"
+	"github.com/ouz/goboilerplate/internal/application/audit"
+	"github.com/ouz/goboilerplate/internal/application/user"
+	"github.com/ouz/goboilerplate/internal/config"
+	domainUser "github.com/ouz/goboilerplate/internal/domain/user"
+	"github.com/ouz/goboilerplate/internal/observability"
+	"github.com/ouz/goboilerplate/pkg/cache"
+	redisCache "github.com/ouz/goboilerplate/pkg/cache/redis"
+)
+
+const adminUsage = `Usage: app admin <command> [arguments]
+
+Commands:
+  grant <email>                              grant the ADMIN role to a confirmed user, granting it again changes nothing
+`
+
+// runAdminCommand bootstraps administrators, the admin API itself requires one
+func runAdminCommand(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, adminUsage)
+		return fmt.Errorf("missing admin command")
+	}
+
+	if err := config.Load(); err != nil {
+		return err
+	}
+	logger = observability.InitLogger()
+
+	db, err := postgres.ConnectDB(logger)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := postgres.CloseDatabaseConnection(db, logger); err != nil {
+			logger.Error("Failed to close database connection", "error", err)
+		}
+	}()
+
+	redisClient, err := observability.InitRedis(logger)
+	if err != nil {
+		return err
+	}
+	defer redisCache.CloseRedisClient(redisClient)
+
+	// The user is evicted through a tiered cache so running instances drop their local copies
+	tiered := cache.NewTieredCacheService(logger,
+		cache.NewLocalCacheService(logger, 1, newCacheEncoder()),
+		redisCache.NewRedisCacheService(redisClient, newCacheEncoder()),
+		redisCache.NewInvalidationBus(logger, redisClient),
+		cache.TieredCacheOptions{Prefixes: config.Get().Cache.LocalPrefixes},
+	)
+	auditService := audit.NewAuditService(logger, repoAudit.NewAuditRepository(db))
+	roleService := user.NewRoleService(logger, repoUser.NewUserRepository(db), tiered, auditService)
+
+	switch args[0] {
+	case "grant":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: admin grant <email>")
+		}
+		u, err := roleService.GrantRole(context.Background(), args[1], domainUser.UserRoleAdmin)
+		if err != nil {
+			return err
+		}
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(map[string]string{"granted": string(domainUser.UserRoleAdmin), "userId": u.ID})
+	default:
+		fmt.Fprint(os.Stderr, adminUsage)
+		return fmt.Errorf("unknown admin command %q", args[0])
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ouz/goboilerplate/internal/config"
+	"github.com/ouz/goboilerplate/internal/observability"
+	"github.com/ouz/goboilerplate/pkg/cache"
+	redisCache "github.com/ouz/goboilerplate/pkg/cache/redis"
+)
+
+const cacheUsage = `Usage: app cache <command> [arguments]
+
+Commands:
+  inspect <prefix> <key>                     show a Valkey entry with its TTL, size and encoding
+  keys [-cursor c] [-count n] <prefix>       list one page of the keys of a prefix
+  evict <prefix> <key>                       evict a key from Valkey and every local cache
+  evict-prefix <prefix>                      evict every key of a prefix
+  stats [prefix...]                          count the keys and memory of prefixes, the locally cached ones by default
+`
+
+// runCacheCommand runs a cache administration command against Valkey and prints
+// its result as JSON. Local caches live in the server processes, use the admin
+// endpoints to inspect them
+func runCacheCommand(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, cacheUsage)
+		return fmt.Errorf("missing cache command")
+	}
+
+	if err := config.Load(); err != nil {
+		return err
+	}
+	logger = observability.InitLogger()
+
+	redisClient, err := observability.InitRedis(logger)
+	if err != nil {
+		return err
+	}
+	defer redisCache.CloseRedisClient(redisClient)
+
+	// Evictions go through a tiered cache so running instances drop their local copies
+	tiered := cache.NewTieredCacheService(logger,
+		cache.NewLocalCacheService(logger, 1, newCacheEncoder()),
+		redisCache.NewRedisCacheService(redisClient, newCacheEncoder()),
+		redisCache.NewInvalidationBus(logger, redisClient),
+		cache.TieredCacheOptions{Prefixes: config.Get().Cache.LocalPrefixes},
+	)
+	admin := cache.NewAdmin(tiered, nil, config.Get().Cache.LocalPrefixes)
+
+	return executeCacheCommand(context.Background(), admin, os.Stdout, args[0], args[1:])
+}
+
+func executeCacheCommand(ctx context.Context, admin *cache.Admin, out io.Writer, command string, args []string) error {
+	var result any
+	var err error
+
+	switch command {
+	case "inspect":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: cache inspect <prefix> <key>")
+		}
+		result, err = admin.Inspect(ctx, args[0], args[1])
+	case "keys":
+		flags := flag.NewFlagSet("cache keys", flag.ContinueOnError)
+		cursor := flags.String("cursor", "", "cursor returned by the previous page")
+		count := flags.Int64("count", 0, "number of keys to scan for")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			return fmt.Errorf("usage: cache keys [-cursor c] [-count n] <prefix>")
+		}
+		result, err = admin.Keys(ctx, flags.Arg(0), *cursor, *count)
+	case "evict":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: cache evict <prefix> <key>")
+		}
+		err = admin.Evict(ctx, args[0], args[1])
+		result = map[string]string{"evicted": args[0] + ":" + args[1]}
+	case "evict-prefix":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: cache evict-prefix <prefix>")
+		}
+		err = admin.EvictPrefix(ctx, args[0])
+		result = map[string]string{"evicted": args[0] + ":*"}
+	case "stats":
+		result, err = admin.Stats(ctx, args...)
+	default:
+		fmt.Fprint(os.Stderr, cacheUsage)
+		return fmt.Errorf("unknown cache command %q", command)
+	}
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
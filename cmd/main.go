@@ -2,12 +2,15 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/redis/go-redis/v9"
@@ -18,25 +21,65 @@ import (
 
 	"github.com/ouz/goboilerplate/internal/adapters/api"
 	"github.com/ouz/goboilerplate/internal/adapters/api/middleware"
+	"github.com/ouz/goboilerplate/internal/adapters/mail"
 	"github.com/ouz/goboilerplate/internal/adapters/repo/postgres"
 	"github.com/ouz/goboilerplate/internal/observability"
+	"github.com/ouz/goboilerplate/pkg/cache"
 	redisCache "github.com/ouz/goboilerplate/pkg/cache/redis"
 	"github.com/ouz/goboilerplate/pkg/errors"
+	"github.com/ouz/goboilerplate/pkg/lock"
+	redisLock "github.com/ouz/goboilerplate/pkg/lock/redis"
 	resp "github.com/ouz/goboilerplate/pkg/response"
+	"github.com/ouz/goboilerplate/pkg/stream"
+	redisStream "github.com/ouz/goboilerplate/pkg/stream/redis"
 
+	repoAudit "github.com/ouz/goboilerplate/internal/adapters/repo/postgres/audit"
 	repoAuth "github.com/ouz/goboilerplate/internal/adapters/repo/postgres/auth"
+	repoEvent "github.com/ouz/goboilerplate/internal/adapters/repo/postgres/event"
 	repoUser "github.com/ouz/goboilerplate/internal/adapters/repo/postgres/user"
+	repoWebhook "github.com/ouz/goboilerplate/internal/adapters/repo/postgres/webhook"
 
+	"github.com/ouz/goboilerplate/internal/application/audit"
 	"github.com/ouz/goboilerplate/internal/application/auth"
+	"github.com/ouz/goboilerplate/internal/application/event"
 	"github.com/ouz/goboilerplate/internal/application/user"
+	"github.com/ouz/goboilerplate/internal/application/webhook"
 	"github.com/ouz/goboilerplate/internal/config"
+	domainEvent "github.com/ouz/goboilerplate/internal/domain/event"
+	domainUser "github.com/ouz/goboilerplate/internal/domain/user"
 	"github.com/ouz/goboilerplate/pkg/log"
+	"github.com/ouz/goboilerplate/pkg/policy"
 	"gorm.io/gorm"
 )
 
 var logger *log.Logger
 
+// jobLockTTL bounds how long a crashed instance keeps a purge job from running elsewhere
+const jobLockTTL = time.Minute
+
+const (
+	readinessTimeout = 2 * time.Second
+	// workerRestartDelay is the wait before a long-running worker that failed, e.g.
+	// because Valkey was down when it started, is started again
+	workerRestartDelay = 5 * time.Second
+)
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "cache" {
+		if err := runCacheCommand(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "admin" {
+		if err := runAdminCommand(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if err := run(); err != nil {
 		panic(err)
 	}
@@ -51,8 +94,7 @@ func run() error {
 
 	otelShutdown, err := observability.InitTelemetry(ctx)
 	if err != nil {
-		panic(err)
-		otelShutdown = func(_ context.Context) error { return nil }
+		return err
 	}
 
 	defer func() {
@@ -72,7 +114,7 @@ func run() error {
 		}
 	}()
 
-	redisClient, err := redisCache.ConnectRedis(logger, config.Get().Valkey.Host, config.Get().Valkey.Port, config.Get().Otel.MonitoringEnabled)
+	redisClient, err := observability.InitRedis(logger)
 	if err != nil {
 		return err
 	}
@@ -85,10 +127,30 @@ func run() error {
 
 	resp.InitResponseLogger(logger)
 
+	policies, err := policy.LoadFile(config.Get().Policy.File)
+	if err != nil {
+		return err
+	}
+	authorizer := policy.NewAuthorizer(logger, policies...)
+
+	var workers sync.WaitGroup
+	workerCtx, stopWorkers := context.WithCancel(ctx)
+	defer stopWorkers()
+
+	// Calls to Valkey are bounded and stop while it keeps failing, so requests degrade instead of hanging
+	remoteCache := newResilientCache(redisClient)
+
 	businessRouter := http.NewServeMux()
-	setupServiceAndRoutes(businessRouter, db, redisClient)
+	if err := setupServiceAndRoutes(workerCtx, &workers, businessRouter, db, redisClient, remoteCache, authorizer); err != nil {
+		return err
+	}
 
-	mainRouter := createFinalRouter(businessRouter, db, logger)
+	rateLimiter := newRateLimiter(redisClient)
+	if rateLimiter != nil {
+		defer rateLimiter.Stop()
+	}
+
+	mainRouter := createFinalRouter(businessRouter, db, remoteCache, rateLimiter, logger)
 
 	mainRouterWithOTel := setupRouterWithTelemetry(mainRouter)
 
@@ -102,19 +164,21 @@ func run() error {
 		ReadHeaderTimeout: 10 * time.Second,
 	}
 
-	go func() {
+	workers.Go(func() {
 		logger.Info("Server is starting ", "port ", config.Get().App.Port)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			logger.Error("Server failed", "error", err)
 			os.Exit(1)
 		}
-	}()
+	})
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
 
 	logger.Info("Server is shutting down...")
+	stopWorkers()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -122,6 +186,21 @@ func run() error {
 		return errors.GenericError("server shutdown failed: %v", err)
 	}
 
+	// Let consumers finish in-flight messages before the database and Redis connections are closed
+	// Not started through workers, it would wait for itself
+	drained := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		logger.Info("Background workers stopped")
+	case <-ctx.Done():
+		logger.Warn("Timed out waiting for background workers to stop")
+	}
+
 	logger.Info("Server stopped gracefully")
 	return nil
 }
@@ -147,17 +226,26 @@ func setupRouterWithTelemetry(mainRouter *http.ServeMux) http.Handler {
 	return mainRouterWithOTel
 }
 
-func createFinalRouter(businessRouter *http.ServeMux, db *gorm.DB, logger *log.Logger) *http.ServeMux {
-	chain := middleware.Chain(
-		middleware.Logging(logger),
+// createFinalRouter serves the API behind the shared middlewares, rateLimiter may be nil to disable rate limiting
+func createFinalRouter(businessRouter *http.ServeMux, db *gorm.DB, remoteCache cache.ResilientCacheService, rateLimiter middleware.RateLimiter, logger *log.Logger) *http.ServeMux {
+	// Validated with the rest of the config on load
+	trustedProxies, _ := config.Get().App.TrustedProxyPrefixes()
+
+	middlewares := []middleware.Middleware{
+		middleware.Logging(logger, trustedProxies),
 		middleware.Recovery(logger),
-	)
+		middleware.RequestInfo(trustedProxies),
+	}
+	if rateLimiter != nil {
+		middlewares = append(middlewares, middleware.RateLimitMiddleware(rateLimiter, trustedProxies))
+	}
+	chain := middleware.Chain(middlewares...)
 
 	finalRouter := http.NewServeMux()
 
 	finalRouter.Handle("/metrics", promhttp.Handler())
 	finalRouter.HandleFunc("/live", livenessHandler)
-	finalRouter.HandleFunc("/ready", readinessHandler(db))
+	finalRouter.HandleFunc("/ready", readinessHandler(db, remoteCache))
 
 	finalRouter.Handle("/api/v1/", chain(http.StripPrefix("/api/v1", businessRouter)))
 
@@ -169,33 +257,266 @@ func livenessHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintln(w, "Live")
 }
 
-func readinessHandler(db *gorm.DB) http.HandlerFunc {
+// readinessHandler fails only without the database. An unreachable cache is reported
+// as degraded, requests are still served with fail-open prefixes falling back to the database
+func readinessHandler(db *gorm.DB, remoteCache cache.ResilientCacheService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if postgres.IsReady(db) {
-			w.WriteHeader(http.StatusOK)
-			fmt.Fprintln(w, "Ready")
-		} else {
-			w.WriteHeader(http.StatusServiceUnavailable)
-			fmt.Fprintln(w, "Not Ready")
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+
+		status := readiness{Status: "ready", Database: "up", Cache: "up", Circuit: remoteCache.State().String()}
+		if err := remoteCache.Check(ctx); err != nil {
+			status.Status = "degraded"
+			status.Cache = "down"
+			status.Circuit = remoteCache.State().String()
 		}
+		code := http.StatusOK
+		if !postgres.IsReady(db) {
+			status.Status = "not ready"
+			status.Database = "down"
+			code = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(status)
 	}
 }
 
-func setupServiceAndRoutes(mainRouter *http.ServeMux, pgdb *gorm.DB, redisClient *redis.Client) {
-	// cache := cache.NewLocalCacheService()
-	redisCache := redisCache.NewRedisCacheService(redisClient)
+type readiness struct {
+	Status   string `json:"status"`
+	Database string `json:"database"`
+	Cache    string `json:"cache"`
+	Circuit  string `json:"cacheCircuit"`
+}
+
+func setupServiceAndRoutes(ctx context.Context, workers *sync.WaitGroup, mainRouter *http.ServeMux, pgdb *gorm.DB, redisClient redis.UniversalClient, remoteCache cache.ResilientCacheService, authorizer policy.Authorizer) error {
+	encoder := newCacheEncoder()
+	localCache := cache.NewLocalCacheService(logger, config.Get().Cache.SizeMB, encoder)
+	// Local copies in front of Valkey, evictions go through it so every instance drops its copy
+	appCache := cache.NewTieredCacheService(logger, localCache, remoteCache, redisCache.NewInvalidationBus(logger, redisClient), cache.TieredCacheOptions{
+		LocalTTL: config.Get().Cache.LocalTTL,
+		Prefixes: config.Get().Cache.LocalPrefixes,
+	})
 	tx := postgres.NewTransactionManager(pgdb)
 
+	confirmationSender, err := newConfirmationSender()
+	if err != nil {
+		return err
+	}
+
+	streamService := newStreamService(redisClient)
+	outboxRepo := repoEvent.NewOutboxRepository(pgdb)
+	eventRegistry := domainEvent.NewRegistry()
+	eventPublisher := event.NewOutboxPublisher(outboxRepo, eventRegistry)
+	outboxRelay := event.NewOutboxRelay(logger, outboxRepo, streamService, tx, config.Get().Outbox)
+
+	auditRepo := repoAudit.NewAuditRepository(pgdb)
+	auditService := audit.NewAuditService(logger, auditRepo)
+
 	userRepo := repoUser.NewUserRepository(pgdb)
-	userService := user.NewUserService(logger, userRepo, redisCache, tx)
+	userService := user.NewUserService(logger, userRepo, appCache, tx, confirmationSender, auditService, eventPublisher)
 
 	authRepo := repoAuth.NewAuthRepository(pgdb)
-	authService := auth.NewAuthService(logger, authRepo, userService, redisCache)
+	authService := auth.NewAuthService(logger, authRepo, userService, appCache, auditService, eventPublisher)
 
 	authHandler := api.NewAuthHandler(logger, authService)
-	userHandler := api.NewUserHandler(logger, userService)
+	dataExportService := user.NewDataExportService(logger, userRepo, auditRepo, appCache, streamService)
+	userHandler := api.NewUserHandler(logger, userService, dataExportService, authorizer)
+
+	adminUserService := user.NewAdminUserService(logger, userRepo, authService, appCache, tx, eventPublisher, auditService)
+	adminHandler := api.NewAdminHandler(logger, adminUserService, auditService, authorizer)
+
+	webhookRepo := repoWebhook.NewWebhookRepository(pgdb)
+	webhookService := webhook.NewWebhookService(logger, webhookRepo, authRepo)
+	webhookHandler := api.NewWebhookHandler(logger, webhookService)
+	cacheHandler := api.NewCacheHandler(logger, cache.NewAdmin(appCache, localCache, config.Get().Cache.LocalPrefixes), auditService)
+	webhookDispatcher := webhook.NewDispatcher(logger, webhookRepo, streamService, eventRegistry, tx, config.Get().Webhook)
 
 	api.SetUpAuthRoutes(mainRouter, authHandler, userHandler, authService)
 	api.SetUpUserRoutes(mainRouter, userHandler, authService)
+	api.SetUpAdminRoutes(mainRouter, adminHandler, webhookHandler, cacheHandler, authService)
+
+	// Purges run on one instance at a time, the others skip the run while the lock is held
+	locker := redisLock.NewRedisLocker(logger, redisClient, lock.DefaultOptions())
+
+	workers.Go(func() {
+		runExclusively(ctx, locker, "purge inactive anonymous users", config.Get().Anonymous.PurgeInterval, func(ctx context.Context) error {
+			_, err := userService.PurgeInactiveAnonymousUsers(ctx)
+			return err
+		})
+	})
+	workers.Go(func() {
+		runExclusively(ctx, locker, "purge deleted accounts", config.Get().Account.PurgeInterval, func(ctx context.Context) error {
+			_, err := userService.PurgeDeletedAccounts(ctx)
+			return err
+		})
+	})
+
+	workers.Go(func() {
+		runPeriodically(ctx, "relay outbox", config.Get().Outbox.RelayInterval, func(ctx context.Context) error {
+			_, err := outboxRelay.Relay(ctx)
+			return err
+		})
+	})
+	workers.Go(func() {
+		runExclusively(ctx, locker, "purge published outbox messages", config.Get().Outbox.PurgeInterval, func(ctx context.Context) error {
+			_, err := outboxRelay.PurgePublished(ctx)
+			return err
+		})
+	})
+	workers.Go(func() {
+		runExclusively(ctx, locker, "purge expired audit events", config.Get().Audit.PurgeInterval, func(ctx context.Context) error {
+			_, err := auditService.PurgeExpired(ctx)
+			return err
+		})
+	})
+
+	workers.Go(func() {
+		runPeriodically(ctx, "dispatch webhooks", config.Get().Webhook.DispatchInterval, func(ctx context.Context) error {
+			_, err := webhookDispatcher.Dispatch(ctx)
+			return err
+		})
+	})
+
+	workers.Go(func() {
+		runRestarting(ctx, "cache invalidation listener", appCache.ListenInvalidations)
+	})
+	workers.Go(func() {
+		runRestarting(ctx, "data export consumer", func(ctx context.Context) error {
+			return dataExportService.ConsumeExportRequests(ctx, consumerName())
+		})
+	})
+	workers.Go(func() {
+		runRestarting(ctx, "webhook event consumer", func(ctx context.Context) error {
+			return webhookDispatcher.ConsumeEvents(ctx, consumerName())
+		})
+	})
 
+	return nil
+}
+
+func newResilientCache(redisClient redis.UniversalClient) cache.ResilientCacheService {
+	resilience := config.Get().Cache.Resilience
+	return cache.NewResilientCacheService(logger, redisCache.NewRedisCacheService(redisClient, newCacheEncoder()), cache.ResilienceOptions{
+		Timeout:          resilience.Timeout,
+		FailureThreshold: resilience.FailureThreshold,
+		OpenDuration:     resilience.OpenDuration,
+		FailOpenPrefixes: resilience.FailOpenPrefixes,
+		IsFailure:        redisCache.IsConnectionError,
+	})
+}
+
+// newCacheEncoder encodes cache values with the configured codec, the config is already validated
+func newCacheEncoder() *cache.Encoder {
+	cacheConfig := config.Get().Cache
+	codec, _ := cache.CodecByName(cacheConfig.Codec)
+	compression, _ := cache.CompressionByName(cacheConfig.Compression)
+
+	return cache.NewEncoder(cache.EncoderOptions{
+		Codec:                codec,
+		Compression:          compression,
+		CompressionThreshold: cacheConfig.CompressionThreshold,
+	})
+}
+
+// newConfirmationSender only sends emails when mail is enabled
+func newConfirmationSender() (domainUser.ConfirmationSender, error) {
+	if !config.Get().Mail.Enabled {
+		return mail.NewNoopConfirmationSender(), nil
+	}
+	return mail.NewSMTPConfirmationSender(config.Get().Mail, config.Get().App)
+}
+
+// newRateLimiter returns nil when rate limiting is disabled
+func newRateLimiter(redisClient redis.UniversalClient) middleware.RateLimiter {
+	rateLimit := config.Get().RateLimit
+	if !rateLimit.Enabled {
+		return nil
+	}
+
+	local := middleware.NewTokenBucket(rateLimit.Rate, rateLimit.Burst)
+	if rateLimit.Driver == config.RateLimitDriverMemory {
+		logger.Warn("Using the in-memory rate limiter, every instance applies the limit on its own")
+		return local
+	}
+	return middleware.NewRedisRateLimiter(logger, redisClient, middleware.RedisRateLimiterOptions{
+		Rate:       rateLimit.Rate,
+		BucketSize: rateLimit.Burst,
+		Timeout:    rateLimit.Timeout,
+		Fallback:   local,
+	})
+}
+
+func newStreamService(redisClient redis.UniversalClient) stream.StreamService {
+	streamConfig := config.Get().Stream
+	options := stream.ConsumerOptions{
+		BatchSize:      streamConfig.BatchSize,
+		Concurrency:    streamConfig.Concurrency,
+		HandlerTimeout: streamConfig.HandlerTimeout,
+		MaxDeliveries:  streamConfig.MaxDeliveries,
+		RetryBackoff:   streamConfig.RetryBackoff,
+		ClaimInterval:  streamConfig.ClaimInterval,
+		Retention:      streamConfig.Retention,
+	}
+
+	if streamConfig.Driver == config.StreamDriverMemory {
+		logger.Warn("Using the in-memory stream, events are lost on restart and not shared between instances")
+		return stream.NewMemoryStreamService(logger, options)
+	}
+	return redisStream.NewRedisStreamService(logger, redisClient, options)
+}
+
+// consumerName identifies this instance within stream consumer groups
+func consumerName() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return fmt.Sprintf("consumer-%d", os.Getpid())
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// runExclusively runs job periodically on whichever instance holds its lock, the
+// others skip the run
+func runExclusively(ctx context.Context, locker lock.Locker, name string, interval time.Duration, job func(ctx context.Context) error) {
+	runPeriodically(ctx, name, interval, func(ctx context.Context) error {
+		err := lock.WithLock(ctx, locker, "job:"+name, jobLockTTL, job)
+		if lock.IsNotAcquired(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+// runRestarting runs a long-running worker and starts it again after it failed, until ctx is done
+func runRestarting(ctx context.Context, name string, run func(ctx context.Context) error) {
+	for {
+		err := run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Error("Background worker stopped, restarting", "worker", name, "error", err, "retry_in", workerRestartDelay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(workerRestartDelay):
+		}
+	}
+}
+
+func runPeriodically(ctx context.Context, name string, interval time.Duration, job func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := job(ctx); err != nil {
+				logger.Error("Background job failed", "job", name, "error", err)
+			}
+		}
+	}
 }
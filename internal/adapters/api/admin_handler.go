@@ -0,0 +1,202 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ouz/goboilerplate/internal/adapters/api/util"
+	"github.com/ouz/goboilerplate/internal/adapters/repo/postgres"
+	auditDto "github.com/ouz/goboilerplate/internal/application/audit/dto"
+	userDto "github.com/ouz/goboilerplate/internal/application/user/dto"
+	"github.com/ouz/goboilerplate/internal/domain/audit"
+	"github.com/ouz/goboilerplate/internal/domain/shared"
+	"github.com/ouz/goboilerplate/internal/domain/user"
+	"github.com/ouz/goboilerplate/pkg/errors"
+	"github.com/ouz/goboilerplate/pkg/log"
+	"github.com/ouz/goboilerplate/pkg/policy"
+	resp "github.com/ouz/goboilerplate/pkg/response"
+)
+
+const userResource = "user"
+
+type AdminHandler struct {
+	logger           *log.Logger
+	adminUserService user.AdminUserService
+	auditService     audit.AuditService
+	authorizer       policy.Authorizer
+}
+
+func NewAdminHandler(logger *log.Logger, adminUserService user.AdminUserService, auditService audit.AuditService, authorizer policy.Authorizer) *AdminHandler {
+	return &AdminHandler{
+		logger:           logger,
+		adminUserService: adminUserService,
+		auditService:     auditService,
+		authorizer:       authorizer,
+	}
+}
+
+func (h *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	pagination, err := postgres.CreatePagination[user.User](r)
+	if err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	if err := h.adminUserService.ListUsers(r.Context(), r.URL.Query().Get("q"), pagination); err != nil {
+		h.logger.Error("Failed to list users", "error", err)
+		resp.Error(w, err)
+		return
+	}
+
+	users := make([]userDto.AdminUserResponse, 0, len(pagination.Data))
+	for _, u := range pagination.Data {
+		users = append(users, userDto.NewAdminUserResponse(u))
+	}
+
+	resp.JSON(w, http.StatusOK, shared.PaginationResponse{
+		Page:       pagination.GetPage(),
+		Limit:      pagination.GetLimit(),
+		TotalRows:  pagination.TotalRows,
+		TotalPages: pagination.TotalPages,
+		Data:       users,
+	})
+}
+
+func (h *AdminHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := util.Authorize(r, h.authorizer, "read", userPolicyResource(id)); err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	u, err := h.adminUserService.GetUser(r.Context(), id)
+	if err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	resp.JSON(w, http.StatusOK, userDto.NewAdminUserDetailResponse(*u))
+}
+
+func (h *AdminHandler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	h.handleUserAction(w, r, "enable", h.adminUserService.EnableUser)
+}
+
+func (h *AdminHandler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	h.handleUserAction(w, r, "disable", h.adminUserService.DisableUser)
+}
+
+func (h *AdminHandler) VerifyUser(w http.ResponseWriter, r *http.Request) {
+	h.handleUserAction(w, r, "verify", h.adminUserService.VerifyUser)
+}
+
+func (h *AdminHandler) LogoutUser(w http.ResponseWriter, r *http.Request) {
+	h.handleUserAction(w, r, "logout", h.adminUserService.LogoutUser)
+}
+
+func (h *AdminHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := util.Authorize(r, h.authorizer, "delete", userPolicyResource(id)); err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	if err := h.adminUserService.DeleteUser(r.Context(), id); err != nil {
+		h.logger.Error("Failed to delete user", "error", err, "userID", id)
+		resp.Error(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandler) handleUserAction(w http.ResponseWriter, r *http.Request, action string, fn func(ctx context.Context, id string) error) {
+	id := r.PathValue("id")
+	if err := util.Authorize(r, h.authorizer, action, userPolicyResource(id)); err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	if err := fn(r.Context(), id); err != nil {
+		h.logger.Error("Failed to "+action+" user", "error", err, "userID", id)
+		resp.Error(w, err)
+		return
+	}
+
+	resp.JSON(w, http.StatusOK, nil)
+}
+
+func userPolicyResource(id string) policy.Resource {
+	return policy.Resource{Type: userResource, ID: id, OwnerID: id}
+}
+
+func (h *AdminHandler) ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	pagination, err := postgres.CreatePagination[audit.Event](r)
+	if err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	if err := h.auditService.ListEvents(r.Context(), filter, pagination); err != nil {
+		h.logger.Error("Failed to list audit events", "error", err)
+		resp.Error(w, err)
+		return
+	}
+
+	events := make([]auditDto.AuditEventResponse, 0, len(pagination.Data))
+	for _, e := range pagination.Data {
+		events = append(events, auditDto.NewAuditEventResponse(e))
+	}
+
+	resp.JSON(w, http.StatusOK, shared.PaginationResponse{
+		Page:       pagination.GetPage(),
+		Limit:      pagination.GetLimit(),
+		TotalRows:  pagination.TotalRows,
+		TotalPages: pagination.TotalPages,
+		Data:       events,
+	})
+}
+
+func parseAuditFilter(r *http.Request) (audit.Filter, error) {
+	query := r.URL.Query()
+	filter := audit.Filter{
+		ActorID:  query.Get("actor"),
+		TargetID: query.Get("target"),
+		Subject:  query.Get("subject"),
+		Action:   audit.Action(strings.ToUpper(query.Get("action"))),
+		Outcome:  audit.Outcome(strings.ToUpper(query.Get("outcome"))),
+	}
+
+	for _, id := range []string{filter.ActorID, filter.TargetID} {
+		if id == "" {
+			continue
+		}
+		if _, err := uuid.Parse(id); err != nil {
+			return audit.Filter{}, errors.BadRequestError("actor and target must be valid ids")
+		}
+	}
+
+	for param, dst := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return audit.Filter{}, errors.BadRequestError(param + " must be an RFC3339 timestamp")
+		}
+		*dst = &t
+	}
+
+	return filter, nil
+}
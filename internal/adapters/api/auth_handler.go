@@ -72,6 +72,28 @@ func (h *AuthHandler) LoginUser(w http.ResponseWriter, r *http.Request) {
 	resp.JSON(w, http.StatusOK, response)
 }
 
+func (h *AuthHandler) RestoreAccount(w http.ResponseWriter, r *http.Request) {
+	var request authDto.UserLoginRequest
+	if err := resp.DecodeAndValidate(r, &request); err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	tokens, err := h.authService.RestoreAccount(r.Context(), request.Email, request.Password)
+	if err != nil {
+		h.logger.Error("Failed to restore user account", "error", err, "email", request.Email)
+		resp.Error(w, err)
+		return
+	}
+
+	response := authDto.TokenResponse{
+		AccessToken:  tokens.AccessToken.RawToken,
+		RefreshToken: tokens.RefreshToken.RawToken,
+	}
+
+	resp.JSON(w, http.StatusOK, response)
+}
+
 func (h *AuthHandler) LoginAnonymousUser(w http.ResponseWriter, r *http.Request) {
 	var request authDto.AnonymousUserLoginRequest
 	if err := resp.DecodeAndValidate(r, &request); err != nil {
@@ -79,7 +101,7 @@ func (h *AuthHandler) LoginAnonymousUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	tokens, err := h.authService.LoginAnonymous(r.Context(), request.Email)
+	tokens, err := h.authService.LoginAnonymous(r.Context(), request.Email, request.DeviceSecret)
 	if err != nil {
 		h.logger.Error("Failed to login anonymous user", "error", err, "email", request.Email)
 		resp.Error(w, err)
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ouz/goboilerplate/internal/domain/audit"
+	"github.com/ouz/goboilerplate/pkg/cache"
+	"github.com/ouz/goboilerplate/pkg/errors"
+	"github.com/ouz/goboilerplate/pkg/log"
+	resp "github.com/ouz/goboilerplate/pkg/response"
+)
+
+type CacheHandler struct {
+	logger       *log.Logger
+	admin        *cache.Admin
+	auditService audit.AuditService
+}
+
+func NewCacheHandler(logger *log.Logger, admin *cache.Admin, auditService audit.AuditService) *CacheHandler {
+	return &CacheHandler{
+		logger:       logger,
+		admin:        admin,
+		auditService: auditService,
+	}
+}
+
+func (h *CacheHandler) Inspect(w http.ResponseWriter, r *http.Request) {
+	inspection, err := h.admin.Inspect(r.Context(), r.PathValue("prefix"), r.PathValue("key"))
+	if err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	resp.JSON(w, http.StatusOK, inspection)
+}
+
+func (h *CacheHandler) ListKeys(w http.ResponseWriter, r *http.Request) {
+	var count int64
+	if value := r.URL.Query().Get("count"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			resp.Error(w, errors.ValidationError("count must be a number", err))
+			return
+		}
+		count = parsed
+	}
+
+	page, err := h.admin.Keys(r.Context(), r.PathValue("prefix"), r.URL.Query().Get("cursor"), count)
+	if err != nil {
+		h.logger.Error("Failed to list cache keys", "error", err, "prefix", r.PathValue("prefix"))
+		resp.Error(w, err)
+		return
+	}
+
+	resp.JSON(w, http.StatusOK, page)
+}
+
+func (h *CacheHandler) Evict(w http.ResponseWriter, r *http.Request) {
+	err := h.admin.Evict(r.Context(), r.PathValue("prefix"), r.PathValue("key"))
+	h.auditService.Record(r.Context(), audit.Result(audit.ActionCacheEvict, err).WithSubject(r.PathValue("prefix")+":"+r.PathValue("key")))
+	if err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	h.logger.Info("Evicted cache entry", "prefix", r.PathValue("prefix"), "key", r.PathValue("key"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *CacheHandler) EvictPrefix(w http.ResponseWriter, r *http.Request) {
+	err := h.admin.EvictPrefix(r.Context(), r.PathValue("prefix"))
+	h.auditService.Record(r.Context(), audit.Result(audit.ActionCacheEvictPrefix, err).WithSubject(r.PathValue("prefix")+":*"))
+	if err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	h.logger.Info("Evicted cache prefix", "prefix", r.PathValue("prefix"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Stats reports the prefixes given as repeated prefix parameters, or the locally
+// cached prefixes when none is given
+func (h *CacheHandler) Stats(w http.ResponseWriter, r *http.Request) {
+	reports, err := h.admin.Stats(r.Context(), r.URL.Query()["prefix"]...)
+	if err != nil {
+		h.logger.Error("Failed to read cache stats", "error", err)
+		resp.Error(w, err)
+		return
+	}
+
+	resp.JSON(w, http.StatusOK, reports)
+}
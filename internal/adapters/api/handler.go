@@ -15,6 +15,7 @@ func SetUpAuthRoutes(mainRouter *http.ServeMux, authHandler *AuthHandler, userHa
 
 	// Public routes with client secret
 	authRouter.Handle("POST /login", clientSecretMiddleware(http.HandlerFunc(authHandler.LoginUser)))
+	authRouter.Handle("POST /restore", clientSecretMiddleware(http.HandlerFunc(authHandler.RestoreAccount)))
 	authRouter.Handle("POST /login/anonymous", clientSecretMiddleware(http.HandlerFunc(authHandler.LoginAnonymousUser)))
 	authRouter.Handle("POST /register", clientSecretMiddleware(http.HandlerFunc(userHandler.RegisterUser)))
 	authRouter.Handle("POST /register/anonymous", clientSecretMiddleware(http.HandlerFunc(userHandler.RegisterAnonymousUser)))
@@ -44,6 +45,57 @@ func SetUpUserRoutes(mainRouter *http.ServeMux, userHandler *UserHandler, userAu
 		middleware.HasRoles(user.UserRoleUser, user.UserRoleAnonymous),
 	)
 	userRouter.Handle("GET /me", protected(http.HandlerFunc(userHandler.GetUser)))
+	userRouter.Handle("DELETE /me", protected(http.HandlerFunc(userHandler.DeleteAccount)))
+	userRouter.Handle("GET /me/export", protected(http.HandlerFunc(userHandler.ExportData)))
+	userRouter.Handle("GET /me/export/status", protected(http.HandlerFunc(userHandler.GetDataExport)))
+
+	protectedUser := middleware.Chain(
+		middleware.HasClientSecret(userAuthService),
+		middleware.Protected(userAuthService),
+		middleware.HasRoles(user.UserRoleUser),
+	)
+	userRouter.Handle("PATCH /me", protectedUser(http.HandlerFunc(userHandler.UpdateProfile)))
+	userRouter.Handle("POST /me/email", protectedUser(http.HandlerFunc(userHandler.RequestEmailChange)))
+
+	protectedAnonymous := middleware.Chain(
+		middleware.HasClientSecret(userAuthService),
+		middleware.Protected(userAuthService),
+		middleware.HasRoles(user.UserRoleAnonymous),
+	)
+	userRouter.Handle("POST /me/upgrade", protectedAnonymous(http.HandlerFunc(userHandler.UpgradeAnonymousUser)))
 
 	mainRouter.Handle("/users/", http.StripPrefix("/users", userRouter)) // Prefix all user routes with /user
 }
+
+func SetUpAdminRoutes(mainRouter *http.ServeMux, adminHandler *AdminHandler, webhookHandler *WebhookHandler, cacheHandler *CacheHandler, userAuthService auth.AuthService) {
+	adminRouter := http.NewServeMux()
+
+	protectedAdmin := middleware.Chain(
+		middleware.HasClientSecret(userAuthService),
+		middleware.Protected(userAuthService),
+		middleware.HasRoles(user.UserRoleAdmin),
+	)
+	adminRouter.Handle("GET /audit-events", protectedAdmin(http.HandlerFunc(adminHandler.ListAuditEvents)))
+	adminRouter.Handle("GET /users", protectedAdmin(http.HandlerFunc(adminHandler.ListUsers)))
+	adminRouter.Handle("GET /users/{id}", protectedAdmin(http.HandlerFunc(adminHandler.GetUser)))
+	adminRouter.Handle("POST /users/{id}/enable", protectedAdmin(http.HandlerFunc(adminHandler.EnableUser)))
+	adminRouter.Handle("POST /users/{id}/disable", protectedAdmin(http.HandlerFunc(adminHandler.DisableUser)))
+	adminRouter.Handle("POST /users/{id}/verify", protectedAdmin(http.HandlerFunc(adminHandler.VerifyUser)))
+	adminRouter.Handle("POST /users/{id}/logout", protectedAdmin(http.HandlerFunc(adminHandler.LogoutUser)))
+	adminRouter.Handle("DELETE /users/{id}", protectedAdmin(http.HandlerFunc(adminHandler.DeleteUser)))
+
+	adminRouter.Handle("POST /clients/{clientType}/webhooks", protectedAdmin(http.HandlerFunc(webhookHandler.CreateSubscription)))
+	adminRouter.Handle("GET /clients/{clientType}/webhooks", protectedAdmin(http.HandlerFunc(webhookHandler.ListSubscriptions)))
+	adminRouter.Handle("DELETE /clients/{clientType}/webhooks/{id}", protectedAdmin(http.HandlerFunc(webhookHandler.DeleteSubscription)))
+	adminRouter.Handle("GET /clients/{clientType}/webhook-deliveries", protectedAdmin(http.HandlerFunc(webhookHandler.ListDeliveries)))
+	adminRouter.Handle("GET /clients/{clientType}/webhook-deliveries/{id}", protectedAdmin(http.HandlerFunc(webhookHandler.GetDelivery)))
+	adminRouter.Handle("POST /clients/{clientType}/webhook-deliveries/{id}/retry", protectedAdmin(http.HandlerFunc(webhookHandler.RetryDelivery)))
+
+	adminRouter.Handle("GET /cache/stats", protectedAdmin(http.HandlerFunc(cacheHandler.Stats)))
+	adminRouter.Handle("GET /cache/{prefix}/keys", protectedAdmin(http.HandlerFunc(cacheHandler.ListKeys)))
+	adminRouter.Handle("GET /cache/{prefix}/keys/{key}", protectedAdmin(http.HandlerFunc(cacheHandler.Inspect)))
+	adminRouter.Handle("DELETE /cache/{prefix}/keys/{key}", protectedAdmin(http.HandlerFunc(cacheHandler.Evict)))
+	adminRouter.Handle("DELETE /cache/{prefix}", protectedAdmin(http.HandlerFunc(cacheHandler.EvictPrefix)))
+
+	mainRouter.Handle("/admin/", http.StripPrefix("/admin", adminRouter))
+}
@@ -2,12 +2,13 @@ package middleware
 
 import (
 	"net/http"
+	"net/netip"
 	"time"
 
 	"github.com/ouz/goboilerplate/pkg/log"
 )
 
-func Logging(logger *log.Logger) Middleware {
+func Logging(logger *log.Logger, trustedProxies []netip.Prefix) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
@@ -16,7 +17,7 @@ func Logging(logger *log.Logger) Middleware {
 			next.ServeHTTP(wrapper, r)
 			duration := time.Since(start)
 
-			realIP := getRealIP(r)
+			realIP := requestIP(r, trustedProxies)
 
 			entry := logger.With(
 				"method", r.Method,
@@ -59,20 +60,3 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	rw.written += int64(n)
 	return n, err
 }
-
-func getRealIP(r *http.Request) string {
-	if ip := r.Header.Get("X-Real-IP"); ip != "" {
-		return ip
-	}
-
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		for i := 0; i < len(xff); i++ {
-			if xff[i] == ',' {
-				return xff[:i]
-			}
-		}
-		return xff
-	}
-
-	return r.RemoteAddr
-}
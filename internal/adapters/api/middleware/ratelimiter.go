@@ -2,8 +2,8 @@ package middleware
 
 import (
 	"context"
-	"net"
 	"net/http"
+	"net/netip"
 	"sync"
 	"time"
 
@@ -20,8 +20,11 @@ type RateLimiter interface {
 	Allow(key string) bool
 	AllowWithContext(ctx context.Context, key string) bool
 	Cleanup()
+	Stop()
 }
 
+// TokenBucket keeps buckets in process memory, every instance limits on its own.
+// It suits tests and single-node setups, RedisRateLimiter shares buckets
 type TokenBucket struct {
 	rate       float64
 	bucketSize float64
@@ -122,16 +125,17 @@ func min(a, b float64) float64 {
 	return b
 }
 
-func RateLimitMiddleware(limiter RateLimiter) Middleware {
+// RateLimitMiddleware limits each client IP, see ClientIP for how it is resolved
+func RateLimitMiddleware(limiter RateLimiter, trustedProxies []netip.Prefix) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ip, _, err := net.SplitHostPort(r.RemoteAddr)
+			ip, err := ClientIP(r, trustedProxies)
 			if err != nil {
 				resp.Error(w, errors.InternalError("Failed to parse remote address", err))
 				return
 			}
 
-			if !limiter.AllowWithContext(r.Context(), ip) {
+			if !limiter.AllowWithContext(r.Context(), ip.String()) {
 				resp.Error(w, errors.NewAppError(
 					errors.ErrCodeTooManyRequests,
 					"RATE_LIMIT_EXCEEDED",
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/ouz/goboilerplate/pkg/log"
+	"github.com/redis/go-redis/v9"
+)
+
+const rateLimitKeyPrefix = "ratelimit:"
+
+// gcraScript is a token bucket in GCRA form: the key holds the theoretical arrival
+// time of the next request in microseconds, and a request is allowed while that
+// time is less than a full bucket ahead of now. The clock is the one of Valkey, so
+// replicas with skewed clocks share one bucket
+var gcraScript = redis.NewScript(`
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+local interval = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+
+local tat = now
+local stored = redis.call('GET', KEYS[1])
+if stored then
+	tat = math.max(tonumber(stored), now)
+end
+
+local new_tat = tat + interval
+if new_tat - capacity > now then
+	return 0
+end
+redis.call('SET', KEYS[1], string.format('%d', new_tat), 'PX', math.ceil((new_tat - now) / 1000))
+return 1
+`)
+
+type RedisRateLimiterOptions struct {
+	// Rate is the number of requests per second a key is allowed on average
+	Rate float64
+	// BucketSize is the number of requests a key may burst
+	BucketSize float64
+	// Timeout bounds every call to Valkey
+	Timeout time.Duration
+	// Fallback decides while Valkey is unavailable, so limits are enforced per
+	// instance instead of not at all. Without it requests are allowed
+	Fallback RateLimiter
+}
+
+// RedisRateLimiter keeps one bucket per key in Valkey, so every instance draws
+// from the same bucket. Buckets expire once they are full again
+type RedisRateLimiter struct {
+	client   redis.UniversalClient
+	interval int64
+	capacity int64
+	options  RedisRateLimiterOptions
+	degraded atomic.Bool
+	logger   *log.Logger
+}
+
+func NewRedisRateLimiter(logger *log.Logger, client redis.UniversalClient, options RedisRateLimiterOptions) *RedisRateLimiter {
+	interval := int64(math.Round(float64(time.Second/time.Microsecond) / options.Rate))
+	return &RedisRateLimiter{
+		client:   client,
+		interval: interval,
+		capacity: int64(math.Round(float64(interval) * options.BucketSize)),
+		options:  options,
+		logger:   logger,
+	}
+}
+
+func (rl *RedisRateLimiter) Allow(key string) bool {
+	return rl.AllowWithContext(context.Background(), key)
+}
+
+func (rl *RedisRateLimiter) AllowWithContext(ctx context.Context, key string) bool {
+	callCtx, cancel := context.WithTimeout(ctx, rl.options.Timeout)
+	defer cancel()
+
+	allowed, err := gcraScript.Run(callCtx, rl.client, []string{rateLimitKeyPrefix + key}, rl.interval, rl.capacity).Int64()
+	if err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+		// Log only the transitions, not every request while Valkey is down
+		if !rl.degraded.Swap(true) {
+			rl.logger.Warn("Rate limiter cannot reach Valkey, falling back", "per_instance", rl.options.Fallback != nil, "error", err)
+		}
+		if rl.options.Fallback == nil {
+			return true
+		}
+		return rl.options.Fallback.AllowWithContext(ctx, key)
+	}
+
+	if rl.degraded.Swap(false) {
+		rl.logger.Info("Rate limiter reaches Valkey again")
+	}
+	return allowed == 1
+}
+
+// Cleanup cleans up the fallback, Valkey expires full buckets itself
+func (rl *RedisRateLimiter) Cleanup() {
+	if rl.options.Fallback != nil {
+		rl.options.Fallback.Cleanup()
+	}
+}
+
+func (rl *RedisRateLimiter) Stop() {
+	if rl.options.Fallback != nil {
+		rl.options.Fallback.Stop()
+	}
+}
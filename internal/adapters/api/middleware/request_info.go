@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/ouz/goboilerplate/internal/adapters/api/util"
+)
+
+// RequestInfo stores the client IP and user agent for the audit log, the IP is
+// resolved like the rate limiter does, see ClientIP
+func RequestInfo(trustedProxies []netip.Prefix) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			info := util.RequestInfo{
+				IP:        requestIP(r, trustedProxies),
+				UserAgent: r.UserAgent(),
+			}
+			ctx := context.WithValue(r.Context(), util.RequestInfoKey, info)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// requestIP is the client IP of r, or its remote address when that is not an IP
+func requestIP(r *http.Request, trustedProxies []netip.Prefix) string {
+	ip, err := ClientIP(r, trustedProxies)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip.String()
+}
+
+// ClientIP is the peer address of r unless the peer is a trusted proxy. Then it is
+// the right-most X-Forwarded-For hop that is not a trusted proxy, or X-Real-IP
+// without X-Forwarded-For. Headers from any other peer are ignored as they are
+// set by the client
+func ClientIP(r *http.Request, trustedProxies []netip.Prefix) (netip.Addr, error) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	peer, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	peer = peer.Unmap()
+	if !isTrustedProxy(peer, trustedProxies) {
+		return peer, nil
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				// Anything left of a malformed hop may be made up by the client
+				return peer, nil
+			}
+			if hop = hop.Unmap(); !isTrustedProxy(hop, trustedProxies) {
+				return hop, nil
+			}
+		}
+		return peer, nil
+	}
+
+	if realIP, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return realIP.Unmap(), nil
+	}
+	return peer, nil
+}
+
+func isTrustedProxy(addr netip.Addr, trustedProxies []netip.Prefix) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
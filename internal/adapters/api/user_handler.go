@@ -1,6 +1,7 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/ouz/goboilerplate/internal/adapters/api/util"
@@ -8,6 +9,7 @@ import (
 	userDto "github.com/ouz/goboilerplate/internal/application/user/dto"
 	"github.com/ouz/goboilerplate/internal/domain/user"
 	"github.com/ouz/goboilerplate/pkg/log"
+	"github.com/ouz/goboilerplate/pkg/policy"
 	resp "github.com/ouz/goboilerplate/pkg/response"
 )
 
@@ -17,14 +19,18 @@ const (
 )
 
 type UserHandler struct {
-	logger      *log.Logger
-	userService user.UserService
+	logger            *log.Logger
+	userService       user.UserService
+	dataExportService user.DataExportService
+	authorizer        policy.Authorizer
 }
 
-func NewUserHandler(logger *log.Logger, userService user.UserService) *UserHandler {
+func NewUserHandler(logger *log.Logger, userService user.UserService, dataExportService user.DataExportService, authorizer policy.Authorizer) *UserHandler {
 	return &UserHandler{
-		logger:      logger,
-		userService: userService,
+		logger:            logger,
+		userService:       userService,
+		dataExportService: dataExportService,
+		authorizer:        authorizer,
 	}
 }
 
@@ -45,7 +51,7 @@ func (h *UserHandler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *UserHandler) RegisterAnonymousUser(w http.ResponseWriter, r *http.Request) {
-	user, err := h.userService.RegisterAnonymousUser(r.Context())
+	user, deviceSecret, err := h.userService.RegisterAnonymousUser(r.Context())
 	if err != nil {
 		h.logger.Error("Failed to register anonymous user", "error", err)
 		resp.Error(w, err)
@@ -53,7 +59,8 @@ func (h *UserHandler) RegisterAnonymousUser(w http.ResponseWriter, r *http.Reque
 	}
 
 	response := authDto.AnonymousUserResponse{
-		Email: user.Email,
+		Email:        user.Email,
+		DeviceSecret: deviceSecret,
 	}
 
 	resp.JSON(w, http.StatusCreated, response)
@@ -82,11 +89,172 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp.JSON(w, http.StatusOK, userDto.UserResponse{
-		ID:        user.ID,
-		Email:     user.Email,
-		Anonymous: user.Anonymous,
+	if err := util.Authorize(r, h.authorizer, "read", userPolicyResource(user.ID)); err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	resp.JSON(w, http.StatusOK, newUserResponse(user))
+}
+
+func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	authUser, err := util.GetAuthenticatedUser(r)
+	if err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	if err := util.Authorize(r, h.authorizer, "update", userPolicyResource(authUser.ID)); err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	var request userDto.UpdateProfileRequest
+	if err := resp.DecodeAndValidate(r, &request); err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	updated, err := h.userService.UpdateProfile(r.Context(), authUser.ID, user.ProfileUpdate{
+		Username:    request.Username,
+		DisplayName: request.DisplayName,
+		Locale:      request.Locale,
+		TimeZone:    request.TimeZone,
 	})
+	if err != nil {
+		h.logger.Error("Failed to update user profile", "error", err, "userID", authUser.ID)
+		resp.Error(w, err)
+		return
+	}
+
+	resp.JSON(w, http.StatusOK, newUserResponse(*updated))
+}
+
+func (h *UserHandler) RequestEmailChange(w http.ResponseWriter, r *http.Request) {
+	authUser, err := util.GetAuthenticatedUser(r)
+	if err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	var request userDto.ChangeEmailRequest
+	if err := resp.DecodeAndValidate(r, &request); err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	if err := h.userService.RequestEmailChange(r.Context(), authUser.ID, request.Email); err != nil {
+		h.logger.Error("Failed to request email change", "error", err, "userID", authUser.ID)
+		resp.Error(w, err)
+		return
+	}
+
+	resp.JSON(w, http.StatusAccepted, nil)
+}
+
+func (h *UserHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	authUser, err := util.GetAuthenticatedUser(r)
+	if err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	if err := h.userService.DeleteAccount(r.Context(), authUser.ID); err != nil {
+		h.logger.Error("Failed to delete user account", "error", err, "userID", authUser.ID)
+		resp.Error(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ExportData serves the latest completed export. Until it is ready the export is
+// started or its status returned with 202, poll GetDataExport and call again
+func (h *UserHandler) ExportData(w http.ResponseWriter, r *http.Request) {
+	authUser, err := util.GetAuthenticatedUser(r)
+	if err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	job, archive, err := h.dataExportService.Export(r.Context(), authUser.ID)
+	if err != nil {
+		h.logger.Error("Failed to export data", "error", err, "userID", authUser.ID)
+		resp.Error(w, err)
+		return
+	}
+
+	if archive == nil {
+		resp.JSON(w, http.StatusAccepted, newDataExportResponse(job))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="data-export-%s.json"`, job.ID))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(archive); err != nil {
+		h.logger.Error("Failed to write data export", "error", err, "userID", authUser.ID)
+	}
+}
+
+func (h *UserHandler) GetDataExport(w http.ResponseWriter, r *http.Request) {
+	authUser, err := util.GetAuthenticatedUser(r)
+	if err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	job, err := h.dataExportService.GetLatestExport(r.Context(), authUser.ID)
+	if err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	resp.JSON(w, http.StatusOK, newDataExportResponse(job))
+}
+
+func newDataExportResponse(job *user.DataExportJob) userDto.DataExportResponse {
+	return userDto.DataExportResponse{
+		ID:          job.ID,
+		Status:      string(job.Status),
+		RequestedAt: job.RequestedAt,
+		CompletedAt: job.CompletedAt,
+		Error:       job.Error,
+	}
+}
+
+func newUserResponse(u user.User) userDto.UserResponse {
+	return userDto.UserResponse{
+		ID:          u.ID,
+		Email:       u.Email,
+		Username:    u.Username,
+		DisplayName: u.DisplayName,
+		Locale:      u.Locale,
+		TimeZone:    u.TimeZone,
+		Anonymous:   u.Anonymous,
+	}
+}
+
+func (h *UserHandler) UpgradeAnonymousUser(w http.ResponseWriter, r *http.Request) {
+	user, err := util.GetAuthenticatedUser(r)
+	if err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	var request authDto.UpgradeAnonymousUserRequest
+	if err := resp.DecodeAndValidate(r, &request); err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	if err := h.userService.UpgradeAnonymousUser(r.Context(), user.ID, request); err != nil {
+		h.logger.Error("Failed to upgrade anonymous user", "error", err, "userID", user.ID)
+		resp.Error(w, err)
+		return
+	}
+
+	resp.JSON(w, http.StatusOK, nil)
 }
 
 func returnNotFound(w http.ResponseWriter, r *http.Request) {
@@ -7,6 +7,7 @@ import (
 	"github.com/ouz/goboilerplate/internal/domain/auth"
 	"github.com/ouz/goboilerplate/internal/domain/user"
 	"github.com/ouz/goboilerplate/pkg/errors"
+	"github.com/ouz/goboilerplate/pkg/policy"
 )
 
 type ContextKey string
@@ -14,6 +15,13 @@ type ContextKey string
 const AuthenticatedUserKey ContextKey = "auth_user"
 const ClientHeader string = "x-client-key"
 const ClientKey ContextKey = "client"
+const RequestInfoKey ContextKey = "request_info"
+
+// RequestInfo describes where a request came from, it is attached to audit events
+type RequestInfo struct {
+	IP        string
+	UserAgent string
+}
 
 func GetClient(ctx context.Context) (auth.Client, error) {
 	rawClient := ctx.Value(ClientKey)
@@ -27,6 +35,11 @@ func GetClient(ctx context.Context) (auth.Client, error) {
 	return client, nil
 }
 
+func GetRequestInfo(ctx context.Context) RequestInfo {
+	info, _ := ctx.Value(RequestInfoKey).(RequestInfo)
+	return info
+}
+
 func ExtractClientSecret(r *http.Request) string {
 	return r.Header.Get(ClientHeader)
 }
@@ -42,3 +55,35 @@ func GetAuthenticatedUser(r *http.Request) (user.User, error) {
 	}
 	return u, nil
 }
+
+// AuthenticatedUserID returns the id of the user making the request, or an empty
+// string for unauthenticated requests
+func AuthenticatedUserID(ctx context.Context) string {
+	if u, ok := ctx.Value(AuthenticatedUserKey).(user.User); ok {
+		return u.ID
+	}
+	return ""
+}
+
+func Authorize(r *http.Request, authorizer policy.Authorizer, action string, resource policy.Resource) error {
+	u, err := GetAuthenticatedUser(r)
+	if err != nil {
+		return err
+	}
+
+	roles := make([]string, 0, len(u.Roles))
+	for _, role := range u.Roles {
+		roles = append(roles, string(role.Name))
+	}
+
+	decision := authorizer.Authorize(r.Context(), policy.Request{
+		Subject:  policy.Subject{ID: u.ID, Roles: roles},
+		Action:   action,
+		Resource: resource,
+	})
+	if !decision.Allowed {
+		return errors.ForbiddenError("Insufficient permissions", nil)
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ouz/goboilerplate/internal/adapters/repo/postgres"
+	webhookDto "github.com/ouz/goboilerplate/internal/application/webhook/dto"
+	"github.com/ouz/goboilerplate/internal/domain/shared"
+	"github.com/ouz/goboilerplate/internal/domain/webhook"
+	"github.com/ouz/goboilerplate/pkg/auth"
+	"github.com/ouz/goboilerplate/pkg/log"
+	resp "github.com/ouz/goboilerplate/pkg/response"
+)
+
+type WebhookHandler struct {
+	logger         *log.Logger
+	webhookService webhook.WebhookService
+}
+
+func NewWebhookHandler(logger *log.Logger, webhookService webhook.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		logger:         logger,
+		webhookService: webhookService,
+	}
+}
+
+func clientTypeFromPath(r *http.Request) auth.ClientType {
+	return auth.ClientType(r.PathValue("clientType"))
+}
+
+func (h *WebhookHandler) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	var request webhookDto.CreateSubscriptionRequest
+	if err := resp.DecodeAndValidate(r, &request); err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	subscription, err := h.webhookService.CreateSubscription(r.Context(), clientTypeFromPath(r), request.URL, request.EventTypes)
+	if err != nil {
+		h.logger.Error("Failed to create webhook subscription", "error", err)
+		resp.Error(w, err)
+		return
+	}
+
+	resp.JSON(w, http.StatusCreated, webhookDto.CreateSubscriptionResponse{
+		SubscriptionResponse: webhookDto.NewSubscriptionResponse(*subscription),
+		Secret:               subscription.Secret,
+	})
+}
+
+func (h *WebhookHandler) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subscriptions, err := h.webhookService.ListSubscriptions(r.Context(), clientTypeFromPath(r))
+	if err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	response := make([]webhookDto.SubscriptionResponse, 0, len(subscriptions))
+	for _, s := range subscriptions {
+		response = append(response, webhookDto.NewSubscriptionResponse(s))
+	}
+
+	resp.JSON(w, http.StatusOK, response)
+}
+
+func (h *WebhookHandler) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	if err := h.webhookService.DeleteSubscription(r.Context(), clientTypeFromPath(r), r.PathValue("id")); err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	pagination, err := postgres.CreatePagination[webhook.Delivery](r)
+	if err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	filter := webhook.DeliveryFilter{
+		ClientType:     clientTypeFromPath(r),
+		SubscriptionID: r.URL.Query().Get("subscription"),
+		Status:         webhook.DeliveryStatus(strings.ToUpper(r.URL.Query().Get("status"))),
+	}
+
+	if err := h.webhookService.ListDeliveries(r.Context(), filter, pagination); err != nil {
+		h.logger.Error("Failed to list webhook deliveries", "error", err)
+		resp.Error(w, err)
+		return
+	}
+
+	deliveries := make([]webhookDto.DeliveryResponse, 0, len(pagination.Data))
+	for _, d := range pagination.Data {
+		deliveries = append(deliveries, webhookDto.NewDeliveryResponse(d))
+	}
+
+	resp.JSON(w, http.StatusOK, shared.PaginationResponse{
+		Page:       pagination.GetPage(),
+		Limit:      pagination.GetLimit(),
+		TotalRows:  pagination.TotalRows,
+		TotalPages: pagination.TotalPages,
+		Data:       deliveries,
+	})
+}
+
+func (h *WebhookHandler) GetDelivery(w http.ResponseWriter, r *http.Request) {
+	delivery, attempts, err := h.webhookService.GetDelivery(r.Context(), clientTypeFromPath(r), r.PathValue("id"))
+	if err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	resp.JSON(w, http.StatusOK, webhookDto.NewDeliveryDetailResponse(*delivery, attempts))
+}
+
+func (h *WebhookHandler) RetryDelivery(w http.ResponseWriter, r *http.Request) {
+	if err := h.webhookService.RetryDelivery(r.Context(), clientTypeFromPath(r), r.PathValue("id")); err != nil {
+		resp.Error(w, err)
+		return
+	}
+
+	resp.JSON(w, http.StatusAccepted, nil)
+}
@@ -0,0 +1,92 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"net/smtp"
+	"net/url"
+
+	"github.com/ouz/goboilerplate/internal/config"
+	"github.com/ouz/goboilerplate/internal/domain/user"
+	"github.com/ouz/goboilerplate/pkg/errors"
+)
+
+const (
+	emailConfirmationTemplatePath = "internal/adapters/api/template/email_confirmation.html"
+	emailConfirmationSubject      = "Verify your email address"
+	emailConfirmationPath         = "/users/email/confirm"
+)
+
+type smtpConfirmationSender struct {
+	conf     config.MailConfig
+	baseURL  string
+	template *template.Template
+}
+
+type noopConfirmationSender struct{}
+
+// NewNoopConfirmationSender drops confirmations, it is used while mail is disabled
+func NewNoopConfirmationSender() user.ConfirmationSender {
+	return noopConfirmationSender{}
+}
+
+func (noopConfirmationSender) SendConfirmation(context.Context, string, string) error {
+	return nil
+}
+
+func NewSMTPConfirmationSender(conf config.MailConfig, appConf config.AppConfig) (user.ConfirmationSender, error) {
+	tmpl, err := template.ParseFiles(emailConfirmationTemplatePath)
+	if err != nil {
+		return nil, errors.TemplateNotFoundError("Failed to load email confirmation template", err)
+	}
+
+	return &smtpConfirmationSender{
+		conf:     conf,
+		baseURL:  appConf.BaseURL + appConf.V1Prefix,
+		template: tmpl,
+	}, nil
+}
+
+func (s *smtpConfirmationSender) SendConfirmation(ctx context.Context, email, confirmationID string) error {
+	var body bytes.Buffer
+	err := s.template.Execute(&body, struct{ VerificationLink string }{
+		VerificationLink: fmt.Sprintf("%s%s?key=%s", s.baseURL, emailConfirmationPath, url.QueryEscape(confirmationID)),
+	})
+	if err != nil {
+		return errors.TemplateRenderError("Failed to render email confirmation template", err)
+	}
+
+	return s.send(ctx, email, emailConfirmationSubject, body.Bytes())
+}
+
+func (s *smtpConfirmationSender) send(ctx context.Context, to, subject string, htmlBody []byte) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.conf.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=\"UTF-8\"\r\n\r\n")
+	msg.Write(htmlBody)
+
+	addr := fmt.Sprintf("%s:%d", s.conf.Host, s.conf.Port)
+	auth := smtp.PlainAuth("", s.conf.Username, s.conf.Password, s.conf.Host)
+
+	// net/smtp has no context support, so the send runs in the background and
+	// the caller is released when its context is done
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, s.conf.From, []string{to}, msg.Bytes())
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return errors.ExternalServiceError("Failed to send email", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return errors.ExternalServiceTimeoutError("Sending email timed out", ctx.Err())
+	}
+}
@@ -0,0 +1,87 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/ouz/goboilerplate/internal/adapters/repo/postgres"
+	"github.com/ouz/goboilerplate/internal/domain/audit"
+	"github.com/ouz/goboilerplate/internal/domain/shared"
+	"github.com/ouz/goboilerplate/pkg/errors"
+	"gorm.io/gorm"
+)
+
+type auditRepository struct {
+	postgres.BaseRepository
+}
+
+func NewAuditRepository(db *gorm.DB) audit.AuditRepository {
+	return &auditRepository{BaseRepository: postgres.BaseRepository{
+		DB: db,
+	}}
+}
+
+func (r *auditRepository) Create(ctx context.Context, event *audit.Event) error {
+	if err := r.GetDB(ctx).Create(event).Error; err != nil {
+		return errors.DatabaseError("Failed to create audit event", err)
+	}
+	return nil
+}
+
+func (r *auditRepository) FindAll(ctx context.Context, filter audit.Filter, pagination *shared.Pagination[audit.Event]) error {
+	query := r.GetDB(ctx).Model(&audit.Event{})
+	if filter.ActorID != "" {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.Subject != "" {
+		query = query.Where("subject = ?", filter.Subject)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.Outcome != "" {
+		query = query.Where("outcome = ?", filter.Outcome)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+
+	var events []audit.Event
+	err := query.Scopes(postgres.Paginate(&audit.Event{}, pagination, query.Session(&gorm.Session{}))).
+		Order("created_at DESC").
+		Find(&events).Error
+	if err != nil {
+		return errors.InternalError("Failed to fetch audit events", err)
+	}
+
+	pagination.Data = events
+	return nil
+}
+
+func (r *auditRepository) FindByUser(ctx context.Context, userID string) ([]audit.Event, error) {
+	var events []audit.Event
+	err := r.GetDB(ctx).
+		Where("actor_id = ? OR target_id = ?", userID, userID).
+		Order("created_at").
+		Find(&events).Error
+	if err != nil {
+		return nil, errors.InternalError("Failed to fetch audit events", err)
+	}
+	return events, nil
+}
+
+func (r *auditRepository) DeleteBefore(ctx context.Context, before time.Time, limit int) (int64, error) {
+	result := r.GetDB(ctx).
+		Where("id IN (?)", r.GetDB(ctx).Model(&audit.Event{}).Select("id").Where("created_at < ?", before).Limit(limit)).
+		Delete(&audit.Event{})
+	if result.Error != nil {
+		return 0, errors.DatabaseError("Failed to delete expired audit events", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/ouz/goboilerplate/internal/adapters/repo/postgres"
 	"github.com/ouz/goboilerplate/internal/domain/auth"
+	sharedAuth "github.com/ouz/goboilerplate/pkg/auth"
 	"github.com/ouz/goboilerplate/pkg/errors"
 	"gorm.io/gorm"
 )
@@ -29,3 +30,14 @@ func (r *authRepository) FindClientBySecret(ctx context.Context, secret string)
 	}
 	return &client, nil
 }
+
+func (r *authRepository) FindClientByType(ctx context.Context, clientType sharedAuth.ClientType) (*auth.Client, error) {
+	var client auth.Client
+	if err := r.GetDB(ctx).Where("client_type = ?", clientType).First(&client).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NotFoundError("Client not found", err)
+		}
+		return nil, errors.InternalError("Failed to find client", err)
+	}
+	return &client, nil
+}
@@ -0,0 +1,129 @@
+package event
+
+import (
+	"context"
+	"time"
+
+	"github.com/ouz/goboilerplate/internal/adapters/repo/postgres"
+	"github.com/ouz/goboilerplate/internal/domain/event"
+	"github.com/ouz/goboilerplate/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type outboxRepository struct {
+	postgres.BaseRepository
+}
+
+func NewOutboxRepository(db *gorm.DB) event.OutboxRepository {
+	return &outboxRepository{BaseRepository: postgres.BaseRepository{
+		DB: db,
+	}}
+}
+
+func (r *outboxRepository) Create(ctx context.Context, message *event.OutboxMessage) error {
+	if err := r.GetDB(ctx).Create(message).Error; err != nil {
+		return errors.DatabaseError("Failed to create outbox message", err)
+	}
+	return nil
+}
+
+func (r *outboxRepository) ClaimUnpublished(ctx context.Context, now, leaseUntil time.Time, limit int) ([]event.OutboxMessage, error) {
+	db := r.GetDB(ctx)
+
+	var messages []event.OutboxMessage
+	err := db.
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("published_at IS NULL AND parked_at IS NULL").
+		Where("claimed_until IS NULL OR claimed_until <= ?", now).
+		Order("created_at").
+		Limit(limit).
+		Find(&messages).Error
+	if err != nil {
+		return nil, errors.DatabaseError("Failed to fetch outbox messages", err)
+	}
+
+	if len(messages) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+
+	if err := db.Model(&event.OutboxMessage{}).Where("id IN ?", ids).Update("claimed_until", leaseUntil).Error; err != nil {
+		return nil, errors.DatabaseError("Failed to lease outbox messages", err)
+	}
+	return messages, nil
+}
+
+func (r *outboxRepository) MarkPublished(ctx context.Context, ids []string, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	err := r.GetDB(ctx).Model(&event.OutboxMessage{}).
+		Where("id IN ?", ids).
+		Updates(map[string]any{
+			"published_at":  at,
+			"claimed_until": nil,
+		}).Error
+	if err != nil {
+		return errors.DatabaseError("Failed to mark outbox messages as published", err)
+	}
+	return nil
+}
+
+func (r *outboxRepository) MarkFailed(ctx context.Context, id string, reason string) error {
+	err := r.GetDB(ctx).Model(&event.OutboxMessage{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"attempts":      gorm.Expr("attempts + 1"),
+			"last_error":    reason,
+			"claimed_until": nil,
+		}).Error
+	if err != nil {
+		return errors.DatabaseError("Failed to mark outbox message as failed", err)
+	}
+	return nil
+}
+
+func (r *outboxRepository) Park(ctx context.Context, id string, reason string, at time.Time) error {
+	err := r.GetDB(ctx).Model(&event.OutboxMessage{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"attempts":      gorm.Expr("attempts + 1"),
+			"last_error":    reason,
+			"parked_at":     at,
+			"claimed_until": nil,
+		}).Error
+	if err != nil {
+		return errors.DatabaseError("Failed to park outbox message", err)
+	}
+	return nil
+}
+
+func (r *outboxRepository) Release(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	err := r.GetDB(ctx).Model(&event.OutboxMessage{}).
+		Where("id IN ? AND published_at IS NULL", ids).
+		Update("claimed_until", nil).Error
+	if err != nil {
+		return errors.DatabaseError("Failed to release outbox messages", err)
+	}
+	return nil
+}
+
+func (r *outboxRepository) DeletePublishedBefore(ctx context.Context, before time.Time, limit int) (int64, error) {
+	result := r.GetDB(ctx).
+		Where("id IN (?)", r.GetDB(ctx).Model(&event.OutboxMessage{}).Select("id").Where("published_at < ?", before).Limit(limit)).
+		Delete(&event.OutboxMessage{})
+	if result.Error != nil {
+		return 0, errors.DatabaseError("Failed to delete published outbox messages", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -2,11 +2,14 @@ package user
 
 import (
 	"context"
+	"time"
 
 	"github.com/ouz/goboilerplate/internal/adapters/repo/postgres"
+	"github.com/ouz/goboilerplate/internal/domain/shared"
 	"github.com/ouz/goboilerplate/internal/domain/user"
 	"github.com/ouz/goboilerplate/pkg/errors"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type userRepository struct {
@@ -31,9 +34,10 @@ func (r *userRepository) FindByEmail(ctx context.Context, email string) (*user.U
 	return &user, nil
 }
 
+// FindNotVerifiedUser also finds soft deleted users, their email stays unique until they are purged
 func (r *userRepository) FindNotVerifiedUser(ctx context.Context, email string) (*user.User, error) {
 	var user user.User
-	err := r.GetDB(ctx).Preload("Credentials").Where("email = ?", email).First(&user).Error
+	err := r.GetDB(ctx).Unscoped().Preload("Credentials").Where("email = ?", email).First(&user).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil
@@ -106,3 +110,257 @@ func (r *userRepository) CreateUserConfirmation(ctx context.Context, userConfirm
 	}
 	return nil
 }
+
+func (r *userRepository) FindAll(ctx context.Context, search string, pagination *shared.Pagination[user.User]) error {
+	query := r.GetDB(ctx).Model(&user.User{})
+	if search != "" {
+		pattern := "%" + search + "%"
+		query = query.Where("email ILIKE ? OR username ILIKE ?", pattern, pattern)
+	}
+
+	var users []user.User
+	err := query.Scopes(postgres.Paginate(&user.User{}, pagination, query.Session(&gorm.Session{}))).
+		Preload("Roles").
+		Order("created_at DESC").
+		Find(&users).Error
+	if err != nil {
+		return errors.InternalError("Failed to fetch users", err)
+	}
+
+	pagination.Data = users
+	return nil
+}
+
+func (r *userRepository) FindByIdWithDetails(ctx context.Context, id string) (*user.User, error) {
+	var user user.User
+	err := r.GetDB(ctx).Preload("Roles").Preload("Credentials").Where("id = ?", id).First(&user).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NotFoundError("User not found", err)
+		}
+		return nil, errors.InternalError("Failed to fetch user by ID", err)
+	}
+	return &user, nil
+}
+
+func (r *userRepository) UpdateStatus(ctx context.Context, user *user.User) error {
+	if err := r.GetDB(ctx).Model(user).Select("enabled", "verified", "updated_at").Updates(user).Error; err != nil {
+		return errors.InternalError("Failed to update user status", err)
+	}
+	return nil
+}
+
+func (r *userRepository) UpdateAccount(ctx context.Context, user *user.User) error {
+	err := r.GetDB(ctx).Model(user).
+		Select("username", "email", "anonymous", "enabled", "verified", "updated_at").
+		Updates(user).Error
+	if err != nil {
+		return errors.InternalError("Failed to update user account", err)
+	}
+	return nil
+}
+
+func (r *userRepository) ReplaceRole(ctx context.Context, userID string, from user.UserRoleName, to *user.UserRole) error {
+	// Roles share a (user_id, name) primary key, so the old row is removed for
+	// good instead of being soft deleted
+	err := r.GetDB(ctx).Unscoped().Where("user_id = ? AND name = ?", userID, from).Delete(&user.UserRole{}).Error
+	if err != nil {
+		return errors.InternalError("Failed to remove user role", err)
+	}
+
+	if err := r.GetDB(ctx).Create(to).Error; err != nil {
+		return errors.InternalError("Failed to create user role", err)
+	}
+	return nil
+}
+
+// AddRole creates the role, or restores it when it was soft deleted
+func (r *userRepository) AddRole(ctx context.Context, role *user.UserRole) error {
+	err := r.GetDB(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "name"}},
+		DoUpdates: clause.Assignments(map[string]any{"deleted_at": nil}),
+	}).Create(role).Error
+	if err != nil {
+		return errors.InternalError("Failed to add user role", err)
+	}
+	return nil
+}
+
+func (r *userRepository) CreateCredential(ctx context.Context, credential *user.Credential) error {
+	if err := r.GetDB(ctx).Omit("User").Create(credential).Error; err != nil {
+		return errors.InternalError("Failed to create credential", err)
+	}
+	return nil
+}
+
+func (r *userRepository) UpdateLastActive(ctx context.Context, id string, at time.Time) error {
+	if err := r.GetDB(ctx).Model(&user.User{}).Where("id = ?", id).Update("last_active_at", at).Error; err != nil {
+		return errors.InternalError("Failed to update last activity", err)
+	}
+	return nil
+}
+
+func (r *userRepository) FindInactiveAnonymousIDs(ctx context.Context, before time.Time, limit int) ([]string, error) {
+	var ids []string
+	err := r.GetDB(ctx).Unscoped().Model(&user.User{}).
+		Where("anonymous = ? AND COALESCE(last_active_at, created_at) < ?", true, before).
+		Limit(limit).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return nil, errors.InternalError("Failed to fetch inactive anonymous users", err)
+	}
+	return ids, nil
+}
+
+func (r *userRepository) HardDeleteByIDs(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	// Related roles, credentials and confirmations are removed by ON DELETE CASCADE
+	if err := r.GetDB(ctx).Unscoped().Where("id IN ?", ids).Delete(&user.User{}).Error; err != nil {
+		return errors.InternalError("Failed to delete users", err)
+	}
+	return nil
+}
+
+func (r *userRepository) FindByUsername(ctx context.Context, username string) (*user.User, error) {
+	var user user.User
+	err := r.GetDB(ctx).Where("LOWER(username) = LOWER(?)", username).First(&user).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, errors.InternalError("Failed to fetch user by username", err)
+	}
+	return &user, nil
+}
+
+func (r *userRepository) UpdateProfile(ctx context.Context, user *user.User) error {
+	err := r.GetDB(ctx).Model(user).
+		Select("username", "display_name", "locale", "time_zone", "updated_at").
+		Updates(user).Error
+	if err != nil {
+		if postgres.IsUniqueViolation(err) {
+			return errors.DuplicateEntryError("Username is already taken", err)
+		}
+		return errors.InternalError("Failed to update user profile", err)
+	}
+	return nil
+}
+
+func (r *userRepository) FindDeletedByEmail(ctx context.Context, email string) (*user.User, error) {
+	var user user.User
+	err := r.GetDB(ctx).Unscoped().Preload("Credentials").
+		Where("email = ? AND deleted_at IS NOT NULL", email).
+		First(&user).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, errors.InternalError("Failed to fetch deleted user by email", err)
+	}
+	return &user, nil
+}
+
+func (r *userRepository) FindDeletedById(ctx context.Context, id string) (*user.User, error) {
+	var user user.User
+	err := r.GetDB(ctx).Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(&user).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NotFoundError("User not found", err)
+		}
+		return nil, errors.InternalError("Failed to fetch deleted user by ID", err)
+	}
+	return &user, nil
+}
+
+func (r *userRepository) SoftDelete(ctx context.Context, user *user.User) error {
+	err := r.GetDB(ctx).Model(user).Updates(map[string]any{
+		"deleted_at":  user.DeletedAt,
+		"purge_after": user.PurgeAfter,
+		"updated_at":  user.UpdatedAt,
+	}).Error
+	if err != nil {
+		return errors.InternalError("Failed to delete user", err)
+	}
+	return nil
+}
+
+func (r *userRepository) Restore(ctx context.Context, user *user.User) error {
+	err := r.GetDB(ctx).Unscoped().Model(user).Updates(map[string]any{
+		"deleted_at":  nil,
+		"purge_after": nil,
+		"updated_at":  user.UpdatedAt,
+	}).Error
+	if err != nil {
+		if postgres.IsUniqueViolation(err) {
+			return errors.ConflictError("Username is already taken", err)
+		}
+		return errors.InternalError("Failed to restore user", err)
+	}
+	return nil
+}
+
+func (r *userRepository) FindIDsDueForPurge(ctx context.Context, before time.Time, limit int) ([]string, error) {
+	var ids []string
+	err := r.GetDB(ctx).Unscoped().Model(&user.User{}).
+		Where("deleted_at IS NOT NULL AND purged_at IS NULL AND purge_after <= ?", before).
+		Limit(limit).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return nil, errors.InternalError("Failed to fetch users due for purge", err)
+	}
+	return ids, nil
+}
+
+func (r *userRepository) Anonymize(ctx context.Context, u *user.User) error {
+	db := r.GetDB(ctx).Unscoped()
+
+	if err := db.Where("user_id = ?", u.ID).Delete(&user.Credential{}).Error; err != nil {
+		return errors.InternalError("Failed to delete user credentials", err)
+	}
+
+	if err := db.Where("user_id = ?", u.ID).Delete(&user.UserRole{}).Error; err != nil {
+		return errors.InternalError("Failed to delete user roles", err)
+	}
+
+	if err := db.Where("user_id = ?", u.ID).Delete(&user.UserConfirmation{}).Error; err != nil {
+		return errors.InternalError("Failed to delete user confirmations", err)
+	}
+
+	err := db.Model(u).Updates(map[string]any{
+		"username":       u.Username,
+		"email":          u.Email,
+		"display_name":   nil,
+		"locale":         nil,
+		"time_zone":      nil,
+		"enabled":        false,
+		"verified":       false,
+		"last_active_at": nil,
+		"purged_at":      u.PurgedAt,
+		"updated_at":     u.UpdatedAt,
+	}).Error
+	if err != nil {
+		return errors.InternalError("Failed to anonymise user", err)
+	}
+	return nil
+}
+
+func (r *userRepository) FindByIdForExport(ctx context.Context, id string) (*user.User, error) {
+	var user user.User
+	err := r.GetDB(ctx).
+		Preload("Roles").
+		Preload("Credentials").
+		Preload("Confirmations", func(db *gorm.DB) *gorm.DB {
+			return db.Unscoped().Order("created_at")
+		}).
+		Where("id = ?", id).
+		First(&user).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NotFoundError("User not found", err)
+		}
+		return nil, errors.InternalError("Failed to fetch user for export", err)
+	}
+	return &user, nil
+}
@@ -0,0 +1,199 @@
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/ouz/goboilerplate/internal/adapters/repo/postgres"
+	"github.com/ouz/goboilerplate/internal/domain/shared"
+	"github.com/ouz/goboilerplate/internal/domain/webhook"
+	"github.com/ouz/goboilerplate/pkg/auth"
+	"github.com/ouz/goboilerplate/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type webhookRepository struct {
+	postgres.BaseRepository
+}
+
+func NewWebhookRepository(db *gorm.DB) webhook.WebhookRepository {
+	return &webhookRepository{BaseRepository: postgres.BaseRepository{
+		DB: db,
+	}}
+}
+
+func (r *webhookRepository) CreateSubscription(ctx context.Context, subscription *webhook.Subscription) error {
+	if err := r.GetDB(ctx).Create(subscription).Error; err != nil {
+		return errors.DatabaseError("Failed to create webhook subscription", err)
+	}
+	return nil
+}
+
+func (r *webhookRepository) FindSubscriptions(ctx context.Context, clientType auth.ClientType) ([]webhook.Subscription, error) {
+	var subscriptions []webhook.Subscription
+	err := r.GetDB(ctx).Where("client_type = ?", clientType).Order("created_at").Find(&subscriptions).Error
+	if err != nil {
+		return nil, errors.DatabaseError("Failed to fetch webhook subscriptions", err)
+	}
+	return subscriptions, nil
+}
+
+func (r *webhookRepository) FindSubscription(ctx context.Context, clientType auth.ClientType, id string) (*webhook.Subscription, error) {
+	var subscription webhook.Subscription
+	err := r.GetDB(ctx).Where("id = ? AND client_type = ?", id, clientType).First(&subscription).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NotFoundError("Webhook subscription not found", err)
+		}
+		return nil, errors.DatabaseError("Failed to fetch webhook subscription", err)
+	}
+	return &subscription, nil
+}
+
+func (r *webhookRepository) FindSubscriptionsForEvent(ctx context.Context, clientType auth.ClientType, eventType string) ([]webhook.Subscription, error) {
+	var subscriptions []webhook.Subscription
+	err := r.GetDB(ctx).
+		Where("client_type = ? AND event_types @> ?::jsonb", clientType, `["`+eventType+`"]`).
+		Find(&subscriptions).Error
+	if err != nil {
+		return nil, errors.DatabaseError("Failed to fetch webhook subscriptions", err)
+	}
+	return subscriptions, nil
+}
+
+func (r *webhookRepository) DeleteSubscription(ctx context.Context, subscription *webhook.Subscription) error {
+	if err := r.GetDB(ctx).Delete(subscription).Error; err != nil {
+		return errors.DatabaseError("Failed to delete webhook subscription", err)
+	}
+	return nil
+}
+
+func (r *webhookRepository) CreateDeliveries(ctx context.Context, deliveries []webhook.Delivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	err := r.GetDB(ctx).
+		Omit(clause.Associations).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "subscription_id"}, {Name: "event_id"}},
+			DoNothing: true,
+		}).
+		Create(&deliveries).Error
+	if err != nil {
+		return errors.DatabaseError("Failed to create webhook deliveries", err)
+	}
+	return nil
+}
+
+func (r *webhookRepository) ClaimDueDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]webhook.Delivery, error) {
+	db := r.GetDB(ctx)
+
+	var deliveries []webhook.Delivery
+	err := db.
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status = ? AND next_attempt_at <= ?", webhook.DeliveryStatusPending, now).
+		Order("next_attempt_at").
+		Limit(limit).
+		Find(&deliveries).Error
+	if err != nil {
+		return nil, errors.DatabaseError("Failed to fetch due webhook deliveries", err)
+	}
+
+	if len(deliveries) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, 0, len(deliveries))
+	subscriptionIDs := make([]string, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		ids = append(ids, delivery.ID)
+		subscriptionIDs = append(subscriptionIDs, delivery.SubscriptionID)
+	}
+
+	if err := db.Model(&webhook.Delivery{}).Where("id IN ?", ids).Update("next_attempt_at", leaseUntil).Error; err != nil {
+		return nil, errors.DatabaseError("Failed to lease webhook deliveries", err)
+	}
+
+	// Subscriptions deleted in the meantime are not loaded, their deliveries are left without one
+	var subscriptions []webhook.Subscription
+	if err := db.Where("id IN ?", subscriptionIDs).Find(&subscriptions).Error; err != nil {
+		return nil, errors.DatabaseError("Failed to fetch webhook subscriptions", err)
+	}
+
+	byID := make(map[string]webhook.Subscription, len(subscriptions))
+	for _, subscription := range subscriptions {
+		byID[subscription.ID] = subscription
+	}
+	for i := range deliveries {
+		deliveries[i].Subscription = byID[deliveries[i].SubscriptionID]
+	}
+
+	return deliveries, nil
+}
+
+func (r *webhookRepository) UpdateDelivery(ctx context.Context, delivery *webhook.Delivery) error {
+	err := r.GetDB(ctx).Model(delivery).
+		Omit(clause.Associations).
+		Select("status", "attempts", "next_attempt_at", "last_status_code", "last_error", "delivered_at", "updated_at").
+		Updates(delivery).Error
+	if err != nil {
+		return errors.DatabaseError("Failed to update webhook delivery", err)
+	}
+	return nil
+}
+
+func (r *webhookRepository) CreateAttempt(ctx context.Context, attempt *webhook.DeliveryAttempt) error {
+	if err := r.GetDB(ctx).Create(attempt).Error; err != nil {
+		return errors.DatabaseError("Failed to create webhook delivery attempt", err)
+	}
+	return nil
+}
+
+func (r *webhookRepository) FindDeliveries(ctx context.Context, filter webhook.DeliveryFilter, pagination *shared.Pagination[webhook.Delivery]) error {
+	query := r.GetDB(ctx).Model(&webhook.Delivery{}).
+		Joins("JOIN webhook_subscriptions ON webhook_subscriptions.id = webhook_deliveries.subscription_id").
+		Where("webhook_subscriptions.client_type = ?", filter.ClientType)
+	if filter.SubscriptionID != "" {
+		query = query.Where("webhook_deliveries.subscription_id = ?", filter.SubscriptionID)
+	}
+	if filter.Status != "" {
+		query = query.Where("webhook_deliveries.status = ?", filter.Status)
+	}
+
+	var deliveries []webhook.Delivery
+	err := query.Scopes(postgres.Paginate(&webhook.Delivery{}, pagination, query.Session(&gorm.Session{}))).
+		Order("webhook_deliveries.created_at DESC").
+		Find(&deliveries).Error
+	if err != nil {
+		return errors.DatabaseError("Failed to fetch webhook deliveries", err)
+	}
+
+	pagination.Data = deliveries
+	return nil
+}
+
+func (r *webhookRepository) FindDelivery(ctx context.Context, clientType auth.ClientType, id string) (*webhook.Delivery, error) {
+	var delivery webhook.Delivery
+	err := r.GetDB(ctx).
+		Joins("JOIN webhook_subscriptions ON webhook_subscriptions.id = webhook_deliveries.subscription_id").
+		Where("webhook_deliveries.id = ? AND webhook_subscriptions.client_type = ?", id, clientType).
+		First(&delivery).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NotFoundError("Webhook delivery not found", err)
+		}
+		return nil, errors.DatabaseError("Failed to fetch webhook delivery", err)
+	}
+	return &delivery, nil
+}
+
+func (r *webhookRepository) FindAttempts(ctx context.Context, deliveryID string) ([]webhook.DeliveryAttempt, error) {
+	var attempts []webhook.DeliveryAttempt
+	err := r.GetDB(ctx).Where("delivery_id = ?", deliveryID).Order("attempt").Find(&attempts).Error
+	if err != nil {
+		return nil, errors.DatabaseError("Failed to fetch webhook delivery attempts", err)
+	}
+	return attempts, nil
+}
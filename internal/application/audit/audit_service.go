@@ -0,0 +1,88 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/ouz/goboilerplate/internal/adapters/api/util"
+	"github.com/ouz/goboilerplate/internal/config"
+	"github.com/ouz/goboilerplate/internal/domain/audit"
+	"github.com/ouz/goboilerplate/internal/domain/shared"
+	"github.com/ouz/goboilerplate/pkg/errors"
+	"github.com/ouz/goboilerplate/pkg/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	auditWriteTimeout   = 5 * time.Second
+	auditPurgeBatchSize = 1000
+)
+
+type auditService struct {
+	auditRepository audit.AuditRepository
+	logger          *log.Logger
+}
+
+func NewAuditService(logger *log.Logger, ar audit.AuditRepository) audit.AuditService {
+	return &auditService{
+		auditRepository: ar,
+		logger:          logger,
+	}
+}
+
+// Record enriches the event with request metadata and stores it. Failing to
+// write an audit event never fails the action being audited.
+func (s *auditService) Record(ctx context.Context, event *audit.Event) {
+	if event.ActorID == "" {
+		event.ActorID = util.AuthenticatedUserID(ctx)
+	}
+
+	info := util.GetRequestInfo(ctx)
+	event.IP = info.IP
+	event.UserAgent = info.UserAgent
+
+	if client, err := util.GetClient(ctx); err == nil {
+		event.ClientType = string(client.ClientType)
+	}
+
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		event.TraceID = spanContext.TraceID().String()
+	}
+
+	// The event must be stored even when the client disconnects mid-request
+	writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), auditWriteTimeout)
+	defer cancel()
+
+	if err := s.auditRepository.Create(writeCtx, event); err != nil {
+		s.logger.Error("Failed to record audit event", "error", err, "action", event.Action, "outcome", event.Outcome, "actor_id", event.ActorID)
+	}
+}
+
+func (s *auditService) ListEvents(ctx context.Context, filter audit.Filter, pagination *shared.Pagination[audit.Event]) error {
+	if err := s.auditRepository.FindAll(ctx, filter, pagination); err != nil {
+		return errors.InternalError("Failed to list audit events", err)
+	}
+	return nil
+}
+
+func (s *auditService) PurgeExpired(ctx context.Context) (int64, error) {
+	before := time.Now().Add(-config.Get().Audit.Retention)
+	var purged int64
+
+	for {
+		deleted, err := s.auditRepository.DeleteBefore(ctx, before, auditPurgeBatchSize)
+		if err != nil {
+			return purged, err
+		}
+		purged += deleted
+
+		if deleted < auditPurgeBatchSize {
+			break
+		}
+	}
+
+	if purged > 0 {
+		s.logger.Info("Expired audit events purged", "count", purged)
+	}
+	return purged, nil
+}
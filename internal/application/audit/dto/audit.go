@@ -0,0 +1,39 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/ouz/goboilerplate/internal/domain/audit"
+)
+
+type AuditEventResponse struct {
+	ID         string    `json:"id"`
+	ActorID    string    `json:"actorId,omitempty"`
+	Action     string    `json:"action"`
+	TargetID   string    `json:"targetId,omitempty"`
+	Subject    string    `json:"subject,omitempty"`
+	ClientType string    `json:"clientType,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+	TraceID    string    `json:"traceId,omitempty"`
+	Outcome    string    `json:"outcome"`
+	Reason     string    `json:"reason,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+func NewAuditEventResponse(e audit.Event) AuditEventResponse {
+	return AuditEventResponse{
+		ID:         e.ID,
+		ActorID:    e.ActorID,
+		Action:     string(e.Action),
+		TargetID:   e.TargetID,
+		Subject:    e.Subject,
+		ClientType: e.ClientType,
+		IP:         e.IP,
+		UserAgent:  e.UserAgent,
+		TraceID:    e.TraceID,
+		Outcome:    string(e.Outcome),
+		Reason:     e.Reason,
+		CreatedAt:  e.CreatedAt,
+	}
+}
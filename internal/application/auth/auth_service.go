@@ -2,12 +2,16 @@ package auth
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"time"
 
 	"github.com/ouz/goboilerplate/internal/adapters/api/util"
 	"github.com/ouz/goboilerplate/internal/config"
+	"github.com/ouz/goboilerplate/internal/domain/audit"
 	"github.com/ouz/goboilerplate/internal/domain/auth"
+	"github.com/ouz/goboilerplate/internal/domain/event"
 	"github.com/ouz/goboilerplate/internal/domain/user"
 	sharedAuth "github.com/ouz/goboilerplate/pkg/auth"
 	"github.com/ouz/goboilerplate/pkg/cache"
@@ -15,19 +19,36 @@ import (
 	"github.com/ouz/goboilerplate/pkg/log"
 )
 
+const (
+	clientCachePrefix = "client"
+	clientCacheTTL    = time.Hour
+	// Clients rarely change, an expired entry keeps serving while it is reloaded
+	clientStaleTTL = 5 * time.Minute
+)
+
 type authService struct {
 	logger         *log.Logger
 	authRepository auth.AuthRepository
 	userService    user.UserService
 	redisCache     cache.RedisCacheService
+	clientCache    *cache.CacheAside
+	auditService   audit.AuditService
+	eventPublisher event.Publisher
 }
 
-func NewAuthService(logger *log.Logger, ar auth.AuthRepository, us user.UserService, rc cache.RedisCacheService) auth.AuthService {
+func NewAuthService(logger *log.Logger, ar auth.AuthRepository, us user.UserService, rc cache.RedisCacheService, as audit.AuditService, ep event.Publisher) auth.AuthService {
 	return &authService{
 		logger:         logger,
 		authRepository: ar,
 		userService:    us,
 		redisCache:     rc,
+		// Unknown secrets are not cached, every guess would otherwise leave a key behind
+		clientCache: cache.NewCacheAside(logger, rc, cache.CacheAsideOptions{
+			Jitter:               0.1,
+			StaleWhileRevalidate: clientStaleTTL,
+		}),
+		auditService:   as,
+		eventPublisher: ep,
 	}
 }
 
@@ -50,38 +71,40 @@ func (s *authService) GenerateToken(ctx context.Context, userId string) (auth.To
 		return auth.TokenPair{}, errors.InternalError("Failed to save token pair", err)
 	}
 
+	if err := s.userService.RecordActivity(ctx, userId); err != nil {
+		s.logger.Error("Failed to record user activity", "error", err, "userID", userId)
+	}
+
 	return tokenPair, nil
 }
 
+// saveTokenPair stores both tokens in one atomic write, a refresh token never exists without its access token
 func (s *authService) saveTokenPair(ctx context.Context, tokenPair auth.TokenPair) error {
-	if err := s.redisCache.Set(ctx, tokenPair.AccessToken.GetPrefix(), tokenPair.AccessToken.ID, config.Get().JWT.AccessExpiration, 0); err != nil {
-		return errors.InternalError("Failed to save access token", err)
-	}
-
-	if err := s.redisCache.Set(ctx, tokenPair.RefreshToken.GetPrefix(), tokenPair.RefreshToken.ID, config.Get().JWT.RefreshExpiration, 0); err != nil {
-		return errors.InternalError("Failed to save refresh token", err)
-	}
-
-	return nil
+	jwtConfig := config.Get().JWT
+	return s.redisCache.MSet(ctx,
+		cache.Entry{Prefix: tokenPair.AccessToken.GetPrefix(), Key: tokenPair.AccessToken.ID, TTL: jwtConfig.AccessExpiration, Value: 0},
+		cache.Entry{Prefix: tokenPair.RefreshToken.GetPrefix(), Key: tokenPair.RefreshToken.ID, TTL: jwtConfig.RefreshExpiration, Value: 0},
+	)
 }
 
 func (s *authService) FindClientBySecretCached(ctx context.Context, clientSecret string) (auth.Client, error) {
-	var cachedClient auth.Client
-	cacheKey := fmt.Sprintf("client:%s", clientSecret)
-
-	if found, _ := s.redisCache.Get(ctx, cacheKey, clientSecret, &cachedClient); found {
-		return cachedClient, nil
-	}
-
-	clientFromDB, err := s.authRepository.FindClientBySecret(ctx, clientSecret)
+	client, err := cache.GetOrLoad(ctx, s.clientCache, clientCachePrefix, clientCacheKey(clientSecret), clientCacheTTL, func(ctx context.Context) (auth.Client, error) {
+		client, err := s.authRepository.FindClientBySecret(ctx, clientSecret)
+		if err != nil {
+			return auth.Client{}, err
+		}
+		return *client, nil
+	})
 	if err != nil {
 		return auth.Client{}, err
 	}
+	return client, nil
+}
 
-	if err := s.redisCache.Set(ctx, cacheKey, clientSecret, 1*time.Hour, clientFromDB); err != nil {
-		s.logger.Error("Failed to cache client", "error", err)
-	}
-	return *clientFromDB, nil
+// clientCacheKey keeps client secrets out of cache keys, which administrators can list
+func clientCacheKey(clientSecret string) string {
+	sum := sha256.Sum256([]byte(clientSecret))
+	return hex.EncodeToString(sum[:])
 }
 
 func (s *authService) RevokeAllTokensByClient(ctx context.Context, userID string, clientType sharedAuth.ClientType) error {
@@ -112,15 +135,21 @@ func (s *authService) RevokeAllTokens(ctx context.Context, userID string) error
 	return nil
 }
 
-func (s *authService) RefreshAccessToken(ctx context.Context, refreshToken string) (auth.TokenPair, error) {
+func (s *authService) RefreshAccessToken(ctx context.Context, refreshToken string) (tokenPair auth.TokenPair, err error) {
+	var userID string
+	defer func() {
+		s.auditService.Record(ctx, audit.Result(audit.ActionTokenRefresh, err).WithActor(userID))
+	}()
+
 	claims, err := auth.ValidateToken(refreshToken, config.Get().JWT.Secret)
 	if err != nil {
 		return auth.TokenPair{}, err
 	}
+	userID = claims.UserId
 
 	revoked, err := s.IsTokenRevoked(ctx, claims)
 	if err != nil {
-		return auth.TokenPair{}, errors.InternalError("Failed to check if token is revoked", err)
+		return auth.TokenPair{}, revocationCheckError(err)
 	}
 
 	if revoked {
@@ -139,35 +168,131 @@ func (s *authService) ValidateToken(ctx context.Context, tokenStr string) (*auth
 	return auth.ValidateToken(tokenStr, config.Get().JWT.Secret)
 }
 
-func (s *authService) Login(ctx context.Context, email, password string) (auth.TokenPair, error) {
+func (s *authService) Login(ctx context.Context, email, password string) (tokenPair auth.TokenPair, err error) {
+	var userID string
+	defer func() {
+		event := audit.Result(audit.ActionLogin, err).WithActor(userID)
+		// Without a user the submitted email is all that identifies the target
+		if userID == "" {
+			event.WithSubject(email)
+		}
+		s.auditService.Record(ctx, event)
+	}()
+
 	user, err := s.userService.FindByEmail(ctx, email)
 	if err != nil {
 		return auth.TokenPair{}, errors.InternalError("Failed to find user", err)
 	}
 	if user == nil {
-		return auth.TokenPair{}, errors.NotFoundError("User not found", nil)
+		return auth.TokenPair{}, s.checkPendingDeletion(ctx, email, password)
 	}
+	userID = user.ID
 
 	if !user.IsPasswordValid(password) {
 		return auth.TokenPair{}, errors.UnauthorizedError("Invalid credentials", nil)
 	}
 
-	return s.GenerateToken(ctx, user.ID)
+	return s.login(ctx, user.ID, event.LoginMethodPassword)
+}
+
+func (s *authService) RestoreAccount(ctx context.Context, email, password string) (tokenPair auth.TokenPair, err error) {
+	var userID string
+	defer func() {
+		event := audit.Result(audit.ActionAccountRestore, err).WithActor(userID)
+		if userID == "" {
+			event.WithSubject(email)
+		}
+		s.auditService.Record(ctx, event)
+	}()
+
+	user, err := s.userService.FindPendingDeletionByEmail(ctx, email)
+	if err != nil {
+		return auth.TokenPair{}, err
+	}
+	if user == nil {
+		return auth.TokenPair{}, errors.UnauthorizedError("Invalid credentials", nil)
+	}
+	userID = user.ID
+
+	if !user.IsPasswordValid(password) {
+		return auth.TokenPair{}, errors.UnauthorizedError("Invalid credentials", nil)
+	}
+
+	if err := s.userService.RestoreAccount(ctx, user.ID); err != nil {
+		return auth.TokenPair{}, err
+	}
+
+	return s.login(ctx, user.ID, event.LoginMethodRestore)
 }
 
-func (s *authService) LoginAnonymous(ctx context.Context, email string) (auth.TokenPair, error) {
+// login issues a new token pair for an authenticated user and announces the login
+func (s *authService) login(ctx context.Context, userID string, method event.LoginMethod) (auth.TokenPair, error) {
+	tokenPair, err := s.GenerateToken(ctx, userID)
+	if err != nil {
+		return auth.TokenPair{}, err
+	}
+
+	s.publish(ctx, event.UserLoggedIn{UserID: userID, ClientType: string(tokenPair.AccessToken.ClientType), Method: method})
+	return tokenPair, nil
+}
+
+// publish records an event for a change that has already happened outside the
+// database, such as issuing or revoking tokens, so a failure can only be logged
+func (s *authService) publish(ctx context.Context, e event.Event) {
+	if err := s.eventPublisher.Publish(ctx, e); err != nil {
+		s.logger.Error("Failed to publish domain event", "error", err, "type", e.EventType())
+	}
+}
+
+// checkPendingDeletion tells a user with valid credentials that their account
+// is in its deletion grace period instead of reporting it as missing
+func (s *authService) checkPendingDeletion(ctx context.Context, email, password string) error {
+	deleted, err := s.userService.FindPendingDeletionByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	if deleted == nil || !deleted.IsPasswordValid(password) {
+		return errors.NotFoundError("User not found", nil)
+	}
+
+	return errors.AccountDeletedError(
+		fmt.Sprintf("Account is scheduled for deletion on %s and can be restored until then", deleted.PurgeAfter.Format(time.RFC3339)),
+		nil,
+	)
+}
+
+func (s *authService) LoginAnonymous(ctx context.Context, email, deviceSecret string) (tokenPair auth.TokenPair, err error) {
+	var userID string
+	defer func() {
+		s.auditService.Record(ctx, audit.Result(audit.ActionAnonymousLogin, err).WithActor(userID))
+	}()
+
 	user, err := s.userService.FindByEmail(ctx, email)
 	if err != nil {
 		return auth.TokenPair{}, errors.InternalError("Failed to find user", err)
 	}
-	if user == nil {
+	if user == nil || !user.Anonymous {
 		return auth.TokenPair{}, errors.NotFoundError("User not found", nil)
 	}
+	userID = user.ID
 
-	return s.GenerateToken(ctx, user.ID)
+	if !user.IsDeviceSecretValid(deviceSecret) {
+		return auth.TokenPair{}, errors.UnauthorizedError("Invalid credentials", nil)
+	}
+
+	if user.IsInactiveSince(time.Now().Add(-config.Get().Anonymous.InactivityPeriod)) {
+		return auth.TokenPair{}, errors.UnauthorizedError("Anonymous account has expired", nil)
+	}
+
+	return s.login(ctx, user.ID, event.LoginMethodDeviceSecret)
 }
 
-func (s *authService) Logout(ctx context.Context, userID string) error {
+func (s *authService) Logout(ctx context.Context, userID string) (err error) {
+	defer func() {
+		s.auditService.Record(ctx, audit.Result(audit.ActionLogout, err).WithTarget(userID))
+	}()
+
 	client, err := util.GetClient(ctx)
 	if err != nil {
 		return err
@@ -175,13 +300,21 @@ func (s *authService) Logout(ctx context.Context, userID string) error {
 	if err := s.RevokeAllTokensByClient(ctx, userID, client.ClientType); err != nil {
 		return errors.InternalError("Failed to revoke old tokens", err)
 	}
+
+	s.publish(ctx, event.SessionRevoked{UserID: userID, ClientType: string(client.ClientType), Reason: event.RevocationReasonLogout})
 	return nil
 }
 
-func (s *authService) LogoutAll(ctx context.Context, userID string) error {
+func (s *authService) LogoutAll(ctx context.Context, userID string) (err error) {
+	defer func() {
+		s.auditService.Record(ctx, audit.Result(audit.ActionLogoutAll, err).WithTarget(userID))
+	}()
+
 	if err := s.RevokeAllTokens(ctx, userID); err != nil {
 		return errors.InternalError("Failed to revoke old tokens", err)
 	}
+
+	s.publish(ctx, event.SessionRevoked{UserID: userID, Reason: event.RevocationReasonLogoutAll})
 	return nil
 }
 
@@ -193,7 +326,7 @@ func (s *authService) ValidateTokenAndGetUser(ctx context.Context, token string)
 
 	revoked, err := s.IsTokenRevoked(ctx, claims)
 	if err != nil {
-		return user.User{}, errors.InternalError("Failed to check if token is revoked", err)
+		return user.User{}, revocationCheckError(err)
 	}
 
 	if revoked {
@@ -208,6 +341,15 @@ func (s *authService) ValidateTokenAndGetUser(ctx context.Context, token string)
 	return *u, nil
 }
 
+// revocationCheckError fails closed. While the cache is unavailable a revoked token
+// cannot be told apart, so the request is refused as temporarily unavailable
+func revocationCheckError(err error) error {
+	if cache.IsUnavailable(err) {
+		return errors.ServiceUnavailableError("Token revocation cannot be checked right now", err)
+	}
+	return errors.InternalError("Failed to check if token is revoked", err)
+}
+
 func (s *authService) IsTokenRevoked(ctx context.Context, token *auth.Token) (bool, error) {
 	key := token.GetPrefix()
 	found, err := s.redisCache.Exists(ctx, key, token.ID)
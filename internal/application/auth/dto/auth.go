@@ -10,8 +10,15 @@ type UserRegisterRequest struct {
 	Password string `json:"password" validate:"required"`
 }
 
+type UpgradeAnonymousUserRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
 type AnonymousUserLoginRequest struct {
-	Email string `json:"email" validate:"required"`
+	Email        string `json:"email" validate:"required"`
+	DeviceSecret string `json:"deviceSecret" validate:"required"`
 }
 
 type UserLoginRequest struct {
@@ -25,5 +32,6 @@ type TokenResponse struct {
 }
 
 type AnonymousUserResponse struct {
-	Email string `json:"email"`
+	Email        string `json:"email"`
+	DeviceSecret string `json:"deviceSecret"`
 }
@@ -0,0 +1,140 @@
+package event
+
+import (
+	"context"
+	"time"
+
+	"github.com/ouz/goboilerplate/internal/adapters/repo/postgres"
+	"github.com/ouz/goboilerplate/internal/config"
+	"github.com/ouz/goboilerplate/internal/domain/event"
+	"github.com/ouz/goboilerplate/pkg/log"
+	"github.com/ouz/goboilerplate/pkg/stream"
+)
+
+const outboxPurgeBatchSize = 1000
+
+type outboxRelay struct {
+	outboxRepository event.OutboxRepository
+	streamService    stream.StreamService
+	tx               postgres.TransactionManager
+	config           config.OutboxConfig
+	logger           *log.Logger
+}
+
+func NewOutboxRelay(logger *log.Logger, or event.OutboxRepository, ss stream.StreamService, tx postgres.TransactionManager, cfg config.OutboxConfig) event.OutboxRelay {
+	return &outboxRelay{
+		outboxRepository: or,
+		streamService:    ss,
+		tx:               tx,
+		config:           cfg,
+		logger:           logger,
+	}
+}
+
+// Relay publishes committed outbox messages until the outbox is drained or a
+// publish fails. Delivery is at-least-once: a crash between publishing and
+// marking a message leaves it to be published again, consumers deduplicate on
+// the envelope id.
+func (r *outboxRelay) Relay(ctx context.Context) (int, error) {
+	relayed := 0
+
+	for {
+		published, done, err := r.relayBatch(ctx, r.config.BatchSize)
+		relayed += published
+		if err != nil || done {
+			return relayed, err
+		}
+	}
+}
+
+// relayBatch leases a batch in a short transaction and publishes it outside of
+// it, so row locks are not held across network calls. The lease bounds every
+// publish, once it expires another relay may claim the messages again
+func (r *outboxRelay) relayBatch(ctx context.Context, batchSize int) (int, bool, error) {
+	now := time.Now()
+	leaseUntil := now.Add(r.config.LeaseDuration)
+
+	var messages []event.OutboxMessage
+	err := r.tx.ExecuteInTransaction(ctx, func(ctx context.Context) error {
+		claimed, err := r.outboxRepository.ClaimUnpublished(ctx, now, leaseUntil, batchSize)
+		messages = claimed
+		return err
+	})
+	if err != nil {
+		return 0, true, err
+	}
+	done := len(messages) < batchSize
+
+	publishCtx, cancel := context.WithDeadline(ctx, leaseUntil)
+	defer cancel()
+
+	ids := make([]string, 0, len(messages))
+	for i, message := range messages {
+		err := r.publish(publishCtx, message)
+		if err == nil {
+			ids = append(ids, message.ID)
+			continue
+		}
+
+		if message.Attempts+1 >= r.config.MaxAttempts {
+			// Park it so one poisoned message does not block the outbox forever
+			r.logger.Error("Parking outbox message after repeated failures", "error", err, "message_id", message.ID, "type", message.EventType, "attempts", message.Attempts+1)
+			if parkErr := r.outboxRepository.Park(ctx, message.ID, err.Error(), time.Now()); parkErr != nil {
+				r.logger.Error("Failed to park outbox message", "error", parkErr, "message_id", message.ID)
+			}
+			continue
+		}
+
+		r.logger.Error("Failed to relay outbox message", "error", err, "message_id", message.ID, "type", message.EventType)
+		if markErr := r.outboxRepository.MarkFailed(ctx, message.ID, err.Error()); markErr != nil {
+			r.logger.Error("Failed to record outbox failure", "error", markErr, "message_id", message.ID)
+		}
+
+		// Stop here so later events are not published ahead of this one
+		rest := make([]string, 0, len(messages)-i-1)
+		for _, later := range messages[i+1:] {
+			rest = append(rest, later.ID)
+		}
+		if releaseErr := r.outboxRepository.Release(ctx, rest); releaseErr != nil {
+			r.logger.Error("Failed to release outbox messages", "error", releaseErr)
+		}
+		done = true
+		break
+	}
+
+	if err := r.outboxRepository.MarkPublished(ctx, ids, time.Now()); err != nil {
+		return 0, true, err
+	}
+
+	return len(ids), done, nil
+}
+
+func (r *outboxRelay) publish(ctx context.Context, message event.OutboxMessage) error {
+	msg, err := stream.EnvelopeMessage(message.Payload)
+	if err != nil {
+		return err
+	}
+	return r.streamService.PublishMessage(ctx, message.Stream, msg)
+}
+
+func (r *outboxRelay) PurgePublished(ctx context.Context) (int64, error) {
+	before := time.Now().Add(-r.config.Retention)
+	var purged int64
+
+	for {
+		deleted, err := r.outboxRepository.DeletePublishedBefore(ctx, before, outboxPurgeBatchSize)
+		if err != nil {
+			return purged, err
+		}
+		purged += deleted
+
+		if deleted < outboxPurgeBatchSize {
+			break
+		}
+	}
+
+	if purged > 0 {
+		r.logger.Info("Published outbox messages purged", "count", purged)
+	}
+	return purged, nil
+}
@@ -0,0 +1,49 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ouz/goboilerplate/internal/domain/event"
+	"github.com/ouz/goboilerplate/pkg/errors"
+	"github.com/ouz/goboilerplate/pkg/stream"
+)
+
+type outboxPublisher struct {
+	outboxRepository event.OutboxRepository
+	registry         *stream.Registry
+}
+
+// NewOutboxPublisher returns a publisher that stores events in the outbox. When
+// called with a transactional context the event is committed or rolled back
+// together with the rest of the transaction. Events missing from the registry
+// are rejected.
+func NewOutboxPublisher(or event.OutboxRepository, registry *stream.Registry) event.Publisher {
+	return &outboxPublisher{
+		outboxRepository: or,
+		registry:         registry,
+	}
+}
+
+func (p *outboxPublisher) Publish(ctx context.Context, e event.Event) error {
+	if err := p.registry.Validate(e.EventType(), e.EventVersion()); err != nil {
+		return err
+	}
+
+	envelope, err := stream.NewEnvelope(ctx, e.EventType(), e.EventVersion(), e)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		return errors.InternalError("Failed to encode domain event", err)
+	}
+
+	return p.outboxRepository.Create(ctx, &event.OutboxMessage{
+		ID:        envelope.ID,
+		Stream:    event.UserEventsStream,
+		EventType: envelope.Type,
+		Payload:   payload,
+	})
+}
@@ -0,0 +1,158 @@
+package user
+
+import (
+	"context"
+
+	"github.com/ouz/goboilerplate/internal/adapters/repo/postgres"
+	"github.com/ouz/goboilerplate/internal/domain/audit"
+	"github.com/ouz/goboilerplate/internal/domain/auth"
+	"github.com/ouz/goboilerplate/internal/domain/event"
+	"github.com/ouz/goboilerplate/internal/domain/shared"
+	"github.com/ouz/goboilerplate/internal/domain/user"
+	"github.com/ouz/goboilerplate/pkg/cache"
+	"github.com/ouz/goboilerplate/pkg/errors"
+	"github.com/ouz/goboilerplate/pkg/log"
+)
+
+type adminUserService struct {
+	userRepository user.UserRepository
+	authService    auth.AuthService
+	redisCache     cache.RedisCacheService
+	tx             postgres.TransactionManager
+	eventPublisher event.Publisher
+	auditService   audit.AuditService
+	logger         *log.Logger
+}
+
+func NewAdminUserService(logger *log.Logger, ur user.UserRepository, as auth.AuthService, rc cache.RedisCacheService, tx postgres.TransactionManager, ep event.Publisher, aus audit.AuditService) user.AdminUserService {
+	return &adminUserService{
+		userRepository: ur,
+		authService:    as,
+		redisCache:     rc,
+		tx:             tx,
+		eventPublisher: ep,
+		auditService:   aus,
+		logger:         logger,
+	}
+}
+
+// record audits an admin action on a user, the actor is the authenticated admin
+func (s *adminUserService) record(ctx context.Context, action audit.Action, id string, err error) {
+	s.auditService.Record(ctx, audit.Result(action, err).WithTarget(id))
+}
+
+func (s *adminUserService) ListUsers(ctx context.Context, search string, pagination *shared.Pagination[user.User]) error {
+	if err := s.userRepository.FindAll(ctx, search, pagination); err != nil {
+		return errors.InternalError("Failed to list users", err)
+	}
+	return nil
+}
+
+func (s *adminUserService) GetUser(ctx context.Context, id string) (*user.User, error) {
+	return s.userRepository.FindByIdWithDetails(ctx, id)
+}
+
+func (s *adminUserService) EnableUser(ctx context.Context, id string) (err error) {
+	defer func() { s.record(ctx, audit.ActionAdminEnableUser, id, err) }()
+
+	return s.updateStatus(ctx, id, (*user.User).Enable)
+}
+
+func (s *adminUserService) DisableUser(ctx context.Context, id string) (err error) {
+	defer func() { s.record(ctx, audit.ActionAdminDisableUser, id, err) }()
+
+	if err := s.updateStatus(ctx, id, (*user.User).Disable); err != nil {
+		return err
+	}
+
+	// A disabled user must not keep using tokens issued before the change
+	if err := s.authService.LogoutAll(ctx, id); err != nil {
+		return err
+	}
+
+	s.logger.Info("User disabled by admin", "userID", id)
+	return nil
+}
+
+// VerifyUser only marks the email as verified, a disabled user stays disabled
+func (s *adminUserService) VerifyUser(ctx context.Context, id string) (err error) {
+	defer func() { s.record(ctx, audit.ActionAdminVerifyUser, id, err) }()
+
+	if err := s.updateStatus(ctx, id, (*user.User).Verify); err != nil {
+		return err
+	}
+
+	s.logger.Info("User verified by admin", "userID", id)
+	return nil
+}
+
+func (s *adminUserService) LogoutUser(ctx context.Context, id string) (err error) {
+	defer func() { s.record(ctx, audit.ActionAdminLogoutUser, id, err) }()
+
+	if _, err := s.userRepository.FindByIdWithDetails(ctx, id); err != nil {
+		return err
+	}
+
+	if err := s.authService.LogoutAll(ctx, id); err != nil {
+		return err
+	}
+
+	s.logger.Info("User sessions revoked by admin", "userID", id)
+	return nil
+}
+
+func (s *adminUserService) DeleteUser(ctx context.Context, id string) (err error) {
+	defer func() { s.record(ctx, audit.ActionAdminDeleteUser, id, err) }()
+
+	u, err := s.userRepository.FindByIdWithDetails(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// Without a grace period the user cannot restore the account, the next purge anonymises it
+	if err := u.ScheduleDeletion(0); err != nil {
+		return err
+	}
+
+	err = s.tx.ExecuteInTransaction(ctx, func(ctx context.Context) error {
+		if err := s.userRepository.SoftDelete(ctx, u); err != nil {
+			return err
+		}
+
+		return s.eventPublisher.Publish(ctx, event.UserDeleted{UserID: u.ID, ByAdmin: true, ClientType: string(u.ClientType)})
+	})
+	if err != nil {
+		return err
+	}
+
+	s.evictUserCache(ctx, id)
+
+	if err := s.authService.LogoutAll(ctx, id); err != nil {
+		return err
+	}
+
+	s.logger.Info("User deleted by admin", "userID", id)
+	return nil
+}
+
+func (s *adminUserService) updateStatus(ctx context.Context, id string, apply func(*user.User)) error {
+	u, err := s.userRepository.FindByIdWithDetails(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	apply(u)
+
+	if err := s.userRepository.UpdateStatus(ctx, u); err != nil {
+		return errors.InternalError("Failed to update user status", err)
+	}
+
+	s.evictUserCache(ctx, id)
+	return nil
+}
+
+func (s *adminUserService) evictUserCache(ctx context.Context, id string) {
+	if err := s.redisCache.Evict(ctx, userCachePrefix, id); err != nil {
+		s.logger.Error("Failed to invalidate user cache", "error", err, "userID", id)
+	}
+}
@@ -0,0 +1,65 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/ouz/goboilerplate/internal/domain/user"
+)
+
+type AdminUserResponse struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	Enabled   bool      `json:"enabled"`
+	Verified  bool      `json:"verified"`
+	Anonymous bool      `json:"anonymous"`
+	Roles     []string  `json:"roles"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type AdminUserDetailResponse struct {
+	AdminUserResponse
+	Credentials []CredentialMetadataResponse `json:"credentials"`
+}
+
+type CredentialMetadataResponse struct {
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func NewAdminUserResponse(u user.User) AdminUserResponse {
+	roles := make([]string, 0, len(u.Roles))
+	for _, role := range u.Roles {
+		roles = append(roles, string(role.Name))
+	}
+
+	return AdminUserResponse{
+		ID:        u.ID,
+		Username:  u.Username,
+		Email:     u.Email,
+		Enabled:   u.Enabled,
+		Verified:  u.Verified,
+		Anonymous: u.Anonymous,
+		Roles:     roles,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+	}
+}
+
+func NewAdminUserDetailResponse(u user.User) AdminUserDetailResponse {
+	credentials := make([]CredentialMetadataResponse, 0, len(u.Credentials))
+	for _, credential := range u.Credentials {
+		credentials = append(credentials, CredentialMetadataResponse{
+			Type:      string(credential.CredentialType),
+			CreatedAt: credential.CreatedAt,
+			UpdatedAt: credential.UpdatedAt,
+		})
+	}
+
+	return AdminUserDetailResponse{
+		AdminUserResponse: NewAdminUserResponse(u),
+		Credentials:       credentials,
+	}
+}
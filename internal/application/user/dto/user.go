@@ -1,7 +1,32 @@
 package dto
 
+import "time"
+
 type UserResponse struct {
-	ID        string `json:"id"`
-	Email     string `json:"email"`
-	Anonymous bool   `json:"anonymous"`
+	ID          string `json:"id"`
+	Email       string `json:"email"`
+	Username    string `json:"username"`
+	DisplayName string `json:"displayName"`
+	Locale      string `json:"locale"`
+	TimeZone    string `json:"timeZone"`
+	Anonymous   bool   `json:"anonymous"`
+}
+
+type UpdateProfileRequest struct {
+	Username    *string `json:"username" validate:"omitempty,min=3"`
+	DisplayName *string `json:"displayName" validate:"omitempty,max=100"`
+	Locale      *string `json:"locale"`
+	TimeZone    *string `json:"timeZone"`
+}
+
+type ChangeEmailRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type DataExportResponse struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	RequestedAt time.Time  `json:"requestedAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	Error       string     `json:"error,omitempty"`
 }
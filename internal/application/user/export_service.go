@@ -0,0 +1,213 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ouz/goboilerplate/internal/domain/audit"
+	"github.com/ouz/goboilerplate/internal/domain/auth"
+	"github.com/ouz/goboilerplate/internal/domain/user"
+	sharedAuth "github.com/ouz/goboilerplate/pkg/auth"
+	"github.com/ouz/goboilerplate/pkg/cache"
+	"github.com/ouz/goboilerplate/pkg/errors"
+	"github.com/ouz/goboilerplate/pkg/log"
+	"github.com/ouz/goboilerplate/pkg/stream"
+)
+
+const (
+	dataExportStream        = "user-data-exports"
+	dataExportGroup         = "data-exporters"
+	dataExportRequestedType = "user.data_export_requested"
+
+	dataExportJobPrefix     = "export:job"
+	dataExportArchivePrefix = "export:archive"
+	dataExportTTL           = 24 * time.Hour
+)
+
+type dataExportRequestedEvent struct {
+	UserID   string `json:"userId"`
+	ExportID string `json:"exportId"`
+}
+
+func (dataExportRequestedEvent) EventType() string { return dataExportRequestedType }
+func (dataExportRequestedEvent) EventVersion() int { return 1 }
+
+type dataExportService struct {
+	userRepository  user.UserRepository
+	auditRepository audit.AuditRepository
+	redisCache      cache.RedisCacheService
+	streamService   stream.StreamService
+	registry        *stream.Registry
+	logger          *log.Logger
+}
+
+func NewDataExportService(logger *log.Logger, ur user.UserRepository, ar audit.AuditRepository, rc cache.RedisCacheService, ss stream.StreamService) user.DataExportService {
+	registry := stream.NewRegistry()
+	stream.MustRegister[dataExportRequestedEvent](registry)
+
+	return &dataExportService{
+		userRepository:  ur,
+		auditRepository: ar,
+		redisCache:      rc,
+		streamService:   ss,
+		registry:        registry,
+		logger:          logger,
+	}
+}
+
+func (s *dataExportService) RequestExport(ctx context.Context, userID string) (*user.DataExportJob, error) {
+	job, err := s.GetLatestExport(ctx, userID)
+	if err != nil && !errors.IsNotFoundError(err) {
+		return nil, err
+	}
+
+	// A user can only have one export in flight, repeated requests return the running job
+	if job != nil && job.IsPending() {
+		return job, nil
+	}
+
+	job = user.NewDataExportJob(userID)
+	if err := s.saveJob(ctx, job); err != nil {
+		return nil, err
+	}
+
+	event := dataExportRequestedEvent{UserID: userID, ExportID: job.ID}
+	if err := stream.Publish(ctx, s.streamService, s.registry, dataExportStream, event); err != nil {
+		return nil, errors.InternalError("Failed to queue data export", err)
+	}
+
+	s.logger.Info("Data export requested", "user_id", userID, "export_id", job.ID)
+	return job, nil
+}
+
+func (s *dataExportService) GetLatestExport(ctx context.Context, userID string) (*user.DataExportJob, error) {
+	var job user.DataExportJob
+	found, err := s.redisCache.Get(ctx, dataExportJobPrefix, userID, &job)
+	if err != nil {
+		return nil, errors.InternalError("Failed to get data export", err)
+	}
+	if !found {
+		return nil, errors.NotFoundError("Data export not found", nil)
+	}
+	return &job, nil
+}
+
+// Export returns the archive of the latest completed export. Without one it returns
+// the job in flight, or starts a new export, together with a nil archive
+func (s *dataExportService) Export(ctx context.Context, userID string) (*user.DataExportJob, []byte, error) {
+	job, err := s.GetLatestExport(ctx, userID)
+	if err != nil && !errors.IsNotFoundError(err) {
+		return nil, nil, err
+	}
+
+	if job != nil && job.IsPending() {
+		return job, nil, nil
+	}
+
+	if job != nil && job.Status == user.DataExportStatusCompleted {
+		var export user.DataExport
+		found, err := s.redisCache.Get(ctx, dataExportArchivePrefix, job.ID, &export)
+		if err != nil {
+			return nil, nil, errors.InternalError("Failed to get data export archive", err)
+		}
+		// An expired archive is generated again
+		if found {
+			archive, err := json.MarshalIndent(export, "", "  ")
+			if err != nil {
+				return nil, nil, errors.InternalError("Failed to encode data export archive", err)
+			}
+			return job, archive, nil
+		}
+	}
+
+	job, err = s.RequestExport(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return job, nil, nil
+}
+
+func (s *dataExportService) ConsumeExportRequests(ctx context.Context, consumer string) error {
+	return stream.Subscribe(ctx, s.streamService, s.registry, dataExportStream, dataExportGroup, consumer, s.handleExportRequest)
+}
+
+func (s *dataExportService) handleExportRequest(ctx context.Context, _ stream.Envelope, event dataExportRequestedEvent) error {
+	job, err := s.GetLatestExport(ctx, event.UserID)
+	if err != nil {
+		if errors.IsNotFoundError(err) {
+			return nil
+		}
+		return err
+	}
+
+	// The job was superseded or has already been processed
+	if job.ID != event.ExportID || !job.IsPending() {
+		return nil
+	}
+
+	if err := s.buildExport(ctx, job); err != nil {
+		s.logger.Error("Data export failed", "user_id", job.UserID, "export_id", job.ID, "error", err)
+		job.Fail("Failed to generate data export")
+		return s.saveJob(ctx, job)
+	}
+
+	job.Complete()
+	if err := s.saveJob(ctx, job); err != nil {
+		return err
+	}
+
+	s.logger.Info("Data export completed", "user_id", job.UserID, "export_id", job.ID)
+	return nil
+}
+
+func (s *dataExportService) buildExport(ctx context.Context, job *user.DataExportJob) error {
+	u, err := s.userRepository.FindByIdForExport(ctx, job.UserID)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := s.findSessions(ctx, job.UserID)
+	if err != nil {
+		return err
+	}
+
+	auditEvents, err := s.auditRepository.FindByUser(ctx, job.UserID)
+	if err != nil {
+		return err
+	}
+
+	export := user.NewDataExport(u, sessions, auditEvents)
+	if err := s.redisCache.Set(ctx, dataExportArchivePrefix, job.ID, dataExportTTL, export); err != nil {
+		return errors.InternalError("Failed to store data export archive", err)
+	}
+	return nil
+}
+
+// findSessions lists the refresh tokens of the user, each one backs a login session
+func (s *dataExportService) findSessions(ctx context.Context, userID string) ([]user.ExportedSession, error) {
+	prefix := auth.GeneratePrefix(sharedAuth.REFRESH_TOKEN, userID, "")
+	keys, err := cache.ScanAll(ctx, s.redisCache, fmt.Sprintf("%s:*", prefix))
+	if err != nil {
+		return nil, errors.InternalError("Failed to list sessions", err)
+	}
+
+	sessions := make([]user.ExportedSession, 0, len(keys))
+	for _, key := range keys {
+		parts := strings.Split(strings.TrimPrefix(key, prefix+":"), ":")
+		if len(parts) != 2 {
+			continue
+		}
+		sessions = append(sessions, user.ExportedSession{ID: parts[1], ClientType: parts[0]})
+	}
+	return sessions, nil
+}
+
+func (s *dataExportService) saveJob(ctx context.Context, job *user.DataExportJob) error {
+	if err := s.redisCache.Set(ctx, dataExportJobPrefix, job.UserID, dataExportTTL, job); err != nil {
+		return errors.InternalError("Failed to save data export", err)
+	}
+	return nil
+}
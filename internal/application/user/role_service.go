@@ -0,0 +1,74 @@
+package user
+
+import (
+	"context"
+
+	"github.com/ouz/goboilerplate/internal/domain/audit"
+	"github.com/ouz/goboilerplate/internal/domain/user"
+	"github.com/ouz/goboilerplate/pkg/cache"
+	"github.com/ouz/goboilerplate/pkg/errors"
+	"github.com/ouz/goboilerplate/pkg/log"
+)
+
+type roleService struct {
+	userRepository user.UserRepository
+	redisCache     cache.RedisCacheService
+	auditService   audit.AuditService
+	logger         *log.Logger
+}
+
+func NewRoleService(logger *log.Logger, ur user.UserRepository, rc cache.RedisCacheService, aus audit.AuditService) user.RoleService {
+	return &roleService{
+		userRepository: ur,
+		redisCache:     rc,
+		auditService:   aus,
+		logger:         logger,
+	}
+}
+
+// GrantRole grants the role to the confirmed user with the email. Granting a
+// role the user already has changes nothing, so it can be run repeatedly
+func (s *roleService) GrantRole(ctx context.Context, email string, role user.UserRoleName) (u *user.User, err error) {
+	defer func() {
+		event := audit.Result(audit.ActionGrantRole, err)
+		if u != nil {
+			event.WithTarget(u.ID)
+		} else {
+			event.WithSubject(email)
+		}
+		s.auditService.Record(ctx, event)
+	}()
+
+	found, err := s.userRepository.FindByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, errors.NotFoundError("No confirmed user with this email", nil)
+	}
+
+	u, err = s.userRepository.FindUserWithRoles(ctx, found.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	granted, err := u.GrantRole(role)
+	if err != nil {
+		return u, err
+	}
+	if granted == nil {
+		return u, nil
+	}
+
+	if err := s.userRepository.AddRole(ctx, granted); err != nil {
+		return u, err
+	}
+
+	// Cached users carry their roles, running instances have to reload them
+	if err := s.redisCache.Evict(ctx, userCachePrefix, u.ID); err != nil {
+		return u, errors.InternalError("Role granted but the cached user could not be evicted", err)
+	}
+
+	s.logger.Info("Role granted", "userID", u.ID, "role", role)
+	return u, nil
+}
@@ -2,41 +2,70 @@ package user
 
 import (
 	"context"
-	"fmt"
 	"time"
 
+	"github.com/ouz/goboilerplate/internal/adapters/api/util"
 	"github.com/ouz/goboilerplate/internal/adapters/repo/postgres"
 	authDto "github.com/ouz/goboilerplate/internal/application/auth/dto"
+	"github.com/ouz/goboilerplate/internal/config"
 	"github.com/ouz/goboilerplate/pkg/cache"
 
+	"github.com/ouz/goboilerplate/internal/domain/audit"
+	"github.com/ouz/goboilerplate/internal/domain/auth"
+	"github.com/ouz/goboilerplate/internal/domain/event"
 	"github.com/ouz/goboilerplate/internal/domain/shared"
 	"github.com/ouz/goboilerplate/internal/domain/user"
+	sharedAuth "github.com/ouz/goboilerplate/pkg/auth"
 	"github.com/ouz/goboilerplate/pkg/errors"
 	"github.com/ouz/goboilerplate/pkg/log"
 )
 
 const (
-	userCachePrefix = "user:%s"
+	userCachePrefix = "user"
 	userCacheTTL    = 5 * time.Minute
+	// Unknown and unverified ids are cached briefly so they cannot hammer the database
+	userNegativeCacheTTL = 30 * time.Second
+
+	confirmationSendTimeout = 30 * time.Second
+
+	anonymousPurgeBatchSize = 500
+	accountPurgeBatchSize   = 100
 )
 
 type userService struct {
-	userRepository user.UserRepository
-	redisCache     cache.RedisCacheService
-	tx             postgres.TransactionManager
-	logger         *log.Logger
+	userRepository     user.UserRepository
+	redisCache         cache.RedisCacheService
+	userCache          *cache.CacheAside
+	tx                 postgres.TransactionManager
+	confirmationSender user.ConfirmationSender
+	auditService       audit.AuditService
+	eventPublisher     event.Publisher
+	logger             *log.Logger
 }
 
-func NewUserService(logger *log.Logger, ur user.UserRepository, rc cache.RedisCacheService, tx postgres.TransactionManager) user.UserService {
+func NewUserService(logger *log.Logger, ur user.UserRepository, rc cache.RedisCacheService, tx postgres.TransactionManager, cs user.ConfirmationSender, as audit.AuditService, ep event.Publisher) user.UserService {
 	return &userService{
 		userRepository: ur,
 		redisCache:     rc,
-		tx:             tx,
-		logger:         logger,
+		// No stale-while-revalidate, role changes have to apply as soon as the entry expires
+		userCache: cache.NewCacheAside(logger, rc, cache.CacheAsideOptions{
+			Jitter:      0.1,
+			NegativeTTL: userNegativeCacheTTL,
+		}),
+		tx:                 tx,
+		confirmationSender: cs,
+		auditService:       as,
+		eventPublisher:     ep,
+		logger:             logger,
 	}
 }
 
-func (s *userService) Register(ctx context.Context, request authDto.UserRegisterRequest) error {
+func (s *userService) Register(ctx context.Context, request authDto.UserRegisterRequest) (err error) {
+	var userID string
+	defer func() {
+		s.auditService.Record(ctx, audit.Result(audit.ActionRegister, err).WithActor(userID))
+	}()
+
 	email, err := shared.NewEmail(request.Email)
 	if err != nil {
 		return err
@@ -46,6 +75,7 @@ func (s *userService) Register(ctx context.Context, request authDto.UserRegister
 	if err != nil {
 		return err
 	}
+	user.ClientType = requestClientType(ctx)
 
 	existingUser, err := s.userRepository.FindNotVerifiedUser(ctx, user.Email)
 	if err != nil {
@@ -53,30 +83,77 @@ func (s *userService) Register(ctx context.Context, request authDto.UserRegister
 	}
 
 	if existingUser != nil {
-		return errors.ConflictError("User already exists", nil)
+		return existingUserError(existingUser)
+	}
+
+	if err := s.ensureUsernameAvailable(ctx, user.Username, ""); err != nil {
+		return err
 	}
 
-	if err := s.userRepository.Create(ctx, user); err != nil {
-		return errors.InternalError("Failed to create user", err)
+	err = s.tx.ExecuteInTransaction(ctx, func(ctx context.Context) error {
+		if err := s.userRepository.Create(ctx, user); err != nil {
+			return errors.InternalError("Failed to create user", err)
+		}
+
+		return s.eventPublisher.Publish(ctx, event.UserRegistered{UserID: user.ID, Email: user.Email, Username: user.Username})
+	})
+	if err != nil {
+		return err
 	}
+	userID = user.ID
 
 	s.logger.Info("User registered successfully, verification email will be sent", "userID", user.ID, "email", user.Email)
 	// TODO: Send email to user
 	return nil
 }
 
-func (s *userService) RegisterAnonymousUser(ctx context.Context) (*user.User, error) {
-	user, err := user.NewAnonymousUser()
+func (s *userService) RegisterAnonymousUser(ctx context.Context) (u *user.User, deviceSecret string, err error) {
+	defer func() {
+		event := audit.Result(audit.ActionRegisterAnonymous, err)
+		if u != nil {
+			event.WithActor(u.ID)
+		}
+		s.auditService.Record(ctx, event)
+	}()
+
+	user, deviceSecret, err := user.NewAnonymousUser()
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
+	user.ClientType = requestClientType(ctx)
 
-	if err := s.userRepository.Create(ctx, user); err != nil {
-		return nil, errors.InternalError("Failed to create anonymous user", err)
+	err = s.tx.ExecuteInTransaction(ctx, func(ctx context.Context) error {
+		if err := s.userRepository.Create(ctx, user); err != nil {
+			return errors.InternalError("Failed to create anonymous user", err)
+		}
+
+		return s.eventPublisher.Publish(ctx, event.UserRegistered{UserID: user.ID, Email: user.Email, Anonymous: true})
+	})
+	if err != nil {
+		return nil, "", err
 	}
 
 	s.logger.Info("Anonymous user registered successfully", "user_id", user.ID)
-	return user, nil
+	return user, deviceSecret, nil
+}
+
+// existingUserError tells apart an email held by an account in its deletion grace
+// period, which can still be restored, from one held by an active account
+func existingUserError(existingUser *user.User) error {
+	if existingUser.DeletedAt.Valid {
+		return errors.AccountDeletedError("An account with this email is pending deletion", nil)
+	}
+	return errors.ConflictError("User already exists", nil)
+}
+
+// requestClientType returns the client of the request, users created outside of
+// a client request are not attributed to any client
+func requestClientType(ctx context.Context) sharedAuth.ClientType {
+	client, err := util.GetClient(ctx)
+	if err != nil {
+		return ""
+	}
+	return client.ClientType
 }
 
 func (s *userService) FindByEmail(ctx context.Context, email string) (*user.User, error) {
@@ -88,30 +165,30 @@ func (s *userService) FindByEmail(ctx context.Context, email string) (*user.User
 }
 
 func (s *userService) FindUserWithRoles(ctx context.Context, id string, fromCache bool) (*user.User, error) {
+	var (
+		found *user.User
+		err   error
+	)
 	if fromCache {
-		var user = &user.User{}
-		cacheKey := fmt.Sprintf(userCachePrefix, id)
-		if found, err := s.redisCache.Get(ctx, cacheKey, "", user); err == nil && found {
-			return user, nil
-		}
+		found, err = cache.GetOrLoad(ctx, s.userCache, userCachePrefix, id, userCacheTTL, func(ctx context.Context) (*user.User, error) {
+			return s.userRepository.FindUserWithRoles(ctx, id)
+		})
+	} else {
+		found, err = s.userRepository.FindUserWithRoles(ctx, id)
 	}
-
-	user, err := s.userRepository.FindUserWithRoles(ctx, id)
 	if err != nil {
 		return nil, errors.InternalError("Failed to find user with roles", err)
 	}
 
-	if user != nil && fromCache {
-		cacheKey := fmt.Sprintf(userCachePrefix, id)
-		if err := s.redisCache.Set(ctx, cacheKey, "", userCacheTTL, user); err != nil {
-			s.logger.Error("Failed to cache user", "error", err, "user_id", id)
-		}
-	}
-
-	return user, nil
+	return found, nil
 }
 
-func (s *userService) ConfirmUser(ctx context.Context, confirmation string) error {
+func (s *userService) ConfirmUser(ctx context.Context, confirmation string) (err error) {
+	var userID string
+	defer func() {
+		s.auditService.Record(ctx, audit.Result(audit.ActionConfirm, err).WithActor(userID))
+	}()
+
 	userConfirmation, err := s.userRepository.FindConfirmationByID(ctx, confirmation)
 	if err != nil {
 		return errors.InternalError("Failed to find user confirmation", err)
@@ -124,6 +201,11 @@ func (s *userService) ConfirmUser(ctx context.Context, confirmation string) erro
 	if userConfirmation.User.ID == "" {
 		return errors.InternalError("Invalid user confirmation data", nil)
 	}
+	userID = userConfirmation.User.ID
+
+	if userConfirmation.NewEmail != "" {
+		return s.confirmEmailChange(ctx, userConfirmation)
+	}
 
 	userConfirmation.User.Confirm()
 
@@ -136,11 +218,11 @@ func (s *userService) ConfirmUser(ctx context.Context, confirmation string) erro
 			return errors.InternalError("Failed to confirm user", err)
 		}
 
-		cacheKey := fmt.Sprintf(userCachePrefix, userConfirmation.User.ID)
-		if err := s.redisCache.Evict(ctx, cacheKey, ""); err != nil {
+		if err := s.redisCache.Evict(ctx, userCachePrefix, userConfirmation.User.ID); err != nil {
 			s.logger.Error("Failed to invalidate user cache", "error", err, "userID", userConfirmation.User.ID)
 		}
-		return nil
+
+		return s.eventPublisher.Publish(ctx, event.UserConfirmed{UserID: userConfirmation.User.ID, Email: userConfirmation.User.Email, ClientType: string(userConfirmation.User.ClientType)})
 	})
 
 	if err != nil {
@@ -150,3 +232,356 @@ func (s *userService) ConfirmUser(ctx context.Context, confirmation string) erro
 	s.logger.Info("User confirmed successfully", "userID", userConfirmation.User.ID)
 	return nil
 }
+
+func (s *userService) confirmEmailChange(ctx context.Context, userConfirmation *user.UserConfirmation) error {
+	existingUser, err := s.userRepository.FindNotVerifiedUser(ctx, userConfirmation.NewEmail)
+	if err != nil {
+		return errors.InternalError("Failed to check existing user", err)
+	}
+
+	if existingUser != nil && existingUser.ID != userConfirmation.User.ID {
+		return errors.ConflictError("Email is already in use", nil)
+	}
+
+	previousEmail := userConfirmation.User.Email
+	userConfirmation.User.ChangeEmail(userConfirmation.NewEmail)
+
+	err = s.tx.ExecuteInTransaction(ctx, func(ctx context.Context) error {
+		if err := s.userRepository.DeleteConfirmation(ctx, userConfirmation); err != nil {
+			return errors.InternalError("Failed to delete user confirmation", err)
+		}
+
+		if err := s.userRepository.UpdateAccount(ctx, &userConfirmation.User); err != nil {
+			return err
+		}
+
+		return s.eventPublisher.Publish(ctx, event.EmailChanged{UserID: userConfirmation.User.ID, PreviousEmail: previousEmail, Email: userConfirmation.User.Email})
+	})
+
+	if err != nil {
+		return errors.InternalError("Failed to change user email", err)
+	}
+
+	s.evictUserCache(ctx, userConfirmation.User.ID)
+
+	s.logger.Info("User email changed successfully", "userID", userConfirmation.User.ID)
+	return nil
+}
+
+func (s *userService) UpgradeAnonymousUser(ctx context.Context, userID string, request authDto.UpgradeAnonymousUserRequest) error {
+	email, err := shared.NewEmail(request.Email)
+	if err != nil {
+		return err
+	}
+
+	u, err := s.userRepository.FindByIdWithDetails(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	existingUser, err := s.userRepository.FindNotVerifiedUser(ctx, email.Address)
+	if err != nil {
+		return errors.InternalError("Failed to check existing user", err)
+	}
+
+	if existingUser != nil {
+		return existingUserError(existingUser)
+	}
+
+	if err := s.ensureUsernameAvailable(ctx, request.Username, u.ID); err != nil {
+		return err
+	}
+
+	if err := u.Upgrade(request.Username, request.Password, email); err != nil {
+		return err
+	}
+
+	err = s.tx.ExecuteInTransaction(ctx, func(ctx context.Context) error {
+		if err := s.userRepository.UpdateAccount(ctx, u); err != nil {
+			return err
+		}
+
+		if err := s.userRepository.ReplaceRole(ctx, u.ID, user.UserRoleAnonymous, &u.Roles[0]); err != nil {
+			return err
+		}
+
+		if err := s.userRepository.CreateCredential(ctx, u.LatestCredential()); err != nil {
+			return err
+		}
+
+		if err := s.userRepository.CreateUserConfirmation(ctx, u.LatestConfirmation()); err != nil {
+			return err
+		}
+
+		return s.eventPublisher.Publish(ctx, event.UserUpgraded{UserID: u.ID, Email: u.Email, Username: u.Username})
+	})
+
+	if err != nil {
+		return errors.InternalError("Failed to upgrade anonymous user", err)
+	}
+
+	s.revokeSessions(ctx, u.ID, event.RevocationReasonAccountUpgraded)
+
+	s.logger.Info("Anonymous user upgraded, verification email will be sent", "userID", u.ID, "email", u.Email)
+	s.sendConfirmation(ctx, u.ID, u.Email, u.LatestConfirmation())
+	return nil
+}
+
+func (s *userService) RecordActivity(ctx context.Context, userID string) error {
+	if err := s.userRepository.UpdateLastActive(ctx, userID, time.Now()); err != nil {
+		return errors.InternalError("Failed to record user activity", err)
+	}
+	return nil
+}
+
+func (s *userService) PurgeInactiveAnonymousUsers(ctx context.Context) (int, error) {
+	before := time.Now().Add(-config.Get().Anonymous.InactivityPeriod)
+	purged := 0
+
+	for {
+		ids, err := s.userRepository.FindInactiveAnonymousIDs(ctx, before, anonymousPurgeBatchSize)
+		if err != nil {
+			return purged, err
+		}
+
+		if len(ids) == 0 {
+			break
+		}
+
+		if err := s.userRepository.HardDeleteByIDs(ctx, ids); err != nil {
+			return purged, err
+		}
+
+		for _, id := range ids {
+			s.revokeSessions(ctx, id, event.RevocationReasonAccountPurged)
+		}
+		purged += len(ids)
+
+		if len(ids) < anonymousPurgeBatchSize {
+			break
+		}
+	}
+
+	if purged > 0 {
+		s.logger.Info("Inactive anonymous users purged", "count", purged)
+	}
+	return purged, nil
+}
+
+func (s *userService) UpdateProfile(ctx context.Context, userID string, update user.ProfileUpdate) (*user.User, error) {
+	u, err := s.userRepository.FindByIdWithDetails(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.UpdateProfile(update); err != nil {
+		return nil, err
+	}
+
+	if update.Username != nil {
+		if err := s.ensureUsernameAvailable(ctx, u.Username, u.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.userRepository.UpdateProfile(ctx, u); err != nil {
+		return nil, err
+	}
+
+	s.evictUserCache(ctx, u.ID)
+
+	s.logger.Info("User profile updated", "userID", u.ID)
+	return u, nil
+}
+
+func (s *userService) RequestEmailChange(ctx context.Context, userID, newEmail string) error {
+	email, err := shared.NewEmail(newEmail)
+	if err != nil {
+		return err
+	}
+
+	u, err := s.userRepository.FindByIdWithDetails(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	existingUser, err := s.userRepository.FindNotVerifiedUser(ctx, email.Address)
+	if err != nil {
+		return errors.InternalError("Failed to check existing user", err)
+	}
+
+	if existingUser != nil {
+		return errors.ConflictError("Email is already in use", nil)
+	}
+
+	confirmation, err := u.RequestEmailChange(email)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepository.CreateUserConfirmation(ctx, confirmation); err != nil {
+		return errors.InternalError("Failed to create email change confirmation", err)
+	}
+
+	s.logger.Info("Email change requested, verification email will be sent", "userID", u.ID)
+	// TODO: Send email to the new address
+	return nil
+}
+
+func (s *userService) DeleteAccount(ctx context.Context, userID string) error {
+	u, err := s.userRepository.FindByIdWithDetails(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := u.ScheduleDeletion(config.Get().Account.DeletionGracePeriod); err != nil {
+		return err
+	}
+
+	err = s.tx.ExecuteInTransaction(ctx, func(ctx context.Context) error {
+		if err := s.userRepository.SoftDelete(ctx, u); err != nil {
+			return err
+		}
+
+		return s.eventPublisher.Publish(ctx, event.UserDeleted{UserID: u.ID, ClientType: string(u.ClientType)})
+	})
+	if err != nil {
+		return err
+	}
+
+	s.revokeSessions(ctx, u.ID, event.RevocationReasonAccountDeleted)
+
+	s.logger.Info("User account scheduled for deletion", "userID", u.ID, "purgeAfter", u.PurgeAfter)
+	return nil
+}
+
+func (s *userService) FindPendingDeletionByEmail(ctx context.Context, email string) (*user.User, error) {
+	u, err := s.userRepository.FindDeletedByEmail(ctx, email)
+	if err != nil {
+		return nil, errors.InternalError("Failed to find deleted user by email", err)
+	}
+
+	if u == nil || !u.IsPendingDeletion() {
+		return nil, nil
+	}
+	return u, nil
+}
+
+func (s *userService) RestoreAccount(ctx context.Context, userID string) error {
+	u, err := s.userRepository.FindDeletedById(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := u.Restore(); err != nil {
+		return err
+	}
+
+	if err := s.userRepository.Restore(ctx, u); err != nil {
+		return err
+	}
+
+	s.logger.Info("User account restored", "userID", u.ID)
+	return nil
+}
+
+func (s *userService) PurgeDeletedAccounts(ctx context.Context) (int, error) {
+	purged := 0
+
+	for {
+		ids, err := s.userRepository.FindIDsDueForPurge(ctx, time.Now(), accountPurgeBatchSize)
+		if err != nil {
+			return purged, err
+		}
+
+		for _, id := range ids {
+			if err := s.purgeAccount(ctx, id); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+
+		if len(ids) < accountPurgeBatchSize {
+			break
+		}
+	}
+
+	if purged > 0 {
+		s.logger.Info("Deleted user accounts purged", "count", purged)
+	}
+	return purged, nil
+}
+
+func (s *userService) purgeAccount(ctx context.Context, id string) error {
+	u, err := s.userRepository.FindDeletedById(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	u.Anonymize()
+
+	if err := s.tx.ExecuteInTransaction(ctx, func(ctx context.Context) error {
+		return s.userRepository.Anonymize(ctx, u)
+	}); err != nil {
+		return errors.InternalError("Failed to purge user account", err)
+	}
+
+	s.revokeSessions(ctx, u.ID, event.RevocationReasonAccountPurged)
+	return nil
+}
+
+func (s *userService) ensureUsernameAvailable(ctx context.Context, username, userID string) error {
+	existingUser, err := s.userRepository.FindByUsername(ctx, username)
+	if err != nil {
+		return errors.InternalError("Failed to check existing username", err)
+	}
+
+	if existingUser != nil && existingUser.ID != userID {
+		return errors.ConflictError("Username is already taken", nil)
+	}
+	return nil
+}
+
+func (s *userService) evictUserCache(ctx context.Context, userID string) {
+	if err := s.redisCache.Evict(ctx, userCachePrefix, userID); err != nil {
+		s.logger.Error("Failed to invalidate user cache", "error", err, "userID", userID)
+	}
+}
+
+// revokeSessions drops cached user data and every issued token so the account
+// has to log in again with its new credentials
+func (s *userService) revokeSessions(ctx context.Context, userID string, reason event.RevocationReason) {
+	s.evictUserCache(ctx, userID)
+
+	for _, tokenType := range []sharedAuth.TokenType{sharedAuth.ACCESS_TOKEN, sharedAuth.REFRESH_TOKEN} {
+		if err := s.redisCache.EvictByPrefix(ctx, auth.GeneratePrefix(tokenType, userID, "")); err != nil {
+			s.logger.Error("Failed to revoke user tokens", "error", err, "userID", userID, "tokenType", tokenType)
+		}
+	}
+
+	s.publish(ctx, event.SessionRevoked{UserID: userID, Reason: reason})
+}
+
+// publish records an event for a change that has already happened outside the
+// database, such as revoking tokens, so a failure can only be logged
+func (s *userService) publish(ctx context.Context, e event.Event) {
+	if err := s.eventPublisher.Publish(ctx, e); err != nil {
+		s.logger.Error("Failed to publish domain event", "error", err, "type", e.EventType())
+	}
+}
+
+func (s *userService) sendConfirmation(ctx context.Context, userID, email string, confirmation *user.UserConfirmation) {
+	if confirmation == nil {
+		return
+	}
+
+	// Delivery must not block or fail the request, a new confirmation can be requested later
+	go func(ctx context.Context, email, confirmationID string) {
+		ctx, cancel := context.WithTimeout(ctx, confirmationSendTimeout)
+		defer cancel()
+
+		if err := s.confirmationSender.SendConfirmation(ctx, email, confirmationID); err != nil {
+			s.logger.Error("Failed to send confirmation email", "error", err, "userID", userID)
+		}
+	}(context.WithoutCancel(ctx), email, confirmation.ID)
+}
@@ -0,0 +1,207 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ouz/goboilerplate/internal/adapters/repo/postgres"
+	"github.com/ouz/goboilerplate/internal/config"
+	"github.com/ouz/goboilerplate/internal/domain/event"
+	"github.com/ouz/goboilerplate/internal/domain/webhook"
+	"github.com/ouz/goboilerplate/pkg/auth"
+	"github.com/ouz/goboilerplate/pkg/log"
+	"github.com/ouz/goboilerplate/pkg/stream"
+)
+
+const (
+	webhookConsumerGroup = "webhooks"
+	maxErrorBodyBytes    = 512
+)
+
+type dispatcher struct {
+	webhookRepository webhook.WebhookRepository
+	streamService     stream.StreamService
+	registry          *stream.Registry
+	tx                postgres.TransactionManager
+	httpClient        *http.Client
+	config            config.WebhookConfig
+	logger            *log.Logger
+}
+
+func NewDispatcher(logger *log.Logger, wr webhook.WebhookRepository, ss stream.StreamService, registry *stream.Registry, tx postgres.TransactionManager, cfg config.WebhookConfig) webhook.Dispatcher {
+	return &dispatcher{
+		webhookRepository: wr,
+		streamService:     ss,
+		registry:          registry,
+		tx:                tx,
+		httpClient:        newReceiverClient(cfg),
+		config:            cfg,
+		logger:            logger,
+	}
+}
+
+func (d *dispatcher) retryPolicy() webhook.RetryPolicy {
+	return webhook.RetryPolicy{
+		MaxAttempts:    d.config.MaxAttempts,
+		InitialBackoff: d.config.InitialBackoff,
+		MaxBackoff:     d.config.MaxBackoff,
+	}
+}
+
+func (d *dispatcher) ConsumeEvents(ctx context.Context, consumer string) error {
+	return stream.SubscribeEnvelopes(ctx, d.streamService, d.registry, event.UserEventsStream, webhookConsumerGroup, consumer, d.handleEvent)
+}
+
+func (d *dispatcher) handleEvent(ctx context.Context, envelope stream.Envelope) error {
+	// Events are only delivered to the client the user belongs to
+	clientType, err := eventClientType(envelope)
+	if err != nil || clientType == "" {
+		return err
+	}
+
+	subscriptions, err := d.webhookRepository.FindSubscriptionsForEvent(ctx, clientType, envelope.Type)
+	if err != nil || len(subscriptions) == 0 {
+		return err
+	}
+
+	// Receivers get the envelope at the current version of the event
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	deliveries := make([]webhook.Delivery, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		deliveries = append(deliveries, webhook.NewDelivery(subscription, envelope.ID, envelope.Type, payload))
+	}
+
+	return d.webhookRepository.CreateDeliveries(ctx, deliveries)
+}
+
+// eventClientType returns the client of the user an event is about, or an empty
+// client type for events that are not delivered as webhooks
+func eventClientType(envelope stream.Envelope) (auth.ClientType, error) {
+	switch envelope.Type {
+	case event.TypeUserConfirmed:
+		var confirmed event.UserConfirmed
+		if err := envelope.Decode(&confirmed); err != nil {
+			return "", err
+		}
+		return auth.ClientType(confirmed.ClientType), nil
+	case event.TypeUserDeleted:
+		var deleted event.UserDeleted
+		if err := envelope.Decode(&deleted); err != nil {
+			return "", err
+		}
+		return auth.ClientType(deleted.ClientType), nil
+	}
+	return "", nil
+}
+
+// Dispatch sends every due delivery. A batch is sent sequentially, so it is
+// leased for a request timeout per delivery plus one spare, and a delivery is
+// only sent while the lease outlasts its request. A dispatcher that dies
+// mid-batch only delays the rest
+func (d *dispatcher) Dispatch(ctx context.Context) (int, error) {
+	dispatched := 0
+
+	for {
+		var deliveries []webhook.Delivery
+		now := time.Now()
+		leaseUntil := now.Add(time.Duration(d.config.BatchSize+1) * d.config.Timeout)
+		err := d.tx.ExecuteInTransaction(ctx, func(ctx context.Context) error {
+			claimed, err := d.webhookRepository.ClaimDueDeliveries(ctx, now, leaseUntil, d.config.BatchSize)
+			deliveries = claimed
+			return err
+		})
+		if err != nil {
+			return dispatched, err
+		}
+
+		for i := range deliveries {
+			if time.Until(leaseUntil) < d.config.Timeout {
+				// The rest are claimed again once the lease expires
+				d.logger.Warn("Webhook lease too short for the rest of the batch", "remaining", len(deliveries)-i)
+				return dispatched, nil
+			}
+			if err := d.deliver(ctx, &deliveries[i]); err != nil {
+				return dispatched, err
+			}
+			dispatched++
+		}
+
+		if len(deliveries) < d.config.BatchSize {
+			return dispatched, nil
+		}
+	}
+}
+
+func (d *dispatcher) deliver(ctx context.Context, delivery *webhook.Delivery) error {
+	if delivery.Subscription.ID == "" {
+		delivery.Kill("Subscription was deleted")
+		return d.webhookRepository.UpdateDelivery(ctx, delivery)
+	}
+
+	start := time.Now()
+	statusCode, sendErr := d.send(ctx, delivery)
+	finished := time.Now()
+
+	attempt := &webhook.DeliveryAttempt{
+		DeliveryID: delivery.ID,
+		Attempt:    delivery.Attempts + 1,
+		StatusCode: statusCode,
+		DurationMs: finished.Sub(start).Milliseconds(),
+	}
+
+	if sendErr == nil {
+		delivery.RecordSuccess(statusCode, finished)
+	} else {
+		attempt.Error = sendErr.Error()
+		delivery.RecordFailure(statusCode, sendErr.Error(), d.retryPolicy(), finished)
+		d.logger.Warn("Webhook delivery failed", "delivery_id", delivery.ID, "attempt", attempt.Attempt, "status_code", statusCode, "error", sendErr)
+		if delivery.IsDead() {
+			d.logger.Error("Webhook delivery moved to dead-letter list", "delivery_id", delivery.ID, "subscription_id", delivery.SubscriptionID)
+		}
+	}
+
+	return d.tx.ExecuteInTransaction(ctx, func(ctx context.Context) error {
+		if err := d.webhookRepository.CreateAttempt(ctx, attempt); err != nil {
+			return err
+		}
+		return d.webhookRepository.UpdateDelivery(ctx, delivery)
+	})
+}
+
+func (d *dispatcher) send(ctx context.Context, delivery *webhook.Delivery) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(webhook.HeaderID, delivery.EventID)
+	request.Header.Set(webhook.HeaderEvent, delivery.EventType)
+	request.Header.Set(webhook.HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	request.Header.Set(webhook.HeaderSignature, webhook.Sign(delivery.Subscription.Secret, timestamp, delivery.Payload))
+
+	response, err := d.httpClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBodyBytes))
+		return response.StatusCode, fmt.Errorf("receiver responded with %d: %s", response.StatusCode, bytes.TrimSpace(body))
+	}
+
+	_, _ = io.Copy(io.Discard, response.Body)
+	return response.StatusCode, nil
+}
@@ -0,0 +1,100 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/ouz/goboilerplate/internal/domain/webhook"
+)
+
+type CreateSubscriptionRequest struct {
+	URL        string   `json:"url" validate:"required,url"`
+	EventTypes []string `json:"eventTypes" validate:"required,min=1"`
+}
+
+type SubscriptionResponse struct {
+	ID         string    `json:"id"`
+	ClientType string    `json:"clientType"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"eventTypes"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// CreateSubscriptionResponse is the only response that carries the signing
+// secret, it cannot be read back afterwards
+type CreateSubscriptionResponse struct {
+	SubscriptionResponse
+	Secret string `json:"secret"`
+}
+
+type DeliveryResponse struct {
+	ID             string     `json:"id"`
+	SubscriptionID string     `json:"subscriptionId"`
+	EventID        string     `json:"eventId"`
+	EventType      string     `json:"eventType"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"nextAttemptAt,omitempty"`
+	LastStatusCode int        `json:"lastStatusCode,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+	DeliveredAt    *time.Time `json:"deliveredAt,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+}
+
+type DeliveryAttemptResponse struct {
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"durationMs"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type DeliveryDetailResponse struct {
+	DeliveryResponse
+	Attempts []DeliveryAttemptResponse `json:"attemptLog"`
+}
+
+func NewSubscriptionResponse(s webhook.Subscription) SubscriptionResponse {
+	return SubscriptionResponse{
+		ID:         s.ID,
+		ClientType: string(s.ClientType),
+		URL:        s.URL,
+		EventTypes: s.EventTypes,
+		CreatedAt:  s.CreatedAt,
+	}
+}
+
+func NewDeliveryResponse(d webhook.Delivery) DeliveryResponse {
+	response := DeliveryResponse{
+		ID:             d.ID,
+		SubscriptionID: d.SubscriptionID,
+		EventID:        d.EventID,
+		EventType:      d.EventType,
+		Status:         string(d.Status),
+		Attempts:       d.Attempts,
+		LastStatusCode: d.LastStatusCode,
+		LastError:      d.LastError,
+		DeliveredAt:    d.DeliveredAt,
+		CreatedAt:      d.CreatedAt,
+	}
+	if d.Status == webhook.DeliveryStatusPending {
+		response.NextAttemptAt = &d.NextAttemptAt
+	}
+	return response
+}
+
+func NewDeliveryDetailResponse(d webhook.Delivery, attempts []webhook.DeliveryAttempt) DeliveryDetailResponse {
+	response := DeliveryDetailResponse{
+		DeliveryResponse: NewDeliveryResponse(d),
+		Attempts:         make([]DeliveryAttemptResponse, 0, len(attempts)),
+	}
+	for _, a := range attempts {
+		response.Attempts = append(response.Attempts, DeliveryAttemptResponse{
+			Attempt:    a.Attempt,
+			StatusCode: a.StatusCode,
+			Error:      a.Error,
+			DurationMs: a.DurationMs,
+			CreatedAt:  a.CreatedAt,
+		})
+	}
+	return response
+}
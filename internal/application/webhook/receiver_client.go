@@ -0,0 +1,48 @@
+package webhook
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+
+	"github.com/ouz/goboilerplate/internal/config"
+	"github.com/ouz/goboilerplate/internal/domain/webhook"
+)
+
+// newReceiverClient returns the client deliveries are sent with. Receiver urls
+// are chosen by clients, so every connection is checked after name resolution
+// and refused unless it goes to a public address. Proxies would hide the
+// address and redirects are not followed, a redirect counts as a failed attempt
+func newReceiverClient(cfg config.WebhookConfig) *http.Client {
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivateNetworks {
+		dialer.Control = rejectPrivateAddr
+	}
+
+	return &http.Client{
+		Timeout: cfg.Timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: cfg.Timeout,
+			MaxIdleConnsPerHost: 2,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func rejectPrivateAddr(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !webhook.IsPublicAddr(addrPort.Addr()) {
+		return fmt.Errorf("webhook receiver address %s is not public", addrPort.Addr())
+	}
+	return nil
+}
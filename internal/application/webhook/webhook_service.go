@@ -0,0 +1,100 @@
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/ouz/goboilerplate/internal/domain/auth"
+	"github.com/ouz/goboilerplate/internal/domain/shared"
+	"github.com/ouz/goboilerplate/internal/domain/webhook"
+	sharedAuth "github.com/ouz/goboilerplate/pkg/auth"
+	"github.com/ouz/goboilerplate/pkg/errors"
+	"github.com/ouz/goboilerplate/pkg/log"
+)
+
+type webhookService struct {
+	webhookRepository webhook.WebhookRepository
+	authRepository    auth.AuthRepository
+	logger            *log.Logger
+}
+
+func NewWebhookService(logger *log.Logger, wr webhook.WebhookRepository, ar auth.AuthRepository) webhook.WebhookService {
+	return &webhookService{
+		webhookRepository: wr,
+		authRepository:    ar,
+		logger:            logger,
+	}
+}
+
+func (s *webhookService) CreateSubscription(ctx context.Context, clientType sharedAuth.ClientType, url string, eventTypes []string) (*webhook.Subscription, error) {
+	if _, err := s.authRepository.FindClientByType(ctx, clientType); err != nil {
+		return nil, err
+	}
+
+	subscription, err := webhook.NewSubscription(clientType, url, eventTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.webhookRepository.CreateSubscription(ctx, subscription); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Webhook subscription created", "subscription_id", subscription.ID, "client_type", clientType, "event_types", subscription.EventTypes)
+	return subscription, nil
+}
+
+func (s *webhookService) ListSubscriptions(ctx context.Context, clientType sharedAuth.ClientType) ([]webhook.Subscription, error) {
+	return s.webhookRepository.FindSubscriptions(ctx, clientType)
+}
+
+func (s *webhookService) DeleteSubscription(ctx context.Context, clientType sharedAuth.ClientType, id string) error {
+	subscription, err := s.webhookRepository.FindSubscription(ctx, clientType, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.webhookRepository.DeleteSubscription(ctx, subscription); err != nil {
+		return err
+	}
+
+	s.logger.Info("Webhook subscription deleted", "subscription_id", id, "client_type", clientType)
+	return nil
+}
+
+func (s *webhookService) ListDeliveries(ctx context.Context, filter webhook.DeliveryFilter, pagination *shared.Pagination[webhook.Delivery]) error {
+	return s.webhookRepository.FindDeliveries(ctx, filter, pagination)
+}
+
+func (s *webhookService) GetDelivery(ctx context.Context, clientType sharedAuth.ClientType, id string) (*webhook.Delivery, []webhook.DeliveryAttempt, error) {
+	delivery, err := s.webhookRepository.FindDelivery(ctx, clientType, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	attempts, err := s.webhookRepository.FindAttempts(ctx, delivery.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return delivery, attempts, nil
+}
+
+func (s *webhookService) RetryDelivery(ctx context.Context, clientType sharedAuth.ClientType, id string) error {
+	delivery, err := s.webhookRepository.FindDelivery(ctx, clientType, id)
+	if err != nil {
+		return err
+	}
+
+	if !delivery.IsDead() {
+		return errors.ConflictError("Only dead-lettered deliveries can be retried", nil)
+	}
+
+	delivery.Requeue(time.Now())
+	if err := s.webhookRepository.UpdateDelivery(ctx, delivery); err != nil {
+		return err
+	}
+
+	s.logger.Info("Webhook delivery requeued", "delivery_id", id, "client_type", clientType)
+	return nil
+}
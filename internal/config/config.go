@@ -2,8 +2,12 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/netip"
 	"time"
 
+	"github.com/ouz/goboilerplate/pkg/cache"
+	redisCache "github.com/ouz/goboilerplate/pkg/cache/redis"
 	pkgconfig "github.com/ouz/goboilerplate/pkg/config"
 	"github.com/ouz/goboilerplate/pkg/errors"
 )
@@ -19,13 +23,21 @@ const (
 
 // Config holds all configuration for the application
 type Config struct {
-	App      AppConfig      `mapstructure:"app"`
-	Postgres PostgresConfig `mapstructure:"postgres"`
-	Valkey   ValkeyConfig   `mapstructure:"valkey"`
-	JWT      JWTConfig      `mapstructure:"jwt"`
-	Mail     MailConfig     `mapstructure:"mail"`
-	Cache    CacheConfig    `mapstructure:"cache"`
-	Otel     OtelConfig     `mapstructure:"otel"`
+	App       AppConfig       `mapstructure:"app"`
+	Postgres  PostgresConfig  `mapstructure:"postgres"`
+	Valkey    ValkeyConfig    `mapstructure:"valkey"`
+	JWT       JWTConfig       `mapstructure:"jwt"`
+	Mail      MailConfig      `mapstructure:"mail"`
+	Cache     CacheConfig     `mapstructure:"cache"`
+	Otel      OtelConfig      `mapstructure:"otel"`
+	Policy    PolicyConfig    `mapstructure:"policy"`
+	Anonymous AnonymousConfig `mapstructure:"anonymous"`
+	Account   AccountConfig   `mapstructure:"account"`
+	Audit     AuditConfig     `mapstructure:"audit"`
+	Outbox    OutboxConfig    `mapstructure:"outbox"`
+	Webhook   WebhookConfig   `mapstructure:"webhook"`
+	Stream    StreamConfig    `mapstructure:"stream"`
+	RateLimit RateLimitConfig `mapstructure:"rateLimit"`
 }
 
 type AppConfig struct {
@@ -33,6 +45,27 @@ type AppConfig struct {
 	V1Prefix    string `mapstructure:"v1Prefix"`
 	Environment string `mapstructure:"environment"`
 	LogLevel    string `mapstructure:"logLevel"`
+	BaseURL     string `mapstructure:"baseURL"`
+	// TrustedProxies are the IPs or CIDRs of the load balancers, the client IP is
+	// only taken from X-Forwarded-For or X-Real-IP when the peer is one of them
+	TrustedProxies []string `mapstructure:"trustedProxies"`
+}
+
+// TrustedProxyPrefixes parses TrustedProxies, a single IP is a prefix of its full length
+func (c AppConfig) TrustedProxyPrefixes() ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(c.TrustedProxies))
+	for _, proxy := range c.TrustedProxies {
+		if addr, err := netip.ParseAddr(proxy); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
 }
 
 type PostgresConfig struct {
@@ -49,8 +82,45 @@ type PostgresConfig struct {
 }
 
 type ValkeyConfig struct {
+	// Mode is standalone, sentinel or cluster
+	Mode string `mapstructure:"mode"`
 	Host string `mapstructure:"host"`
 	Port string `mapstructure:"port"`
+	// Addrs are the sentinel or cluster node addresses, standalone mode uses Host and Port when empty
+	Addrs            []string        `mapstructure:"addrs"`
+	MasterName       string          `mapstructure:"masterName"`
+	Username         string          `mapstructure:"username"`
+	Password         string          `mapstructure:"password"`
+	SentinelUsername string          `mapstructure:"sentinelUsername"`
+	SentinelPassword string          `mapstructure:"sentinelPassword"`
+	DB               int             `mapstructure:"db"`
+	PoolSize         int             `mapstructure:"poolSize"`
+	DialTimeout      time.Duration   `mapstructure:"dialTimeout"`
+	ReadTimeout      time.Duration   `mapstructure:"readTimeout"`
+	WriteTimeout     time.Duration   `mapstructure:"writeTimeout"`
+	TLS              ValkeyTLSConfig `mapstructure:"tls"`
+	// RequiredOnStartup refuses to start while Valkey is down instead of starting degraded
+	RequiredOnStartup bool `mapstructure:"requiredOnStartup"`
+}
+
+type ValkeyTLSConfig struct {
+	Enabled            bool   `mapstructure:"enabled"`
+	CAFile             string `mapstructure:"caFile"`
+	CertFile           string `mapstructure:"certFile"`
+	KeyFile            string `mapstructure:"keyFile"`
+	ServerName         string `mapstructure:"serverName"`
+	InsecureSkipVerify bool   `mapstructure:"insecureSkipVerify"`
+}
+
+// Addresses returns the configured addresses, falling back to Host and Port
+func (c ValkeyConfig) Addresses() []string {
+	if len(c.Addrs) > 0 {
+		return c.Addrs
+	}
+	if c.Host == "" || c.Port == "" {
+		return nil
+	}
+	return []string{net.JoinHostPort(c.Host, c.Port)}
 }
 
 type JWTConfig struct {
@@ -59,15 +129,33 @@ type JWTConfig struct {
 	RefreshExpiration time.Duration `mapstructure:"refreshExpiration"`
 }
 
+// MailConfig configures the SMTP server, emails are only sent when Enabled
 type MailConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
 	Host     string `mapstructure:"host"`
 	Port     int    `mapstructure:"port"`
 	Username string `mapstructure:"username"`
 	Password string `mapstructure:"password"`
+	From     string `mapstructure:"from"`
 }
 
 type CacheConfig struct {
-	SizeMB int `mapstructure:"sizeMB"`
+	SizeMB        int           `mapstructure:"sizeMB"`
+	LocalTTL      time.Duration `mapstructure:"localTTL"`
+	LocalPrefixes []string      `mapstructure:"localPrefixes"`
+	// Codec is json, msgpack or gob. Values keep their own format marker, so it can be changed without a flush
+	Codec                string                `mapstructure:"codec"`
+	Compression          string                `mapstructure:"compression"`
+	CompressionThreshold int                   `mapstructure:"compressionThreshold"`
+	Resilience           CacheResilienceConfig `mapstructure:"resilience"`
+}
+
+type CacheResilienceConfig struct {
+	Timeout          time.Duration `mapstructure:"timeout"`
+	FailureThreshold int           `mapstructure:"failureThreshold"`
+	OpenDuration     time.Duration `mapstructure:"openDuration"`
+	// FailOpenPrefixes degrade to cache misses while Valkey is down, all other prefixes fail closed
+	FailOpenPrefixes []string `mapstructure:"failOpenPrefixes"`
 }
 
 type OtelConfig struct {
@@ -76,6 +164,80 @@ type OtelConfig struct {
 	MonitoringEnabled bool   `mapstructure:"monitoringEnabled"`
 }
 
+type PolicyConfig struct {
+	File string `mapstructure:"file"`
+}
+
+type AnonymousConfig struct {
+	InactivityPeriod time.Duration `mapstructure:"inactivityPeriod"`
+	PurgeInterval    time.Duration `mapstructure:"purgeInterval"`
+}
+
+type AccountConfig struct {
+	DeletionGracePeriod time.Duration `mapstructure:"deletionGracePeriod"`
+	PurgeInterval       time.Duration `mapstructure:"purgeInterval"`
+}
+
+type OutboxConfig struct {
+	RelayInterval time.Duration `mapstructure:"relayInterval"`
+	BatchSize     int           `mapstructure:"batchSize"`
+	// LeaseDuration bounds how long a relay may take to publish a batch before
+	// another relay claims its unpublished messages
+	LeaseDuration time.Duration `mapstructure:"leaseDuration"`
+	// MaxAttempts is the number of failed publishes after which a message is parked
+	MaxAttempts   int           `mapstructure:"maxAttempts"`
+	Retention     time.Duration `mapstructure:"retention"`
+	PurgeInterval time.Duration `mapstructure:"purgeInterval"`
+}
+
+type WebhookConfig struct {
+	Timeout          time.Duration `mapstructure:"timeout"`
+	MaxAttempts      int           `mapstructure:"maxAttempts"`
+	InitialBackoff   time.Duration `mapstructure:"initialBackoff"`
+	MaxBackoff       time.Duration `mapstructure:"maxBackoff"`
+	DispatchInterval time.Duration `mapstructure:"dispatchInterval"`
+	BatchSize        int           `mapstructure:"batchSize"`
+	// AllowPrivateNetworks lets deliveries reach private and loopback addresses,
+	// only for local development against receivers on the same network
+	AllowPrivateNetworks bool `mapstructure:"allowPrivateNetworks"`
+}
+
+const (
+	StreamDriverRedis  = "redis"
+	StreamDriverMemory = "memory"
+)
+
+type StreamConfig struct {
+	Driver         string        `mapstructure:"driver"`
+	BatchSize      int64         `mapstructure:"batchSize"`
+	Concurrency    int           `mapstructure:"concurrency"`
+	HandlerTimeout time.Duration `mapstructure:"handlerTimeout"`
+	MaxDeliveries  int64         `mapstructure:"maxDeliveries"`
+	RetryBackoff   time.Duration `mapstructure:"retryBackoff"`
+	ClaimInterval  time.Duration `mapstructure:"claimInterval"`
+	Retention      time.Duration `mapstructure:"retention"`
+}
+
+const (
+	RateLimitDriverRedis  = "redis"
+	RateLimitDriverMemory = "memory"
+)
+
+// RateLimitConfig limits the requests of each client IP to Rate per second with
+// bursts of up to Burst
+type RateLimitConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	Driver  string        `mapstructure:"driver"`
+	Rate    float64       `mapstructure:"rate"`
+	Burst   float64       `mapstructure:"burst"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+type AuditConfig struct {
+	Retention     time.Duration `mapstructure:"retention"`
+	PurgeInterval time.Duration `mapstructure:"purgeInterval"`
+}
+
 var conf *Config
 
 // Load loads the configuration from yaml files and environment variables
@@ -107,15 +269,15 @@ func validate(c *Config) error {
 	}{
 		{c.App.Port, "app.port"},
 		{c.App.V1Prefix, "app.v1Prefix"},
+		{c.App.BaseURL, "app.baseURL"},
 		{c.Postgres.Host, "postgres.host"},
 		{c.Postgres.User, "postgres.user"},
 		{c.Postgres.Name, "postgres.name"},
 		{c.Postgres.Port, "postgres.port"},
-		{c.Valkey.Host, "valkey.host"},
-		{c.Valkey.Port, "valkey.port"},
 		{c.JWT.Secret, "jwt.secret"},
 		{c.Otel.ServiceName, "otel.serviceName"},
 		{c.Otel.ExporterEndpoint, "otel.exporterEndpoint"},
+		{c.Policy.File, "policy.file"},
 	}
 
 	for _, check := range checks {
@@ -124,6 +286,10 @@ func validate(c *Config) error {
 		}
 	}
 
+	if _, err := c.App.TrustedProxyPrefixes(); err != nil {
+		return errors.ValidationError("app.trustedProxies must contain IPs or CIDRs", err)
+	}
+
 	// JWT secret length validation
 	if len(c.JWT.Secret) < minJWTSecretLength {
 		return errors.ValidationError(
@@ -141,6 +307,107 @@ func validate(c *Config) error {
 		return errors.ValidationError("jwt.refreshExpiration must be greater than 0", nil)
 	}
 
+	if c.Anonymous.InactivityPeriod <= 0 {
+		return errors.ValidationError("anonymous.inactivityPeriod must be greater than 0", nil)
+	}
+
+	if c.Anonymous.PurgeInterval <= 0 {
+		return errors.ValidationError("anonymous.purgeInterval must be greater than 0", nil)
+	}
+
+	if c.Account.DeletionGracePeriod <= 0 {
+		return errors.ValidationError("account.deletionGracePeriod must be greater than 0", nil)
+	}
+
+	if c.Account.PurgeInterval <= 0 {
+		return errors.ValidationError("account.purgeInterval must be greater than 0", nil)
+	}
+
+	if c.Audit.Retention <= 0 {
+		return errors.ValidationError("audit.retention must be greater than 0", nil)
+	}
+
+	if c.Audit.PurgeInterval <= 0 {
+		return errors.ValidationError("audit.purgeInterval must be greater than 0", nil)
+	}
+
+	if c.Outbox.RelayInterval <= 0 {
+		return errors.ValidationError("outbox.relayInterval must be greater than 0", nil)
+	}
+
+	if c.Outbox.BatchSize <= 0 {
+		return errors.ValidationError("outbox.batchSize must be greater than 0", nil)
+	}
+
+	if c.Outbox.LeaseDuration <= 0 || c.Outbox.MaxAttempts <= 0 {
+		return errors.ValidationError("outbox.leaseDuration and outbox.maxAttempts must be greater than 0", nil)
+	}
+
+	if c.Outbox.Retention <= 0 {
+		return errors.ValidationError("outbox.retention must be greater than 0", nil)
+	}
+
+	if c.Outbox.PurgeInterval <= 0 {
+		return errors.ValidationError("outbox.purgeInterval must be greater than 0", nil)
+	}
+
+	if c.Webhook.Timeout <= 0 || c.Webhook.DispatchInterval <= 0 {
+		return errors.ValidationError("webhook.timeout and webhook.dispatchInterval must be greater than 0", nil)
+	}
+
+	if c.Webhook.MaxAttempts <= 0 || c.Webhook.BatchSize <= 0 {
+		return errors.ValidationError("webhook.maxAttempts and webhook.batchSize must be greater than 0", nil)
+	}
+
+	if c.Webhook.InitialBackoff <= 0 || c.Webhook.MaxBackoff < c.Webhook.InitialBackoff {
+		return errors.ValidationError("webhook.initialBackoff must be greater than 0 and not exceed webhook.maxBackoff", nil)
+	}
+
+	if c.Stream.Driver != StreamDriverRedis && c.Stream.Driver != StreamDriverMemory {
+		return errors.ValidationError(fmt.Sprintf("stream.driver must be %q or %q", StreamDriverRedis, StreamDriverMemory), nil)
+	}
+
+	if c.Stream.BatchSize <= 0 || c.Stream.MaxDeliveries <= 0 {
+		return errors.ValidationError("stream.batchSize and stream.maxDeliveries must be greater than 0", nil)
+	}
+
+	if c.Stream.RetryBackoff <= 0 || c.Stream.ClaimInterval <= 0 {
+		return errors.ValidationError("stream.retryBackoff and stream.claimInterval must be greater than 0", nil)
+	}
+
+	if c.Stream.Concurrency <= 0 || c.Stream.HandlerTimeout <= 0 {
+		return errors.ValidationError("stream.concurrency and stream.handlerTimeout must be greater than 0", nil)
+	}
+
+	if c.Stream.Retention < 0 {
+		return errors.ValidationError("stream.retention must not be negative", nil)
+	}
+
+	// A message still being handled must not be reclaimed by another consumer
+	if c.Stream.RetryBackoff <= c.Stream.HandlerTimeout {
+		return errors.ValidationError("stream.retryBackoff must be greater than stream.handlerTimeout", nil)
+	}
+
+	if c.RateLimit.Driver != RateLimitDriverRedis && c.RateLimit.Driver != RateLimitDriverMemory {
+		return errors.ValidationError(fmt.Sprintf("rateLimit.driver must be %q or %q", RateLimitDriverRedis, RateLimitDriverMemory), nil)
+	}
+
+	if c.RateLimit.Enabled && (c.RateLimit.Rate <= 0 || c.RateLimit.Burst < 1 || c.RateLimit.Timeout <= 0) {
+		return errors.ValidationError("rateLimit.rate and rateLimit.timeout must be greater than 0 and rateLimit.burst at least 1", nil)
+	}
+
+	if err := redisCache.ValidateMode(c.Valkey.Mode, c.Valkey.Addresses(), c.Valkey.MasterName, c.Valkey.DB); err != nil {
+		return err
+	}
+
+	if c.Valkey.TLS.CertFile != "" && c.Valkey.TLS.KeyFile == "" || c.Valkey.TLS.CertFile == "" && c.Valkey.TLS.KeyFile != "" {
+		return errors.ValidationError("valkey.tls.certFile and valkey.tls.keyFile must be set together", nil)
+	}
+
+	if c.Valkey.DB < 0 || c.Valkey.PoolSize < 0 {
+		return errors.ValidationError("valkey.db and valkey.poolSize must not be negative", nil)
+	}
+
 	// Cache size validation
 	if c.Cache.SizeMB < minCacheSizeMB || c.Cache.SizeMB > maxCacheSizeMB {
 		return errors.ValidationError(
@@ -149,6 +416,31 @@ func validate(c *Config) error {
 		)
 	}
 
+	// The local cache stores TTLs in whole seconds
+	if c.Cache.LocalTTL < time.Second {
+		return errors.ValidationError("cache.localTTL must be at least 1s", nil)
+	}
+
+	if _, err := cache.CodecByName(c.Cache.Codec); err != nil {
+		return err
+	}
+
+	if _, err := cache.CompressionByName(c.Cache.Compression); err != nil {
+		return err
+	}
+
+	if c.Cache.CompressionThreshold < 0 {
+		return errors.ValidationError("cache.compressionThreshold must not be negative", nil)
+	}
+
+	if c.Cache.Resilience.Timeout <= 0 || c.Cache.Resilience.OpenDuration <= 0 {
+		return errors.ValidationError("cache.resilience.timeout and cache.resilience.openDuration must be greater than 0", nil)
+	}
+
+	if c.Cache.Resilience.FailureThreshold <= 0 {
+		return errors.ValidationError("cache.resilience.failureThreshold must be greater than 0", nil)
+	}
+
 	// Database connection pool validation
 	if c.Postgres.MaxOpenConns < minDBConnections || c.Postgres.MaxOpenConns > maxDBConnections {
 		return errors.ValidationError(
@@ -0,0 +1,118 @@
+package audit
+
+import (
+	errs "errors"
+	"time"
+
+	"github.com/ouz/goboilerplate/pkg/errors"
+)
+
+type Action string
+
+const (
+	ActionLogin             Action = "LOGIN"
+	ActionAnonymousLogin    Action = "ANONYMOUS_LOGIN"
+	ActionTokenRefresh      Action = "TOKEN_REFRESH"
+	ActionLogout            Action = "LOGOUT"
+	ActionLogoutAll         Action = "LOGOUT_ALL"
+	ActionRegister          Action = "REGISTER"
+	ActionRegisterAnonymous Action = "REGISTER_ANONYMOUS"
+	ActionConfirm           Action = "CONFIRM"
+	ActionAccountRestore    Action = "ACCOUNT_RESTORE"
+
+	ActionAdminEnableUser  Action = "ADMIN_ENABLE_USER"
+	ActionAdminDisableUser Action = "ADMIN_DISABLE_USER"
+	ActionAdminVerifyUser  Action = "ADMIN_VERIFY_USER"
+	ActionAdminLogoutUser  Action = "ADMIN_LOGOUT_USER"
+	ActionAdminDeleteUser  Action = "ADMIN_DELETE_USER"
+	ActionGrantRole        Action = "GRANT_ROLE"
+	ActionCacheEvict       Action = "CACHE_EVICT"
+	ActionCacheEvictPrefix Action = "CACHE_EVICT_PREFIX"
+)
+
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "SUCCESS"
+	OutcomeFailure Outcome = "FAILURE"
+)
+
+// Event is an append-only record of a security relevant action. Rows are never
+// updated, only removed once they fall out of the retention window.
+type Event struct {
+	ID         string    `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	ActorID    string    `gorm:"default:null"`
+	Action     Action    `gorm:"not null"`
+	TargetID   string    `gorm:"default:null"`
+	Subject    string    `gorm:"default:null"`
+	ClientType string    `gorm:"default:null"`
+	IP         string    `gorm:"column:ip;default:null"`
+	UserAgent  string    `gorm:"default:null"`
+	TraceID    string    `gorm:"default:null"`
+	Outcome    Outcome   `gorm:"not null"`
+	Reason     string    `gorm:"default:null"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+}
+
+func NewEvent(action Action, outcome Outcome) *Event {
+	return &Event{
+		Action:  action,
+		Outcome: outcome,
+	}
+}
+
+func Success(action Action) *Event {
+	return NewEvent(action, OutcomeSuccess)
+}
+
+// Failure records a failed action, the reason is kept short and must never
+// contain secrets such as the submitted password
+func Failure(action Action, reason string) *Event {
+	return NewEvent(action, OutcomeFailure).WithReason(reason)
+}
+
+// Result records the outcome of an action from the error it returned, only the
+// client facing message of the error is kept as the reason
+func Result(action Action, err error) *Event {
+	if err == nil {
+		return Success(action)
+	}
+
+	var appErr *errors.AppError
+	if errs.As(err, &appErr) {
+		return Failure(action, appErr.Message)
+	}
+	return Failure(action, "Unexpected error")
+}
+
+func (e *Event) WithActor(actorID string) *Event {
+	e.ActorID = actorID
+	return e
+}
+
+func (e *Event) WithTarget(targetID string) *Event {
+	e.TargetID = targetID
+	return e
+}
+
+// WithSubject names a target that is not a user, such as the email of a failed
+// login or an evicted cache key
+func (e *Event) WithSubject(subject string) *Event {
+	e.Subject = subject
+	return e
+}
+
+func (e *Event) WithReason(reason string) *Event {
+	e.Reason = reason
+	return e
+}
+
+type Filter struct {
+	ActorID  string
+	TargetID string
+	Subject  string
+	Action   Action
+	Outcome  Outcome
+	From     *time.Time
+	To       *time.Time
+}
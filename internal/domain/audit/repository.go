@@ -0,0 +1,15 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/ouz/goboilerplate/internal/domain/shared"
+)
+
+type AuditRepository interface {
+	Create(ctx context.Context, event *Event) error
+	FindAll(ctx context.Context, filter Filter, pagination *shared.Pagination[Event]) error
+	FindByUser(ctx context.Context, userID string) ([]Event, error)
+	DeleteBefore(ctx context.Context, before time.Time, limit int) (int64, error)
+}
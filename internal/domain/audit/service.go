@@ -0,0 +1,13 @@
+package audit
+
+import (
+	"context"
+
+	"github.com/ouz/goboilerplate/internal/domain/shared"
+)
+
+type AuditService interface {
+	Record(ctx context.Context, event *Event)
+	ListEvents(ctx context.Context, filter Filter, pagination *shared.Pagination[Event]) error
+	PurgeExpired(ctx context.Context) (int64, error)
+}
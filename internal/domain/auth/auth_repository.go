@@ -2,8 +2,11 @@ package auth
 
 import (
 	"context"
+
+	"github.com/ouz/goboilerplate/pkg/auth"
 )
 
 type AuthRepository interface {
 	FindClientBySecret(ctx context.Context, secret string) (*Client, error)
+	FindClientByType(ctx context.Context, clientType auth.ClientType) (*Client, error)
 }
@@ -11,7 +11,8 @@ type AuthService interface {
 	RefreshAccessToken(ctx context.Context, refreshToken string) (TokenPair, error)
 	ValidateToken(ctx context.Context, token string) (*Token, error)
 	Login(ctx context.Context, email, password string) (TokenPair, error)
-	LoginAnonymous(ctx context.Context, email string) (TokenPair, error)
+	RestoreAccount(ctx context.Context, email, password string) (TokenPair, error)
+	LoginAnonymous(ctx context.Context, email, deviceSecret string) (TokenPair, error)
 	Logout(ctx context.Context, userID string) error
 	LogoutAll(ctx context.Context, userID string) error
 	ValidateTokenAndGetUser(ctx context.Context, token string) (user.User, error)
@@ -135,17 +135,15 @@ func (t *Token) IsExpired() bool {
 }
 
 func (t *Token) GetPrefix() string {
-	if t.TokenType == auth.ACCESS_TOKEN {
-		return fmt.Sprintf("uat:%s:%s", t.UserId, string(t.ClientType))
+	if t.TokenType != auth.ACCESS_TOKEN && t.TokenType != auth.REFRESH_TOKEN {
+		return ""
 	}
-
-	if t.TokenType == auth.REFRESH_TOKEN {
-		return fmt.Sprintf("urt:%s:%s", t.UserId, string(t.ClientType))
-	}
-
-	return ""
+	return GeneratePrefix(t.TokenType, t.UserId, t.ClientType)
 }
 
+// GeneratePrefix returns the cache prefix of the tokens of a user, of one client
+// or of every client when clientType is empty. The user id is a hash tag, so all
+// tokens of a user share a Cluster slot and a token pair is written atomically
 func GeneratePrefix(tokenType auth.TokenType, userID string, clientType auth.ClientType) string {
 	prefix := "uat"
 	if tokenType == auth.REFRESH_TOKEN {
@@ -153,8 +151,8 @@ func GeneratePrefix(tokenType auth.TokenType, userID string, clientType auth.Cli
 	}
 
 	if clientType == "" {
-		return fmt.Sprintf("%s:%s", prefix, userID)
+		return fmt.Sprintf("%s:{%s}", prefix, userID)
 	}
 
-	return fmt.Sprintf("%s:%s:%s", prefix, userID, string(clientType))
+	return fmt.Sprintf("%s:{%s}:%s", prefix, userID, string(clientType))
 }
@@ -0,0 +1,15 @@
+package event
+
+import "context"
+
+// UserEventsStream is the stream other services subscribe to for user lifecycle events
+const UserEventsStream = "user-events"
+
+type Event interface {
+	EventType() string
+	EventVersion() int
+}
+
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
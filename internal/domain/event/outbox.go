@@ -0,0 +1,54 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// OutboxMessage is an event waiting to be relayed to a stream. It is written in
+// the same transaction as the change it describes, so an event exists if and
+// only if that change was committed. The id doubles as the idempotency key
+// consumers use to drop redeliveries.
+type OutboxMessage struct {
+	ID          string          `gorm:"primaryKey;type:uuid"`
+	Stream      string          `gorm:"not null"`
+	EventType   string          `gorm:"not null"`
+	Payload     json.RawMessage `gorm:"type:jsonb;not null"`
+	Attempts    int             `gorm:"not null;default:0"`
+	LastError   string          `gorm:"default:null"`
+	CreatedAt   time.Time       `gorm:"autoCreateTime"`
+	PublishedAt *time.Time      `gorm:"default:null"`
+	// ClaimedUntil is the lease of the relay publishing the message
+	ClaimedUntil *time.Time `gorm:"default:null"`
+	// ParkedAt is set once the message failed too often, it is no longer relayed
+	ParkedAt *time.Time `gorm:"default:null"`
+}
+
+func (OutboxMessage) TableName() string {
+	return "outbox"
+}
+
+func (m *OutboxMessage) IsPublished() bool {
+	return m.PublishedAt != nil
+}
+
+type OutboxRepository interface {
+	Create(ctx context.Context, message *OutboxMessage) error
+	// ClaimUnpublished leases the oldest unpublished messages until leaseUntil,
+	// concurrent relays skip them instead of publishing them twice
+	ClaimUnpublished(ctx context.Context, now, leaseUntil time.Time, limit int) ([]OutboxMessage, error)
+	MarkPublished(ctx context.Context, ids []string, at time.Time) error
+	// MarkFailed counts a failed attempt and releases the message for a retry
+	MarkFailed(ctx context.Context, id string, reason string) error
+	// Park counts a failed attempt and stops relaying the message
+	Park(ctx context.Context, id string, reason string, at time.Time) error
+	// Release gives up the lease of messages that were not published
+	Release(ctx context.Context, ids []string) error
+	DeletePublishedBefore(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+type OutboxRelay interface {
+	Relay(ctx context.Context) (int, error)
+	PurgePublished(ctx context.Context) (int64, error)
+}
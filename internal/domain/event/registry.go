@@ -0,0 +1,39 @@
+package event
+
+import (
+	"encoding/json"
+
+	"github.com/ouz/goboilerplate/pkg/stream"
+)
+
+// NewRegistry returns the schema registry of the events published to UserEventsStream.
+// Upcasters for older versions are registered here when a payload changes
+func NewRegistry() *stream.Registry {
+	registry := stream.NewRegistry()
+	stream.MustRegister[UserRegistered](registry)
+	stream.MustRegister[UserConfirmed](registry)
+	stream.MustRegister[UserLoggedIn](registry)
+	stream.MustRegister[SessionRevoked](registry)
+	stream.MustRegister[UserDeleted](registry)
+	stream.MustRegister[UserUpgraded](registry)
+	stream.MustRegister[EmailChanged](registry)
+
+	if err := registry.RegisterUpcaster(TypeUserDeleted, 1, withoutFields("email")); err != nil {
+		panic(err)
+	}
+	return registry
+}
+
+// withoutFields upcasts by removing fields that the next version dropped
+func withoutFields(fields ...string) stream.Upcaster {
+	return func(data json.RawMessage) (json.RawMessage, error) {
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(data, &values); err != nil {
+			return nil, err
+		}
+		for _, field := range fields {
+			delete(values, field)
+		}
+		return json.Marshal(values)
+	}
+}
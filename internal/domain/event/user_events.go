@@ -0,0 +1,101 @@
+package event
+
+const (
+	TypeUserRegistered = "user.registered"
+	TypeUserConfirmed  = "user.confirmed"
+	TypeUserLoggedIn   = "user.logged_in"
+	TypeSessionRevoked = "user.session_revoked"
+	TypeUserDeleted    = "user.deleted"
+	TypeUserUpgraded   = "user.upgraded"
+	TypeEmailChanged   = "user.email_changed"
+)
+
+type LoginMethod string
+
+const (
+	LoginMethodPassword     LoginMethod = "PASSWORD"
+	LoginMethodDeviceSecret LoginMethod = "DEVICE_SECRET"
+	LoginMethodRestore      LoginMethod = "RESTORE"
+)
+
+type RevocationReason string
+
+const (
+	RevocationReasonLogout          RevocationReason = "LOGOUT"
+	RevocationReasonLogoutAll       RevocationReason = "LOGOUT_ALL"
+	RevocationReasonAccountUpgraded RevocationReason = "ACCOUNT_UPGRADED"
+	RevocationReasonAccountDeleted  RevocationReason = "ACCOUNT_DELETED"
+	RevocationReasonAccountPurged   RevocationReason = "ACCOUNT_PURGED"
+)
+
+type UserRegistered struct {
+	UserID    string `json:"userId"`
+	Email     string `json:"email"`
+	Username  string `json:"username,omitempty"`
+	Anonymous bool   `json:"anonymous"`
+}
+
+func (UserRegistered) EventType() string { return TypeUserRegistered }
+func (UserRegistered) EventVersion() int { return 1 }
+
+type UserConfirmed struct {
+	UserID     string `json:"userId"`
+	Email      string `json:"email"`
+	ClientType string `json:"clientType,omitempty"`
+}
+
+func (UserConfirmed) EventType() string { return TypeUserConfirmed }
+func (UserConfirmed) EventVersion() int { return 1 }
+
+type UserLoggedIn struct {
+	UserID     string      `json:"userId"`
+	ClientType string      `json:"clientType"`
+	Method     LoginMethod `json:"method"`
+}
+
+func (UserLoggedIn) EventType() string { return TypeUserLoggedIn }
+func (UserLoggedIn) EventVersion() int { return 1 }
+
+// SessionRevoked is published when tokens are revoked, an empty client type
+// means the sessions of every client were revoked
+type SessionRevoked struct {
+	UserID     string           `json:"userId"`
+	ClientType string           `json:"clientType,omitempty"`
+	Reason     RevocationReason `json:"reason"`
+}
+
+func (SessionRevoked) EventType() string { return TypeSessionRevoked }
+func (SessionRevoked) EventVersion() int { return 1 }
+
+// UserUpgraded is published when an anonymous user registers with an email and
+// password. The email still has to be confirmed
+type UserUpgraded struct {
+	UserID   string `json:"userId"`
+	Email    string `json:"email"`
+	Username string `json:"username,omitempty"`
+}
+
+func (UserUpgraded) EventType() string { return TypeUserUpgraded }
+func (UserUpgraded) EventVersion() int { return 1 }
+
+// EmailChanged is published once a user confirmed their new email
+type EmailChanged struct {
+	UserID        string `json:"userId"`
+	PreviousEmail string `json:"previousEmail"`
+	Email         string `json:"email"`
+}
+
+func (EmailChanged) EventType() string { return TypeEmailChanged }
+func (EmailChanged) EventVersion() int { return 1 }
+
+// UserDeleted is published when an account is deleted, either by its owner or
+// by an administrator. Since v2 it carries no email, the account is about to be
+// anonymised and the event must not keep its personal data
+type UserDeleted struct {
+	UserID     string `json:"userId"`
+	ByAdmin    bool   `json:"byAdmin"`
+	ClientType string `json:"clientType,omitempty"`
+}
+
+func (UserDeleted) EventType() string { return TypeUserDeleted }
+func (UserDeleted) EventVersion() int { return 2 }
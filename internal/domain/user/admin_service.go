@@ -0,0 +1,17 @@
+package user
+
+import (
+	"context"
+
+	"github.com/ouz/goboilerplate/internal/domain/shared"
+)
+
+type AdminUserService interface {
+	ListUsers(ctx context.Context, search string, pagination *shared.Pagination[User]) error
+	GetUser(ctx context.Context, id string) (*User, error)
+	EnableUser(ctx context.Context, id string) error
+	DisableUser(ctx context.Context, id string) error
+	VerifyUser(ctx context.Context, id string) error
+	LogoutUser(ctx context.Context, id string) error
+	DeleteUser(ctx context.Context, id string) error
+}
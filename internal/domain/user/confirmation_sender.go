@@ -0,0 +1,7 @@
+package user
+
+import "context"
+
+type ConfirmationSender interface {
+	SendConfirmation(ctx context.Context, email, confirmationID string) error
+}
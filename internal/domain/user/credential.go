@@ -10,7 +10,8 @@ import (
 type CredentialType string
 
 const (
-	CredentialTypePassword CredentialType = "PASSWORD"
+	CredentialTypePassword     CredentialType = "PASSWORD"
+	CredentialTypeDeviceSecret CredentialType = "DEVICE_SECRET"
 )
 
 type Credential struct {
@@ -29,7 +30,7 @@ func NewCredential(credentialType CredentialType, secret string) (*Credential, e
 		return nil, err
 	}
 
-	password, err := NewPassword(secret)
+	hash, err := hashSecret(credentialType, secret)
 	if err != nil {
 		return nil, err
 	}
@@ -37,15 +38,30 @@ func NewCredential(credentialType CredentialType, secret string) (*Credential, e
 	now := time.Now()
 	return &Credential{
 		CredentialType: credentialType,
-		Hash:           password.Hashed(),
+		Hash:           hash,
 		CreatedAt:      now,
 		UpdatedAt:      now,
 	}, nil
 }
 
+func hashSecret(credentialType CredentialType, secret string) (string, error) {
+	if credentialType == CredentialTypeDeviceSecret {
+		if err := validateDeviceSecret(secret); err != nil {
+			return "", err
+		}
+		return hashDeviceSecret(secret), nil
+	}
+
+	password, err := NewPassword(secret)
+	if err != nil {
+		return "", err
+	}
+	return password.Hashed(), nil
+}
+
 func validateCredentialType(credType CredentialType) error {
 	switch credType {
-	case CredentialTypePassword:
+	case CredentialTypePassword, CredentialTypeDeviceSecret:
 		return nil
 	default:
 		return errors.ValidationError("Unsupported credential type", nil)
@@ -58,3 +74,10 @@ func (c *Credential) IsPasswordValid(password string) bool {
 	}
 	return (&Password{hashed: c.Hash}).Verify(password)
 }
+
+func (c *Credential) IsDeviceSecretValid(secret string) bool {
+	if c.CredentialType != CredentialTypeDeviceSecret {
+		return false
+	}
+	return verifyDeviceSecret(c.Hash, secret)
+}
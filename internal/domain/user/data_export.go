@@ -0,0 +1,190 @@
+package user
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ouz/goboilerplate/internal/domain/audit"
+)
+
+type DataExportStatus string
+
+const (
+	DataExportStatusPending   DataExportStatus = "PENDING"
+	DataExportStatusCompleted DataExportStatus = "COMPLETED"
+	DataExportStatusFailed    DataExportStatus = "FAILED"
+)
+
+type DataExportJob struct {
+	ID          string           `json:"id"`
+	UserID      string           `json:"userId"`
+	Status      DataExportStatus `json:"status"`
+	RequestedAt time.Time        `json:"requestedAt"`
+	CompletedAt *time.Time       `json:"completedAt,omitempty"`
+	Error       string           `json:"error,omitempty"`
+}
+
+func NewDataExportJob(userID string) *DataExportJob {
+	return &DataExportJob{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		Status:      DataExportStatusPending,
+		RequestedAt: time.Now(),
+	}
+}
+
+func (j *DataExportJob) Complete() {
+	now := time.Now()
+	j.Status = DataExportStatusCompleted
+	j.CompletedAt = &now
+}
+
+func (j *DataExportJob) Fail(reason string) {
+	now := time.Now()
+	j.Status = DataExportStatusFailed
+	j.CompletedAt = &now
+	j.Error = reason
+}
+
+func (j *DataExportJob) IsPending() bool {
+	return j.Status == DataExportStatusPending
+}
+
+// DataExport is the archive handed to a user answering a data-subject access
+// request. Secrets such as credential hashes are never part of it.
+type DataExport struct {
+	GeneratedAt   time.Time              `json:"generatedAt"`
+	User          ExportedUser           `json:"user"`
+	Roles         []ExportedRole         `json:"roles"`
+	Credentials   []ExportedCredential   `json:"credentials"`
+	Confirmations []ExportedConfirmation `json:"confirmations"`
+	Sessions      []ExportedSession      `json:"sessions"`
+	AuditEvents   []ExportedAuditEvent   `json:"auditEvents"`
+}
+
+type ExportedUser struct {
+	ID           string     `json:"id"`
+	Username     string     `json:"username"`
+	DisplayName  string     `json:"displayName"`
+	Email        string     `json:"email"`
+	Locale       string     `json:"locale"`
+	TimeZone     string     `json:"timeZone"`
+	Enabled      bool       `json:"enabled"`
+	Verified     bool       `json:"verified"`
+	Anonymous    bool       `json:"anonymous"`
+	LastActiveAt *time.Time `json:"lastActiveAt,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+}
+
+type ExportedRole struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type ExportedCredential struct {
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type ExportedConfirmation struct {
+	ID          string     `json:"id"`
+	NewEmail    string     `json:"newEmail,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	ConfirmedAt *time.Time `json:"confirmedAt,omitempty"`
+}
+
+type ExportedSession struct {
+	ID         string `json:"id"`
+	ClientType string `json:"clientType"`
+}
+
+type ExportedAuditEvent struct {
+	Action     string    `json:"action"`
+	Outcome    string    `json:"outcome"`
+	ActorID    string    `json:"actorId,omitempty"`
+	TargetID   string    `json:"targetId,omitempty"`
+	ClientType string    `json:"clientType,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+func NewDataExport(u *User, sessions []ExportedSession, auditEvents []audit.Event) *DataExport {
+	export := &DataExport{
+		GeneratedAt: time.Now(),
+		User: ExportedUser{
+			ID:           u.ID,
+			Username:     u.Username,
+			DisplayName:  u.DisplayName,
+			Email:        u.Email,
+			Locale:       u.Locale,
+			TimeZone:     u.TimeZone,
+			Enabled:      u.Enabled,
+			Verified:     u.Verified,
+			Anonymous:    u.Anonymous,
+			LastActiveAt: u.LastActiveAt,
+			CreatedAt:    u.CreatedAt,
+			UpdatedAt:    u.UpdatedAt,
+		},
+		Roles:         make([]ExportedRole, 0, len(u.Roles)),
+		Credentials:   make([]ExportedCredential, 0, len(u.Credentials)),
+		Confirmations: make([]ExportedConfirmation, 0, len(u.Confirmations)),
+		Sessions:      sessions,
+		AuditEvents:   make([]ExportedAuditEvent, 0, len(auditEvents)),
+	}
+
+	for _, role := range u.Roles {
+		export.Roles = append(export.Roles, ExportedRole{Name: string(role.Name), CreatedAt: role.CreatedAt})
+	}
+
+	for _, credential := range u.Credentials {
+		export.Credentials = append(export.Credentials, ExportedCredential{
+			Type:      string(credential.CredentialType),
+			CreatedAt: credential.CreatedAt,
+			UpdatedAt: credential.UpdatedAt,
+		})
+	}
+
+	// Confirmations are soft deleted once used, so the deletion time is when they were confirmed
+	for _, confirmation := range u.Confirmations {
+		exported := ExportedConfirmation{
+			ID:        confirmation.ID,
+			NewEmail:  confirmation.NewEmail,
+			CreatedAt: confirmation.CreatedAt,
+		}
+		if confirmation.DeletedAt.Valid {
+			confirmedAt := confirmation.DeletedAt.Time
+			exported.ConfirmedAt = &confirmedAt
+		}
+		export.Confirmations = append(export.Confirmations, exported)
+	}
+
+	for _, event := range auditEvents {
+		export.AuditEvents = append(export.AuditEvents, ExportedAuditEvent{
+			Action:     string(event.Action),
+			Outcome:    string(event.Outcome),
+			ActorID:    event.ActorID,
+			TargetID:   event.TargetID,
+			ClientType: event.ClientType,
+			IP:         event.IP,
+			UserAgent:  event.UserAgent,
+			CreatedAt:  event.CreatedAt,
+		})
+	}
+
+	if export.Sessions == nil {
+		export.Sessions = []ExportedSession{}
+	}
+
+	return export
+}
+
+type DataExportService interface {
+	RequestExport(ctx context.Context, userID string) (*DataExportJob, error)
+	GetLatestExport(ctx context.Context, userID string) (*DataExportJob, error)
+	Export(ctx context.Context, userID string) (*DataExportJob, []byte, error)
+	ConsumeExportRequests(ctx context.Context, consumer string) error
+}
@@ -0,0 +1,60 @@
+package user
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ouz/goboilerplate/pkg/errors"
+	"gorm.io/gorm"
+)
+
+const anonymizedEmailDomain = "deleted.invalid"
+
+// ScheduleDeletion soft deletes the user and keeps the data restorable until
+// the grace period ends, after which the account is anonymised.
+func (u *User) ScheduleDeletion(gracePeriod time.Duration) error {
+	if u.DeletedAt.Valid {
+		return errors.AccountDeletedError("Account is already deleted", nil)
+	}
+
+	now := time.Now()
+	purgeAfter := now.Add(gracePeriod)
+	u.DeletedAt = gorm.DeletedAt{Time: now, Valid: true}
+	u.PurgeAfter = &purgeAfter
+	u.UpdatedAt = now
+	return nil
+}
+
+func (u *User) IsPendingDeletion() bool {
+	return u.DeletedAt.Valid && u.PurgeAfter != nil && u.PurgedAt == nil && time.Now().Before(*u.PurgeAfter)
+}
+
+func (u *User) Restore() error {
+	if !u.IsPendingDeletion() {
+		return errors.BusinessLogicError("Account cannot be restored", nil)
+	}
+
+	u.DeletedAt = gorm.DeletedAt{}
+	u.PurgeAfter = nil
+	u.UpdatedAt = time.Now()
+	return nil
+}
+
+// Anonymize strips every piece of personal data while keeping the row, so
+// records that reference the user ID stay consistent.
+func (u *User) Anonymize() {
+	now := time.Now()
+	u.Username = fmt.Sprintf("deleted-%s", u.ID)
+	u.Email = fmt.Sprintf("deleted-%s@%s", u.ID, anonymizedEmailDomain)
+	u.DisplayName = ""
+	u.Locale = ""
+	u.TimeZone = ""
+	u.Enabled = false
+	u.Verified = false
+	u.LastActiveAt = nil
+	u.Roles = nil
+	u.Credentials = nil
+	u.Confirmations = nil
+	u.PurgedAt = &now
+	u.UpdatedAt = now
+}
@@ -0,0 +1,42 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/ouz/goboilerplate/pkg/errors"
+)
+
+const deviceSecretBytes = 32
+
+// NewDeviceSecret returns a random secret that identifies an anonymous user's
+// device. It is only shown to the client once; the credential keeps its hash.
+func NewDeviceSecret() (string, error) {
+	buf := make([]byte, deviceSecretBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.InternalError("Failed to generate device secret", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashDeviceSecret uses a fast digest instead of bcrypt, device secrets carry
+// enough entropy that brute forcing the hash is not a concern
+func hashDeviceSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func validateDeviceSecret(secret string) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(secret)
+	if err != nil || len(decoded) < deviceSecretBytes {
+		return errors.ValidationError("Invalid device secret", err)
+	}
+	return nil
+}
+
+func verifyDeviceSecret(hash, secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(hashDeviceSecret(secret))) == 1
+}
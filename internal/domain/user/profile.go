@@ -0,0 +1,87 @@
+package user
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	vo "github.com/ouz/goboilerplate/internal/domain/shared"
+	"github.com/ouz/goboilerplate/pkg/errors"
+	"golang.org/x/text/language"
+)
+
+const maxDisplayNameLength = 100
+
+// ProfileUpdate holds the profile fields a user may change. Nil fields are left untouched.
+type ProfileUpdate struct {
+	Username    *string
+	DisplayName *string
+	Locale      *string
+	TimeZone    *string
+}
+
+func (u *User) UpdateProfile(update ProfileUpdate) error {
+	username, displayName, locale, timeZone := u.Username, u.DisplayName, u.Locale, u.TimeZone
+
+	if update.Username != nil {
+		username = strings.TrimSpace(*update.Username)
+		if err := validateUsername(username); err != nil {
+			return err
+		}
+	}
+
+	if update.DisplayName != nil {
+		displayName = strings.TrimSpace(*update.DisplayName)
+		if utf8.RuneCountInString(displayName) > maxDisplayNameLength {
+			return errors.ValidationError("Display name cannot be longer than 100 characters", nil)
+		}
+	}
+
+	if update.Locale != nil {
+		tag, err := language.Parse(*update.Locale)
+		if err != nil {
+			return errors.ValidationError("Invalid locale", err)
+		}
+		locale = tag.String()
+	}
+
+	if update.TimeZone != nil {
+		loc, err := time.LoadLocation(*update.TimeZone)
+		if err != nil || *update.TimeZone == "" || *update.TimeZone == "Local" {
+			return errors.ValidationError("Invalid time zone", err)
+		}
+		timeZone = loc.String()
+	}
+
+	u.Username = username
+	u.DisplayName = displayName
+	u.Locale = locale
+	u.TimeZone = timeZone
+	u.UpdatedAt = time.Now()
+	return nil
+}
+
+// RequestEmailChange records a pending switch to a new address. The email is
+// only changed once the confirmation sent to the new address is used.
+func (u *User) RequestEmailChange(email vo.Email) (*UserConfirmation, error) {
+	if u.Anonymous {
+		return nil, errors.BusinessLogicError("Anonymous users cannot change their email", nil)
+	}
+
+	if strings.EqualFold(u.Email, email.Address) {
+		return nil, errors.ValidationError("New email must be different from the current email", nil)
+	}
+
+	if err := u.AddConfirmation(); err != nil {
+		return nil, err
+	}
+
+	confirmation := u.LatestConfirmation()
+	confirmation.NewEmail = email.Address
+	return confirmation, nil
+}
+
+func (u *User) ChangeEmail(email string) {
+	u.Email = email
+	u.UpdatedAt = time.Now()
+}
@@ -12,6 +12,7 @@ type UserRoleName string
 const (
 	UserRoleUser      UserRoleName = "USER"
 	UserRoleAnonymous UserRoleName = "ANONYMOUS"
+	UserRoleAdmin     UserRoleName = "ADMIN"
 )
 
 type UserRole struct {
@@ -35,7 +36,7 @@ func NewUserRole(userID string, name UserRoleName) (*UserRole, error) {
 
 func validateUserRole(name UserRoleName) error {
 	switch name {
-	case UserRoleUser, UserRoleAnonymous:
+	case UserRoleUser, UserRoleAnonymous, UserRoleAdmin:
 		return nil
 	default:
 		return errors.ValidationError("Unsupported role name", nil)
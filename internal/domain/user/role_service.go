@@ -0,0 +1,8 @@
+package user
+
+import "context"
+
+// RoleService grants roles outside of the API, e.g. the first ADMIN
+type RoleService interface {
+	GrantRole(ctx context.Context, email string, role UserRoleName) (*User, error)
+}
@@ -5,20 +5,30 @@ import (
 
 	"github.com/google/uuid"
 	vo "github.com/ouz/goboilerplate/internal/domain/shared"
+	"github.com/ouz/goboilerplate/pkg/auth"
 	"github.com/ouz/goboilerplate/pkg/errors"
 	"gorm.io/gorm"
 )
 
 type User struct {
-	ID            string `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	Username      string
-	Email         string
-	Enabled       bool
-	Verified      bool
-	Anonymous     bool
+	ID          string `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Username    string
+	DisplayName string
+	Locale      string
+	TimeZone    string
+	Email       string
+	Enabled     bool
+	Verified    bool
+	Anonymous   bool
+	// ClientType is the client the user registered through, webhooks about the
+	// user are only delivered to that client
+	ClientType    auth.ClientType    `gorm:"default:null"`
 	Roles         []UserRole         `gorm:"foreignKey:UserID"`
 	Credentials   []Credential       `gorm:"foreignKey:UserID"`
 	Confirmations []UserConfirmation `gorm:"foreignKey:UserID"`
+	LastActiveAt  *time.Time
+	PurgeAfter    *time.Time
+	PurgedAt      *time.Time
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 	DeletedAt     gorm.DeletedAt
@@ -70,26 +80,90 @@ func validateUsername(username string) error {
 	return nil
 }
 
-func NewAnonymousUser() (*User, error) {
+// NewAnonymousUser creates an anonymous user together with the plaintext
+// device secret that has to be presented on anonymous login.
+func NewAnonymousUser() (*User, string, error) {
 	now := time.Now()
 	userID := uuid.New().String()
 
 	role, err := NewUserRole(userID, UserRoleAnonymous)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
+	secret, err := NewDeviceSecret()
+	if err != nil {
+		return nil, "", err
+	}
+
+	credential, err := NewCredential(CredentialTypeDeviceSecret, secret)
+	if err != nil {
+		return nil, "", err
+	}
+	credential.UserID = userID
+
 	return &User{
-		ID:        userID,
-		Username:  uuid.New().String(),
-		Email:     uuid.New().String(),
-		Roles:     []UserRole{*role},
-		Enabled:   true,
-		Verified:  true,
-		Anonymous: true,
-		CreatedAt: now,
-		UpdatedAt: now,
-	}, nil
+		ID:           userID,
+		Username:     uuid.New().String(),
+		Email:        uuid.New().String(),
+		Roles:        []UserRole{*role},
+		Credentials:  []Credential{*credential},
+		Enabled:      true,
+		Verified:     true,
+		Anonymous:    true,
+		LastActiveAt: &now,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}, secret, nil
+}
+
+// Upgrade turns an anonymous user into a regular account while keeping its ID,
+// so data created anonymously stays attached. The account must confirm its
+// new email before it can log in again.
+func (u *User) Upgrade(username, password string, email vo.Email) error {
+	if !u.Anonymous || !u.HasRole(UserRoleAnonymous) {
+		return errors.BusinessLogicError("Only anonymous users can be upgraded", nil)
+	}
+
+	if err := validateUsername(username); err != nil {
+		return err
+	}
+
+	role, err := NewUserRole(u.ID, UserRoleUser)
+	if err != nil {
+		return err
+	}
+
+	if err := u.AddCredential(password); err != nil {
+		return err
+	}
+
+	if err := u.AddConfirmation(); err != nil {
+		return err
+	}
+
+	u.Username = username
+	u.Email = email.Address
+	u.Anonymous = false
+	u.Enabled = false
+	u.Verified = false
+	u.Roles = []UserRole{*role}
+	u.UpdatedAt = time.Now()
+	return nil
+}
+
+func (u *User) LatestCredential() *Credential {
+	if len(u.Credentials) == 0 {
+		return nil
+	}
+	return &u.Credentials[len(u.Credentials)-1]
+}
+
+func (u *User) LatestConfirmation() *UserConfirmation {
+	if len(u.Confirmations) == 0 {
+		return nil
+	}
+	return &u.Confirmations[len(u.Confirmations)-1]
 }
 
 func (u *User) AddCredential(password string) error {
@@ -123,6 +197,24 @@ func (u *User) IsPasswordValid(password string) bool {
 	return false
 }
 
+func (u *User) IsDeviceSecretValid(secret string) bool {
+	for _, credential := range u.Credentials {
+		if credential.IsDeviceSecretValid(secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsInactiveSince reports whether the user has not been active after the given time
+func (u *User) IsInactiveSince(t time.Time) bool {
+	lastActive := u.CreatedAt
+	if u.LastActiveAt != nil {
+		lastActive = *u.LastActiveAt
+	}
+	return lastActive.Before(t)
+}
+
 func (u *User) HasRole(role UserRoleName) bool {
 	for _, userRole := range u.Roles {
 		if userRole.Name == role {
@@ -132,8 +224,38 @@ func (u *User) HasRole(role UserRoleName) bool {
 	return false
 }
 
+// GrantRole adds the role to the user and returns it to be stored, or nil when
+// the user already has it
+func (u *User) GrantRole(name UserRoleName) (*UserRole, error) {
+	if u.HasRole(name) {
+		return nil, nil
+	}
+
+	role, err := NewUserRole(u.ID, name)
+	if err != nil {
+		return nil, err
+	}
+	u.Roles = append(u.Roles, *role)
+	return role, nil
+}
+
 func (u *User) Confirm() {
 	u.Verified = true
 	u.Enabled = true
 	u.UpdatedAt = time.Now()
 }
+
+func (u *User) Enable() {
+	u.Enabled = true
+	u.UpdatedAt = time.Now()
+}
+
+func (u *User) Disable() {
+	u.Enabled = false
+	u.UpdatedAt = time.Now()
+}
+
+func (u *User) Verify() {
+	u.Verified = true
+	u.UpdatedAt = time.Now()
+}
@@ -2,6 +2,9 @@ package user
 
 import (
 	"context"
+	"time"
+
+	"github.com/ouz/goboilerplate/internal/domain/shared"
 )
 
 type UserRepository interface {
@@ -14,4 +17,23 @@ type UserRepository interface {
 	FindConfirmationByID(ctx context.Context, id string) (*UserConfirmation, error)
 	DeleteConfirmation(ctx context.Context, userConfirmation *UserConfirmation) error
 	CreateUserConfirmation(ctx context.Context, userConfirmation *UserConfirmation) error
+	FindAll(ctx context.Context, search string, pagination *shared.Pagination[User]) error
+	FindByIdWithDetails(ctx context.Context, id string) (*User, error)
+	UpdateStatus(ctx context.Context, user *User) error
+	UpdateAccount(ctx context.Context, user *User) error
+	ReplaceRole(ctx context.Context, userID string, from UserRoleName, to *UserRole) error
+	AddRole(ctx context.Context, role *UserRole) error
+	CreateCredential(ctx context.Context, credential *Credential) error
+	UpdateLastActive(ctx context.Context, id string, at time.Time) error
+	FindInactiveAnonymousIDs(ctx context.Context, before time.Time, limit int) ([]string, error)
+	HardDeleteByIDs(ctx context.Context, ids []string) error
+	FindByUsername(ctx context.Context, username string) (*User, error)
+	UpdateProfile(ctx context.Context, user *User) error
+	FindDeletedByEmail(ctx context.Context, email string) (*User, error)
+	SoftDelete(ctx context.Context, user *User) error
+	Restore(ctx context.Context, user *User) error
+	FindIDsDueForPurge(ctx context.Context, before time.Time, limit int) ([]string, error)
+	FindDeletedById(ctx context.Context, id string) (*User, error)
+	Anonymize(ctx context.Context, user *User) error
+	FindByIdForExport(ctx context.Context, id string) (*User, error)
 }
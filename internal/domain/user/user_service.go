@@ -8,8 +8,17 @@ import (
 
 type UserService interface {
 	Register(ctx context.Context, request auth.UserRegisterRequest) error
-	RegisterAnonymousUser(ctx context.Context) (*User, error)
+	RegisterAnonymousUser(ctx context.Context) (*User, string, error)
 	FindByEmail(ctx context.Context, email string) (*User, error)
 	FindUserWithRoles(ctx context.Context, id string, fromCache bool) (*User, error)
 	ConfirmUser(ctx context.Context, confirmation string) error
+	UpgradeAnonymousUser(ctx context.Context, userID string, request auth.UpgradeAnonymousUserRequest) error
+	RecordActivity(ctx context.Context, userID string) error
+	PurgeInactiveAnonymousUsers(ctx context.Context) (int, error)
+	UpdateProfile(ctx context.Context, userID string, update ProfileUpdate) (*User, error)
+	RequestEmailChange(ctx context.Context, userID, email string) error
+	DeleteAccount(ctx context.Context, userID string) error
+	FindPendingDeletionByEmail(ctx context.Context, email string) (*User, error)
+	RestoreAccount(ctx context.Context, userID string) error
+	PurgeDeletedAccounts(ctx context.Context) (int, error)
 }
@@ -10,6 +10,7 @@ type UserConfirmation struct {
 	ID        string `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
 	UserID    string `gorm:"not null"`
 	User      User   `gorm:"foreignKey:UserID"`
+	NewEmail  string `gorm:"default:null"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt gorm.DeletedAt
@@ -0,0 +1,119 @@
+package webhook
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type DeliveryStatus string
+
+const (
+	DeliveryStatusPending   DeliveryStatus = "PENDING"
+	DeliveryStatusSucceeded DeliveryStatus = "SUCCEEDED"
+	// DeliveryStatusDead marks deliveries that exhausted their retries, together
+	// they form the dead-letter list and can be requeued manually
+	DeliveryStatusDead DeliveryStatus = "DEAD"
+)
+
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// Backoff returns the wait before the next attempt, doubling after every failed attempt
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < attempt; i++ {
+		backoff *= 2
+		if backoff >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	return min(backoff, p.MaxBackoff)
+}
+
+type Delivery struct {
+	ID             string          `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	SubscriptionID string          `gorm:"type:uuid;not null"`
+	Subscription   Subscription    `gorm:"foreignKey:SubscriptionID"`
+	EventID        string          `gorm:"not null"`
+	EventType      string          `gorm:"not null"`
+	Payload        json.RawMessage `gorm:"type:jsonb;not null"`
+	Status         DeliveryStatus  `gorm:"not null"`
+	Attempts       int             `gorm:"not null;default:0"`
+	NextAttemptAt  time.Time       `gorm:"not null"`
+	LastStatusCode int             `gorm:"default:null"`
+	LastError      string          `gorm:"default:null"`
+	DeliveredAt    *time.Time      `gorm:"default:null"`
+	CreatedAt      time.Time       `gorm:"autoCreateTime"`
+	UpdatedAt      time.Time       `gorm:"autoUpdateTime"`
+}
+
+func (Delivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+func NewDelivery(subscription Subscription, eventID, eventType string, payload json.RawMessage) Delivery {
+	return Delivery{
+		SubscriptionID: subscription.ID,
+		EventID:        eventID,
+		EventType:      eventType,
+		Payload:        payload,
+		Status:         DeliveryStatusPending,
+		NextAttemptAt:  time.Now(),
+	}
+}
+
+func (d *Delivery) RecordSuccess(statusCode int, at time.Time) {
+	d.Attempts++
+	d.Status = DeliveryStatusSucceeded
+	d.LastStatusCode = statusCode
+	d.LastError = ""
+	d.DeliveredAt = &at
+}
+
+// RecordFailure schedules the next attempt, or moves the delivery to the
+// dead-letter list once the policy's attempts are used up
+func (d *Delivery) RecordFailure(statusCode int, reason string, policy RetryPolicy, at time.Time) {
+	d.Attempts++
+	d.LastStatusCode = statusCode
+	d.LastError = reason
+
+	if d.Attempts >= policy.MaxAttempts {
+		d.Status = DeliveryStatusDead
+		return
+	}
+	d.NextAttemptAt = at.Add(policy.Backoff(d.Attempts))
+}
+
+func (d *Delivery) Kill(reason string) {
+	d.Status = DeliveryStatusDead
+	d.LastError = reason
+}
+
+func (d *Delivery) IsDead() bool {
+	return d.Status == DeliveryStatusDead
+}
+
+// Requeue gives a dead delivery a fresh set of attempts
+func (d *Delivery) Requeue(at time.Time) {
+	d.Status = DeliveryStatusPending
+	d.Attempts = 0
+	d.NextAttemptAt = at
+}
+
+// DeliveryAttempt is the log entry of a single request sent to a subscriber
+type DeliveryAttempt struct {
+	ID         string    `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	DeliveryID string    `gorm:"type:uuid;not null"`
+	Attempt    int       `gorm:"not null"`
+	StatusCode int       `gorm:"default:null"`
+	Error      string    `gorm:"default:null"`
+	DurationMs int64     `gorm:"not null"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+}
+
+func (DeliveryAttempt) TableName() string {
+	return "webhook_delivery_attempts"
+}
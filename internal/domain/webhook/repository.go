@@ -0,0 +1,35 @@
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/ouz/goboilerplate/internal/domain/shared"
+	"github.com/ouz/goboilerplate/pkg/auth"
+)
+
+type DeliveryFilter struct {
+	ClientType     auth.ClientType
+	SubscriptionID string
+	Status         DeliveryStatus
+}
+
+type WebhookRepository interface {
+	CreateSubscription(ctx context.Context, subscription *Subscription) error
+	FindSubscriptions(ctx context.Context, clientType auth.ClientType) ([]Subscription, error)
+	FindSubscription(ctx context.Context, clientType auth.ClientType, id string) (*Subscription, error)
+	FindSubscriptionsForEvent(ctx context.Context, clientType auth.ClientType, eventType string) ([]Subscription, error)
+	DeleteSubscription(ctx context.Context, subscription *Subscription) error
+
+	// CreateDeliveries ignores deliveries that already exist for the same
+	// subscription and event, so redelivered stream messages are harmless
+	CreateDeliveries(ctx context.Context, deliveries []Delivery) error
+	// ClaimDueDeliveries leases pending deliveries until leaseUntil so concurrent
+	// dispatchers do not send them twice
+	ClaimDueDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]Delivery, error)
+	UpdateDelivery(ctx context.Context, delivery *Delivery) error
+	CreateAttempt(ctx context.Context, attempt *DeliveryAttempt) error
+	FindDeliveries(ctx context.Context, filter DeliveryFilter, pagination *shared.Pagination[Delivery]) error
+	FindDelivery(ctx context.Context, clientType auth.ClientType, id string) (*Delivery, error)
+	FindAttempts(ctx context.Context, deliveryID string) ([]DeliveryAttempt, error)
+}
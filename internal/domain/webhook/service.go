@@ -0,0 +1,24 @@
+package webhook
+
+import (
+	"context"
+
+	"github.com/ouz/goboilerplate/internal/domain/shared"
+	"github.com/ouz/goboilerplate/pkg/auth"
+)
+
+type WebhookService interface {
+	CreateSubscription(ctx context.Context, clientType auth.ClientType, url string, eventTypes []string) (*Subscription, error)
+	ListSubscriptions(ctx context.Context, clientType auth.ClientType) ([]Subscription, error)
+	DeleteSubscription(ctx context.Context, clientType auth.ClientType, id string) error
+	ListDeliveries(ctx context.Context, filter DeliveryFilter, pagination *shared.Pagination[Delivery]) error
+	GetDelivery(ctx context.Context, clientType auth.ClientType, id string) (*Delivery, []DeliveryAttempt, error)
+	RetryDelivery(ctx context.Context, clientType auth.ClientType, id string) error
+}
+
+type Dispatcher interface {
+	// ConsumeEvents turns domain events from the stream into pending deliveries
+	ConsumeEvents(ctx context.Context, consumer string) error
+	// Dispatch sends due deliveries and returns how many were attempted
+	Dispatch(ctx context.Context) (int, error)
+}
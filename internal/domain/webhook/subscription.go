@@ -0,0 +1,111 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/netip"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/ouz/goboilerplate/internal/domain/event"
+	"github.com/ouz/goboilerplate/pkg/auth"
+	"github.com/ouz/goboilerplate/pkg/errors"
+	"gorm.io/gorm"
+)
+
+const secretPrefix = "whsec_"
+
+// SupportedEventTypes lists the domain events partners may subscribe to
+var SupportedEventTypes = []string{
+	event.TypeUserConfirmed,
+	event.TypeUserDeleted,
+}
+
+type Subscription struct {
+	ID         string          `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	ClientType auth.ClientType `gorm:"not null"`
+	URL        string          `gorm:"column:url;not null"`
+	Secret     string          `gorm:"not null"`
+	EventTypes []string        `gorm:"type:jsonb;serializer:json;not null"`
+	CreatedAt  time.Time       `gorm:"autoCreateTime"`
+	UpdatedAt  time.Time       `gorm:"autoUpdateTime"`
+	DeletedAt  gorm.DeletedAt  `gorm:"index"`
+}
+
+func NewSubscription(clientType auth.ClientType, rawURL string, eventTypes []string) (*Subscription, error) {
+	if err := validateURL(rawURL); err != nil {
+		return nil, err
+	}
+
+	if err := validateEventTypes(eventTypes); err != nil {
+		return nil, err
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Subscription{
+		ClientType: clientType,
+		URL:        rawURL,
+		Secret:     secret,
+		EventTypes: slices.Compact(slices.Sorted(slices.Values(eventTypes))),
+	}, nil
+}
+
+func (s *Subscription) Accepts(eventType string) bool {
+	return slices.Contains(s.EventTypes, eventType)
+}
+
+func validateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return errors.ValidationError("Webhook url must be an absolute url", err)
+	}
+
+	if u.Scheme != "https" {
+		return errors.ValidationError("Webhook url must use https", nil)
+	}
+
+	// Hostnames are checked again when dialing, they may resolve to anything
+	if u.Hostname() == "localhost" {
+		return errors.ValidationError("Webhook url must not point to a private address", nil)
+	}
+	if ip, err := netip.ParseAddr(u.Hostname()); err == nil && !IsPublicAddr(ip) {
+		return errors.ValidationError("Webhook url must not point to a private address", nil)
+	}
+
+	return nil
+}
+
+// IsPublicAddr reports whether ip may receive webhooks. Loopback, private,
+// link-local (which includes cloud metadata endpoints) and unspecified
+// addresses are rejected so subscriptions cannot reach internal services
+func IsPublicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast()
+}
+
+func validateEventTypes(eventTypes []string) error {
+	if len(eventTypes) == 0 {
+		return errors.ValidationError("At least one event type is required", nil)
+	}
+
+	for _, eventType := range eventTypes {
+		if !slices.Contains(SupportedEventTypes, eventType) {
+			return errors.ValidationError("Unsupported event type: "+eventType, nil)
+		}
+	}
+
+	return nil
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.InternalError("Failed to generate webhook secret", err)
+	}
+	return secretPrefix + hex.EncodeToString(b), nil
+}
@@ -36,7 +36,31 @@ func InitDatabase(logger *log.Logger) (*gorm.DB, error) {
 	return postgres.ConnectDB(logger)
 }
 
-func InitRedis(logger *log.Logger) (*redis.Client, error) {
+func InitRedis(logger *log.Logger) (redis.UniversalClient, error) {
 	cfg := config.Get()
-	return redisCache.ConnectRedis(logger, cfg.Valkey.Host, cfg.Valkey.Port, cfg.Otel.MonitoringEnabled)
+	valkey := cfg.Valkey
+	return redisCache.ConnectRedis(logger, redisCache.ConnectOptions{
+		Mode:             valkey.Mode,
+		Addrs:            valkey.Addresses(),
+		MasterName:       valkey.MasterName,
+		Username:         valkey.Username,
+		Password:         valkey.Password,
+		SentinelUsername: valkey.SentinelUsername,
+		SentinelPassword: valkey.SentinelPassword,
+		DB:               valkey.DB,
+		PoolSize:         valkey.PoolSize,
+		DialTimeout:      valkey.DialTimeout,
+		ReadTimeout:      valkey.ReadTimeout,
+		WriteTimeout:     valkey.WriteTimeout,
+		TLS: redisCache.TLSOptions{
+			Enabled:            valkey.TLS.Enabled,
+			CAFile:             valkey.TLS.CAFile,
+			CertFile:           valkey.TLS.CertFile,
+			KeyFile:            valkey.TLS.KeyFile,
+			ServerName:         valkey.TLS.ServerName,
+			InsecureSkipVerify: valkey.TLS.InsecureSkipVerify,
+		},
+		RequiredOnStartup: valkey.RequiredOnStartup,
+		MonitoringEnabled: cfg.Otel.MonitoringEnabled,
+	})
 }
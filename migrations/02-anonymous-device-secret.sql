@@ -0,0 +1,2 @@
+ALTER TABLE app.users ADD COLUMN IF NOT EXISTS last_active_at TIMESTAMP NULL;
+CREATE INDEX IF NOT EXISTS idx_users_anonymous_last_active_at ON app.users USING btree (anonymous, last_active_at);
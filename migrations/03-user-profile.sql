@@ -0,0 +1,8 @@
+ALTER TABLE app.users ADD COLUMN IF NOT EXISTS display_name text NULL;
+ALTER TABLE app.users ADD COLUMN IF NOT EXISTS locale text NULL;
+ALTER TABLE app.users ADD COLUMN IF NOT EXISTS time_zone text NULL;
+
+DROP INDEX IF EXISTS app.idx_users_username;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username_unique ON app.users USING btree (LOWER(username)) WHERE deleted_at IS NULL;
+
+ALTER TABLE app.user_confirmations ADD COLUMN IF NOT EXISTS new_email text NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE app.users ADD COLUMN IF NOT EXISTS purge_after TIMESTAMP NULL;
+ALTER TABLE app.users ADD COLUMN IF NOT EXISTS purged_at TIMESTAMP NULL;
+CREATE INDEX IF NOT EXISTS idx_users_purge_after ON app.users USING btree (purge_after) WHERE deleted_at IS NOT NULL AND purged_at IS NULL;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS app.audit_events (
+    id uuid NOT NULL DEFAULT gen_random_uuid(),
+    actor_id uuid NULL,
+    action text NOT NULL,
+    target_id uuid NULL,
+    client_type text NULL,
+    ip text NULL,
+    user_agent text NULL,
+    trace_id text NULL,
+    outcome text NOT NULL,
+    reason text NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT audit_events_pkey PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON app.audit_events USING btree (created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON app.audit_events USING btree (actor_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_target_id ON app.audit_events USING btree (target_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON app.audit_events USING btree (action, created_at);
+
+-- Audit events are append-only, rows may only be removed by the retention job
+CREATE OR REPLACE FUNCTION app.audit_events_reject_update() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_no_update ON app.audit_events;
+CREATE TRIGGER audit_events_no_update BEFORE UPDATE ON app.audit_events
+    FOR EACH ROW EXECUTE FUNCTION app.audit_events_reject_update();
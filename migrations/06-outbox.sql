@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS app.outbox (
+    id uuid NOT NULL,
+    stream text NOT NULL,
+    event_type text NOT NULL,
+    payload jsonb NOT NULL,
+    attempts int NOT NULL DEFAULT 0,
+    last_error text NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    published_at TIMESTAMP NULL,
+    CONSTRAINT outbox_pkey PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_outbox_unpublished ON app.outbox USING btree (created_at) WHERE published_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_published_at ON app.outbox USING btree (published_at) WHERE published_at IS NOT NULL;
@@ -0,0 +1,50 @@
+CREATE TABLE IF NOT EXISTS app.webhook_subscriptions (
+    id uuid NOT NULL DEFAULT gen_random_uuid(),
+    client_type text NOT NULL,
+    url text NOT NULL,
+    secret text NOT NULL,
+    event_types jsonb NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NULL,
+    deleted_at TIMESTAMP NULL,
+    CONSTRAINT webhook_subscriptions_pkey PRIMARY KEY (id),
+    CONSTRAINT webhook_subscriptions_clients_fk FOREIGN KEY (client_type) REFERENCES app.clients(client_type) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_subscriptions_client_type ON app.webhook_subscriptions USING btree (client_type);
+CREATE INDEX IF NOT EXISTS idx_webhook_subscriptions_deleted_at ON app.webhook_subscriptions USING btree (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_subscriptions_event_types ON app.webhook_subscriptions USING gin (event_types);
+
+CREATE TABLE IF NOT EXISTS app.webhook_deliveries (
+    id uuid NOT NULL DEFAULT gen_random_uuid(),
+    subscription_id uuid NOT NULL,
+    event_id text NOT NULL,
+    event_type text NOT NULL,
+    payload jsonb NOT NULL,
+    status text NOT NULL,
+    attempts int NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_status_code int NULL,
+    last_error text NULL,
+    delivered_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NULL,
+    CONSTRAINT webhook_deliveries_pkey PRIMARY KEY (id),
+    CONSTRAINT webhook_deliveries_subscriptions_fk FOREIGN KEY (subscription_id) REFERENCES app.webhook_subscriptions(id) ON DELETE CASCADE,
+    CONSTRAINT webhook_deliveries_event_unique UNIQUE (subscription_id, event_id)
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON app.webhook_deliveries USING btree (next_attempt_at) WHERE status = 'PENDING';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_subscription ON app.webhook_deliveries USING btree (subscription_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status ON app.webhook_deliveries USING btree (status);
+
+CREATE TABLE IF NOT EXISTS app.webhook_delivery_attempts (
+    id uuid NOT NULL DEFAULT gen_random_uuid(),
+    delivery_id uuid NOT NULL,
+    attempt int NOT NULL,
+    status_code int NULL,
+    error text NULL,
+    duration_ms bigint NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT webhook_delivery_attempts_pkey PRIMARY KEY (id),
+    CONSTRAINT webhook_delivery_attempts_deliveries_fk FOREIGN KEY (delivery_id) REFERENCES app.webhook_deliveries(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_delivery_attempts_delivery ON app.webhook_delivery_attempts USING btree (delivery_id, attempt);
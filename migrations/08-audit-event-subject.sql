@@ -0,0 +1,3 @@
+-- Names the target of an event that is not a user, e.g. the email of a failed login or an evicted cache key
+ALTER TABLE app.audit_events ADD COLUMN IF NOT EXISTS subject text NULL;
+CREATE INDEX IF NOT EXISTS idx_audit_events_subject ON app.audit_events USING btree (subject, created_at) WHERE subject IS NOT NULL;
@@ -0,0 +1,7 @@
+-- Relays lease the messages they publish instead of holding row locks across network calls,
+-- messages that keep failing are parked so later ones are still relayed
+ALTER TABLE app.outbox ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMP NULL;
+ALTER TABLE app.outbox ADD COLUMN IF NOT EXISTS parked_at TIMESTAMP NULL;
+DROP INDEX IF EXISTS app.idx_outbox_unpublished;
+CREATE INDEX IF NOT EXISTS idx_outbox_unpublished ON app.outbox USING btree (created_at) WHERE published_at IS NULL AND parked_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_parked_at ON app.outbox USING btree (parked_at) WHERE parked_at IS NOT NULL;
@@ -0,0 +1 @@
+ALTER TABLE app.users ADD COLUMN IF NOT EXISTS client_type text NULL;
@@ -0,0 +1,2 @@
+-- Users deleted by an admin before they were scheduled for purging are purged on the next run
+UPDATE app.users SET purge_after = deleted_at WHERE deleted_at IS NOT NULL AND purge_after IS NULL AND purged_at IS NULL;
@@ -0,0 +1,190 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ouz/goboilerplate/pkg/errors"
+)
+
+// maxScanCount bounds the page size an administrator can ask for
+const maxScanCount = 1000
+
+const redactedValue = "[REDACTED]"
+
+// sensitiveFields are parts of field names whose values Inspect never returns,
+// such as credential hashes and client secrets of cached users and clients
+var sensitiveFields = []string{"hash", "secret", "password", "token"}
+
+// Inspection is a key as stored in Valkey and in the local cache of this instance
+type Inspection struct {
+	Redis *EntryInfo `json:"redis,omitempty"`
+	Local *EntryInfo `json:"local,omitempty"`
+}
+
+// KeyPage is one page of the keys of a prefix, an empty Cursor means the scan is complete
+type KeyPage struct {
+	Prefix string   `json:"prefix"`
+	Keys   []string `json:"keys"`
+	Cursor string   `json:"cursor,omitempty"`
+}
+
+// PrefixReport holds the key count and memory usage of a prefix per tier
+type PrefixReport struct {
+	Prefix string       `json:"prefix"`
+	Redis  PrefixStats  `json:"redis"`
+	Local  *PrefixStats `json:"local,omitempty"`
+}
+
+// Admin inspects and evicts cache entries for operators. Evictions go through
+// remote, so a tiered cache broadcasts them to the local caches of all instances
+type Admin struct {
+	remote   RedisCacheService
+	local    LocalCacheService
+	prefixes []string
+}
+
+// NewAdmin creates an Admin, local may be nil when there is no local cache to
+// report on. prefixes are reported by Stats when no prefix is asked for
+func NewAdmin(remote RedisCacheService, local LocalCacheService, prefixes []string) *Admin {
+	return &Admin{
+		remote:   remote,
+		local:    local,
+		prefixes: prefixes,
+	}
+}
+
+// validatePrefix rejects prefixes that would widen a scan pattern
+func validatePrefix(prefix string) error {
+	if prefix == "" {
+		return errors.ValidationError("cache prefix is required", nil)
+	}
+	if strings.ContainsAny(prefix, `*?[]\`) {
+		return errors.ValidationError(fmt.Sprintf("cache prefix %q must not contain pattern characters", prefix), nil)
+	}
+	return nil
+}
+
+func (a *Admin) Inspect(ctx context.Context, prefix, key string) (Inspection, error) {
+	if err := validatePrefix(prefix); err != nil {
+		return Inspection{}, err
+	}
+
+	var inspection Inspection
+	info, found, err := a.remote.Inspect(ctx, prefix, key)
+	if err != nil {
+		return Inspection{}, err
+	}
+	if found {
+		info.Value = redact(info.Value)
+		inspection.Redis = &info
+	}
+
+	if a.local != nil {
+		info, found, err := a.local.Inspect(prefix, key)
+		if err != nil {
+			return Inspection{}, errors.GenericError("error inspecting local cache entry", err)
+		}
+		if found {
+			info.Value = redact(info.Value)
+			inspection.Local = &info
+		}
+	}
+
+	if inspection.Redis == nil && inspection.Local == nil {
+		return Inspection{}, errors.NotFoundError(fmt.Sprintf("cache entry %s:%s not found", prefix, key), nil)
+	}
+	return inspection, nil
+}
+
+// Keys returns a page of the keys of prefix without the prefix itself. A page may
+// hold fewer keys than count, or none, before the scan is complete
+func (a *Admin) Keys(ctx context.Context, prefix, cursor string, count int64) (KeyPage, error) {
+	if err := validatePrefix(prefix); err != nil {
+		return KeyPage{}, err
+	}
+	if count < 0 || count > maxScanCount {
+		return KeyPage{}, errors.ValidationError(fmt.Sprintf("count must be between 0 and %d", maxScanCount), nil)
+	}
+
+	keys, next, err := a.remote.Scan(ctx, prefix+":*", cursor, count)
+	if err != nil {
+		return KeyPage{}, err
+	}
+
+	page := KeyPage{Prefix: prefix, Keys: make([]string, 0, len(keys)), Cursor: next}
+	for _, key := range keys {
+		page.Keys = append(page.Keys, strings.TrimPrefix(key, prefix+":"))
+	}
+	return page, nil
+}
+
+func (a *Admin) Evict(ctx context.Context, prefix, key string) error {
+	if err := validatePrefix(prefix); err != nil {
+		return err
+	}
+	return a.remote.Evict(ctx, prefix, key)
+}
+
+func (a *Admin) EvictPrefix(ctx context.Context, prefix string) error {
+	if err := validatePrefix(prefix); err != nil {
+		return err
+	}
+	return a.remote.EvictByPrefix(ctx, prefix)
+}
+
+// Stats reports every prefix of prefixes, or the configured ones when none is given
+func (a *Admin) Stats(ctx context.Context, prefixes ...string) ([]PrefixReport, error) {
+	if len(prefixes) == 0 {
+		prefixes = a.prefixes
+	}
+
+	reports := make([]PrefixReport, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		if err := validatePrefix(prefix); err != nil {
+			return nil, err
+		}
+
+		stats, err := a.remote.Stats(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		report := PrefixReport{Prefix: prefix, Redis: stats}
+		if a.local != nil {
+			local := a.local.Stats(prefix)
+			report.Local = &local
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// redact replaces the values of sensitive fields at any depth of a decoded value
+func redact(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for field, fieldValue := range v {
+			if isSensitiveField(field) {
+				v[field] = redactedValue
+				continue
+			}
+			v[field] = redact(fieldValue)
+		}
+	case []any:
+		for i := range v {
+			v[i] = redact(v[i])
+		}
+	}
+	return value
+}
+
+func isSensitiveField(field string) bool {
+	field = strings.ToLower(field)
+	for _, sensitive := range sensitiveFields {
+		if strings.Contains(field, sensitive) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 )
 
@@ -10,6 +11,60 @@ type LocalCacheService interface {
 	Get(prefix, key string, result any) (bool, error)
 	Evict(prefix, key string)
 	EvictByPrefix(prefix string)
+	// Inspect describes the entry of key without knowing the type of its value
+	Inspect(prefix, key string) (EntryInfo, bool, error)
+	// Stats counts the entries of prefix by walking the whole cache, it is meant for administration
+	Stats(prefix string) PrefixStats
+}
+
+// EntryInfo describes a stored entry for administration
+type EntryInfo struct {
+	Prefix string `json:"prefix"`
+	Key    string `json:"key"`
+	// TTL is zero for an entry without expiry
+	TTL         time.Duration `json:"ttl"`
+	Size        int           `json:"size"`
+	Format      string        `json:"format"`
+	Compression string        `json:"compression"`
+	// Value is the decoded value, nil for gob values which cannot be decoded without their type
+	Value any `json:"value"`
+}
+
+// MarshalJSON renders the TTL as a duration such as "4m30s" and leaves it out without expiry
+func (e EntryInfo) MarshalJSON() ([]byte, error) {
+	type entryInfo EntryInfo
+	ttl := ""
+	if e.TTL > 0 {
+		ttl = e.TTL.String()
+	}
+	return json.Marshal(struct {
+		entryInfo
+		TTL string `json:"ttl,omitempty"`
+	}{entryInfo(e), ttl})
+}
+
+// PrefixStats counts the entries of a prefix and the memory they use. Local
+// caches report the size of keys and values, Valkey its MEMORY USAGE
+type PrefixStats struct {
+	Keys  int64 `json:"keys"`
+	Bytes int64 `json:"bytes"`
+}
+
+// Entry is a value stored under prefix and key for TTL
+type Entry struct {
+	Prefix string
+	Key    string
+	TTL    time.Duration
+	Value  any
+}
+
+// Batch queues writes that are sent to Valkey together. Errors are reported
+// when the batch is executed
+type Batch interface {
+	Set(prefix, key string, ttl time.Duration, value any)
+	Evict(prefix, key string)
+	SAdd(prefix, key string, ttl time.Duration, member string)
+	Incr(prefix, key string, ttl time.Duration)
 }
 
 type RedisCacheService interface {
@@ -18,9 +73,52 @@ type RedisCacheService interface {
 	Exists(ctx context.Context, prefix, key string) (bool, error)
 	Evict(ctx context.Context, prefix, key string) error
 	EvictByPrefix(ctx context.Context, prefix string) error
+	// MGet decodes the value of keys[i] into results[i] and reports which keys were found
+	MGet(ctx context.Context, prefix string, keys []string, results []any) ([]bool, error)
+	// MSet stores all entries atomically in a single round-trip. On Cluster this
+	// only holds for keys of one hash slot, share a hash tag to get there
+	MSet(ctx context.Context, entries ...Entry) error
+	// SetNX stores value only if key does not exist and reports whether it did
+	SetNX(ctx context.Context, prefix, key string, ttl time.Duration, value any) (bool, error)
+	// CompareAndSwap replaces the value of key with value only if it currently decodes
+	// to expected, a nil expected means the key must not exist. It reports whether
+	// the value was replaced
+	CompareAndSwap(ctx context.Context, prefix, key string, ttl time.Duration, expected, value any) (bool, error)
+	// Incr increments the counter of key, the TTL is set when the counter is created
+	Incr(ctx context.Context, prefix, key string, ttl time.Duration) (int64, error)
+	// Pipeline sends the writes queued by fn in one round-trip, without atomicity
+	Pipeline(ctx context.Context, fn func(Batch)) error
+	// Transaction applies the writes queued by fn atomically with MULTI/EXEC. On
+	// Cluster every hash slot gets a transaction of its own
+	Transaction(ctx context.Context, fn func(Batch)) error
 	SAdd(ctx context.Context, prefix, key string, ttl time.Duration, member string) error
 	SMembers(ctx context.Context, prefix, key string) ([]string, error)
 	SCard(ctx context.Context, prefix, key string) (int64, error)
-	Scan(ctx context.Context, pattern string) ([]string, error)
+	// Scan returns a page of the keys matching pattern starting at cursor, an empty
+	// cursor starts a new scan. The returned cursor is empty once the scan is complete.
+	// A page may hold more or fewer than count keys, or none before the end
+	Scan(ctx context.Context, pattern, cursor string, count int64) (keys []string, next string, err error)
+	// Inspect describes the value stored under key without knowing its type
+	Inspect(ctx context.Context, prefix, key string) (EntryInfo, bool, error)
+	// Stats counts the keys of prefix and their memory by scanning the keyspace, it
+	// is meant for administration
+	Stats(ctx context.Context, prefix string) (PrefixStats, error)
 	CloseRedisClient() error
 }
+
+// ScanAll returns every key matching pattern
+func ScanAll(ctx context.Context, c RedisCacheService, pattern string) ([]string, error) {
+	var all []string
+	cursor := ""
+	for {
+		keys, next, err := c.Scan(ctx, pattern, cursor, 0)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, keys...)
+		if next == "" {
+			return all, nil
+		}
+		cursor = next
+	}
+}
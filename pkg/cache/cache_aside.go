@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"context"
+	errs "errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/ouz/goboilerplate/pkg/errors"
+	"github.com/ouz/goboilerplate/pkg/log"
+	"golang.org/x/sync/singleflight"
+)
+
+const refreshTimeout = 10 * time.Second
+
+type CacheAsideOptions struct {
+	// Jitter spreads expirations by up to this fraction of the TTL in either
+	// direction, so keys cached together do not expire together
+	Jitter float64
+	// NegativeTTL caches not-found results of the loader, zero disables it
+	NegativeTTL time.Duration
+	// StaleWhileRevalidate keeps serving an expired value for this long while
+	// a single background load refreshes it, zero disables it
+	StaleWhileRevalidate time.Duration
+}
+
+// CacheAside loads values through a cache. Concurrent misses of the same key
+// share a single load
+type CacheAside struct {
+	cache   RedisCacheService
+	options CacheAsideOptions
+	group   singleflight.Group
+	logger  *log.Logger
+}
+
+func NewCacheAside(logger *log.Logger, cache RedisCacheService, options CacheAsideOptions) *CacheAside {
+	return &CacheAside{
+		cache:   cache,
+		options: options,
+		logger:  logger,
+	}
+}
+
+type cachedEntry[T any] struct {
+	Value      T         `json:"value"`
+	NotFound   string    `json:"notFound,omitempty"`
+	FreshUntil time.Time `json:"freshUntil"`
+}
+
+// GetOrLoad returns the cached value of key or calls loader on a miss and caches the
+// result for ttl. A not-found error of the loader is cached for NegativeTTL and
+// returned again as a not-found error. Cache failures fall back to the loader
+func GetOrLoad[T any](ctx context.Context, c *CacheAside, prefix, key string, ttl time.Duration, loader func(ctx context.Context) (T, error)) (T, error) {
+	var entry cachedEntry[T]
+	found, err := c.cache.Get(ctx, prefix, key, &entry)
+	if err != nil {
+		c.logger.Warn("Failed to read cache, loading instead", "error", err, "prefix", prefix)
+	}
+
+	// Values cached before they were wrapped in an entry decode without a
+	// freshness and are loaded again instead of being returned as zero values
+	if found && !entry.FreshUntil.IsZero() {
+		fresh := time.Now().Before(entry.FreshUntil)
+		if fresh || c.options.StaleWhileRevalidate > 0 {
+			if !fresh {
+				refresh(ctx, c, prefix, key, ttl, loader)
+			}
+			if entry.NotFound != "" {
+				var zero T
+				return zero, errors.NotFoundError(entry.NotFound, nil)
+			}
+			return entry.Value, nil
+		}
+	}
+
+	result := c.group.DoChan(prefix+":"+key, func() (any, error) {
+		// The load is shared, a caller giving up must not cancel it for the others
+		return load(context.WithoutCancel(ctx), c, prefix, key, ttl, loader)
+	})
+
+	select {
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	case res := <-result:
+		if res.Err != nil {
+			var zero T
+			return zero, res.Err
+		}
+		value, _ := res.Val.(T)
+		return value, nil
+	}
+}
+
+// refresh reloads an expired entry in the background, at most once at a time per key
+func refresh[T any](ctx context.Context, c *CacheAside, prefix, key string, ttl time.Duration, loader func(ctx context.Context) (T, error)) {
+	c.group.DoChan(prefix+":"+key, func() (any, error) {
+		refreshCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), refreshTimeout)
+		defer cancel()
+
+		value, err := load(refreshCtx, c, prefix, key, ttl, loader)
+		if err != nil && !errors.IsNotFoundError(err) {
+			c.logger.Warn("Failed to refresh stale cache entry", "error", err, "prefix", prefix)
+		}
+		return value, err
+	})
+}
+
+func load[T any](ctx context.Context, c *CacheAside, prefix, key string, ttl time.Duration, loader func(ctx context.Context) (T, error)) (T, error) {
+	value, err := loader(ctx)
+	if err != nil {
+		if errors.IsNotFoundError(err) && c.options.NegativeTTL > 0 {
+			store(ctx, c, prefix, key, c.options.NegativeTTL, cachedEntry[T]{NotFound: notFoundMessage(err)})
+		}
+		return value, err
+	}
+
+	store(ctx, c, prefix, key, ttl, cachedEntry[T]{Value: value})
+	return value, nil
+}
+
+func store[T any](ctx context.Context, c *CacheAside, prefix, key string, ttl time.Duration, entry cachedEntry[T]) {
+	ttl = c.jitter(ttl)
+	entry.FreshUntil = time.Now().Add(ttl)
+
+	if err := c.cache.Set(ctx, prefix, key, ttl+c.options.StaleWhileRevalidate, entry); err != nil {
+		c.logger.Warn("Failed to write cache", "error", err, "prefix", prefix)
+	}
+}
+
+func (c *CacheAside) jitter(ttl time.Duration) time.Duration {
+	if c.options.Jitter <= 0 {
+		return ttl
+	}
+	spread := float64(ttl) * c.options.Jitter
+	return ttl + time.Duration((rand.Float64()*2-1)*spread)
+}
+
+func notFoundMessage(err error) string {
+	var appErr *errors.AppError
+	if errs.As(err, &appErr) && appErr.Message != "" {
+		return appErr.Message
+	}
+	return "Not found"
+}
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+type CircuitState int
+
+const (
+	// CircuitClosed lets every call through
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects calls until the open duration has passed
+	CircuitOpen
+	// CircuitHalfOpen lets a single trial call through, its result closes or reopens the circuit
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// circuitBreaker opens after threshold consecutive failures so calls fail fast
+// instead of waiting for timeouts while the backend is down
+type circuitBreaker struct {
+	mu           sync.Mutex
+	state        CircuitState
+	failures     int
+	openedAt     time.Time
+	threshold    int
+	openDuration time.Duration
+	onChange     func(from, to CircuitState)
+}
+
+func newCircuitBreaker(threshold int, openDuration time.Duration, onChange func(from, to CircuitState)) *circuitBreaker {
+	return &circuitBreaker{
+		threshold:    threshold,
+		openDuration: openDuration,
+		onChange:     onChange,
+	}
+}
+
+func (b *circuitBreaker) State() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// allow reports whether a call may go through. Once the open duration has passed
+// an open circuit lets one trial call through
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitClosed:
+		return true
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.openDuration {
+			return false
+		}
+		b.setState(CircuitHalfOpen)
+		return true
+	default:
+		// The trial call is still running
+		return false
+	}
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.setState(CircuitClosed)
+}
+
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		b.setState(CircuitOpen)
+	}
+}
+
+// abandon ends a call that says nothing about the backend, such as one cancelled
+// by its caller. A trial call is retried by the next call
+func (b *circuitBreaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitHalfOpen {
+		b.setState(CircuitOpen)
+	}
+}
+
+// setState changes the state and reports the transition. Callers must hold mu
+func (b *circuitBreaker) setState(state CircuitState) {
+	if b.state == state {
+		return
+	}
+	from := b.state
+	b.state = state
+	if b.onChange != nil {
+		b.onChange(from, state)
+	}
+}
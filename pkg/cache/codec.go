@@ -0,0 +1,289 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ouz/goboilerplate/pkg/errors"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Format identifies the codec of an encoded value
+type Format byte
+
+const (
+	FormatJSON Format = iota + 1
+	FormatMsgpack
+	FormatGob
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatJSON:
+		return "json"
+	case FormatMsgpack:
+		return "msgpack"
+	case FormatGob:
+		return "gob"
+	default:
+		return "unknown"
+	}
+}
+
+// Compression identifies how an encoded value is compressed
+type Compression byte
+
+const (
+	CompressionNone Compression = iota
+	CompressionZstd
+	CompressionSnappy
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionZstd:
+		return "zstd"
+	case CompressionSnappy:
+		return "snappy"
+	default:
+		return "unknown"
+	}
+}
+
+// valueMarker starts every encoded value, followed by its Format and Compression.
+// No JSON document starts with it, so values written before the marker existed
+// still decode as plain JSON
+const valueMarker = 0xCA
+
+const (
+	headerSize = 3
+	// maxDecodedSize bounds decompression of corrupt or hostile values
+	maxDecodedSize = 64 << 20
+)
+
+// Codec serializes cache values
+type Codec interface {
+	Format() Format
+	Marshal(value any) ([]byte, error)
+	Unmarshal(data []byte, result any) error
+}
+
+var (
+	JSON Codec = jsonCodec{}
+	// Msgpack timestamps carry no zone, times decode in the local time zone
+	Msgpack Codec = msgpackCodec{}
+	// Gob only encodes exported fields and needs interface values registered with gob.Register
+	Gob Codec = gobCodec{}
+)
+
+var codecs = map[Format]Codec{
+	FormatJSON:    JSON,
+	FormatMsgpack: Msgpack,
+	FormatGob:     Gob,
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Format() Format                          { return FormatJSON }
+func (jsonCodec) Marshal(value any) ([]byte, error)       { return json.Marshal(value) }
+func (jsonCodec) Unmarshal(data []byte, result any) error { return json.Unmarshal(data, result) }
+
+// msgpackCodec honours json tags, so a value caches the same fields whichever codec is used
+type msgpackCodec struct{}
+
+func (msgpackCodec) Format() Format { return FormatMsgpack }
+
+func (msgpackCodec) Marshal(value any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, result any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(result)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Format() Format { return FormatGob }
+
+func (gobCodec) Marshal(value any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, result any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(result)
+}
+
+// CodecByName returns the codec configured as json, msgpack or gob
+func CodecByName(name string) (Codec, error) {
+	switch name {
+	case "json":
+		return JSON, nil
+	case "msgpack":
+		return Msgpack, nil
+	case "gob":
+		return Gob, nil
+	}
+	return nil, errors.ValidationError(fmt.Sprintf("unknown cache codec %q", name), nil)
+}
+
+// CompressionByName returns the compression configured as none, zstd or snappy
+func CompressionByName(name string) (Compression, error) {
+	switch name {
+	case "", "none":
+		return CompressionNone, nil
+	case "zstd":
+		return CompressionZstd, nil
+	case "snappy":
+		return CompressionSnappy, nil
+	}
+	return CompressionNone, errors.ValidationError(fmt.Sprintf("unknown cache compression %q", name), nil)
+}
+
+type EncoderOptions struct {
+	// Codec encodes new values, defaults to JSON
+	Codec       Codec
+	Compression Compression
+	// CompressionThreshold is the encoded size from which values are compressed,
+	// smaller values rarely shrink enough to pay for it
+	CompressionThreshold int
+}
+
+// Encoder turns cache values into bytes tagged with their format and compression.
+// Values are decoded by their own tag, so changing the codec or compression does
+// not require flushing the cache
+type Encoder struct {
+	options EncoderOptions
+	zstdEnc *zstd.Encoder
+	zstdDec *zstd.Decoder
+}
+
+func NewEncoder(options EncoderOptions) *Encoder {
+	if options.Codec == nil {
+		options.Codec = JSON
+	}
+
+	// Created without a writer or reader these only fail on invalid options
+	zstdEnc, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+	zstdDec, _ := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxDecodedSize))
+
+	return &Encoder{
+		options: options,
+		zstdEnc: zstdEnc,
+		zstdDec: zstdDec,
+	}
+}
+
+// DefaultEncoder encodes uncompressed JSON
+func DefaultEncoder() *Encoder {
+	return NewEncoder(EncoderOptions{Codec: JSON})
+}
+
+func (e *Encoder) Encode(value any) ([]byte, error) {
+	payload, err := e.options.Codec.Marshal(value)
+	if err != nil {
+		return nil, errors.GenericError("error encoding cache value", err)
+	}
+
+	compression := CompressionNone
+	if e.options.Compression != CompressionNone && len(payload) >= e.options.CompressionThreshold {
+		compression = e.options.Compression
+	}
+
+	header := []byte{valueMarker, byte(e.options.Codec.Format()), byte(compression)}
+	switch compression {
+	case CompressionZstd:
+		return e.zstdEnc.EncodeAll(payload, header), nil
+	case CompressionSnappy:
+		return append(header, snappy.Encode(nil, payload)...), nil
+	}
+	return append(header, payload...), nil
+}
+
+func (e *Encoder) Decode(data []byte, result any) error {
+	codec, _, payload, err := e.unwrap(data)
+	if err != nil {
+		return err
+	}
+
+	if err := codec.Unmarshal(payload, result); err != nil {
+		return errors.GenericError("error decoding cache value", err)
+	}
+	return nil
+}
+
+// Describe decodes data without knowing its type, for inspection. Gob values cannot
+// be decoded that way and come back as a nil value
+func (e *Encoder) Describe(data []byte) (Format, Compression, any, error) {
+	codec, compression, payload, err := e.unwrap(data)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if codec.Format() == FormatGob {
+		return FormatGob, compression, nil, nil
+	}
+
+	var value any
+	if err := codec.Unmarshal(payload, &value); err != nil {
+		return 0, 0, nil, errors.GenericError("error decoding cache value", err)
+	}
+	return codec.Format(), compression, value, nil
+}
+
+// unwrap reads the marker of data and returns its codec, compression and decompressed payload
+func (e *Encoder) unwrap(data []byte) (Codec, Compression, []byte, error) {
+	if len(data) == 0 || data[0] != valueMarker {
+		return JSON, CompressionNone, data, nil
+	}
+	if len(data) < headerSize {
+		return nil, 0, nil, errors.GenericError("truncated cache value", nil)
+	}
+
+	codec, ok := codecs[Format(data[1])]
+	if !ok {
+		return nil, 0, nil, errors.GenericError(fmt.Sprintf("unknown cache value format %d", data[1]), nil)
+	}
+
+	compression := Compression(data[2])
+	payload, err := e.decompress(compression, data[headerSize:])
+	if err != nil {
+		return nil, 0, nil, errors.GenericError("error decompressing cache value", err)
+	}
+	return codec, compression, payload, nil
+}
+
+func (e *Encoder) decompress(compression Compression, data []byte) ([]byte, error) {
+	switch compression {
+	case CompressionNone:
+		return data, nil
+	case CompressionZstd:
+		return e.zstdDec.DecodeAll(data, nil)
+	case CompressionSnappy:
+		size, err := snappy.DecodedLen(data)
+		if err != nil {
+			return nil, err
+		}
+		if size > maxDecodedSize {
+			return nil, fmt.Errorf("decoded size %d exceeds %d", size, maxDecodedSize)
+		}
+		return snappy.Decode(nil, data)
+	}
+	return nil, fmt.Errorf("unknown compression %d", compression)
+}
@@ -1,69 +1,86 @@
 package cache
 
 import (
-	"encoding/json"
-	"fmt"
-	"sync"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand/v2"
 	"time"
 
 	"github.com/coocood/freecache"
 	"github.com/ouz/goboilerplate/pkg/log"
 )
 
-var (
-	cacheKeysWithPrefix = make(map[string]map[string]struct{})
-	keyPrefixMu         sync.Mutex
-)
+// generationKeyPrefix starts with a byte no data key starts with, so generations
+// cannot collide with cached values
+const generationKeyPrefix = "\x00generation:"
 
+// localCache evicts by prefix without indexing keys. Every prefix has a random
+// generation stored in freecache itself and part of each full key, EvictByPrefix
+// replaces the generation and the orphaned entries age out of freecache like any
+// other. Memory stays within the freecache size however many keys churn through
 type localCache struct {
-	cache  *freecache.Cache
-	logger *log.Logger
+	cache   *freecache.Cache
+	encoder *Encoder
+	logger  *log.Logger
 }
 
-func NewLocalCacheService(logger *log.Logger, sizeMB int) LocalCacheService {
+func NewLocalCacheService(logger *log.Logger, sizeMB int, encoder *Encoder) LocalCacheService {
 	return &localCache{
-		cache:  freecache.NewCache(sizeMB * 1024 * 1024),
-		logger: logger,
+		cache:   freecache.NewCache(sizeMB * 1024 * 1024),
+		encoder: encoder,
+		logger:  logger,
 	}
 }
 
-func buildFullKey(prefix, key string) string {
-	return fmt.Sprintf("%s:%s", prefix, key)
+func newGeneration() []byte {
+	return binary.BigEndian.AppendUint64(nil, rand.Uint64())
 }
 
-func (c *localCache) Set(prefix, key string, ttl time.Duration, value interface{}) {
-	fullKey := buildFullKey(prefix, key)
+// generation returns the current generation of prefix, starting a new one when it
+// was never set or freecache evicted it. A new generation only hides entries, an
+// evicted generation can never bring stale entries back
+func (c *localCache) generation(prefix string) []byte {
+	generation := newGeneration()
+	// GetOrSet returns nil when it stored generation. If storing failed the entries
+	// written under it are simply never found again
+	if existing, _ := c.cache.GetOrSet([]byte(generationKeyPrefix+prefix), generation, 0); existing != nil {
+		return existing
+	}
+	return generation
+}
 
-	jsonData, err := json.Marshal(value)
+func (c *localCache) buildFullKey(prefix, key string) []byte {
+	fullKey := make([]byte, 0, len(prefix)+len(key)+10)
+	fullKey = append(fullKey, prefix...)
+	fullKey = append(fullKey, ':')
+	fullKey = append(fullKey, c.generation(prefix)...)
+	fullKey = append(fullKey, ':')
+	return append(fullKey, key...)
+}
+
+func (c *localCache) Set(prefix, key string, ttl time.Duration, value interface{}) {
+	data, err := c.encoder.Encode(value)
 	if err != nil {
-		c.logger.Error("Failed to marshal cache value", "error", err, "prefix", prefix, "key", key)
+		c.logger.Error("Failed to encode cache value", "error", err, "prefix", prefix, "key", key)
 		return
 	}
 
-	if err := c.cache.Set([]byte(fullKey), jsonData, int(ttl.Seconds())); err != nil {
+	if err := c.cache.Set(c.buildFullKey(prefix, key), data, int(ttl.Seconds())); err != nil {
 		c.logger.Error("Failed to set cache value", "error", err, "prefix", prefix, "key", key)
 	}
-	keyPrefixMu.Lock()
-	defer keyPrefixMu.Unlock()
-
-	if _, exists := cacheKeysWithPrefix[prefix]; !exists {
-		cacheKeysWithPrefix[prefix] = make(map[string]struct{})
-	}
-
-	if _, exists := cacheKeysWithPrefix[prefix][fullKey]; !exists {
-		cacheKeysWithPrefix[prefix][fullKey] = struct{}{}
-	}
 }
 
 func (c *localCache) Get(prefix, key string, result interface{}) (bool, error) {
-	fullKey := buildFullKey(prefix, key)
-
-	cachedData, err := c.cache.Get([]byte(fullKey))
+	cachedData, err := c.cache.Get(c.buildFullKey(prefix, key))
+	if errors.Is(err, freecache.ErrNotFound) {
+		return false, nil
+	}
 	if err != nil || cachedData == nil {
 		return false, err
 	}
 
-	if err := json.Unmarshal(cachedData, result); err != nil {
+	if err := c.encoder.Decode(cachedData, result); err != nil {
 		return false, err
 	}
 
@@ -71,28 +88,56 @@ func (c *localCache) Get(prefix, key string, result interface{}) (bool, error) {
 }
 
 func (c *localCache) Evict(prefix, key string) {
-	fullKey := buildFullKey(prefix, key)
-	c.cache.Del([]byte(fullKey))
+	c.cache.Del(c.buildFullKey(prefix, key))
+}
 
-	keyPrefixMu.Lock()
-	defer keyPrefixMu.Unlock()
+func (c *localCache) EvictByPrefix(prefix string) {
+	if err := c.cache.Set([]byte(generationKeyPrefix+prefix), newGeneration(), 0); err != nil {
+		// Dropping the generation still hides every entry, the next access starts a new one
+		c.cache.Del([]byte(generationKeyPrefix + prefix))
+		c.logger.Error("Failed to start new cache generation", "error", err, "prefix", prefix)
+	}
+}
 
-	if keys, exists := cacheKeysWithPrefix[prefix]; exists {
-		delete(keys, fullKey)
-		if len(keys) == 0 {
-			delete(cacheKeysWithPrefix, prefix)
-		}
+func (c *localCache) Inspect(prefix, key string) (EntryInfo, bool, error) {
+	data, expireAt, err := c.cache.GetWithExpiration(c.buildFullKey(prefix, key))
+	if errors.Is(err, freecache.ErrNotFound) {
+		return EntryInfo{}, false, nil
 	}
+	if err != nil {
+		return EntryInfo{}, false, err
+	}
+
+	format, compression, value, err := c.encoder.Describe(data)
+	if err != nil {
+		return EntryInfo{}, false, err
+	}
+
+	info := EntryInfo{
+		Prefix:      prefix,
+		Key:         key,
+		Size:        len(data),
+		Format:      format.String(),
+		Compression: compression.String(),
+		Value:       value,
+	}
+	if expireAt > 0 {
+		info.TTL = time.Until(time.Unix(int64(expireAt), 0))
+	}
+	return info, true, nil
 }
 
-func (c *localCache) EvictByPrefix(prefix string) {
-	keyPrefixMu.Lock()
-	defer keyPrefixMu.Unlock()
+// Stats walks every entry and counts those of the current generation of prefix
+func (c *localCache) Stats(prefix string) PrefixStats {
+	keyPrefix := c.buildFullKey(prefix, "")
 
-	if keys, exists := cacheKeysWithPrefix[prefix]; exists {
-		for fullKey := range keys {
-			c.cache.Del([]byte(fullKey))
+	var stats PrefixStats
+	it := c.cache.NewIterator()
+	for entry := it.Next(); entry != nil; entry = it.Next() {
+		if bytes.HasPrefix(entry.Key, keyPrefix) {
+			stats.Keys++
+			stats.Bytes += int64(len(entry.Key) + len(entry.Value))
 		}
-		delete(cacheKeysWithPrefix, prefix)
 	}
+	return stats
 }
@@ -0,0 +1,230 @@
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	errs "errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ouz/goboilerplate/pkg/errors"
+	"github.com/ouz/goboilerplate/pkg/log"
+	"github.com/redis/go-redis/extra/redisotel/v9"
+	"github.com/redis/go-redis/v9"
+)
+
+// Deployment modes of Valkey
+const (
+	ModeStandalone = "standalone"
+	ModeSentinel   = "sentinel"
+	ModeCluster    = "cluster"
+)
+
+// TLSOptions enables TLS to Valkey. CAFile verifies servers signed by a private CA,
+// CertFile and KeyFile present a client certificate for mutual TLS
+type TLSOptions struct {
+	Enabled            bool
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+type ConnectOptions struct {
+	Mode string
+	// Addrs are the node addresses in standalone and cluster mode and the sentinel
+	// addresses in sentinel mode. Standalone mode uses the first one
+	Addrs      []string
+	MasterName string
+	Username   string
+	Password   string
+	// SentinelUsername and SentinelPassword authenticate to the sentinels when they
+	// use other credentials than the master
+	SentinelUsername string
+	SentinelPassword string
+	// DB is only supported in standalone and sentinel mode
+	DB           int
+	PoolSize     int
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	TLS          TLSOptions
+
+	// RequiredOnStartup fails ConnectRedis when Valkey cannot be reached. Otherwise
+	// the client is returned anyway and reconnects once Valkey is back
+	RequiredOnStartup bool
+	MonitoringEnabled bool
+}
+
+// ValidateMode reports whether mode with the given addresses, master name and DB
+// describes a deployment ConnectRedis can reach
+func ValidateMode(mode string, addrs []string, masterName string, db int) error {
+	switch mode {
+	case ModeStandalone:
+		if len(addrs) == 0 {
+			return errors.ValidationError("valkey standalone mode needs an address", nil)
+		}
+	case ModeSentinel:
+		if len(addrs) == 0 || masterName == "" {
+			return errors.ValidationError("valkey sentinel mode needs sentinel addresses and a master name", nil)
+		}
+	case ModeCluster:
+		if len(addrs) == 0 {
+			return errors.ValidationError("valkey cluster mode needs at least one node address", nil)
+		}
+		if db != 0 {
+			return errors.ValidationError("valkey cluster mode only supports DB 0", nil)
+		}
+	default:
+		return errors.ValidationError(fmt.Sprintf("unknown valkey mode %q, want %q, %q or %q", mode, ModeStandalone, ModeSentinel, ModeCluster), nil)
+	}
+	return nil
+}
+
+// NewUniversalOptions translates options to the go-redis options of its mode
+func NewUniversalOptions(options ConnectOptions) (*redis.UniversalOptions, error) {
+	if err := ValidateMode(options.Mode, options.Addrs, options.MasterName, options.DB); err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := NewTLSConfig(options.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	universal := &redis.UniversalOptions{
+		Addrs:            options.Addrs,
+		Username:         options.Username,
+		Password:         options.Password,
+		SentinelUsername: options.SentinelUsername,
+		SentinelPassword: options.SentinelPassword,
+		DB:               options.DB,
+		PoolSize:         options.PoolSize,
+		DialTimeout:      options.DialTimeout,
+		ReadTimeout:      options.ReadTimeout,
+		WriteTimeout:     options.WriteTimeout,
+		TLSConfig:        tlsConfig,
+	}
+
+	switch options.Mode {
+	case ModeStandalone:
+		universal.Addrs = options.Addrs[:1]
+	case ModeSentinel:
+		universal.MasterName = options.MasterName
+	case ModeCluster:
+		// A single address is a configuration endpoint, not a standalone node
+		universal.IsClusterMode = true
+	}
+	return universal, nil
+}
+
+// NewTLSConfig returns the TLS configuration of options, or nil if TLS is disabled
+func NewTLSConfig(options TLSOptions) (*tls.Config, error) {
+	if !options.Enabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         options.ServerName,
+		InsecureSkipVerify: options.InsecureSkipVerify,
+	}
+
+	if options.CAFile != "" {
+		pem, err := os.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, errors.GenericError("error reading valkey CA file", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.ValidationError(fmt.Sprintf("valkey CA file %q contains no certificates", options.CAFile), nil)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if options.CertFile != "" || options.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			return nil, errors.GenericError("error loading valkey client certificate", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// ConnectRedis connects to Valkey in the mode of options and checks the connection
+func ConnectRedis(logger *log.Logger, options ConnectOptions) (redis.UniversalClient, error) {
+	universal, err := NewUniversalOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	client := redis.NewUniversalClient(universal)
+
+	if options.MonitoringEnabled {
+		commandFilter := func(cmd redis.Cmder) bool {
+			switch cmd.Name() {
+			case "xreadgroup", "xadd", "xack", "xgroup", "xinfo", "xlen", "xrange", "xpending":
+				return true // true = skip tracing for this command
+			default:
+				return false // false = trace this command
+			}
+		}
+
+		if err := redisotel.InstrumentTracing(client, redisotel.WithCommandFilter(commandFilter)); err != nil {
+			logger.Warn("Failed to instrument Redis tracing", "error", err)
+		}
+		if err := redisotel.InstrumentMetrics(client); err != nil {
+			logger.Warn("Failed to instrument Redis metrics", "error", err)
+		}
+	}
+
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		if options.RequiredOnStartup {
+			_ = client.Close()
+			return nil, err
+		}
+		logger.Warn("Valkey is unavailable, starting degraded", "error", err)
+	}
+
+	return client, nil
+}
+
+// unavailableReplies are reply errors of a node that cannot serve commands right now
+var unavailableReplies = []string{"LOADING", "CLUSTERDOWN", "MASTERDOWN", "TRYAGAIN"}
+
+// IsConnectionError reports whether err means Valkey could not be reached, as
+// opposed to a reply error for the command or a value that could not be encoded
+func IsConnectionError(err error) bool {
+	if err == nil || errs.Is(err, redis.Nil) {
+		return false
+	}
+
+	var netErr net.Error
+	if errs.As(err, &netErr) || errs.Is(err, context.DeadlineExceeded) || errs.Is(err, io.EOF) ||
+		errs.Is(err, io.ErrUnexpectedEOF) || errs.Is(err, redis.ErrPoolTimeout) || errs.Is(err, redis.ErrClosed) {
+		return true
+	}
+
+	var replyErr redis.Error
+	if errs.As(err, &replyErr) {
+		for _, reply := range unavailableReplies {
+			if strings.HasPrefix(replyErr.Error(), reply) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CloseRedisClient closes the Redis client connection
+func CloseRedisClient(client redis.UniversalClient) error {
+	return client.Close()
+}
@@ -0,0 +1,172 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ouz/goboilerplate/pkg/cache"
+	"github.com/ouz/goboilerplate/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// defaultScanCount is the SCAN COUNT hint of a page when the caller gives none
+const defaultScanCount = 100
+
+// Scan returns one SCAN page. On a cluster the cursor also names the master being
+// scanned, masters are scanned one after another in address order
+func (r *redisCacheService) Scan(ctx context.Context, pattern, cursor string, count int64) ([]string, string, error) {
+	if count <= 0 {
+		count = defaultScanCount
+	}
+
+	var keys []string
+	var next string
+	var err error
+	if cluster, ok := r.client.(*redis.ClusterClient); ok {
+		keys, next, err = scanClusterPage(ctx, cluster, pattern, cursor, count)
+	} else {
+		keys, next, err = scanPage(ctx, r.client, pattern, cursor, count)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return keys, next, nil
+}
+
+func scanPage(ctx context.Context, client redis.Cmdable, pattern, cursor string, count int64) ([]string, string, error) {
+	var position uint64
+	if cursor != "" {
+		var err error
+		if position, err = strconv.ParseUint(cursor, 10, 64); err != nil {
+			return nil, "", errors.ValidationError(fmt.Sprintf("invalid scan cursor %q", cursor), nil)
+		}
+	}
+
+	keys, next, err := client.Scan(ctx, position, pattern, count).Result()
+	if err != nil {
+		return nil, "", errors.GenericError("error scanning keys from redis", err)
+	}
+	if next == 0 {
+		return keys, "", nil
+	}
+	return keys, strconv.FormatUint(next, 10), nil
+}
+
+func scanClusterPage(ctx context.Context, cluster *redis.ClusterClient, pattern, cursor string, count int64) ([]string, string, error) {
+	masters, err := clusterMasters(ctx, cluster)
+	if err != nil {
+		return nil, "", errors.GenericError("error listing cluster masters", err)
+	}
+	if len(masters) == 0 {
+		return nil, "", nil
+	}
+
+	addrs := make([]string, 0, len(masters))
+	for addr := range masters {
+		addrs = append(addrs, addr)
+	}
+	slices.Sort(addrs)
+
+	addr, position := addrs[0], ""
+	if cursor != "" {
+		var ok bool
+		// Addresses contain colons, the node cursor follows the last slash
+		separator := strings.LastIndex(cursor, "/")
+		if separator >= 0 {
+			addr, position = cursor[:separator], cursor[separator+1:]
+		}
+		if _, ok = masters[addr]; separator < 0 || !ok {
+			return nil, "", errors.ValidationError(fmt.Sprintf("invalid scan cursor %q", cursor), nil)
+		}
+	}
+
+	keys, next, err := scanPage(ctx, masters[addr], pattern, position, count)
+	if err != nil {
+		return nil, "", err
+	}
+	if next != "" {
+		return keys, addr + "/" + next, nil
+	}
+
+	// This master is done, continue with the next one
+	if i := slices.Index(addrs, addr); i+1 < len(addrs) {
+		return keys, addrs[i+1] + "/", nil
+	}
+	return keys, "", nil
+}
+
+func clusterMasters(ctx context.Context, cluster *redis.ClusterClient) (map[string]*redis.Client, error) {
+	var mu sync.Mutex
+	masters := map[string]*redis.Client{}
+	err := cluster.ForEachMaster(ctx, func(_ context.Context, node *redis.Client) error {
+		mu.Lock()
+		masters[node.Options().Addr] = node
+		mu.Unlock()
+		return nil
+	})
+	return masters, err
+}
+
+// Inspect reads the value and remaining TTL of key in one round-trip
+func (r *redisCacheService) Inspect(ctx context.Context, prefix, key string) (cache.EntryInfo, bool, error) {
+	fullKey := buildRedisFullKey(prefix, key)
+
+	pipe := r.client.Pipeline()
+	get := pipe.Get(ctx, fullKey)
+	ttl := pipe.PTTL(ctx, fullKey)
+	if _, err := pipe.Exec(ctx); err == redis.Nil {
+		return cache.EntryInfo{}, false, nil
+	} else if err != nil {
+		return cache.EntryInfo{}, false, errors.GenericError("error inspecting key in redis", err)
+	}
+
+	data, _ := get.Bytes()
+	format, compression, value, err := r.encoder.Describe(data)
+	if err != nil {
+		return cache.EntryInfo{}, false, err
+	}
+
+	info := cache.EntryInfo{
+		Prefix:      prefix,
+		Key:         key,
+		Size:        len(data),
+		Format:      format.String(),
+		Compression: compression.String(),
+		Value:       value,
+	}
+	// PTTL is negative for keys without expiry
+	if remaining := ttl.Val(); remaining > 0 {
+		info.TTL = remaining.Round(time.Millisecond)
+	}
+	return info, true, nil
+}
+
+// Stats scans the keys of prefix and sums their MEMORY USAGE
+func (r *redisCacheService) Stats(ctx context.Context, prefix string) (cache.PrefixStats, error) {
+	keys, err := r.scan(ctx, fmt.Sprintf("%s:*", prefix))
+	if err != nil {
+		return cache.PrefixStats{}, errors.GenericError("error scanning keys from redis", err)
+	}
+
+	stats := cache.PrefixStats{Keys: int64(len(keys))}
+	for batch := range slices.Chunk(keys, defaultScanCount) {
+		pipe := r.client.Pipeline()
+		usages := make([]*redis.IntCmd, len(batch))
+		for i, key := range batch {
+			usages[i] = pipe.MemoryUsage(ctx, key)
+		}
+		// Keys that expired since the scan report redis.Nil and count no memory
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return cache.PrefixStats{}, errors.GenericError("error reading memory usage from redis", err)
+		}
+		for _, usage := range usages {
+			stats.Bytes += usage.Val()
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,68 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ouz/goboilerplate/pkg/cache"
+	"github.com/ouz/goboilerplate/pkg/errors"
+	"github.com/ouz/goboilerplate/pkg/log"
+	"github.com/redis/go-redis/v9"
+)
+
+const invalidationChannel = "cache:invalidations"
+
+type invalidationBus struct {
+	client redis.UniversalClient
+	logger *log.Logger
+}
+
+// NewInvalidationBus broadcasts local cache invalidations over Valkey pub/sub.
+// Pub/sub is fire and forget, instances that are disconnected miss invalidations
+// and rely on the local TTL instead
+func NewInvalidationBus(logger *log.Logger, client redis.UniversalClient) cache.InvalidationBus {
+	return &invalidationBus{
+		client: client,
+		logger: logger,
+	}
+}
+
+func (b *invalidationBus) Publish(ctx context.Context, invalidation cache.Invalidation) error {
+	payload, err := json.Marshal(invalidation)
+	if err != nil {
+		return errors.GenericError("error marshaling cache invalidation", err)
+	}
+
+	if err := b.client.Publish(ctx, invalidationChannel, payload).Err(); err != nil {
+		return errors.GenericError("error publishing cache invalidation", err)
+	}
+	return nil
+}
+
+func (b *invalidationBus) Subscribe(ctx context.Context, handler func(cache.Invalidation)) error {
+	pubsub := b.client.Subscribe(ctx, invalidationChannel)
+	defer pubsub.Close()
+
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return errors.GenericError("error subscribing to cache invalidations", err)
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+
+			var invalidation cache.Invalidation
+			if err := json.Unmarshal([]byte(msg.Payload), &invalidation); err != nil {
+				b.logger.Error("Invalid cache invalidation", "error", err)
+				continue
+			}
+			handler(invalidation)
+		}
+	}
+}
@@ -2,68 +2,30 @@ package redis
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"reflect"
+	"sync"
 	"time"
 
 	"github.com/ouz/goboilerplate/pkg/cache"
 	"github.com/ouz/goboilerplate/pkg/errors"
-	"github.com/ouz/goboilerplate/pkg/log"
-	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
 )
 
 // redisCacheService implements the RedisCacheService interface from the cache package
 type redisCacheService struct {
-	client *redis.Client
+	client  redis.UniversalClient
+	encoder *cache.Encoder
 }
 
-// NewRedisCacheService creates a new instance of RedisCacheService
-func NewRedisCacheService(client *redis.Client) cache.RedisCacheService {
+// NewRedisCacheService creates a new instance of RedisCacheService encoding values with encoder
+func NewRedisCacheService(client redis.UniversalClient, encoder *cache.Encoder) cache.RedisCacheService {
 	return &redisCacheService{
-		client: client,
+		client:  client,
+		encoder: encoder,
 	}
 }
 
-// ConnectRedis establishes a connection to Redis
-func ConnectRedis(logger *log.Logger, host, port string, monitoringEnabled bool) (*redis.Client, error) {
-	opt := &redis.Options{
-		Addr: fmt.Sprintf("%s:%s", host, port),
-	}
-
-	client := redis.NewClient(opt)
-
-	if monitoringEnabled {
-		commandFilter := func(cmd redis.Cmder) bool {
-			switch cmd.Name() {
-			case "xreadgroup", "xadd", "xack", "xgroup", "xinfo", "xlen", "xrange", "xpending":
-				return true // true = skip tracing for this command
-			default:
-				return false // false = trace this command
-			}
-		}
-
-		if err := redisotel.InstrumentTracing(client, redisotel.WithCommandFilter(commandFilter)); err != nil {
-			logger.Warn("Failed to instrument Redis tracing", "error", err)
-		}
-		if err := redisotel.InstrumentMetrics(client); err != nil {
-			logger.Warn("Failed to instrument Redis metrics", "error", err)
-		}
-	}
-
-	_, err := client.Ping(context.Background()).Result()
-	if err != nil {
-		return nil, err
-	}
-
-	return client, nil
-}
-
-// CloseRedisClient closes the Redis client connection
-func CloseRedisClient(client *redis.Client) error {
-	return client.Close()
-}
-
 func buildRedisFullKey(prefix, key string) string {
 	return fmt.Sprintf("%s:%s", prefix, key)
 }
@@ -72,12 +34,12 @@ func buildRedisFullKey(prefix, key string) string {
 func (r *redisCacheService) Set(ctx context.Context, prefix, key string, ttl time.Duration, value interface{}) error {
 	fullKey := buildRedisFullKey(prefix, key)
 
-	jsonData, err := json.Marshal(value)
+	data, err := r.encoder.Encode(value)
 	if err != nil {
-		return errors.GenericError("error marshaling value", err)
+		return err
 	}
 
-	err = r.client.Set(ctx, fullKey, jsonData, ttl).Err()
+	err = r.client.Set(ctx, fullKey, data, ttl).Err()
 	if err != nil {
 		return errors.GenericError("error setting value to redis", err)
 	}
@@ -96,8 +58,8 @@ func (r *redisCacheService) Get(ctx context.Context, prefix, key string, result
 		return false, errors.GenericError("error getting value from redis", err)
 	}
 
-	if err := json.Unmarshal(cachedData, result); err != nil {
-		return false, errors.GenericError("error unmarshaling value", err)
+	if err := r.encoder.Decode(cachedData, result); err != nil {
+		return false, err
 	}
 
 	return true, nil
@@ -107,11 +69,11 @@ func (r *redisCacheService) Get(ctx context.Context, prefix, key string, result
 func (r *redisCacheService) Exists(ctx context.Context, prefix, key string) (bool, error) {
 	fullKey := buildRedisFullKey(prefix, key)
 
-	exists := r.client.Exists(ctx, fullKey).Val()
-	if exists == 0 {
-		return false, nil
+	exists, err := r.client.Exists(ctx, fullKey).Result()
+	if err != nil {
+		return false, errors.GenericError("error checking key in redis", err)
 	}
-	return true, nil
+	return exists > 0, nil
 }
 
 // Evict removes a specific key from the cache
@@ -126,25 +88,241 @@ func (r *redisCacheService) Evict(ctx context.Context, prefix, key string) error
 
 // EvictByPrefix removes all keys with the given prefix
 func (r *redisCacheService) EvictByPrefix(ctx context.Context, prefix string) error {
-	pattern := fmt.Sprintf("%s:*", prefix)
-	iter := r.client.Scan(ctx, 0, pattern, 0).Iterator()
-	var keys []string
-	for iter.Next(ctx) {
-		keys = append(keys, iter.Val())
-	}
-	if err := iter.Err(); err != nil {
+	keys, err := r.scan(ctx, fmt.Sprintf("%s:*", prefix))
+	if err != nil {
 		return errors.GenericError("error scanning keys from redis", err)
 	}
+	if len(keys) == 0 {
+		return nil
+	}
 
-	if len(keys) > 0 {
-		err := r.client.Del(ctx, keys...).Err()
-		if err != nil {
-			return errors.GenericError("error deleting keys from redis", err)
+	// Keys are deleted one by one, on a cluster they live in different slots
+	pipe := r.client.Pipeline()
+	for _, key := range keys {
+		pipe.Del(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return errors.GenericError("error deleting keys from redis", err)
+	}
+	return nil
+}
+
+// MGet retrieves the values of keys under prefix in a single round-trip
+func (r *redisCacheService) MGet(ctx context.Context, prefix string, keys []string, results []any) ([]bool, error) {
+	if len(keys) != len(results) {
+		return nil, errors.GenericError(fmt.Sprintf("got %d results for %d keys", len(results), len(keys)), nil)
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	fullKeys := make([]string, len(keys))
+	for i, key := range keys {
+		fullKeys[i] = buildRedisFullKey(prefix, key)
+	}
+
+	values, err := r.mget(ctx, fullKeys)
+	if err != nil {
+		return nil, errors.GenericError("error getting values from redis", err)
+	}
+
+	found := make([]bool, len(keys))
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		if err := r.encoder.Decode([]byte(data), results[i]); err != nil {
+			return nil, err
+		}
+		found[i] = true
+	}
+	return found, nil
+}
+
+// mget reads keys with MGET. A cluster rejects MGET across slots, there the keys
+// are read with one pipelined GET each
+func (r *redisCacheService) mget(ctx context.Context, keys []string) ([]any, error) {
+	if _, ok := r.client.(*redis.ClusterClient); !ok {
+		return r.client.MGet(ctx, keys...).Result()
+	}
+
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Get(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	values := make([]any, len(keys))
+	for i, cmd := range cmds {
+		if value, err := cmd.Result(); err == nil {
+			values[i] = value
+		}
+	}
+	return values, nil
+}
+
+// MSet stores entries with their own TTLs in one MULTI/EXEC round-trip. A
+// cluster client splits it per hash slot, atomic only within each slot
+func (r *redisCacheService) MSet(ctx context.Context, entries ...cache.Entry) error {
+	return r.Transaction(ctx, func(batch cache.Batch) {
+		for _, entry := range entries {
+			batch.Set(entry.Prefix, entry.Key, entry.TTL, entry.Value)
+		}
+	})
+}
+
+// SetNX stores a value only if the key does not exist yet
+func (r *redisCacheService) SetNX(ctx context.Context, prefix, key string, ttl time.Duration, value any) (bool, error) {
+	data, err := r.encoder.Encode(value)
+	if err != nil {
+		return false, err
+	}
+
+	set, err := r.client.SetNX(ctx, buildRedisFullKey(prefix, key), data, ttl).Result()
+	if err != nil {
+		return false, errors.GenericError("error setting value to redis", err)
+	}
+	return set, nil
+}
+
+// CompareAndSwap watches the key and replaces its value if it still decodes to expected.
+// Values are compared decoded, so they match whichever codec wrote them
+func (r *redisCacheService) CompareAndSwap(ctx context.Context, prefix, key string, ttl time.Duration, expected, value any) (bool, error) {
+	fullKey := buildRedisFullKey(prefix, key)
+	data, err := r.encoder.Encode(value)
+	if err != nil {
+		return false, err
+	}
+
+	swapped := false
+	err = r.client.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.Get(ctx, fullKey).Bytes()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if !r.matches(current, err != redis.Nil, expected) {
+			return nil
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, fullKey, data, ttl)
+			return nil
+		})
+		swapped = err == nil
+		return err
+	}, fullKey)
+
+	if err == redis.TxFailedErr {
+		// The key changed between the read and the write
+		return false, nil
+	} else if err != nil {
+		return false, errors.GenericError("error swapping value in redis", err)
+	}
+	return swapped, nil
+}
+
+func (r *redisCacheService) matches(current []byte, exists bool, expected any) bool {
+	if expected == nil || !exists {
+		return expected == nil && !exists
+	}
+
+	decoded := reflect.New(reflect.TypeOf(expected))
+	if err := r.encoder.Decode(current, decoded.Interface()); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(decoded.Elem().Interface(), expected)
+}
+
+// Incr increments a counter and sets its TTL only when the increment created it
+func (r *redisCacheService) Incr(ctx context.Context, prefix, key string, ttl time.Duration) (int64, error) {
+	fullKey := buildRedisFullKey(prefix, key)
+
+	var incr *redis.IntCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, fullKey)
+		if ttl > 0 {
+			pipe.ExpireNX(ctx, fullKey, ttl)
 		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.GenericError("error incrementing counter in redis", err)
+	}
+	return incr.Val(), nil
+}
+
+// Pipeline sends the queued writes in one round-trip, each command applies on its own
+func (r *redisCacheService) Pipeline(ctx context.Context, fn func(cache.Batch)) error {
+	return r.execBatch(ctx, r.client.Pipeline(), fn)
+}
+
+// Transaction sends the queued writes in one MULTI/EXEC round-trip, so they apply together
+func (r *redisCacheService) Transaction(ctx context.Context, fn func(cache.Batch)) error {
+	return r.execBatch(ctx, r.client.TxPipeline(), fn)
+}
+
+func (r *redisCacheService) execBatch(ctx context.Context, pipe redis.Pipeliner, fn func(cache.Batch)) error {
+	batch := &redisBatch{ctx: ctx, pipe: pipe, encoder: r.encoder}
+	fn(batch)
+
+	if batch.err != nil {
+		// Nothing is sent when a value could not be encoded
+		pipe.Discard()
+		return batch.err
+	}
+	if pipe.Len() == 0 {
+		return nil
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return errors.GenericError("error executing redis batch", err)
 	}
 	return nil
 }
 
+// redisBatch queues commands on a pipeline and keeps the first encoding error
+type redisBatch struct {
+	ctx     context.Context
+	pipe    redis.Pipeliner
+	encoder *cache.Encoder
+	err     error
+}
+
+func (b *redisBatch) Set(prefix, key string, ttl time.Duration, value any) {
+	data, err := b.encoder.Encode(value)
+	if err != nil {
+		if b.err == nil {
+			b.err = err
+		}
+		return
+	}
+	b.pipe.Set(b.ctx, buildRedisFullKey(prefix, key), data, ttl)
+}
+
+func (b *redisBatch) Evict(prefix, key string) {
+	b.pipe.Del(b.ctx, buildRedisFullKey(prefix, key))
+}
+
+func (b *redisBatch) SAdd(prefix, key string, ttl time.Duration, member string) {
+	fullKey := buildRedisFullKey(prefix, key)
+	b.pipe.SAdd(b.ctx, fullKey, member)
+	if ttl > 0 {
+		b.pipe.Expire(b.ctx, fullKey, ttl)
+	}
+}
+
+func (b *redisBatch) Incr(prefix, key string, ttl time.Duration) {
+	fullKey := buildRedisFullKey(prefix, key)
+	b.pipe.Incr(b.ctx, fullKey)
+	if ttl > 0 {
+		b.pipe.ExpireNX(b.ctx, fullKey, ttl)
+	}
+}
+
 // SAdd adds a member to a Redis set with TTL
 func (r *redisCacheService) SAdd(ctx context.Context, prefix, key string, ttl time.Duration, member string) error {
 	fullKey := buildRedisFullKey(prefix, key)
@@ -194,18 +372,36 @@ func (r *redisCacheService) SCard(ctx context.Context, prefix, key string) (int6
 	return count, nil
 }
 
-// Scan returns all keys matching a pattern
-func (r *redisCacheService) Scan(ctx context.Context, pattern string) ([]string, error) {
-	iter := r.client.Scan(ctx, 0, pattern, 0).Iterator()
+// scan collects the keys matching pattern. A cluster node only scans its own slots,
+// so on a cluster every master is scanned
+func (r *redisCacheService) scan(ctx context.Context, pattern string) ([]string, error) {
+	cluster, ok := r.client.(*redis.ClusterClient)
+	if !ok {
+		return scanNode(ctx, r.client, pattern)
+	}
+
+	var mu sync.Mutex
+	var keys []string
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		nodeKeys, err := scanNode(ctx, node, pattern)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		keys = append(keys, nodeKeys...)
+		mu.Unlock()
+		return nil
+	})
+	return keys, err
+}
+
+func scanNode(ctx context.Context, client redis.Cmdable, pattern string) ([]string, error) {
+	iter := client.Scan(ctx, 0, pattern, 0).Iterator()
 	var keys []string
 	for iter.Next(ctx) {
 		keys = append(keys, iter.Val())
 	}
-	if err := iter.Err(); err != nil {
-		return nil, errors.GenericError("error scanning keys from redis", err)
-	}
-
-	return keys, nil
+	return keys, iter.Err()
 }
 
 // CloseRedisClient closes the Redis client connection
@@ -0,0 +1,376 @@
+package cache
+
+import (
+	"context"
+	errs "errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ouz/goboilerplate/pkg/errors"
+	"github.com/ouz/goboilerplate/pkg/log"
+)
+
+const (
+	healthPrefix = "health"
+	healthKey    = "ping"
+
+	// maxPendingEvictions bounds the evictions kept for replay, past it a key
+	// eviction is replaced by the eviction of its whole prefix
+	maxPendingEvictions = 10000
+)
+
+// ErrUnavailable is wrapped by the errors of calls that could not reach Valkey or
+// were rejected because the circuit is open
+var ErrUnavailable = errs.New("cache unavailable")
+
+// IsUnavailable reports whether err means the cache could not be reached
+func IsUnavailable(err error) bool {
+	return errs.Is(err, ErrUnavailable)
+}
+
+type ResilienceOptions struct {
+	// Timeout bounds every call to Valkey
+	Timeout time.Duration
+	// FailureThreshold is the number of consecutive failures that opens the circuit
+	FailureThreshold int
+	// OpenDuration is how long an open circuit rejects calls before it lets a trial call through
+	OpenDuration time.Duration
+	// FailOpenPrefixes are the prefixes whose reads turn into misses and whose writes
+	// are skipped while Valkey is unavailable. Calls on all other prefixes fail closed
+	// with an error wrapping ErrUnavailable. A prefix also covers the prefixes below
+	// it, "uat" covers "uat:1:web". Evictions never fail open, see Evict
+	FailOpenPrefixes []string
+	// IsFailure reports whether an error means Valkey is unavailable, nil counts every
+	// error. Reply errors such as a wrong type should not open the circuit
+	IsFailure func(error) bool
+}
+
+// ResilientCacheService is a RedisCacheService that bounds every call with a
+// timeout and stops calling Valkey while it keeps failing
+type ResilientCacheService interface {
+	RedisCacheService
+	State() CircuitState
+	// Check probes Valkey if the circuit lets a call through. An open circuit
+	// recovers through these probes as well as through regular calls
+	Check(ctx context.Context) error
+}
+
+type resilientCache struct {
+	remote  RedisCacheService
+	breaker *circuitBreaker
+	options ResilienceOptions
+	logger  *log.Logger
+
+	evictionsMu sync.Mutex
+	evictions   map[eviction]struct{}
+	// pending is set while evictions wait for replay, replaying while a replay runs
+	pending   atomic.Bool
+	replaying atomic.Bool
+}
+
+// eviction is an eviction that failed while Valkey was unavailable, all evicts the whole prefix
+type eviction struct {
+	prefix string
+	key    string
+	all    bool
+}
+
+func NewResilientCacheService(logger *log.Logger, remote RedisCacheService, options ResilienceOptions) ResilientCacheService {
+	c := &resilientCache{
+		remote:    remote,
+		options:   options,
+		logger:    logger,
+		evictions: map[eviction]struct{}{},
+	}
+	c.breaker = newCircuitBreaker(options.FailureThreshold, options.OpenDuration, func(from, to CircuitState) {
+		switch to {
+		case CircuitOpen:
+			logger.Error("Cache circuit opened, Valkey is unavailable", "from", from.String(), "retry_in", options.OpenDuration)
+		case CircuitClosed:
+			logger.Info("Cache circuit closed, Valkey is reachable again")
+		}
+	})
+	return c
+}
+
+func (c *resilientCache) State() CircuitState {
+	return c.breaker.State()
+}
+
+func (c *resilientCache) Check(ctx context.Context) error {
+	return c.do(ctx, func(ctx context.Context) error {
+		_, err := c.remote.Exists(ctx, healthPrefix, healthKey)
+		return err
+	})
+}
+
+// do runs call through the circuit breaker within the call timeout
+func (c *resilientCache) do(ctx context.Context, call func(ctx context.Context) error) error {
+	callCtx, cancel := context.WithTimeout(ctx, c.options.Timeout)
+	defer cancel()
+	return c.guard(ctx, callCtx, call)
+}
+
+// guard runs call with callCtx through the circuit breaker, ctx is the context of the caller
+func (c *resilientCache) guard(ctx, callCtx context.Context, call func(ctx context.Context) error) error {
+	if !c.breaker.allow() {
+		return errors.ServiceUnavailableError("Cache is unavailable", ErrUnavailable)
+	}
+
+	err := call(callCtx)
+
+	switch {
+	case err == nil:
+		c.breaker.success()
+		if c.pending.Load() {
+			go c.replayEvictions()
+		}
+	case ctx.Err() != nil:
+		// The caller gave up, that says nothing about Valkey
+		c.breaker.abandon()
+	case c.options.IsFailure == nil || c.options.IsFailure(err):
+		c.breaker.failure()
+		return errors.ServiceUnavailableError("Cache is unavailable", fmt.Errorf("%w: %w", ErrUnavailable, err))
+	default:
+		// Valkey replied, even if with an error
+		c.breaker.success()
+	}
+	return err
+}
+
+// failOpen reports whether calls on prefix degrade instead of failing
+func (c *resilientCache) failOpen(prefix string) bool {
+	for _, p := range c.options.FailOpenPrefixes {
+		if prefix == p || strings.HasPrefix(prefix, p+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// degrade drops an unavailability error of a fail-open prefix
+func (c *resilientCache) degrade(err error, prefixes ...string) error {
+	if !IsUnavailable(err) {
+		return err
+	}
+	for _, prefix := range prefixes {
+		if !c.failOpen(prefix) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *resilientCache) Set(ctx context.Context, prefix, key string, ttl time.Duration, value any) error {
+	return c.degrade(c.do(ctx, func(ctx context.Context) error {
+		return c.remote.Set(ctx, prefix, key, ttl, value)
+	}), prefix)
+}
+
+func (c *resilientCache) Get(ctx context.Context, prefix, key string, result any) (bool, error) {
+	var found bool
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		found, err = c.remote.Get(ctx, prefix, key, result)
+		return err
+	})
+	return found, c.degrade(err, prefix)
+}
+
+func (c *resilientCache) Exists(ctx context.Context, prefix, key string) (bool, error) {
+	var found bool
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		found, err = c.remote.Exists(ctx, prefix, key)
+		return err
+	})
+	return found, c.degrade(err, prefix)
+}
+
+// Evict fails even for fail-open prefixes, a skipped eviction would serve stale
+// data such as old roles once Valkey is back. Evictions that failed because Valkey
+// was unavailable are also kept and replayed after the next successful call
+func (c *resilientCache) Evict(ctx context.Context, prefix, key string) error {
+	return c.evict(ctx, eviction{prefix: prefix, key: key})
+}
+
+// EvictByPrefix fails and is replayed like Evict
+func (c *resilientCache) EvictByPrefix(ctx context.Context, prefix string) error {
+	return c.evict(ctx, eviction{prefix: prefix, all: true})
+}
+
+func (c *resilientCache) evict(ctx context.Context, e eviction) error {
+	err := c.do(ctx, func(ctx context.Context) error {
+		if e.all {
+			return c.remote.EvictByPrefix(ctx, e.prefix)
+		}
+		return c.remote.Evict(ctx, e.prefix, e.key)
+	})
+	if IsUnavailable(err) {
+		c.recordEviction(e)
+	}
+	return err
+}
+
+func (c *resilientCache) recordEviction(e eviction) {
+	c.evictionsMu.Lock()
+	defer c.evictionsMu.Unlock()
+
+	if len(c.evictions) >= maxPendingEvictions {
+		e = eviction{prefix: e.prefix, all: true}
+	}
+	c.evictions[e] = struct{}{}
+	c.pending.Store(true)
+}
+
+// replayEvictions retries the evictions that failed while Valkey was unavailable,
+// the ones that fail again are kept for the next replay
+func (c *resilientCache) replayEvictions() {
+	if !c.replaying.CompareAndSwap(false, true) {
+		return
+	}
+	defer c.replaying.Store(false)
+
+	c.evictionsMu.Lock()
+	evictions := c.evictions
+	c.evictions = map[eviction]struct{}{}
+	c.pending.Store(false)
+	c.evictionsMu.Unlock()
+
+	replayed := 0
+	for e := range evictions {
+		if err := c.evict(context.Background(), e); err != nil {
+			if !IsUnavailable(err) {
+				c.logger.Error("Failed to replay cache eviction", "prefix", e.prefix, "key", e.key, "error", err)
+			}
+			continue
+		}
+		replayed++
+	}
+	if replayed > 0 {
+		c.logger.Info("Replayed cache evictions that failed while Valkey was unavailable", "count", replayed)
+	}
+}
+
+func (c *resilientCache) MGet(ctx context.Context, prefix string, keys []string, results []any) ([]bool, error) {
+	var found []bool
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		found, err = c.remote.MGet(ctx, prefix, keys, results)
+		return err
+	})
+	if err != nil && c.degrade(err, prefix) == nil {
+		return make([]bool, len(keys)), nil
+	}
+	return found, err
+}
+
+// MSet only degrades when every entry belongs to a fail-open prefix
+func (c *resilientCache) MSet(ctx context.Context, entries ...Entry) error {
+	prefixes := make([]string, len(entries))
+	for i, entry := range entries {
+		prefixes[i] = entry.Prefix
+	}
+	return c.degrade(c.do(ctx, func(ctx context.Context) error {
+		return c.remote.MSet(ctx, entries...)
+	}), prefixes...)
+}
+
+func (c *resilientCache) SetNX(ctx context.Context, prefix, key string, ttl time.Duration, value any) (bool, error) {
+	var set bool
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		set, err = c.remote.SetNX(ctx, prefix, key, ttl, value)
+		return err
+	})
+	return set, c.degrade(err, prefix)
+}
+
+func (c *resilientCache) CompareAndSwap(ctx context.Context, prefix, key string, ttl time.Duration, expected, value any) (bool, error) {
+	var swapped bool
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		swapped, err = c.remote.CompareAndSwap(ctx, prefix, key, ttl, expected, value)
+		return err
+	})
+	return swapped, c.degrade(err, prefix)
+}
+
+func (c *resilientCache) Incr(ctx context.Context, prefix, key string, ttl time.Duration) (int64, error) {
+	var count int64
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		count, err = c.remote.Incr(ctx, prefix, key, ttl)
+		return err
+	})
+	return count, c.degrade(err, prefix)
+}
+
+// Pipeline and Transaction always fail closed, the prefixes of their writes are not known up front
+func (c *resilientCache) Pipeline(ctx context.Context, fn func(Batch)) error {
+	return c.do(ctx, func(ctx context.Context) error {
+		return c.remote.Pipeline(ctx, fn)
+	})
+}
+
+func (c *resilientCache) Transaction(ctx context.Context, fn func(Batch)) error {
+	return c.do(ctx, func(ctx context.Context) error {
+		return c.remote.Transaction(ctx, fn)
+	})
+}
+
+func (c *resilientCache) SAdd(ctx context.Context, prefix, key string, ttl time.Duration, member string) error {
+	return c.degrade(c.do(ctx, func(ctx context.Context) error {
+		return c.remote.SAdd(ctx, prefix, key, ttl, member)
+	}), prefix)
+}
+
+func (c *resilientCache) SMembers(ctx context.Context, prefix, key string) ([]string, error) {
+	var members []string
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		members, err = c.remote.SMembers(ctx, prefix, key)
+		return err
+	})
+	return members, c.degrade(err, prefix)
+}
+
+func (c *resilientCache) SCard(ctx context.Context, prefix, key string) (int64, error) {
+	var count int64
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		count, err = c.remote.SCard(ctx, prefix, key)
+		return err
+	})
+	return count, c.degrade(err, prefix)
+}
+
+// Scan, Inspect and Stats fail closed, they serve administration where a miss would mislead
+func (c *resilientCache) Scan(ctx context.Context, pattern, cursor string, count int64) ([]string, string, error) {
+	var keys []string
+	var next string
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		keys, next, err = c.remote.Scan(ctx, pattern, cursor, count)
+		return err
+	})
+	return keys, next, err
+}
+
+func (c *resilientCache) Inspect(ctx context.Context, prefix, key string) (EntryInfo, bool, error) {
+	var info EntryInfo
+	var found bool
+	err := c.do(ctx, func(ctx context.Context) (err error) {
+		info, found, err = c.remote.Inspect(ctx, prefix, key)
+		return err
+	})
+	return info, found, err
+}
+
+// Stats scans the whole prefix, it is only bounded by the context of the caller
+func (c *resilientCache) Stats(ctx context.Context, prefix string) (PrefixStats, error) {
+	var stats PrefixStats
+	err := c.guard(ctx, ctx, func(ctx context.Context) (err error) {
+		stats, err = c.remote.Stats(ctx, prefix)
+		return err
+	})
+	return stats, err
+}
+
+func (c *resilientCache) CloseRedisClient() error {
+	return c.remote.CloseRedisClient()
+}
@@ -0,0 +1,293 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ouz/goboilerplate/pkg/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	TierLocal = "local"
+	TierRedis = "redis"
+)
+
+// Invalidation tells the other instances to drop a key, or every key of a
+// prefix when All is set, from their local cache
+type Invalidation struct {
+	Origin string `json:"origin"`
+	Prefix string `json:"prefix"`
+	Key    string `json:"key,omitempty"`
+	All    bool   `json:"all,omitempty"`
+}
+
+// InvalidationBus broadcasts invalidations between instances
+type InvalidationBus interface {
+	Publish(ctx context.Context, invalidation Invalidation) error
+	// Subscribe calls handler for every invalidation until ctx is done
+	Subscribe(ctx context.Context, handler func(Invalidation)) error
+}
+
+type TieredCacheOptions struct {
+	// LocalTTL bounds how long a value stays in the local cache, and so how stale
+	// it can get when an invalidation is missed
+	LocalTTL time.Duration
+	// Prefixes are the prefixes kept in the local cache, all others only use Valkey
+	Prefixes []string
+}
+
+// TieredCacheService is a RedisCacheService that serves the configured prefixes
+// from a local cache first. Writes and evictions are broadcast so other instances
+// drop their local copies
+type TieredCacheService interface {
+	RedisCacheService
+	// ListenInvalidations applies the invalidations of other instances until ctx is done
+	ListenInvalidations(ctx context.Context) error
+}
+
+type tieredCache struct {
+	RedisCacheService
+	local      LocalCacheService
+	bus        InvalidationBus
+	options    TieredCacheOptions
+	prefixes   map[string]struct{}
+	instanceID string
+	lookups    metric.Int64Counter
+	logger     *log.Logger
+}
+
+func NewTieredCacheService(logger *log.Logger, local LocalCacheService, remote RedisCacheService, bus InvalidationBus, options TieredCacheOptions) TieredCacheService {
+	prefixes := make(map[string]struct{}, len(options.Prefixes))
+	for _, prefix := range options.Prefixes {
+		prefixes[prefix] = struct{}{}
+	}
+
+	lookups, err := otel.Meter("github.com/ouz/goboilerplate/pkg/cache").Int64Counter("cache.lookups",
+		metric.WithDescription("Cache lookups by prefix, tier and result, hit ratio is hits over all lookups"),
+	)
+	if err != nil {
+		logger.Warn("Failed to create cache lookup counter", "error", err)
+	}
+
+	return &tieredCache{
+		RedisCacheService: remote,
+		local:             local,
+		bus:               bus,
+		options:           options,
+		prefixes:          prefixes,
+		instanceID:        uuid.NewString(),
+		lookups:           lookups,
+		logger:            logger,
+	}
+}
+
+func (c *tieredCache) isTiered(prefix string) bool {
+	_, ok := c.prefixes[prefix]
+	return ok
+}
+
+func (c *tieredCache) Get(ctx context.Context, prefix, key string, result any) (bool, error) {
+	if !c.isTiered(prefix) {
+		return c.RedisCacheService.Get(ctx, prefix, key, result)
+	}
+
+	if found, err := c.local.Get(prefix, key, result); err == nil && found {
+		c.record(ctx, prefix, TierLocal, true)
+		return true, nil
+	}
+	c.record(ctx, prefix, TierLocal, false)
+
+	found, err := c.RedisCacheService.Get(ctx, prefix, key, result)
+	if err != nil {
+		return false, err
+	}
+	c.record(ctx, prefix, TierRedis, found)
+
+	if found {
+		c.local.Set(prefix, key, c.options.LocalTTL, result)
+	}
+	return found, nil
+}
+
+func (c *tieredCache) Set(ctx context.Context, prefix, key string, ttl time.Duration, value any) error {
+	if err := c.RedisCacheService.Set(ctx, prefix, key, ttl, value); err != nil {
+		return err
+	}
+	if !c.isTiered(prefix) {
+		return nil
+	}
+
+	localTTL := c.options.LocalTTL
+	if ttl > 0 {
+		localTTL = min(ttl, localTTL)
+	}
+	c.local.Set(prefix, key, localTTL, value)
+	c.broadcast(ctx, Invalidation{Prefix: prefix, Key: key})
+	return nil
+}
+
+// Evict drops the local copy even if Valkey could not be reached, the copies of
+// other instances expire within the local TTL
+func (c *tieredCache) Evict(ctx context.Context, prefix, key string) error {
+	if err := c.RedisCacheService.Evict(ctx, prefix, key); err != nil {
+		if c.isTiered(prefix) {
+			c.local.Evict(prefix, key)
+		}
+		return err
+	}
+
+	c.invalidate(ctx, prefix, key)
+	return nil
+}
+
+func (c *tieredCache) EvictByPrefix(ctx context.Context, prefix string) error {
+	err := c.RedisCacheService.EvictByPrefix(ctx, prefix)
+	if !c.isTiered(prefix) {
+		return err
+	}
+	if err != nil {
+		c.local.EvictByPrefix(prefix)
+		return err
+	}
+
+	c.local.EvictByPrefix(prefix)
+	c.broadcast(ctx, Invalidation{Prefix: prefix, All: true})
+	return nil
+}
+
+func (c *tieredCache) MSet(ctx context.Context, entries ...Entry) error {
+	if err := c.RedisCacheService.MSet(ctx, entries...); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		c.invalidate(ctx, entry.Prefix, entry.Key)
+	}
+	return nil
+}
+
+func (c *tieredCache) SetNX(ctx context.Context, prefix, key string, ttl time.Duration, value any) (bool, error) {
+	set, err := c.RedisCacheService.SetNX(ctx, prefix, key, ttl, value)
+	if set {
+		c.invalidate(ctx, prefix, key)
+	}
+	return set, err
+}
+
+func (c *tieredCache) CompareAndSwap(ctx context.Context, prefix, key string, ttl time.Duration, expected, value any) (bool, error) {
+	swapped, err := c.RedisCacheService.CompareAndSwap(ctx, prefix, key, ttl, expected, value)
+	if swapped {
+		c.invalidate(ctx, prefix, key)
+	}
+	return swapped, err
+}
+
+func (c *tieredCache) Incr(ctx context.Context, prefix, key string, ttl time.Duration) (int64, error) {
+	count, err := c.RedisCacheService.Incr(ctx, prefix, key, ttl)
+	if err == nil {
+		c.invalidate(ctx, prefix, key)
+	}
+	return count, err
+}
+
+func (c *tieredCache) Pipeline(ctx context.Context, fn func(Batch)) error {
+	return c.execBatch(ctx, c.RedisCacheService.Pipeline, fn)
+}
+
+func (c *tieredCache) Transaction(ctx context.Context, fn func(Batch)) error {
+	return c.execBatch(ctx, c.RedisCacheService.Transaction, fn)
+}
+
+// execBatch records the keys written by fn and invalidates them once Valkey applied the batch.
+// A failed pipeline may have applied some commands, so its keys are invalidated too
+func (c *tieredCache) execBatch(ctx context.Context, exec func(context.Context, func(Batch)) error, fn func(Batch)) error {
+	var touched []Entry
+	err := exec(ctx, func(batch Batch) {
+		fn(&recordingBatch{Batch: batch, touched: &touched})
+	})
+	for _, entry := range touched {
+		c.invalidate(ctx, entry.Prefix, entry.Key)
+	}
+	return err
+}
+
+// recordingBatch remembers the keys written through it
+type recordingBatch struct {
+	Batch
+	touched *[]Entry
+}
+
+func (b *recordingBatch) record(prefix, key string) {
+	*b.touched = append(*b.touched, Entry{Prefix: prefix, Key: key})
+}
+
+func (b *recordingBatch) Set(prefix, key string, ttl time.Duration, value any) {
+	b.record(prefix, key)
+	b.Batch.Set(prefix, key, ttl, value)
+}
+
+func (b *recordingBatch) Evict(prefix, key string) {
+	b.record(prefix, key)
+	b.Batch.Evict(prefix, key)
+}
+
+func (b *recordingBatch) SAdd(prefix, key string, ttl time.Duration, member string) {
+	b.record(prefix, key)
+	b.Batch.SAdd(prefix, key, ttl, member)
+}
+
+func (b *recordingBatch) Incr(prefix, key string, ttl time.Duration) {
+	b.record(prefix, key)
+	b.Batch.Incr(prefix, key, ttl)
+}
+
+// invalidate drops the local copy of a key written to Valkey and tells the other instances
+func (c *tieredCache) invalidate(ctx context.Context, prefix, key string) {
+	if !c.isTiered(prefix) {
+		return
+	}
+	c.local.Evict(prefix, key)
+	c.broadcast(ctx, Invalidation{Prefix: prefix, Key: key})
+}
+
+func (c *tieredCache) ListenInvalidations(ctx context.Context) error {
+	return c.bus.Subscribe(ctx, func(invalidation Invalidation) {
+		if invalidation.Origin == c.instanceID || !c.isTiered(invalidation.Prefix) {
+			return
+		}
+
+		if invalidation.All {
+			c.local.EvictByPrefix(invalidation.Prefix)
+			return
+		}
+		c.local.Evict(invalidation.Prefix, invalidation.Key)
+	})
+}
+
+// broadcast publishes invalidation to the other instances. Valkey already holds the
+// new state, so a failure only leaves their local copies stale until LocalTTL
+func (c *tieredCache) broadcast(ctx context.Context, invalidation Invalidation) {
+	invalidation.Origin = c.instanceID
+	if err := c.bus.Publish(ctx, invalidation); err != nil {
+		c.logger.Error("Failed to broadcast cache invalidation", "error", err, "prefix", invalidation.Prefix, "key", invalidation.Key)
+	}
+}
+
+func (c *tieredCache) record(ctx context.Context, prefix, tier string, hit bool) {
+	if c.lookups == nil {
+		return
+	}
+
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	c.lookups.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("cache.prefix", prefix),
+		attribute.String("cache.tier", tier),
+		attribute.String("cache.result", result),
+	))
+}
@@ -46,6 +46,7 @@ const (
 	_
 	ErrCodeTemplateNotFound
 	ErrCodeTemplateRenderFailed
+	ErrCodeServiceUnavailable
 )
 
 const (
@@ -218,12 +219,27 @@ func InvalidTokenError(message string, err error) *AppError {
 	return NewAppError(ErrCodeInvalidToken, TypeUnauthorized, message, err, http.StatusUnauthorized)
 }
 
+// ServiceUnavailableError creates an error for a dependency that cannot be reached right now
+func ServiceUnavailableError(message string, err error) *AppError {
+	return NewAppError(ErrCodeServiceUnavailable, TypeExternal, message, err, http.StatusServiceUnavailable)
+}
+
 // ExternalServiceTimeoutError creates an external service timeout error
 func ExternalServiceTimeoutError(message string, err error) *AppError {
 	return NewAppError(ErrCodeExternalServiceTimeout, TypeExternal,
 		message, err, http.StatusGatewayTimeout)
 }
 
+// TemplateNotFoundError creates a template not found error
+func TemplateNotFoundError(message string, err error) *AppError {
+	return NewAppError(ErrCodeTemplateNotFound, TypeInternal, message, err, http.StatusInternalServerError)
+}
+
+// TemplateRenderError creates a template rendering error
+func TemplateRenderError(message string, err error) *AppError {
+	return NewAppError(ErrCodeTemplateRenderFailed, TypeInternal, message, err, http.StatusInternalServerError)
+}
+
 // BusinessLogicError creates a business logic error
 func BusinessLogicError(message string, err error) *AppError {
 	return NewAppError(ErrCodeBusinessLogic, "BUSINESS_LOGIC_ERROR", message, err, http.StatusBadRequest)
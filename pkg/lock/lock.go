@@ -0,0 +1,219 @@
+// Package lock provides mutual exclusion across instances with fencing tokens
+package lock
+
+import (
+	"context"
+	errs "errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ouz/goboilerplate/pkg/errors"
+	"github.com/ouz/goboilerplate/pkg/log"
+)
+
+const releaseTimeout = 5 * time.Second
+
+// ErrLockLost is the cause of a lock context cancelled because the lock could not be renewed
+var ErrLockLost = errs.New("lock lost")
+
+// Store keeps lock ownership. Every operation must be atomic
+type Store interface {
+	// Acquire takes name for owner if it is free and returns a fencing token that
+	// grows with every acquisition of name
+	Acquire(ctx context.Context, name, owner string, ttl time.Duration) (token int64, acquired bool, err error)
+	// Extend resets the TTL of name if owner still holds it
+	Extend(ctx context.Context, name, owner string, ttl time.Duration) (bool, error)
+	// Release frees name if owner still holds it
+	Release(ctx context.Context, name, owner string) (bool, error)
+}
+
+// Lock is a held lock. It is renewed in the background until released
+type Lock interface {
+	Name() string
+	// Token is the fencing token of this acquisition. Resources guarded by the lock
+	// should reject writes carrying a lower token than one they already saw, a
+	// holder paused past its TTL can then no longer overwrite its successor
+	Token() int64
+	// Context is cancelled when the lock is released, lost or its parent context is done
+	Context() context.Context
+	Release(ctx context.Context) error
+}
+
+type Locker interface {
+	// TryAcquire takes the lock once and fails with a conflict error if it is held.
+	// ctx bounds both the attempt and the returned lock
+	TryAcquire(ctx context.Context, name string, ttl time.Duration) (Lock, error)
+	// Acquire waits for the lock until ctx is done
+	Acquire(ctx context.Context, name string, ttl time.Duration) (Lock, error)
+}
+
+type Options struct {
+	// RetryInterval is how often Acquire retries a held lock
+	RetryInterval time.Duration
+}
+
+func DefaultOptions() Options {
+	return Options{RetryInterval: 100 * time.Millisecond}
+}
+
+// IsNotAcquired reports whether err means the lock is held by another owner
+func IsNotAcquired(err error) bool {
+	return errors.IsErrorCode(err, errors.ErrCodeConflict)
+}
+
+// WithLock runs fn while holding name and releases it afterwards. fn gets the lock
+// context, so it is cancelled when the lock is lost. It returns a conflict error
+// without running fn if the lock is held
+func WithLock(ctx context.Context, locker Locker, name string, ttl time.Duration, fn func(ctx context.Context) error) error {
+	l, err := locker.TryAcquire(ctx, name, ttl)
+	if err != nil {
+		return err
+	}
+
+	fnErr := fn(l.Context())
+
+	releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), releaseTimeout)
+	defer cancel()
+	if err := l.Release(releaseCtx); err != nil && fnErr == nil {
+		return err
+	}
+	return fnErr
+}
+
+type locker struct {
+	store   Store
+	options Options
+	logger  *log.Logger
+}
+
+func NewLocker(logger *log.Logger, store Store, options Options) Locker {
+	return &locker{
+		store:   store,
+		options: options,
+		logger:  logger,
+	}
+}
+
+func (l *locker) TryAcquire(ctx context.Context, name string, ttl time.Duration) (Lock, error) {
+	owner := uuid.NewString()
+	token, acquired, err := l.store.Acquire(ctx, name, owner, ttl)
+	if err != nil {
+		return nil, errors.GenericError(fmt.Sprintf("error acquiring lock %q", name), err)
+	}
+	if !acquired {
+		return nil, errors.ConflictError(fmt.Sprintf("lock %q is held by another owner", name), nil)
+	}
+
+	return l.hold(ctx, name, owner, token, ttl), nil
+}
+
+func (l *locker) Acquire(ctx context.Context, name string, ttl time.Duration) (Lock, error) {
+	ticker := time.NewTicker(l.options.RetryInterval)
+	defer ticker.Stop()
+
+	for {
+		held, err := l.TryAcquire(ctx, name, ttl)
+		if err == nil || !IsNotAcquired(err) {
+			return held, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (l *locker) hold(ctx context.Context, name, owner string, token int64, ttl time.Duration) *heldLock {
+	lockCtx, cancel := context.WithCancelCause(ctx)
+	h := &heldLock{
+		locker: l,
+		name:   name,
+		owner:  owner,
+		token:  token,
+		ctx:    lockCtx,
+		cancel: cancel,
+	}
+
+	h.renewing.Go(func() { h.renew(ttl) })
+	return h
+}
+
+type heldLock struct {
+	locker   *locker
+	name     string
+	owner    string
+	token    int64
+	ctx      context.Context
+	cancel   context.CancelCauseFunc
+	renewing sync.WaitGroup
+	release  sync.Once
+}
+
+func (h *heldLock) Name() string             { return h.name }
+func (h *heldLock) Token() int64             { return h.token }
+func (h *heldLock) Context() context.Context { return h.ctx }
+
+// renew extends the lock every third of its TTL. Failed renewals are retried until
+// the TTL has passed since the last successful one, then the lock counts as lost
+func (h *heldLock) renew(ttl time.Duration) {
+	interval := ttl / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	expiresAt := time.Now().Add(ttl)
+
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		extendCtx, cancel := context.WithTimeout(h.ctx, interval)
+		extended, err := h.locker.store.Extend(extendCtx, h.name, h.owner, ttl)
+		cancel()
+
+		switch {
+		case err == nil && extended:
+			expiresAt = time.Now().Add(ttl)
+		case err == nil:
+			h.locker.logger.Error("Lock was taken over before it could be renewed", "lock", h.name, "token", h.token)
+			h.cancel(ErrLockLost)
+			return
+		case h.ctx.Err() != nil:
+			return
+		case time.Now().After(expiresAt):
+			h.locker.logger.Error("Lock expired while it could not be renewed", "lock", h.name, "token", h.token, "error", err)
+			h.cancel(ErrLockLost)
+			return
+		default:
+			h.locker.logger.Warn("Failed to renew lock, retrying", "lock", h.name, "error", err)
+		}
+	}
+}
+
+// Release stops the renewal and frees the lock if it is still held. Releasing a
+// lock that was lost returns an error wrapping ErrLockLost, releasing twice does nothing
+func (h *heldLock) Release(ctx context.Context) error {
+	var err error
+	h.release.Do(func() {
+		lost := context.Cause(h.ctx) == ErrLockLost
+		h.cancel(context.Canceled)
+		h.renewing.Wait()
+		if lost {
+			err = errors.GenericError(fmt.Sprintf("lock %q was lost before it was released", h.name), ErrLockLost)
+			return
+		}
+
+		released, releaseErr := h.locker.store.Release(ctx, h.name, h.owner)
+		if releaseErr != nil {
+			err = errors.GenericError(fmt.Sprintf("error releasing lock %q", h.name), releaseErr)
+		} else if !released {
+			err = errors.GenericError(fmt.Sprintf("lock %q expired before it was released", h.name), ErrLockLost)
+		}
+	})
+	return err
+}
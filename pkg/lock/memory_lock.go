@@ -0,0 +1,84 @@
+package lock
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ouz/goboilerplate/pkg/log"
+)
+
+type memoryEntry struct {
+	owner     string
+	expiresAt time.Time
+}
+
+// memoryStore keeps locks in process. It only excludes holders within one
+// process and is meant for tests and single-node development
+type memoryStore struct {
+	mu     sync.Mutex
+	locks  map[string]memoryEntry
+	tokens map[string]int64
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{
+		locks:  map[string]memoryEntry{},
+		tokens: map[string]int64{},
+	}
+}
+
+// NewMemoryLocker returns a Locker on a store of its own
+func NewMemoryLocker(logger *log.Logger, options Options) Locker {
+	return NewLocker(logger, NewMemoryStore(), options)
+}
+
+// held returns the entry of name if it has not expired. Callers must hold mu
+func (m *memoryStore) held(name string) (memoryEntry, bool) {
+	entry, ok := m.locks[name]
+	if !ok || !time.Now().Before(entry.expiresAt) {
+		delete(m.locks, name)
+		return memoryEntry{}, false
+	}
+	return entry, true
+}
+
+func (m *memoryStore) Acquire(_ context.Context, name, owner string, ttl time.Duration) (int64, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.held(name); ok {
+		return 0, false, nil
+	}
+
+	m.locks[name] = memoryEntry{owner: owner, expiresAt: time.Now().Add(ttl)}
+	m.tokens[name]++
+	return m.tokens[name], true, nil
+}
+
+func (m *memoryStore) Extend(_ context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.held(name)
+	if !ok || entry.owner != owner {
+		return false, nil
+	}
+
+	entry.expiresAt = time.Now().Add(ttl)
+	m.locks[name] = entry
+	return true, nil
+}
+
+func (m *memoryStore) Release(_ context.Context, name, owner string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.held(name)
+	if !ok || entry.owner != owner {
+		return false, nil
+	}
+
+	delete(m.locks, name)
+	return true, nil
+}
@@ -0,0 +1,79 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/ouz/goboilerplate/pkg/lock"
+	"github.com/ouz/goboilerplate/pkg/log"
+	"github.com/redis/go-redis/v9"
+)
+
+// acquireScript sets the lock only if it is free and counts the acquisition, the
+// count is the fencing token. The counter never expires so tokens keep growing
+var acquireScript = redis.NewScript(`
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return redis.call('INCR', KEYS[2])
+end
+return 0
+`)
+
+// extendScript and releaseScript only touch the lock while it still belongs to the
+// caller, a holder whose lock expired must not extend or free its successor's
+var extendScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+type redisStore struct {
+	client redis.UniversalClient
+}
+
+// NewRedisStore keeps locks in Valkey with SET NX PX. Acquisition, renewal and
+// release are single scripts, so each of them is atomic
+func NewRedisStore(client redis.UniversalClient) lock.Store {
+	return &redisStore{client: client}
+}
+
+func NewRedisLocker(logger *log.Logger, client redis.UniversalClient, options lock.Options) lock.Locker {
+	return lock.NewLocker(logger, NewRedisStore(client), options)
+}
+
+// keys returns the lock and fencing counter keys of name. The hash tag keeps both
+// in one slot, scripts may only touch keys of a single slot on a cluster
+func keys(name string) []string {
+	return []string{"lock:{" + name + "}", "lock:{" + name + "}:fence"}
+}
+
+func (s *redisStore) Acquire(ctx context.Context, name, owner string, ttl time.Duration) (int64, bool, error) {
+	token, err := acquireScript.Run(ctx, s.client, keys(name), owner, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return 0, false, err
+	}
+	return token, token > 0, nil
+}
+
+func (s *redisStore) Extend(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	extended, err := extendScript.Run(ctx, s.client, keys(name)[:1], owner, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return false, err
+	}
+	return extended == 1, nil
+}
+
+func (s *redisStore) Release(ctx context.Context, name, owner string) (bool, error) {
+	released, err := releaseScript.Run(ctx, s.client, keys(name)[:1], owner).Int64()
+	if err != nil {
+		return false, err
+	}
+	return released == 1, nil
+}
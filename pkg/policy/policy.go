@@ -0,0 +1,152 @@
+package policy
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/ouz/goboilerplate/pkg/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const Wildcard = "*"
+
+type Effect string
+
+const (
+	ALLOW          Effect = "allow"
+	DENY           Effect = "deny"
+	NOT_APPLICABLE Effect = "not_applicable"
+)
+
+type Subject struct {
+	ID         string
+	Roles      []string
+	Attributes map[string]any
+}
+
+func (s Subject) HasAnyRole(roles ...string) bool {
+	return slices.ContainsFunc(roles, func(role string) bool {
+		return slices.Contains(s.Roles, role)
+	})
+}
+
+type Resource struct {
+	Type       string
+	ID         string
+	OwnerID    string
+	Attributes map[string]any
+}
+
+type Request struct {
+	Subject  Subject
+	Action   string
+	Resource Resource
+}
+
+func (r Request) IsOwner() bool {
+	return r.Subject.ID != "" && r.Subject.ID == r.Resource.OwnerID
+}
+
+type Policy interface {
+	Name() string
+	Evaluate(ctx context.Context, request Request) Effect
+}
+
+type funcPolicy struct {
+	name string
+	fn   func(ctx context.Context, request Request) Effect
+}
+
+// NewPolicyFunc wraps a Go function so it can be registered alongside rule-based policies
+func NewPolicyFunc(name string, fn func(ctx context.Context, request Request) Effect) Policy {
+	return &funcPolicy{name: name, fn: fn}
+}
+
+func (p *funcPolicy) Name() string {
+	return p.name
+}
+
+func (p *funcPolicy) Evaluate(ctx context.Context, request Request) Effect {
+	return p.fn(ctx, request)
+}
+
+type Decision struct {
+	Allowed bool
+	Policy  string
+}
+
+type Authorizer interface {
+	Authorize(ctx context.Context, request Request) Decision
+	Register(policies ...Policy)
+}
+
+type engine struct {
+	mu       sync.RWMutex
+	policies []Policy
+	logger   *log.Logger
+}
+
+func NewAuthorizer(logger *log.Logger, policies ...Policy) Authorizer {
+	return &engine{
+		policies: policies,
+		logger:   logger,
+	}
+}
+
+// Register adds policies, it is safe to call while requests are being authorized
+func (e *engine) Register(policies ...Policy) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	// Clipped so the slice a running Authorize ranges over is never written to
+	e.policies = append(slices.Clip(e.policies), policies...)
+}
+
+// Authorize evaluates every policy with deny-overrides semantics: a single
+// deny wins, otherwise at least one allow is required. Requests that no
+// policy applies to are denied.
+func (e *engine) Authorize(ctx context.Context, request Request) Decision {
+	e.mu.RLock()
+	policies := e.policies
+	e.mu.RUnlock()
+
+	decision := Decision{Allowed: false}
+
+	for _, p := range policies {
+		switch p.Evaluate(ctx, request) {
+		case DENY:
+			decision = Decision{Allowed: false, Policy: p.Name()}
+			e.logDecision(ctx, request, decision)
+			return decision
+		case ALLOW:
+			if !decision.Allowed {
+				decision = Decision{Allowed: true, Policy: p.Name()}
+			}
+		}
+	}
+
+	e.logDecision(ctx, request, decision)
+	return decision
+}
+
+// logDecision logs denies at info, allows are logged at debug as every
+// authorized request has one
+func (e *engine) logDecision(ctx context.Context, request Request, decision Decision) {
+	if e.logger == nil {
+		return
+	}
+
+	logContext := e.logger.InfoContext
+	if decision.Allowed {
+		logContext = e.logger.DebugContext
+	}
+	logContext(ctx, "Authorization decision",
+		"subject", request.Subject.ID,
+		"action", request.Action,
+		"resource_type", request.Resource.Type,
+		"resource_id", request.Resource.ID,
+		"allowed", decision.Allowed,
+		"policy", decision.Policy,
+		"trace_id", trace.SpanContextFromContext(ctx).TraceID().String(),
+	)
+}
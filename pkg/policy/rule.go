@@ -0,0 +1,101 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/ouz/goboilerplate/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// Rule is a declarative policy. All of its conditions must hold for the rule
+// to apply: roles matches when the subject has any of the listed roles and
+// owner matches when the subject owns the resource.
+type Rule struct {
+	Name     string   `mapstructure:"name"`
+	Effect   Effect   `mapstructure:"effect"`
+	Resource string   `mapstructure:"resource"`
+	Actions  []string `mapstructure:"actions"`
+	Roles    []string `mapstructure:"roles"`
+	Owner    bool     `mapstructure:"owner"`
+}
+
+type ruleFile struct {
+	Policies []Rule `mapstructure:"policies"`
+}
+
+func (r *Rule) Validate() error {
+	if r.Name == "" {
+		return errors.ValidationError("policy name cannot be empty", nil)
+	}
+	if r.Effect != ALLOW && r.Effect != DENY {
+		return errors.ValidationError(fmt.Sprintf("policy %s has unsupported effect %q", r.Name, r.Effect), nil)
+	}
+	if r.Resource == "" {
+		return errors.ValidationError(fmt.Sprintf("policy %s must define a resource", r.Name), nil)
+	}
+	if len(r.Actions) == 0 {
+		return errors.ValidationError(fmt.Sprintf("policy %s must define at least one action", r.Name), nil)
+	}
+	return nil
+}
+
+type rulePolicy struct {
+	rule Rule
+}
+
+func NewRulePolicy(rule Rule) (Policy, error) {
+	if err := rule.Validate(); err != nil {
+		return nil, err
+	}
+	return &rulePolicy{rule: rule}, nil
+}
+
+func (p *rulePolicy) Name() string {
+	return p.rule.Name
+}
+
+func (p *rulePolicy) Evaluate(_ context.Context, request Request) Effect {
+	r := p.rule
+	if r.Resource != Wildcard && r.Resource != request.Resource.Type {
+		return NOT_APPLICABLE
+	}
+	if !slices.Contains(r.Actions, Wildcard) && !slices.Contains(r.Actions, request.Action) {
+		return NOT_APPLICABLE
+	}
+	if len(r.Roles) > 0 && !request.Subject.HasAnyRole(r.Roles...) {
+		return NOT_APPLICABLE
+	}
+	if r.Owner && !request.IsOwner() {
+		return NOT_APPLICABLE
+	}
+	return r.Effect
+}
+
+// LoadFile reads rule-based policies from a YAML file with a top-level
+// "policies" list.
+func LoadFile(path string) ([]Policy, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		return nil, errors.GenericError(fmt.Sprintf("cannot read policy file %s", path), err)
+	}
+
+	var file ruleFile
+	if err := v.Unmarshal(&file); err != nil {
+		return nil, errors.GenericError(fmt.Sprintf("cannot decode policy file %s", path), err)
+	}
+
+	policies := make([]Policy, 0, len(file.Policies))
+	for _, rule := range file.Policies {
+		p, err := NewRulePolicy(rule)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, p)
+	}
+
+	return policies, nil
+}
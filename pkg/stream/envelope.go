@@ -0,0 +1,54 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ouz/goboilerplate/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Envelope wraps every event published to a stream so consumers can route on
+// the type, handle schema versions and continue the producer's trace
+type Envelope struct {
+	ID         string            `json:"id"`
+	Type       string            `json:"type"`
+	Version    int               `json:"version"`
+	OccurredAt time.Time         `json:"occurredAt"`
+	Trace      map[string]string `json:"trace,omitempty"`
+	Data       json.RawMessage   `json:"data"`
+}
+
+func NewEnvelope(ctx context.Context, eventType string, version int, data any) (Envelope, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return Envelope{}, errors.GenericError("failed to marshal event data", err)
+	}
+
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	return Envelope{
+		ID:         uuid.New().String(),
+		Type:       eventType,
+		Version:    version,
+		OccurredAt: time.Now().UTC(),
+		Trace:      carrier,
+		Data:       payload,
+	}, nil
+}
+
+// Context returns ctx carrying the trace context of the producer
+func (e Envelope) Context(ctx context.Context) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(e.Trace))
+}
+
+func (e Envelope) Decode(result any) error {
+	if err := json.Unmarshal(e.Data, result); err != nil {
+		return errors.GenericError("failed to unmarshal event data", err)
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ouz/goboilerplate/pkg/errors"
+	"github.com/ouz/goboilerplate/pkg/log"
+)
+
+const memoryReadBlock = 2 * time.Second
+
+type memoryEntry struct {
+	id  string
+	msg Message
+}
+
+type memoryPending struct {
+	consumer    string
+	deliveries  int64
+	deliveredAt time.Time
+}
+
+type memoryGroup struct {
+	// next is the index of the first entry not yet delivered to the group
+	next    int
+	pending map[string]*memoryPending
+}
+
+type memoryStream struct {
+	entries []memoryEntry
+	groups  map[string]*memoryGroup
+	// published is closed and replaced on every publish to wake blocked readers
+	published chan struct{}
+}
+
+// memoryStreamService keeps streams in process with the consumer group, ack and
+// pending semantics of Redis Streams. It is meant for tests and single-node
+// development, nothing survives a restart
+type memoryStreamService struct {
+	mu      sync.Mutex
+	streams map[string]*memoryStream
+	seq     int64
+	options ConsumerOptions
+	logger  *log.Logger
+}
+
+func NewMemoryStreamService(logger *log.Logger, options ConsumerOptions) StreamService {
+	return &memoryStreamService{
+		streams: map[string]*memoryStream{},
+		options: options,
+		logger:  logger,
+	}
+}
+
+// stream returns the stream stored under key, creating it if needed. Callers must hold mu
+func (m *memoryStreamService) stream(key string) *memoryStream {
+	s, ok := m.streams[key]
+	if !ok {
+		s = &memoryStream{groups: map[string]*memoryGroup{}, published: make(chan struct{})}
+		m.streams[key] = s
+	}
+	return s
+}
+
+func (m *memoryStreamService) Publish(ctx context.Context, streamKey string, event interface{}) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return errors.GenericError("failed to marshal event", err)
+	}
+
+	return m.PublishMessage(ctx, streamKey, Message{Data: data})
+}
+
+func (m *memoryStreamService) PublishMessage(_ context.Context, streamKey string, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.seq++
+	msg.ID = fmt.Sprintf("%d-%d", time.Now().UnixMilli(), m.seq)
+
+	s := m.stream(streamKey)
+	s.entries = append(s.entries, memoryEntry{id: msg.ID, msg: msg})
+	close(s.published)
+	s.published = make(chan struct{})
+	return nil
+}
+
+// CreateGroup creates group reading from the start of the stream, like XGROUP CREATE ... 0 MKSTREAM
+func (m *memoryStreamService) CreateGroup(_ context.Context, streamKey, group string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.stream(streamKey)
+	if _, ok := s.groups[group]; !ok {
+		s.groups[group] = &memoryGroup{pending: map[string]*memoryPending{}}
+	}
+	return nil
+}
+
+func (m *memoryStreamService) Ack(_ context.Context, streamKey, group string, ids ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	g, ok := m.stream(streamKey).groups[group]
+	if !ok {
+		return errors.NotFoundError("consumer group not found", nil)
+	}
+	for _, id := range ids {
+		delete(g.pending, id)
+	}
+	return nil
+}
+
+func (m *memoryStreamService) Consume(ctx context.Context, streamKey, group, consumer string, handler HandlerFunc) error {
+	return m.ConsumeOrdered(ctx, streamKey, group, consumer, nil, handler)
+}
+
+func (m *memoryStreamService) ConsumeOrdered(ctx context.Context, streamKey, group, consumer string, key KeyFunc, handler HandlerFunc) error {
+	return m.ConsumeMessages(ctx, streamKey, group, consumer, key, func(ctx context.Context, msg Message) error {
+		return handler(ctx, msg.ID, msg.Data)
+	})
+}
+
+func (m *memoryStreamService) ConsumeMessages(ctx context.Context, streamKey, group, consumer string, key KeyFunc, handler MessageHandlerFunc) error {
+	if err := m.CreateGroup(ctx, streamKey, group); err != nil {
+		return err
+	}
+
+	pool := NewWorkerPool(m.options.Concurrency, key != nil)
+	defer pool.Close()
+
+	submit := func(msg Message, deliveries int64) bool {
+		partition := ""
+		if key != nil {
+			partition = key(msg.Data)
+		}
+		err := pool.Submit(ctx, partition, func() {
+			msgCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), m.options.HandlerTimeout)
+			defer cancel()
+			m.process(msgCtx, streamKey, group, msg, deliveries, handler)
+		})
+		return err == nil
+	}
+
+	var lastClaim time.Time
+
+	for ctx.Err() == nil {
+		if time.Since(lastClaim) >= m.options.ClaimInterval {
+			for _, claimed := range m.reclaim(streamKey, group, consumer) {
+				if claimed.deliveries > m.options.MaxDeliveries {
+					// The consumer died on every previous delivery without failing the handler
+					m.deadLetter(streamKey, group, claimed.msg, claimed.deliveries, "exceeded maximum deliveries without acknowledgement")
+					continue
+				}
+				if !submit(claimed.msg, claimed.deliveries) {
+					return ctx.Err()
+				}
+			}
+			lastClaim = time.Now()
+		}
+
+		messages, published := m.read(streamKey, group, consumer)
+		if len(messages) == 0 {
+			timer := time.NewTimer(min(memoryReadBlock, m.options.ClaimInterval))
+			select {
+			case <-ctx.Done():
+			case <-published:
+			case <-timer.C:
+			}
+			timer.Stop()
+			continue
+		}
+
+		for _, msg := range messages {
+			if !submit(msg, 1) {
+				return ctx.Err()
+			}
+		}
+	}
+
+	return ctx.Err()
+}
+
+// read delivers up to BatchSize new messages to consumer, like XREADGROUP with ">".
+// When there are none it returns a channel that is closed on the next publish
+func (m *memoryStreamService) read(streamKey, group, consumer string) ([]Message, <-chan struct{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.stream(streamKey)
+	g := s.groups[group]
+	end := min(len(s.entries), g.next+int(m.options.BatchSize))
+
+	messages := make([]Message, 0, end-g.next)
+	now := time.Now()
+	for i := g.next; i < end; i++ {
+		entry := s.entries[i]
+		g.pending[entry.id] = &memoryPending{consumer: consumer, deliveries: 1, deliveredAt: now}
+		messages = append(messages, entry.msg)
+	}
+	g.next = end
+
+	return messages, s.published
+}
+
+type memoryClaim struct {
+	msg        Message
+	deliveries int64
+}
+
+// reclaim transfers every pending message idle for at least the retry backoff to
+// consumer and counts the delivery, like XAUTOCLAIM
+func (m *memoryStreamService) reclaim(streamKey, group, consumer string) []memoryClaim {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.stream(streamKey)
+	g := s.groups[group]
+	now := time.Now()
+
+	var claimed []memoryClaim
+	for i := 0; i < g.next; i++ {
+		entry := s.entries[i]
+		p, ok := g.pending[entry.id]
+		if !ok || now.Sub(p.deliveredAt) < m.options.RetryBackoff {
+			continue
+		}
+		p.consumer = consumer
+		p.deliveries++
+		p.deliveredAt = now
+		claimed = append(claimed, memoryClaim{msg: entry.msg, deliveries: p.deliveries})
+	}
+	return claimed
+}
+
+func (m *memoryStreamService) process(ctx context.Context, streamKey, group string, msg Message, deliveries int64, handler MessageHandlerFunc) {
+	if err := handler(ctx, msg); err != nil {
+		if m.options.ShouldDeadLetter(deliveries) {
+			m.deadLetter(streamKey, group, msg, deliveries, err.Error())
+			return
+		}
+		m.logger.Warn("Failed to process message, will retry", "stream", streamKey, "msg_id", msg.ID, "deliveries", deliveries, "error", err)
+		return
+	}
+
+	if err := m.Ack(ctx, streamKey, group, msg.ID); err != nil {
+		m.logger.Error("Failed to ack message", "msg_id", msg.ID, "error", err)
+	}
+}
+
+// deadLetter moves msg to the dead-letter stream with its original fields and acks it
+func (m *memoryStreamService) deadLetter(streamKey, group string, msg Message, deliveries int64, reason string) {
+	dlq := DeadLetterStream(streamKey)
+	// Acking and publishing only touch memory, neither can fail
+	_ = m.PublishMessage(context.Background(), dlq, msg)
+	_ = m.Ack(context.Background(), streamKey, group, msg.ID)
+
+	m.logger.Error("Message moved to dead-letter stream", "stream", streamKey, "dlq", dlq, "msg_id", msg.ID, "deliveries", deliveries, "error", reason)
+}
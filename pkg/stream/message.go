@@ -0,0 +1,57 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ouz/goboilerplate/pkg/errors"
+)
+
+const ContentTypeJSON = "application/json"
+
+// Message is a single stream entry. Type, Version and ContentType are stored as
+// fields of their own next to Data, so consumers can route and upcast without
+// decoding the payload
+type Message struct {
+	ID          string
+	Type        string
+	Version     int
+	ContentType string
+	Data        []byte
+}
+
+type MessageHandlerFunc func(ctx context.Context, msg Message) error
+
+// EnvelopeMessage builds the stream message for an encoded envelope
+func EnvelopeMessage(payload []byte) (Message, error) {
+	var envelope Envelope
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		return Message{}, errors.GenericError("failed to unmarshal event envelope", err)
+	}
+
+	return Message{
+		Type:        envelope.Type,
+		Version:     envelope.Version,
+		ContentType: ContentTypeJSON,
+		Data:        payload,
+	}, nil
+}
+
+// Envelope decodes the envelope carried by msg. Entries written before type and
+// version had fields of their own only carry them inside the envelope
+func (m Message) Envelope() (Envelope, error) {
+	if m.ContentType != "" && m.ContentType != ContentTypeJSON {
+		return Envelope{}, errors.ValidationError("unsupported content type: "+m.ContentType, nil)
+	}
+
+	var envelope Envelope
+	if err := json.Unmarshal(m.Data, &envelope); err != nil {
+		return Envelope{}, errors.GenericError("failed to unmarshal event envelope", err)
+	}
+
+	if m.Type != "" {
+		envelope.Type = m.Type
+		envelope.Version = m.Version
+	}
+	return envelope, nil
+}
@@ -3,6 +3,9 @@ package redis
 import (
 	"context"
 	"encoding/json"
+	errs "errors"
+	"math"
+	"strconv"
 	"strings"
 	"time"
 
@@ -12,15 +15,42 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// Stream entry fields
+const (
+	fieldData        = "data"
+	fieldType        = "type"
+	fieldVersion     = "version"
+	fieldContentType = "contentType"
+)
+
+const (
+	readBlock      = 2 * time.Second
+	minReadBackoff = 100 * time.Millisecond
+	maxReadBackoff = 5 * time.Second
+)
+
+// groupConsumer is a single Consume call of one consumer in a group
+type groupConsumer struct {
+	service  *redisStreamService
+	stream   string
+	group    string
+	consumer string
+	key      stream.KeyFunc
+	handler  stream.MessageHandlerFunc
+	pool     *stream.WorkerPool
+}
+
 type redisStreamService struct {
-	client *redis.Client
-	logger *log.Logger
+	client  redis.UniversalClient
+	logger  *log.Logger
+	options stream.ConsumerOptions
 }
 
-func NewRedisStreamService(logger *log.Logger, client *redis.Client) stream.StreamService {
+func NewRedisStreamService(logger *log.Logger, client redis.UniversalClient, options stream.ConsumerOptions) stream.StreamService {
 	return &redisStreamService{
-		client: client,
-		logger: logger,
+		client:  client,
+		logger:  logger,
+		options: options,
 	}
 }
 
@@ -30,12 +60,22 @@ func (r *redisStreamService) Publish(ctx context.Context, streamKey string, even
 		return errors.GenericError("failed to marshal event", err)
 	}
 
-	err = r.client.XAdd(ctx, &redis.XAddArgs{
-		Stream: streamKey,
-		Values: map[string]interface{}{
-			"data": data,
-		},
-	}).Err()
+	return r.PublishMessage(ctx, streamKey, stream.Message{Data: data})
+}
+
+func (r *redisStreamService) PublishMessage(ctx context.Context, streamKey string, msg stream.Message) error {
+	values := map[string]interface{}{
+		fieldData: msg.Data,
+	}
+	if msg.Type != "" {
+		values[fieldType] = msg.Type
+		values[fieldVersion] = msg.Version
+	}
+	if msg.ContentType != "" {
+		values[fieldContentType] = msg.ContentType
+	}
+
+	err := r.client.XAdd(ctx, r.addArgs(streamKey, values)).Err()
 
 	if err != nil {
 		return errors.GenericError("failed to publish to stream", err)
@@ -44,6 +84,17 @@ func (r *redisStreamService) Publish(ctx context.Context, streamKey string, even
 	return nil
 }
 
+// addArgs adds an entry and trims the entries older than the retention. The trim
+// is approximate, Redis only drops whole nodes, so a few older entries may remain
+func (r *redisStreamService) addArgs(streamKey string, values map[string]interface{}) *redis.XAddArgs {
+	args := &redis.XAddArgs{Stream: streamKey, Values: values}
+	if r.options.Retention > 0 {
+		args.MinID = strconv.FormatInt(time.Now().Add(-r.options.Retention).UnixMilli(), 10)
+		args.Approx = true
+	}
+	return args
+}
+
 func (r *redisStreamService) CreateGroup(ctx context.Context, streamKey, group string) error {
 	err := r.client.XGroupCreateMkStream(ctx, streamKey, group, "0").Err()
 	if err != nil {
@@ -55,60 +106,290 @@ func (r *redisStreamService) CreateGroup(ctx context.Context, streamKey, group s
 	return nil
 }
 
+// Consume reads new messages for the group and periodically reclaims messages that stayed
+// pending longer than the retry backoff, whether their handler failed or their consumer died.
+// Messages are acked only after the handler succeeds; once a message reaches the maximum number
+// of deliveries it is moved to the dead-letter stream together with the last error
 func (r *redisStreamService) Consume(ctx context.Context, streamKey, group, consumer string, handler stream.HandlerFunc) error {
+	return r.ConsumeOrdered(ctx, streamKey, group, consumer, nil, handler)
+}
+
+func (r *redisStreamService) ConsumeOrdered(ctx context.Context, streamKey, group, consumer string, key stream.KeyFunc, handler stream.HandlerFunc) error {
+	return r.ConsumeMessages(ctx, streamKey, group, consumer, key, func(ctx context.Context, msg stream.Message) error {
+		return handler(ctx, msg.ID, msg.Data)
+	})
+}
+
+func (r *redisStreamService) ConsumeMessages(ctx context.Context, streamKey, group, consumer string, key stream.KeyFunc, handler stream.MessageHandlerFunc) error {
 	if err := r.CreateGroup(ctx, streamKey, group); err != nil {
 		return err
 	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			// Read from consumer group
-			streams, err := r.client.XReadGroup(ctx, &redis.XReadGroupArgs{
-				Group:    group,
-				Consumer: consumer,
-				Streams:  []string{streamKey, ">"}, // ">" means new messages
-				Count:    10,                       // Batch size
-				Block:    2 * time.Second,          // Block for 2 seconds if no messages
-			}).Result()
+	c := &groupConsumer{
+		service:  r,
+		stream:   streamKey,
+		group:    group,
+		consumer: consumer,
+		key:      key,
+		handler:  handler,
+		pool:     stream.NewWorkerPool(r.options.Concurrency, key != nil),
+	}
+	// Messages already handed to a worker are finished before returning, the rest
+	// stay pending and are reclaimed after a restart
+	defer c.pool.Close()
 
-			if err != nil {
-				if err == redis.Nil {
-					continue // No messages, retry
-				}
-				if strings.Contains(err.Error(), "client is closed") {
-					r.logger.Info("Redis client closed, stopping consumer")
-					return nil
-				}
-				r.logger.Error("Error reading from stream", "error", err)
-				time.Sleep(1 * time.Second)
-				continue
+	var lastClaim time.Time
+	backoff := minReadBackoff
+
+	for ctx.Err() == nil {
+		if time.Since(lastClaim) >= r.options.ClaimInterval {
+			c.reclaim(ctx)
+			lastClaim = time.Now()
+		}
+
+		// Read from consumer group
+		streams, err := r.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    group,
+			Consumer: consumer,
+			Streams:  []string{streamKey, ">"}, // ">" means new messages
+			Count:    r.options.BatchSize,
+			Block:    min(readBlock, r.options.ClaimInterval),
+		}).Result()
+
+		if err != nil {
+			if err == redis.Nil {
+				continue // No messages, retry
+			}
+			if errs.Is(err, redis.ErrClosed) {
+				r.logger.Info("Redis client closed, stopping consumer")
+				return nil
+			}
+			if ctx.Err() != nil {
+				break
 			}
+			r.logger.Error("Error reading from stream", "stream", streamKey, "error", err, "retry_in", backoff)
+			if !sleep(ctx, backoff) {
+				break
+			}
+			backoff = min(2*backoff, maxReadBackoff)
+			continue
+		}
+		backoff = minReadBackoff
 
-			for _, xStream := range streams {
-				for _, msg := range xStream.Messages {
-					dataStr, ok := msg.Values["data"].(string)
-					if !ok {
-						r.logger.Error("Invalid message format", "msg_id", msg.ID)
-						r.Ack(ctx, streamKey, group, msg.ID)
-						continue
-					}
-
-					if err := handler(ctx, msg.ID, []byte(dataStr)); err != nil {
-						r.logger.Error("Failed to process message", "msg_id", msg.ID, "error", err)
-					} else {
-						if err := r.Ack(ctx, streamKey, group, msg.ID); err != nil {
-							r.logger.Error("Failed to ack message", "msg_id", msg.ID, "error", err)
-						}
-					}
+		for _, xStream := range streams {
+			for _, msg := range xStream.Messages {
+				if !c.submit(ctx, msg, 1) {
+					return ctx.Err()
 				}
 			}
 		}
 	}
+
+	return ctx.Err()
 }
 
 func (r *redisStreamService) Ack(ctx context.Context, streamKey, group string, ids ...string) error {
 	return r.client.XAck(ctx, streamKey, group, ids...).Err()
 }
+
+// reclaim takes over every pending message of the group that has been idle for at least the
+// retry backoff and processes it again
+func (c *groupConsumer) reclaim(ctx context.Context) {
+	r, streamKey, group, consumer := c.service, c.stream, c.group, c.consumer
+	start := "0-0"
+	for ctx.Err() == nil {
+		messages, next, err := r.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   streamKey,
+			Group:    group,
+			Consumer: consumer,
+			MinIdle:  r.options.RetryBackoff,
+			Start:    start,
+			Count:    r.options.BatchSize,
+		}).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				r.logger.Error("Failed to reclaim pending messages", "stream", streamKey, "group", group, "error", err)
+			}
+			return
+		}
+
+		if len(messages) > 0 {
+			deliveries, err := c.deliveryCounts(ctx, messages)
+			if err != nil {
+				r.logger.Error("Failed to read delivery counts", "stream", streamKey, "group", group, "error", err)
+				return
+			}
+
+			for _, msg := range messages {
+				count := deliveries[msg.ID]
+				if count > r.options.MaxDeliveries {
+					// The consumer died on every previous delivery without failing the handler
+					c.deadLetter(ctx, msg, count, "exceeded maximum deliveries without acknowledgement")
+					continue
+				}
+				if !c.submit(ctx, msg, count) {
+					return
+				}
+			}
+		}
+
+		if next == "0-0" {
+			return
+		}
+		start = next
+	}
+}
+
+// deliveryCounts returns how many times each of the claimed messages has been delivered
+func (c *groupConsumer) deliveryCounts(ctx context.Context, messages []redis.XMessage) (map[string]int64, error) {
+	r := c.service
+	counts := make(map[string]int64, len(messages))
+	start := messages[0].ID
+	end := messages[len(messages)-1].ID
+
+	for {
+		pending, err := r.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream:   c.stream,
+			Group:    c.group,
+			Consumer: c.consumer,
+			Start:    start,
+			End:      end,
+			Count:    r.options.BatchSize,
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range pending {
+			counts[p.ID] = p.RetryCount
+		}
+		if int64(len(pending)) < r.options.BatchSize {
+			return counts, nil
+		}
+		start = nextID(pending[len(pending)-1].ID)
+	}
+}
+
+// nextID returns the smallest stream id after id. Exclusive ranges are not
+// understood by every server, so pages start at the following id instead
+func nextID(id string) string {
+	ms, seq, found := strings.Cut(id, "-")
+	sequence, err := strconv.ParseUint(seq, 10, 64)
+	if !found || err != nil {
+		return "(" + id
+	}
+	if sequence == math.MaxUint64 {
+		milliseconds, _ := strconv.ParseUint(ms, 10, 64)
+		return strconv.FormatUint(milliseconds+1, 10) + "-0"
+	}
+	return ms + "-" + strconv.FormatUint(sequence+1, 10)
+}
+
+// submit hands msg to the worker pool. It returns false once ctx is done
+func (c *groupConsumer) submit(ctx context.Context, msg redis.XMessage, deliveries int64) bool {
+	key := ""
+	if c.key != nil {
+		if data, ok := msg.Values[fieldData].(string); ok {
+			key = c.key([]byte(data))
+		}
+	}
+
+	err := c.pool.Submit(ctx, key, func() {
+		// In-flight messages are allowed to finish during shutdown, bounded by the handler timeout
+		msgCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.service.options.HandlerTimeout)
+		defer cancel()
+		c.process(msgCtx, msg, deliveries)
+	})
+	return err == nil
+}
+
+func (c *groupConsumer) process(ctx context.Context, msg redis.XMessage, deliveries int64) {
+	r := c.service
+
+	message, ok := parseMessage(msg)
+	if !ok {
+		c.deadLetter(ctx, msg, deliveries, "invalid message format")
+		return
+	}
+
+	if err := c.handler(ctx, message); err != nil {
+		if r.options.ShouldDeadLetter(deliveries) {
+			c.deadLetter(ctx, msg, deliveries, err.Error())
+			return
+		}
+		r.logger.Warn("Failed to process message, will retry", "stream", c.stream, "msg_id", msg.ID, "deliveries", deliveries, "error", err)
+		return
+	}
+
+	if err := r.Ack(ctx, c.stream, c.group, msg.ID); err != nil {
+		r.logger.Error("Failed to ack message", "msg_id", msg.ID, "error", err)
+	}
+}
+
+// deadLetter copies the message to the dead-letter stream and acks the original. If the copy
+// fails the original stays pending and is dead-lettered on the next reclaim
+func (c *groupConsumer) deadLetter(ctx context.Context, msg redis.XMessage, deliveries int64, reason string) {
+	r, streamKey, group, consumer := c.service, c.stream, c.group, c.consumer
+	values := map[string]interface{}{
+		"error":      reason,
+		"originalId": msg.ID,
+		"stream":     streamKey,
+		"group":      group,
+		"consumer":   consumer,
+		"deliveries": deliveries,
+		"failedAt":   time.Now().UTC().Format(time.RFC3339),
+	}
+	// Keep the original fields so the entry can be replayed as is
+	for _, field := range []string{fieldData, fieldType, fieldVersion, fieldContentType} {
+		if value, ok := msg.Values[field]; ok {
+			values[field] = value
+		}
+	}
+
+	dlq := stream.DeadLetterStream(streamKey)
+	if err := r.client.XAdd(ctx, r.addArgs(dlq, values)).Err(); err != nil {
+		r.logger.Error("Failed to dead-letter message", "stream", streamKey, "msg_id", msg.ID, "error", err)
+		return
+	}
+
+	if err := r.Ack(ctx, streamKey, group, msg.ID); err != nil {
+		r.logger.Error("Failed to ack dead-lettered message", "msg_id", msg.ID, "error", err)
+		return
+	}
+
+	r.logger.Error("Message moved to dead-letter stream", "stream", streamKey, "dlq", dlq, "msg_id", msg.ID, "deliveries", deliveries, "error", reason)
+}
+
+// parseMessage reads the fields of a stream entry. Only data is required, entries
+// published without metadata leave the other fields empty
+func parseMessage(msg redis.XMessage) (stream.Message, bool) {
+	data, ok := msg.Values[fieldData].(string)
+	if !ok {
+		return stream.Message{}, false
+	}
+
+	message := stream.Message{ID: msg.ID, Data: []byte(data)}
+	message.Type, _ = msg.Values[fieldType].(string)
+	message.ContentType, _ = msg.Values[fieldContentType].(string)
+	if version, ok := msg.Values[fieldVersion].(string); ok {
+		v, err := strconv.Atoi(version)
+		if err != nil {
+			return stream.Message{}, false
+		}
+		message.Version = v
+	}
+	return message, true
+}
+
+// sleep waits for d and reports whether ctx is still active
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,200 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/ouz/goboilerplate/pkg/errors"
+)
+
+// Event is a payload that can be published through the registry
+type Event interface {
+	EventType() string
+	EventVersion() int
+}
+
+// Upcaster converts the data of an event from one schema version to the next
+type Upcaster func(data json.RawMessage) (json.RawMessage, error)
+
+// Handler receives a decoded event together with the envelope it arrived in
+type Handler[T Event] func(ctx context.Context, envelope Envelope, event T) error
+
+type schema struct {
+	version   int
+	upcasters map[int]Upcaster
+}
+
+// Registry knows the current schema version of every event type a service
+// publishes or consumes. Unknown types are rejected on both sides and older
+// versions are upcast before they reach a handler
+type Registry struct {
+	mu      sync.RWMutex
+	schemas map[string]*schema
+}
+
+func NewRegistry() *Registry {
+	return &Registry{schemas: map[string]*schema{}}
+}
+
+// Register adds the event type of T at its current version
+func Register[T Event](r *Registry) error {
+	var event T
+	eventType, version := event.EventType(), event.EventVersion()
+	if eventType == "" || version < 1 {
+		return errors.ValidationError(fmt.Sprintf("invalid event schema %q v%d", eventType, version), nil)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.schemas[eventType]; ok {
+		if existing.version != version {
+			return errors.ConflictError(fmt.Sprintf("event type %q is already registered at v%d", eventType, existing.version), nil)
+		}
+		return nil
+	}
+
+	r.schemas[eventType] = &schema{version: version, upcasters: map[int]Upcaster{}}
+	return nil
+}
+
+// MustRegister is Register for schemas known at compile time, it panics if T cannot be registered
+func MustRegister[T Event](r *Registry) {
+	if err := Register[T](r); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterUpcaster adds the conversion of eventType data from version from to from+1
+func (r *Registry) RegisterUpcaster(eventType string, from int, upcaster Upcaster) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.schemas[eventType]
+	if !ok {
+		return unknownEventType(eventType)
+	}
+	if from < 1 || from >= s.version {
+		return errors.ValidationError(fmt.Sprintf("event type %q has no version after v%d", eventType, from), nil)
+	}
+
+	s.upcasters[from] = upcaster
+	return nil
+}
+
+// Validate checks that events of eventType are published at the current version
+func (r *Registry) Validate(eventType string, version int) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.schemas[eventType]
+	if !ok {
+		return unknownEventType(eventType)
+	}
+	if s.version != version {
+		return errors.ValidationError(fmt.Sprintf("event type %q must be published at v%d, got v%d", eventType, s.version, version), nil)
+	}
+	return nil
+}
+
+// Decode returns the envelope of msg with its data upcast to the current version
+func (r *Registry) Decode(msg Message) (Envelope, error) {
+	envelope, err := msg.Envelope()
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.schemas[envelope.Type]
+	if !ok {
+		return Envelope{}, unknownEventType(envelope.Type)
+	}
+	if envelope.Version < 1 || envelope.Version > s.version {
+		return Envelope{}, errors.ValidationError(fmt.Sprintf("unsupported version v%d of event type %q", envelope.Version, envelope.Type), nil)
+	}
+
+	for ; envelope.Version < s.version; envelope.Version++ {
+		upcaster, ok := s.upcasters[envelope.Version]
+		if !ok {
+			return Envelope{}, errors.ValidationError(fmt.Sprintf("no upcaster for event type %q v%d", envelope.Type, envelope.Version), nil)
+		}
+		if envelope.Data, err = upcaster(envelope.Data); err != nil {
+			return Envelope{}, errors.GenericError(fmt.Sprintf("failed to upcast event type %q v%d", envelope.Type, envelope.Version), err)
+		}
+	}
+
+	return envelope, nil
+}
+
+// Publish wraps event in an envelope and publishes it with its type, version and
+// content type as separate fields
+func Publish[T Event](ctx context.Context, ss StreamService, r *Registry, stream string, event T) error {
+	if err := r.Validate(event.EventType(), event.EventVersion()); err != nil {
+		return err
+	}
+
+	envelope, err := NewEnvelope(ctx, event.EventType(), event.EventVersion(), event)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return errors.GenericError("failed to marshal event envelope", err)
+	}
+
+	return ss.PublishMessage(ctx, stream, Message{
+		Type:        envelope.Type,
+		Version:     envelope.Version,
+		ContentType: ContentTypeJSON,
+		Data:        data,
+	})
+}
+
+// Subscribe consumes the events of type T from stream. Other registered types
+// are acknowledged without calling handler; unknown types and versions fail and
+// end up in the dead-letter stream
+func Subscribe[T Event](ctx context.Context, ss StreamService, r *Registry, stream, group, consumer string, handler Handler[T]) error {
+	var zero T
+	eventType := zero.EventType()
+	if err := r.Validate(eventType, zero.EventVersion()); err != nil {
+		return err
+	}
+
+	return ss.ConsumeMessages(ctx, stream, group, consumer, nil, func(ctx context.Context, msg Message) error {
+		envelope, err := r.Decode(msg)
+		if err != nil {
+			return err
+		}
+		if envelope.Type != eventType {
+			return nil
+		}
+
+		var event T
+		if err := envelope.Decode(&event); err != nil {
+			return err
+		}
+		return handler(envelope.Context(ctx), envelope, event)
+	})
+}
+
+// SubscribeEnvelopes consumes every event of stream as an envelope with its data
+// upcast to the current version, for handlers of several event types. Unknown
+// types and versions fail and end up in the dead-letter stream
+func SubscribeEnvelopes(ctx context.Context, ss StreamService, r *Registry, stream, group, consumer string, handler func(ctx context.Context, envelope Envelope) error) error {
+	return ss.ConsumeMessages(ctx, stream, group, consumer, nil, func(ctx context.Context, msg Message) error {
+		envelope, err := r.Decode(msg)
+		if err != nil {
+			return err
+		}
+		return handler(envelope.Context(ctx), envelope)
+	})
+}
+
+func unknownEventType(eventType string) error {
+	return errors.ValidationError(fmt.Sprintf("unknown event type %q", eventType), nil)
+}
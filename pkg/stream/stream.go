@@ -1,12 +1,70 @@
 package stream
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type HandlerFunc func(ctx context.Context, msgID string, payload []byte) error
 
 type StreamService interface {
 	Publish(ctx context.Context, stream string, event interface{}) error
+	// PublishMessage appends msg with its type, version and content type as separate fields
+	PublishMessage(ctx context.Context, stream string, msg Message) error
+	// Consume handles the messages of the group on a pool of workers until ctx is done,
+	// then waits for in-flight handlers before returning
 	Consume(ctx context.Context, stream, group, consumer string, handler HandlerFunc) error
+	// ConsumeOrdered is Consume with messages sharing a partition key handled one at a time in stream order.
+	// Ordering is best-effort: a failed message stays pending while later messages with its key are
+	// handled, and it is retried after the retry backoff, out of order
+	ConsumeOrdered(ctx context.Context, stream, group, consumer string, key KeyFunc, handler HandlerFunc) error
+	// ConsumeMessages is ConsumeOrdered for handlers that need the message fields. A nil key disables ordering
+	ConsumeMessages(ctx context.Context, stream, group, consumer string, key KeyFunc, handler MessageHandlerFunc) error
 	CreateGroup(ctx context.Context, stream, group string) error
 	Ack(ctx context.Context, stream, group string, ids ...string) error
 }
+
+// ConsumerOptions controls how failed and abandoned messages are retried and
+// how long entries are kept
+type ConsumerOptions struct {
+	// BatchSize is the maximum number of messages read or reclaimed at once
+	BatchSize int64
+	// Concurrency is the number of messages handled in parallel by one consumer
+	Concurrency int
+	// HandlerTimeout bounds a single handler call. In-flight handlers keep running
+	// after shutdown starts, up to this timeout
+	HandlerTimeout time.Duration
+	// MaxDeliveries is the number of deliveries after which a failing message is dead-lettered
+	MaxDeliveries int64
+	// RetryBackoff is how long a pending message must stay unacknowledged before it is
+	// reclaimed, either for a retry after a failure or from a consumer that died
+	RetryBackoff time.Duration
+	// ClaimInterval is how often pending messages are checked for reclaiming
+	ClaimInterval time.Duration
+	// Retention is how long entries stay in a stream and its dead-letter stream,
+	// older ones are trimmed when entries are added. Zero keeps every entry.
+	// Entries are trimmed even if a consumer group has not handled them yet
+	Retention time.Duration
+}
+
+func DefaultConsumerOptions() ConsumerOptions {
+	return ConsumerOptions{
+		BatchSize:      10,
+		Concurrency:    4,
+		HandlerTimeout: 10 * time.Second,
+		MaxDeliveries:  5,
+		RetryBackoff:   30 * time.Second,
+		ClaimInterval:  10 * time.Second,
+	}
+}
+
+// DeadLetterStream returns the stream that receives messages of stream which
+// exhausted their deliveries
+func DeadLetterStream(stream string) string {
+	return stream + ":dlq"
+}
+
+// ShouldDeadLetter reports whether a message delivered deliveries times must not be retried again
+func (o ConsumerOptions) ShouldDeadLetter(deliveries int64) bool {
+	return deliveries >= o.MaxDeliveries
+}
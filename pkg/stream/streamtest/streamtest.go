@@ -0,0 +1,376 @@
+// Package streamtest provides the conformance suite every stream.StreamService
+// implementation has to pass
+package streamtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ouz/goboilerplate/pkg/stream"
+)
+
+const waitTimeout = 5 * time.Second
+
+// Factory returns a service configured with options. Services may share
+// storage between calls, every test uses streams of its own
+type Factory func(t *testing.T, options stream.ConsumerOptions) stream.StreamService
+
+// Options are the consumer options the suite runs with, short enough to observe retries
+func Options() stream.ConsumerOptions {
+	return stream.ConsumerOptions{
+		BatchSize:      10,
+		Concurrency:    4,
+		HandlerTimeout: time.Second,
+		MaxDeliveries:  3,
+		RetryBackoff:   100 * time.Millisecond,
+		ClaimInterval:  20 * time.Millisecond,
+	}
+}
+
+// Run runs the conformance suite against the services returned by newService
+func Run(t *testing.T, newService Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, service stream.StreamService)
+	}{
+		{name: "DeliversMessagesInOrder", test: testDeliversMessagesInOrder},
+		{name: "GroupsReceiveEveryMessage", test: testGroupsReceiveEveryMessage},
+		{name: "ConsumersShareGroup", test: testConsumersShareGroup},
+		{name: "AckedMessagesAreNotRedelivered", test: testAckedMessagesAreNotRedelivered},
+		{name: "RetriesFailedMessages", test: testRetriesFailedMessages},
+		{name: "DeadLettersAfterMaxDeliveries", test: testDeadLettersAfterMaxDeliveries},
+		{name: "OrdersByPartitionKey", test: testOrdersByPartitionKey},
+		{name: "RetriesAfterLaterMessagesOfPartition", test: testRetriesAfterLaterMessagesOfPartition},
+		{name: "DrainsInFlightOnShutdown", test: testDrainsInFlightOnShutdown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newService(t, Options()))
+		})
+	}
+}
+
+func streamName(t *testing.T) string {
+	return fmt.Sprintf("streamtest:%s:%s", t.Name(), uuid.NewString())
+}
+
+// consume runs ConsumeMessages in the background until the returned stop function is called
+func consume(t *testing.T, service stream.StreamService, streamKey, group, consumer string, key stream.KeyFunc, handler stream.MessageHandlerFunc) (stop func()) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() {
+		done <- service.ConsumeMessages(ctx, streamKey, group, consumer, key, handler)
+	}()
+
+	stopped := false
+	stop = func() {
+		if stopped {
+			return
+		}
+		stopped = true
+		cancel()
+		select {
+		case err := <-done:
+			if err != nil && !errors.Is(err, context.Canceled) {
+				t.Errorf("ConsumeMessages() error = %v", err)
+			}
+		case <-time.After(waitTimeout):
+			t.Error("ConsumeMessages() did not return after cancel")
+		}
+	}
+	t.Cleanup(stop)
+	return stop
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(waitTimeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func publish(t *testing.T, service stream.StreamService, streamKey string, count int) {
+	t.Helper()
+	for i := range count {
+		err := service.PublishMessage(context.Background(), streamKey, stream.Message{
+			Type:        "test.event",
+			Version:     2,
+			ContentType: stream.ContentTypeJSON,
+			Data:        []byte(fmt.Sprintf(`{"n":%d}`, i)),
+		})
+		if err != nil {
+			t.Fatalf("PublishMessage() error = %v", err)
+		}
+	}
+}
+
+// collector records the data of every handled message
+type collector struct {
+	mu       sync.Mutex
+	messages []stream.Message
+}
+
+func (c *collector) handle(_ context.Context, msg stream.Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, msg)
+	return nil
+}
+
+func (c *collector) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.messages)
+}
+
+func (c *collector) data() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data := make([]string, len(c.messages))
+	for i, msg := range c.messages {
+		data[i] = string(msg.Data)
+	}
+	return data
+}
+
+func testDeliversMessagesInOrder(t *testing.T, service stream.StreamService) {
+	streamKey := streamName(t)
+	// Published before the group exists, groups read from the start of the stream
+	publish(t, service, streamKey, 5)
+
+	received := &collector{}
+	// A single partition key keeps the worker pool from reordering messages
+	stop := consume(t, service, streamKey, "group", "consumer", func([]byte) string { return "" }, received.handle)
+	waitFor(t, "5 messages", func() bool { return received.count() == 5 })
+	stop()
+
+	for i, data := range received.data() {
+		if want := fmt.Sprintf(`{"n":%d}`, i); data != want {
+			t.Errorf("message %d data = %s, want %s", i, data, want)
+		}
+	}
+	for _, msg := range received.messages {
+		if msg.ID == "" || msg.Type != "test.event" || msg.Version != 2 || msg.ContentType != stream.ContentTypeJSON {
+			t.Errorf("message fields = %+v, want id, type, version and content type", msg)
+		}
+	}
+}
+
+func testGroupsReceiveEveryMessage(t *testing.T, service stream.StreamService) {
+	streamKey := streamName(t)
+	first, second := &collector{}, &collector{}
+
+	consume(t, service, streamKey, "first", "consumer", nil, first.handle)
+	consume(t, service, streamKey, "second", "consumer", nil, second.handle)
+	publish(t, service, streamKey, 10)
+
+	waitFor(t, "both groups to receive 10 messages", func() bool { return first.count() == 10 && second.count() == 10 })
+}
+
+func testConsumersShareGroup(t *testing.T, service stream.StreamService) {
+	streamKey := streamName(t)
+	var handled sync.Map
+	var duplicates, total atomic.Int32
+
+	handler := func(_ context.Context, msg stream.Message) error {
+		if _, loaded := handled.LoadOrStore(string(msg.Data), true); loaded {
+			duplicates.Add(1)
+		}
+		total.Add(1)
+		return nil
+	}
+	consume(t, service, streamKey, "group", "first", nil, handler)
+	consume(t, service, streamKey, "group", "second", nil, handler)
+	publish(t, service, streamKey, 20)
+
+	waitFor(t, "20 messages", func() bool { return total.Load() >= 20 })
+	time.Sleep(2 * Options().RetryBackoff)
+
+	if duplicates.Load() != 0 || total.Load() != 20 {
+		t.Errorf("group handled %d messages with %d duplicates, want 20 without duplicates", total.Load(), duplicates.Load())
+	}
+}
+
+func testAckedMessagesAreNotRedelivered(t *testing.T, service stream.StreamService) {
+	streamKey := streamName(t)
+	received := &collector{}
+
+	consume(t, service, streamKey, "group", "consumer", nil, received.handle)
+	publish(t, service, streamKey, 3)
+
+	waitFor(t, "3 messages", func() bool { return received.count() == 3 })
+	time.Sleep(3 * Options().RetryBackoff)
+
+	if got := received.count(); got != 3 {
+		t.Errorf("handled %d messages, want 3", got)
+	}
+}
+
+func testRetriesFailedMessages(t *testing.T, service stream.StreamService) {
+	streamKey := streamName(t)
+	var attempts atomic.Int32
+
+	consume(t, service, streamKey, "group", "consumer", nil, func(context.Context, stream.Message) error {
+		if attempts.Add(1) < 3 {
+			return errors.New("temporary failure")
+		}
+		return nil
+	})
+	publish(t, service, streamKey, 1)
+
+	waitFor(t, "3 attempts", func() bool { return attempts.Load() >= 3 })
+	time.Sleep(3 * Options().RetryBackoff)
+
+	if got := attempts.Load(); got != 3 {
+		t.Errorf("handler called %d times, want 3", got)
+	}
+
+	dead := &collector{}
+	consume(t, service, stream.DeadLetterStream(streamKey), "inspect", "consumer", nil, dead.handle)
+	time.Sleep(2 * Options().ClaimInterval)
+	if dead.count() != 0 {
+		t.Errorf("dead-letter stream has %d messages, want 0", dead.count())
+	}
+}
+
+func testDeadLettersAfterMaxDeliveries(t *testing.T, service stream.StreamService) {
+	streamKey := streamName(t)
+	var attempts atomic.Int32
+
+	consume(t, service, streamKey, "group", "consumer", nil, func(context.Context, stream.Message) error {
+		attempts.Add(1)
+		return errors.New("permanent failure")
+	})
+	publish(t, service, streamKey, 1)
+
+	dead := &collector{}
+	consume(t, service, stream.DeadLetterStream(streamKey), "inspect", "consumer", nil, dead.handle)
+	waitFor(t, "the dead-lettered message", func() bool { return dead.count() == 1 })
+	time.Sleep(3 * Options().RetryBackoff)
+
+	if got := attempts.Load(); got != int32(Options().MaxDeliveries) {
+		t.Errorf("handler called %d times, want %d", got, Options().MaxDeliveries)
+	}
+	msg := dead.messages[0]
+	if string(msg.Data) != `{"n":0}` || msg.Type != "test.event" || msg.Version != 2 {
+		t.Errorf("dead-lettered message = %+v, want the original payload and fields", msg)
+	}
+}
+
+func testOrdersByPartitionKey(t *testing.T, service stream.StreamService) {
+	streamKey := streamName(t)
+	received := &collector{}
+	key := func(data []byte) string { return string(data[len(data)-2:]) }
+
+	var inFlight atomic.Int32
+	handler := func(ctx context.Context, msg stream.Message) error {
+		inFlight.Add(1)
+		defer inFlight.Add(-1)
+		time.Sleep(time.Millisecond)
+		return received.handle(ctx, msg)
+	}
+
+	for i := range 30 {
+		err := service.PublishMessage(context.Background(), streamKey, stream.Message{
+			Data: []byte(fmt.Sprintf(`{"seq":%02d,"key":%d}`, i, i%3)),
+		})
+		if err != nil {
+			t.Fatalf("PublishMessage() error = %v", err)
+		}
+	}
+	consume(t, service, streamKey, "group", "consumer", key, handler)
+	waitFor(t, "30 messages", func() bool { return received.count() == 30 })
+
+	last := map[string]string{}
+	for _, data := range received.data() {
+		k := key([]byte(data))
+		if data < last[k] {
+			t.Errorf("message %s handled after %s", data, last[k])
+		}
+		last[k] = data
+	}
+}
+
+// testRetriesAfterLaterMessagesOfPartition pins that ordering is best-effort: a
+// failed message does not hold back the later messages with its key
+func testRetriesAfterLaterMessagesOfPartition(t *testing.T, service stream.StreamService) {
+	streamKey := streamName(t)
+	var mu sync.Mutex
+	var attempts []string
+	failed := false
+
+	publish(t, service, streamKey, 2)
+	consume(t, service, streamKey, "group", "consumer", func([]byte) string { return "same" }, func(_ context.Context, msg stream.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, string(msg.Data))
+		if string(msg.Data) == `{"n":0}` && !failed {
+			failed = true
+			return errors.New("temporary failure")
+		}
+		return nil
+	})
+
+	waitFor(t, "the retry", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(attempts) == 3
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{`{"n":0}`, `{"n":1}`, `{"n":0}`}
+	if !slices.Equal(attempts, want) {
+		t.Errorf("handled %v, want %v", attempts, want)
+	}
+}
+
+func testDrainsInFlightOnShutdown(t *testing.T, service stream.StreamService) {
+	streamKey := streamName(t)
+	started := make(chan struct{})
+	var finished atomic.Bool
+
+	stop := consume(t, service, streamKey, "group", "consumer", nil, func(ctx context.Context, _ stream.Message) error {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		finished.Store(true)
+		return nil
+	})
+	publish(t, service, streamKey, 1)
+
+	select {
+	case <-started:
+	case <-time.After(waitTimeout):
+		t.Fatal("timed out waiting for the handler to start")
+	}
+	stop()
+
+	if !finished.Load() {
+		t.Error("ConsumeMessages() returned before the in-flight handler finished")
+	}
+
+	// The message was acked while draining, a new consumer must not see it again
+	received := &collector{}
+	consume(t, service, streamKey, "group", "other", nil, received.handle)
+	time.Sleep(3 * Options().RetryBackoff)
+	if received.count() != 0 {
+		t.Errorf("drained message was delivered again %d times", received.count())
+	}
+}
@@ -0,0 +1,77 @@
+package stream
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+)
+
+// KeyFunc returns the partition key of a message. Messages with the same key are
+// handled one at a time in the order they were read, retries are not ordered
+type KeyFunc func(payload []byte) string
+
+// WorkerPool runs tasks on a fixed number of goroutines. Submit blocks until a
+// worker is free, so a consumer never reads further ahead than it can handle.
+// An ordered pool routes every key to the same worker
+type WorkerPool struct {
+	shared     chan func()
+	partitions []chan func()
+	wg         sync.WaitGroup
+}
+
+func NewWorkerPool(concurrency int, ordered bool) *WorkerPool {
+	concurrency = max(concurrency, 1)
+	p := &WorkerPool{}
+
+	if !ordered {
+		p.shared = make(chan func())
+		for range concurrency {
+			p.wg.Go(func() { p.work(p.shared) })
+		}
+		return p
+	}
+
+	p.partitions = make([]chan func(), concurrency)
+	for i := range p.partitions {
+		tasks := make(chan func())
+		p.partitions[i] = tasks
+		p.wg.Go(func() { p.work(tasks) })
+	}
+	return p
+}
+
+func (p *WorkerPool) work(tasks <-chan func()) {
+	for task := range tasks {
+		task()
+	}
+}
+
+// Submit hands task to a worker, waiting while all of them are busy. It returns
+// ctx.Err() if ctx is done before a worker accepted the task
+func (p *WorkerPool) Submit(ctx context.Context, key string, task func()) error {
+	tasks := p.shared
+	if p.partitions != nil {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		tasks = p.partitions[h.Sum32()%uint32(len(p.partitions))]
+	}
+
+	select {
+	case tasks <- task:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting tasks and waits for the running ones to finish.
+// Submit must not be called after Close
+func (p *WorkerPool) Close() {
+	if p.shared != nil {
+		close(p.shared)
+	}
+	for _, tasks := range p.partitions {
+		close(tasks)
+	}
+	p.wg.Wait()
+}
@@ -0,0 +1,72 @@
+package audit
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ouz/goboilerplate/internal/domain/audit"
+	"github.com/ouz/goboilerplate/pkg/errors"
+)
+
+func TestResult(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantOutcome audit.Outcome
+		wantReason  string
+	}{
+		{
+			name:        "success",
+			err:         nil,
+			wantOutcome: audit.OutcomeSuccess,
+		},
+		{
+			name:        "app error keeps client message",
+			err:         errors.UnauthorizedError("Invalid credentials", fmt.Errorf("hash mismatch")),
+			wantOutcome: audit.OutcomeFailure,
+			wantReason:  "Invalid credentials",
+		},
+		{
+			name:        "wrapped app error",
+			err:         fmt.Errorf("login: %w", errors.NotFoundError("User not found", nil)),
+			wantOutcome: audit.OutcomeFailure,
+			wantReason:  "User not found",
+		},
+		{
+			name:        "unknown error hides details",
+			err:         fmt.Errorf("connection refused"),
+			wantOutcome: audit.OutcomeFailure,
+			wantReason:  "Unexpected error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := audit.Result(audit.ActionLogin, tt.err)
+			if event.Action != audit.ActionLogin {
+				t.Errorf("Result() action = %v, want %v", event.Action, audit.ActionLogin)
+			}
+			if event.Outcome != tt.wantOutcome {
+				t.Errorf("Result() outcome = %v, want %v", event.Outcome, tt.wantOutcome)
+			}
+			if event.Reason != tt.wantReason {
+				t.Errorf("Result() reason = %q, want %q", event.Reason, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestEvent_Builders(t *testing.T) {
+	event := audit.Failure(audit.ActionLogoutAll, "Failed").WithActor("admin").WithTarget("user")
+
+	if event.ActorID != "admin" || event.TargetID != "user" {
+		t.Errorf("Event builders = actor %q target %q, want admin and user", event.ActorID, event.TargetID)
+	}
+	if event.Outcome != audit.OutcomeFailure || event.Reason != "Failed" {
+		t.Errorf("Failure() = outcome %v reason %q", event.Outcome, event.Reason)
+	}
+
+	if event := audit.Success(audit.ActionCacheEvict).WithSubject("user:1"); event.Subject != "user:1" || event.TargetID != "" {
+		t.Errorf("WithSubject() = subject %q target %q, want only the subject", event.Subject, event.TargetID)
+	}
+}
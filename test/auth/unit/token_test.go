@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ouz/goboilerplate/internal/domain/auth"
+	sharedAuth "github.com/ouz/goboilerplate/pkg/auth"
+)
+
+// hashTag returns the part of key Cluster hashes to pick its slot
+func hashTag(key string) string {
+	start := strings.Index(key, "{")
+	if start < 0 {
+		return key
+	}
+	end := strings.Index(key[start+1:], "}")
+	if end <= 0 {
+		return key
+	}
+	return key[start+1 : start+1+end]
+}
+
+func TestToken_GetPrefixSharesSlotPerUser(t *testing.T) {
+	access, err := auth.NewToken("jti-1", "user-1", sharedAuth.ACCESS_TOKEN, "secret", sharedAuth.WEB, time.Minute)
+	if err != nil {
+		t.Fatalf("NewToken() error = %v", err)
+	}
+	refresh, err := auth.NewToken("jti-2", "user-1", sharedAuth.REFRESH_TOKEN, "secret", sharedAuth.IOS, time.Hour)
+	if err != nil {
+		t.Fatalf("NewToken() error = %v", err)
+	}
+
+	accessKey := access.GetPrefix() + ":" + access.ID
+	refreshKey := refresh.GetPrefix() + ":" + refresh.ID
+	if hashTag(accessKey) != "user-1" || hashTag(refreshKey) != "user-1" {
+		t.Errorf("token keys %q and %q, want both hash tagged with the user id", accessKey, refreshKey)
+	}
+
+	// Revoking by prefix must cover the keys of the token
+	if prefix := auth.GeneratePrefix(sharedAuth.ACCESS_TOKEN, "user-1", ""); !strings.HasPrefix(accessKey, prefix+":") {
+		t.Errorf("GeneratePrefix() = %q does not cover %q", prefix, accessKey)
+	}
+	if prefix := auth.GeneratePrefix(sharedAuth.REFRESH_TOKEN, "user-1", sharedAuth.IOS); prefix != refresh.GetPrefix() {
+		t.Errorf("GeneratePrefix() = %q, want %q", prefix, refresh.GetPrefix())
+	}
+}
@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ouz/goboilerplate/pkg/cache"
+	redisCache "github.com/ouz/goboilerplate/pkg/cache/redis"
+	appErrors "github.com/ouz/goboilerplate/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisCache_ScanCursor(t *testing.T) {
+	c, server := newRedisCache(t)
+	ctx := context.Background()
+	for i := range 25 {
+		server.Set(fmt.Sprintf("user:%d", i), "x")
+	}
+	server.Set("session:1", "x")
+
+	// miniredis returns every match in the first page
+	keys, next, err := c.Scan(ctx, "user:*", "", 10)
+	if err != nil || len(keys) != 25 || next != "" {
+		t.Errorf("Scan() = %d keys, next %q, %v, want 25 keys and a complete scan", len(keys), next, err)
+	}
+	if _, _, err := c.Scan(ctx, "user:*", "not-a-cursor", 10); !appErrors.IsErrorCode(err, appErrors.ErrCodeValidation) {
+		t.Errorf("Scan() with a malformed cursor error = %v, want a validation error", err)
+	}
+}
+
+func TestRedisCache_ScanClusterCursor(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{server.Addr()}})
+	t.Cleanup(func() { _ = client.Close() })
+	c := redisCache.NewRedisCacheService(client, cache.DefaultEncoder())
+	for i := range 15 {
+		server.Set(fmt.Sprintf("user:%d", i), "x")
+	}
+
+	keys, err := cache.ScanAll(context.Background(), c, "user:*")
+	if err != nil || len(keys) != 15 {
+		t.Errorf("ScanAll() = %d keys, %v, want 15", len(keys), err)
+	}
+	if _, _, err := c.Scan(context.Background(), "user:*", "unknown:6379/0", 10); !appErrors.IsErrorCode(err, appErrors.ErrCodeValidation) {
+		t.Errorf("Scan() with a cursor of an unknown master error = %v, want a validation error", err)
+	}
+}
+
+func TestRedisCache_InspectAndStats(t *testing.T) {
+	c, _ := newRedisCache(t)
+	ctx := context.Background()
+	if err := c.Set(ctx, "user", "1", time.Minute, cachedUser{Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set(ctx, "user", "2", 0, cachedUser{Name: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	info, found, err := c.Inspect(ctx, "user", "1")
+	if err != nil || !found {
+		t.Fatalf("Inspect() = %v, %v", found, err)
+	}
+	if info.TTL <= 0 || info.TTL > time.Minute || info.Size == 0 || info.Format != "json" {
+		t.Errorf("Inspect() = %+v, want a json entry expiring within a minute", info)
+	}
+	if value, ok := info.Value.(map[string]any); !ok || value["name"] != "alice" {
+		t.Errorf("Inspect() value = %#v, want the decoded entry", info.Value)
+	}
+
+	if info, _, _ := c.Inspect(ctx, "user", "2"); info.TTL != 0 {
+		t.Errorf("Inspect() TTL of a key without expiry = %v, want 0", info.TTL)
+	}
+	if _, found, err := c.Inspect(ctx, "user", "missing"); err != nil || found {
+		t.Errorf("Inspect() of a missing key = %v, %v, want a miss", found, err)
+	}
+
+	stats, err := c.Stats(ctx, "user")
+	if err != nil {
+		t.Fatalf("Stats() error = %v", err)
+	}
+	if stats.Keys != 2 || stats.Bytes == 0 {
+		t.Errorf("Stats() = %+v, want 2 keys using memory", stats)
+	}
+}
+
+func TestLocalCache_InspectAndStats(t *testing.T) {
+	local := cache.NewLocalCacheService(testLogger(), 10, cache.DefaultEncoder())
+	local.Set("user", "1", time.Minute, cachedUser{Name: "alice"})
+	local.Set("user", "2", time.Minute, cachedUser{Name: "bob"})
+	local.Set("session", "1", time.Minute, "x")
+
+	info, found, err := local.Inspect("user", "1")
+	if err != nil || !found || info.TTL <= 0 || info.Size == 0 {
+		t.Errorf("Inspect() = %+v, %v, %v, want an expiring entry", info, found, err)
+	}
+
+	if stats := local.Stats("user"); stats.Keys != 2 || stats.Bytes == 0 {
+		t.Errorf("Stats() = %+v, want 2 keys", stats)
+	}
+	local.EvictByPrefix("user")
+	if stats := local.Stats("user"); stats.Keys != 0 {
+		t.Errorf("Stats() after EvictByPrefix = %+v, want no keys", stats)
+	}
+}
+
+func TestAdmin_InspectsListsAndEvicts(t *testing.T) {
+	remote, server := newRedisCache(t)
+	local := cache.NewLocalCacheService(testLogger(), 10, cache.DefaultEncoder())
+	tiered := cache.NewTieredCacheService(testLogger(), local, remote, &memoryBus{}, cache.TieredCacheOptions{
+		LocalTTL: time.Minute,
+		Prefixes: []string{"user"},
+	})
+	admin := cache.NewAdmin(tiered, local, []string{"user"})
+	ctx := context.Background()
+
+	for _, key := range []string{"1", "2"} {
+		if err := tiered.Set(ctx, "user", key, time.Minute, cachedUser{Name: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inspection, err := admin.Inspect(ctx, "user", "1")
+	if err != nil || inspection.Redis == nil || inspection.Local == nil {
+		t.Errorf("Inspect() = %+v, %v, want the entry of both tiers", inspection, err)
+	}
+	if _, err := admin.Inspect(ctx, "user", "missing"); !appErrors.IsNotFoundError(err) {
+		t.Errorf("Inspect() of a missing key error = %v, want not found", err)
+	}
+
+	page, err := admin.Keys(ctx, "user", "", 0)
+	if err != nil {
+		t.Fatalf("Keys() error = %v", err)
+	}
+	slices.Sort(page.Keys)
+	if !slices.Equal(page.Keys, []string{"1", "2"}) || page.Cursor != "" {
+		t.Errorf("Keys() = %+v, want keys 1 and 2 without the prefix", page)
+	}
+	if _, err := admin.Keys(ctx, "*", "", 0); !appErrors.IsErrorCode(err, appErrors.ErrCodeValidation) {
+		t.Errorf("Keys() of a pattern prefix error = %v, want a validation error", err)
+	}
+
+	reports, err := admin.Stats(ctx)
+	if err != nil || len(reports) != 1 || reports[0].Redis.Keys != 2 || reports[0].Local == nil || reports[0].Local.Keys != 2 {
+		t.Errorf("Stats() = %+v, %v, want 2 keys in both tiers", reports, err)
+	}
+
+	if err := admin.Evict(ctx, "user", "1"); err != nil {
+		t.Fatalf("Evict() error = %v", err)
+	}
+	if _, found, _ := local.Inspect("user", "1"); found || server.Exists("user:1") {
+		t.Error("Evict() left the entry in a tier")
+	}
+	if err := admin.EvictPrefix(ctx, "user"); err != nil {
+		t.Fatalf("EvictPrefix() error = %v", err)
+	}
+	if reports, _ := admin.Stats(ctx, "user"); reports[0].Redis.Keys != 0 || reports[0].Local.Keys != 0 {
+		t.Errorf("Stats() after EvictPrefix = %+v, want no keys", reports)
+	}
+}
+
+func TestAdmin_InspectRedactsCredentials(t *testing.T) {
+	remote, _ := newRedisCache(t)
+	local := cache.NewLocalCacheService(testLogger(), 10, cache.DefaultEncoder())
+	tiered := cache.NewTieredCacheService(testLogger(), local, remote, &memoryBus{}, cache.TieredCacheOptions{
+		LocalTTL: time.Minute,
+		Prefixes: []string{"user"},
+	})
+	admin := cache.NewAdmin(tiered, local, []string{"user"})
+	ctx := context.Background()
+
+	cached := map[string]any{
+		"Email":        "alice@example.com",
+		"Credentials":  []any{map[string]any{"CredentialType": "PASSWORD", "Hash": "$2a$10$secret"}},
+		"ClientSecret": "client-secret",
+	}
+	if err := tiered.Set(ctx, "user", "1", time.Minute, cached); err != nil {
+		t.Fatal(err)
+	}
+
+	inspection, err := admin.Inspect(ctx, "user", "1")
+	if err != nil {
+		t.Fatalf("Inspect() error = %v", err)
+	}
+	for tier, info := range map[string]*cache.EntryInfo{"redis": inspection.Redis, "local": inspection.Local} {
+		value, _ := info.Value.(map[string]any)
+		credential, _ := value["Credentials"].([]any)[0].(map[string]any)
+		if credential["Hash"] != "[REDACTED]" || value["ClientSecret"] != "[REDACTED]" {
+			t.Errorf("Inspect() %s value = %v, want credentials redacted", tier, value)
+		}
+		if value["Email"] != "alice@example.com" || credential["CredentialType"] != "PASSWORD" {
+			t.Errorf("Inspect() %s value = %v, want other fields kept", tier, value)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ouz/goboilerplate/pkg/cache"
+	appErrors "github.com/ouz/goboilerplate/pkg/errors"
+)
+
+func TestGetOrLoad_CachesLoadedValue(t *testing.T) {
+	ca := cache.NewCacheAside(testLogger(), newRemoteCache(), cache.CacheAsideOptions{})
+	var loads atomic.Int32
+	loader := func(context.Context) (cachedUser, error) {
+		loads.Add(1)
+		return cachedUser{Name: "alice"}, nil
+	}
+
+	for range 3 {
+		got, err := cache.GetOrLoad(context.Background(), ca, "user", "1", time.Minute, loader)
+		if err != nil {
+			t.Fatalf("GetOrLoad() error = %v", err)
+		}
+		if got.Name != "alice" {
+			t.Errorf("GetOrLoad() = %+v, want alice", got)
+		}
+	}
+	if loads.Load() != 1 {
+		t.Errorf("loader called %d times, want 1", loads.Load())
+	}
+}
+
+func TestGetOrLoad_DeduplicatesConcurrentMisses(t *testing.T) {
+	ca := cache.NewCacheAside(testLogger(), newRemoteCache(), cache.CacheAsideOptions{})
+	var loads atomic.Int32
+	release := make(chan struct{})
+	loader := func(context.Context) (cachedUser, error) {
+		loads.Add(1)
+		<-release
+		return cachedUser{Name: "alice"}, nil
+	}
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Go(func() {
+			if _, err := cache.GetOrLoad(context.Background(), ca, "user", "1", time.Minute, loader); err != nil {
+				t.Errorf("GetOrLoad() error = %v", err)
+			}
+		})
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if loads.Load() != 1 {
+		t.Errorf("loader called %d times, want 1", loads.Load())
+	}
+}
+
+func TestGetOrLoad_CallerCancellationDoesNotCancelLoad(t *testing.T) {
+	remote := newRemoteCache()
+	ca := cache.NewCacheAside(testLogger(), remote, cache.CacheAsideOptions{})
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (cachedUser, error) {
+		<-release
+		return cachedUser{Name: "alice"}, ctx.Err()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := cache.GetOrLoad(ctx, ca, "user", "1", time.Minute, loader); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetOrLoad() error = %v, want deadline exceeded", err)
+	}
+
+	close(release)
+	got, err := cache.GetOrLoad(context.Background(), ca, "user", "1", time.Minute, loader)
+	if err != nil || got.Name != "alice" {
+		t.Errorf("GetOrLoad() = %+v, %v, want the value loaded for the cancelled caller", got, err)
+	}
+}
+
+func TestGetOrLoad_LoadsValuesCachedWithoutEntry(t *testing.T) {
+	remote := newRemoteCache()
+	ca := cache.NewCacheAside(testLogger(), remote, cache.CacheAsideOptions{StaleWhileRevalidate: time.Minute})
+	// Written as a plain value, before values were wrapped in an entry
+	if err := remote.Set(context.Background(), "user", "1", time.Minute, cachedUser{Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := cache.GetOrLoad(context.Background(), ca, "user", "1", time.Minute, func(context.Context) (cachedUser, error) {
+		return cachedUser{Name: "bob"}, nil
+	})
+	if err != nil || got.Name != "bob" {
+		t.Errorf("GetOrLoad() = %+v, %v, want the loaded value instead of an empty one", got, err)
+	}
+}
+
+func TestGetOrLoad_CachesNotFound(t *testing.T) {
+	ca := cache.NewCacheAside(testLogger(), newRemoteCache(), cache.CacheAsideOptions{NegativeTTL: time.Minute})
+	var loads atomic.Int32
+	loader := func(context.Context) (*cachedUser, error) {
+		loads.Add(1)
+		return nil, appErrors.NotFoundError("User not found", nil)
+	}
+
+	for range 3 {
+		_, err := cache.GetOrLoad(context.Background(), ca, "user", "missing", time.Minute, loader)
+		if !appErrors.IsNotFoundError(err) {
+			t.Fatalf("GetOrLoad() error = %v, want not found", err)
+		}
+	}
+	if loads.Load() != 1 {
+		t.Errorf("loader called %d times, want 1", loads.Load())
+	}
+}
+
+func TestGetOrLoad_DoesNotCacheOtherErrors(t *testing.T) {
+	ca := cache.NewCacheAside(testLogger(), newRemoteCache(), cache.CacheAsideOptions{NegativeTTL: time.Minute})
+	var loads atomic.Int32
+	loader := func(context.Context) (*cachedUser, error) {
+		loads.Add(1)
+		return nil, errors.New("connection refused")
+	}
+
+	for range 2 {
+		if _, err := cache.GetOrLoad(context.Background(), ca, "user", "1", time.Minute, loader); err == nil {
+			t.Fatal("GetOrLoad() error = nil, want the loader error")
+		}
+	}
+	if loads.Load() != 2 {
+		t.Errorf("loader called %d times, want 2", loads.Load())
+	}
+}
+
+func TestGetOrLoad_ServesStaleWhileRevalidating(t *testing.T) {
+	ca := cache.NewCacheAside(testLogger(), newRemoteCache(), cache.CacheAsideOptions{StaleWhileRevalidate: time.Minute})
+	var loads atomic.Int32
+	loader := func(context.Context) (cachedUser, error) {
+		n := loads.Add(1)
+		return cachedUser{Name: map[int32]string{1: "old", 2: "new"}[n]}, nil
+	}
+
+	if _, err := cache.GetOrLoad(context.Background(), ca, "user", "1", time.Millisecond, loader); err != nil {
+		t.Fatalf("GetOrLoad() error = %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	got, err := cache.GetOrLoad(context.Background(), ca, "user", "1", time.Hour, loader)
+	if err != nil || got.Name != "old" {
+		t.Fatalf("GetOrLoad() = %+v, %v, want the stale value", got, err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		got, _ = cache.GetOrLoad(context.Background(), ca, "user", "1", time.Hour, loader)
+		if got.Name == "new" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("stale value was not refreshed in the background")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if loads.Load() != 2 {
+		t.Errorf("loader called %d times, want 2", loads.Load())
+	}
+}
+
+func TestGetOrLoad_ReloadsExpiredWithoutStaleWindow(t *testing.T) {
+	ca := cache.NewCacheAside(testLogger(), newRemoteCache(), cache.CacheAsideOptions{})
+	var loads atomic.Int32
+	loader := func(context.Context) (cachedUser, error) {
+		loads.Add(1)
+		return cachedUser{Name: "alice"}, nil
+	}
+
+	cache.GetOrLoad(context.Background(), ca, "user", "1", time.Millisecond, loader)
+	time.Sleep(5 * time.Millisecond)
+	cache.GetOrLoad(context.Background(), ca, "user", "1", time.Millisecond, loader)
+
+	if loads.Load() != 2 {
+		t.Errorf("loader called %d times, want 2", loads.Load())
+	}
+}
+
+func TestGetOrLoad_JittersTTL(t *testing.T) {
+	remote := newRemoteCache()
+	ca := cache.NewCacheAside(testLogger(), remote, cache.CacheAsideOptions{Jitter: 0.1, StaleWhileRevalidate: time.Minute})
+	loader := func(context.Context) (cachedUser, error) { return cachedUser{}, nil }
+
+	ttls := map[time.Duration]bool{}
+	for i := range 20 {
+		key := string(rune('a' + i))
+		if _, err := cache.GetOrLoad(context.Background(), ca, "user", key, 10*time.Minute, loader); err != nil {
+			t.Fatalf("GetOrLoad() error = %v", err)
+		}
+
+		// The stored TTL covers the stale window on top of the jittered TTL
+		ttl := remote.ttl("user", key) - time.Minute
+		if ttl < 9*time.Minute || ttl > 11*time.Minute {
+			t.Errorf("ttl = %v, want within 10%% of 10m", ttl)
+		}
+		ttls[ttl] = true
+	}
+	if len(ttls) < 2 {
+		t.Error("every entry got the same ttl, want jittered ttls")
+	}
+}
@@ -0,0 +1,161 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ouz/goboilerplate/pkg/cache"
+)
+
+type codecRole struct {
+	ID          string   `json:"id"`
+	Permissions []string `json:"permissions"`
+}
+
+type codecUser struct {
+	ID        string      `json:"id"`
+	Email     string      `json:"email"`
+	Password  string      `json:"-"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Roles     []codecRole `json:"roles"`
+	Manager   *codecUser  `json:"manager,omitempty"`
+}
+
+func sampleUser() codecUser {
+	roles := make([]codecRole, 20)
+	for i := range roles {
+		roles[i] = codecRole{ID: "role", Permissions: []string{"users:read", "users:write", "clients:read"}}
+	}
+	return codecUser{
+		ID:        "6f1c7a52-8f7e-4a8b-9a53-1f0f7d3c2b11",
+		Email:     "alice@example.com",
+		Password:  "secret",
+		CreatedAt: time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+		Roles:     roles,
+	}
+}
+
+func TestEncoder_RoundTrips(t *testing.T) {
+	codecs := []cache.Codec{cache.JSON, cache.Msgpack, cache.Gob}
+	compressions := []cache.Compression{cache.CompressionNone, cache.CompressionZstd, cache.CompressionSnappy}
+
+	for _, codec := range codecs {
+		for _, compression := range compressions {
+			encoder := cache.NewEncoder(cache.EncoderOptions{Codec: codec, Compression: compression})
+			data, err := encoder.Encode(sampleUser())
+			if err != nil {
+				t.Fatalf("Encode(format %d, compression %d) error = %v", codec.Format(), compression, err)
+			}
+
+			var got codecUser
+			if err := encoder.Decode(data, &got); err != nil {
+				t.Fatalf("Decode(format %d, compression %d) error = %v", codec.Format(), compression, err)
+			}
+
+			// MessagePack keeps the instant but not the zone
+			got.CreatedAt = got.CreatedAt.UTC()
+			want := sampleUser()
+			if codec != cache.Gob {
+				// JSON and MessagePack both honour json:"-"
+				want.Password = ""
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("format %d, compression %d decoded %+v, want %+v", codec.Format(), compression, got, want)
+			}
+		}
+	}
+}
+
+func TestEncoder_DecodesValuesOfOtherCodecs(t *testing.T) {
+	written, err := cache.NewEncoder(cache.EncoderOptions{Codec: cache.Msgpack, Compression: cache.CompressionZstd}).Encode(sampleUser())
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	var got codecUser
+	if err := cache.DefaultEncoder().Decode(written, &got); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if got.Email != "alice@example.com" || len(got.Roles) != 20 {
+		t.Errorf("Decode() = %+v, want the msgpack value", got)
+	}
+}
+
+func TestEncoder_DecodesUnmarkedJSON(t *testing.T) {
+	// Values written before the format marker are plain JSON
+	legacy, _ := json.Marshal(sampleUser())
+
+	var got codecUser
+	encoder := cache.NewEncoder(cache.EncoderOptions{Codec: cache.Gob})
+	if err := encoder.Decode(legacy, &got); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if got.Email != "alice@example.com" {
+		t.Errorf("Decode() = %+v, want the legacy value", got)
+	}
+}
+
+func TestEncoder_CompressesAboveThreshold(t *testing.T) {
+	encoder := cache.NewEncoder(cache.EncoderOptions{Codec: cache.JSON, Compression: cache.CompressionZstd, CompressionThreshold: 256})
+
+	small, _ := encoder.Encode("token")
+	if !bytes.Contains(small, []byte(`"token"`)) {
+		t.Errorf("value below the threshold was compressed: %q", small)
+	}
+
+	large := strings.Repeat("permission ", 200)
+	compressed, _ := encoder.Encode(large)
+	if len(compressed) >= len(large)/4 {
+		t.Errorf("encoded %d bytes into %d, want compression", len(large), len(compressed))
+	}
+
+	var got string
+	if err := encoder.Decode(compressed, &got); err != nil || got != large {
+		t.Errorf("Decode() = %d bytes, %v, want the original", len(got), err)
+	}
+}
+
+func TestEncoder_RejectsCorruptValues(t *testing.T) {
+	encoder := cache.DefaultEncoder()
+	var got codecUser
+
+	for name, data := range map[string][]byte{
+		"truncated header":    {0xCA, 1},
+		"unknown format":      {0xCA, 42, 0, '{', '}'},
+		"unknown compression": {0xCA, 1, 42, '{', '}'},
+		"corrupt zstd":        {0xCA, 1, 1, 'n', 'o', 't'},
+	} {
+		if err := encoder.Decode(data, &got); err == nil {
+			t.Errorf("Decode(%s) error = nil, want an error", name)
+		}
+	}
+}
+
+func TestCodecByName(t *testing.T) {
+	for name, want := range map[string]cache.Codec{"json": cache.JSON, "msgpack": cache.Msgpack, "gob": cache.Gob} {
+		if got, err := cache.CodecByName(name); err != nil || got != want {
+			t.Errorf("CodecByName(%q) = %v, %v", name, got, err)
+		}
+	}
+	if _, err := cache.CodecByName("xml"); err == nil {
+		t.Error("CodecByName(xml) error = nil, want an error")
+	}
+	if _, err := cache.CompressionByName("lz4"); err == nil {
+		t.Error("CompressionByName(lz4) error = nil, want an error")
+	}
+}
+
+func TestLocalCache_UsesEncoder(t *testing.T) {
+	local := cache.NewLocalCacheService(testLogger(), 1, cache.NewEncoder(cache.EncoderOptions{Codec: cache.Msgpack, Compression: cache.CompressionSnappy}))
+	local.Set("user", "1", time.Minute, sampleUser())
+
+	var got codecUser
+	found, err := local.Get("user", "1", &got)
+	if err != nil || !found || got.Email != "alice@example.com" {
+		t.Errorf("Get() = %+v, %v, %v, want the cached user", got, found, err)
+	}
+}
@@ -0,0 +1,225 @@
+package cache
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ouz/goboilerplate/pkg/cache"
+	redisCache "github.com/ouz/goboilerplate/pkg/cache/redis"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestNewUniversalOptions_Modes(t *testing.T) {
+	tests := []struct {
+		name        string
+		options     redisCache.ConnectOptions
+		wantAddrs   []string
+		wantMaster  string
+		wantCluster bool
+	}{
+		{
+			name:      "Standalone",
+			options:   redisCache.ConnectOptions{Mode: redisCache.ModeStandalone, Addrs: []string{"valkey:6379", "ignored:6379"}, DB: 2},
+			wantAddrs: []string{"valkey:6379"},
+		},
+		{
+			name:       "Sentinel",
+			options:    redisCache.ConnectOptions{Mode: redisCache.ModeSentinel, Addrs: []string{"s1:26379", "s2:26379"}, MasterName: "primary"},
+			wantAddrs:  []string{"s1:26379", "s2:26379"},
+			wantMaster: "primary",
+		},
+		{
+			name:        "ClusterConfigurationEndpoint",
+			options:     redisCache.ConnectOptions{Mode: redisCache.ModeCluster, Addrs: []string{"cluster:6379"}},
+			wantAddrs:   []string{"cluster:6379"},
+			wantCluster: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := redisCache.NewUniversalOptions(tt.options)
+			if err != nil {
+				t.Fatalf("NewUniversalOptions() error = %v", err)
+			}
+			if !slices.Equal(got.Addrs, tt.wantAddrs) || got.MasterName != tt.wantMaster || got.IsClusterMode != tt.wantCluster {
+				t.Errorf("NewUniversalOptions() = addrs %v, master %q, cluster %v", got.Addrs, got.MasterName, got.IsClusterMode)
+			}
+		})
+	}
+}
+
+func TestValidateMode_RejectsIncompleteDeployments(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		addrs      []string
+		masterName string
+		db         int
+	}{
+		{name: "UnknownMode", mode: "replica", addrs: []string{"valkey:6379"}},
+		{name: "StandaloneWithoutAddress", mode: redisCache.ModeStandalone},
+		{name: "SentinelWithoutMaster", mode: redisCache.ModeSentinel, addrs: []string{"s1:26379"}},
+		{name: "ClusterWithDB", mode: redisCache.ModeCluster, addrs: []string{"cluster:6379"}, db: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := redisCache.ValidateMode(tt.mode, tt.addrs, tt.masterName, tt.db); err == nil {
+				t.Error("ValidateMode() error = nil, want a validation error")
+			}
+		})
+	}
+}
+
+// writeCA writes a self-signed CA certificate and its key as PEM files
+func writeCA(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "valkey-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "ca.pem")
+	keyFile = filepath.Join(dir, "ca-key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	certFile, keyFile := writeCA(t)
+
+	if config, err := redisCache.NewTLSConfig(redisCache.TLSOptions{CAFile: certFile}); err != nil || config != nil {
+		t.Errorf("NewTLSConfig() with TLS disabled = %v, %v, want nil", config, err)
+	}
+
+	config, err := redisCache.NewTLSConfig(redisCache.TLSOptions{
+		Enabled:    true,
+		CAFile:     certFile,
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		ServerName: "valkey.internal",
+	})
+	if err != nil {
+		t.Fatalf("NewTLSConfig() error = %v", err)
+	}
+	if config.RootCAs == nil || len(config.Certificates) != 1 || config.ServerName != "valkey.internal" {
+		t.Errorf("NewTLSConfig() = %+v, want the CA, client certificate and server name", config)
+	}
+
+	if _, err := redisCache.NewTLSConfig(redisCache.TLSOptions{Enabled: true, CAFile: keyFile}); err == nil {
+		t.Error("NewTLSConfig() with a CA file without certificates error = nil")
+	}
+	if _, err := redisCache.NewTLSConfig(redisCache.TLSOptions{Enabled: true, CAFile: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Error("NewTLSConfig() with a missing CA file error = nil")
+	}
+}
+
+func TestConnectRedis_Authenticates(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.RequireUserAuth("app", "secret")
+	options := redisCache.ConnectOptions{Mode: redisCache.ModeStandalone, Addrs: []string{server.Addr()}, Username: "app", Password: "wrong", RequiredOnStartup: true}
+
+	if _, err := redisCache.ConnectRedis(testLogger(), options); err == nil {
+		t.Fatal("ConnectRedis() with a wrong password error = nil")
+	}
+
+	options.Password = "secret"
+	client, err := redisCache.ConnectRedis(testLogger(), options)
+	if err != nil {
+		t.Fatalf("ConnectRedis() error = %v", err)
+	}
+	defer redisCache.CloseRedisClient(client)
+
+	c := redisCache.NewRedisCacheService(client, cache.DefaultEncoder())
+	if err := c.Set(context.Background(), "user", "1", time.Minute, "alice"); err != nil {
+		t.Errorf("Set() error = %v", err)
+	}
+}
+
+func TestConnectRedis_StartsDegradedUnlessRequired(t *testing.T) {
+	server := miniredis.RunT(t)
+	addr := server.Addr()
+	server.Close()
+	options := redisCache.ConnectOptions{Mode: redisCache.ModeStandalone, Addrs: []string{addr}, DialTimeout: 100 * time.Millisecond}
+
+	client, err := redisCache.ConnectRedis(testLogger(), options)
+	if err != nil {
+		t.Fatalf("ConnectRedis() with Valkey down error = %v, want a degraded client", err)
+	}
+	_ = redisCache.CloseRedisClient(client)
+
+	options.RequiredOnStartup = true
+	if _, err := redisCache.ConnectRedis(testLogger(), options); err == nil {
+		t.Error("ConnectRedis() with Valkey down and required error = nil")
+	}
+}
+
+func TestRedisCache_ClusterClient(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{server.Addr()}})
+	t.Cleanup(func() { _ = client.Close() })
+	c := redisCache.NewRedisCacheService(client, cache.DefaultEncoder())
+	ctx := context.Background()
+
+	for _, key := range []string{"1", "2", "3"} {
+		if err := c.Set(ctx, "user", key, time.Minute, cachedUser{Name: key}); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+	}
+
+	results := []cachedUser{{}, {}, {}}
+	found, err := c.MGet(ctx, "user", []string{"1", "missing", "3"}, []any{&results[0], &results[1], &results[2]})
+	if err != nil {
+		t.Fatalf("MGet() error = %v", err)
+	}
+	if !found[0] || found[1] || !found[2] || results[2].Name != "3" {
+		t.Errorf("MGet() = %v, %+v", found, results)
+	}
+
+	keys, err := cache.ScanAll(ctx, c, "user:*")
+	if err != nil || len(keys) != 3 {
+		t.Errorf("Scan() = %v, %v, want 3 keys", keys, err)
+	}
+	if err := c.EvictByPrefix(ctx, "user"); err != nil {
+		t.Fatalf("EvictByPrefix() error = %v", err)
+	}
+	if keys := server.Keys(); len(keys) != 0 {
+		t.Errorf("keys after EvictByPrefix = %v, want none", keys)
+	}
+}
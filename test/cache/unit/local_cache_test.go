@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/ouz/goboilerplate/pkg/cache"
+)
+
+func get(t *testing.T, local cache.LocalCacheService, prefix, key string) (string, bool) {
+	t.Helper()
+	var value string
+	found, err := local.Get(prefix, key, &value)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	return value, found
+}
+
+func TestLocalCache_SetGetEvict(t *testing.T) {
+	local := cache.NewLocalCacheService(testLogger(), 1, cache.DefaultEncoder())
+
+	local.Set("user", "1", time.Minute, "alice")
+	if value, found := get(t, local, "user", "1"); !found || value != "alice" {
+		t.Fatalf("Get() = %q, %v, want alice", value, found)
+	}
+
+	local.Evict("user", "1")
+	if _, found := get(t, local, "user", "1"); found {
+		t.Error("Get() found an evicted key")
+	}
+}
+
+func TestLocalCache_EvictByPrefix(t *testing.T) {
+	local := cache.NewLocalCacheService(testLogger(), 1, cache.DefaultEncoder())
+	local.Set("user", "1", time.Minute, "alice")
+	local.Set("user", "2", time.Minute, "bob")
+	local.Set("users", "1", time.Minute, "other prefix")
+	local.Set("client", "user:1", time.Minute, "key containing the prefix")
+
+	local.EvictByPrefix("user")
+
+	for _, key := range []string{"1", "2"} {
+		if _, found := get(t, local, "user", key); found {
+			t.Errorf("Get(user, %s) found a key evicted by prefix", key)
+		}
+	}
+	if _, found := get(t, local, "users", "1"); !found {
+		t.Error("EvictByPrefix(user) evicted prefix users")
+	}
+	if _, found := get(t, local, "client", "user:1"); !found {
+		t.Error("EvictByPrefix(user) evicted a client key")
+	}
+
+	local.Set("user", "1", time.Minute, "carol")
+	if value, found := get(t, local, "user", "1"); !found || value != "carol" {
+		t.Errorf("Get() after EvictByPrefix = %q, %v, want carol", value, found)
+	}
+}
+
+func TestLocalCache_InstancesAreIsolated(t *testing.T) {
+	first := cache.NewLocalCacheService(testLogger(), 1, cache.DefaultEncoder())
+	second := cache.NewLocalCacheService(testLogger(), 1, cache.DefaultEncoder())
+	first.Set("user", "1", time.Minute, "alice")
+	second.Set("user", "1", time.Minute, "alice")
+
+	first.EvictByPrefix("user")
+
+	if _, found := get(t, first, "user", "1"); found {
+		t.Error("first instance kept a key evicted by prefix")
+	}
+	if _, found := get(t, second, "user", "1"); !found {
+		t.Error("EvictByPrefix on one instance evicted keys of another")
+	}
+
+	second.EvictByPrefix("user")
+	if _, found := get(t, second, "user", "1"); found {
+		t.Error("EvictByPrefix missed a key after another instance evicted the same prefix")
+	}
+}
+
+func TestLocalCache_ExpiredKeysStayEvictable(t *testing.T) {
+	local := cache.NewLocalCacheService(testLogger(), 1, cache.DefaultEncoder())
+	local.Set("user", "1", time.Second, "alice")
+	time.Sleep(1100 * time.Millisecond)
+
+	if _, found := get(t, local, "user", "1"); found {
+		t.Fatal("Get() found an expired key")
+	}
+	local.EvictByPrefix("user")
+	local.Set("user", "1", time.Minute, "bob")
+	if value, found := get(t, local, "user", "1"); !found || value != "bob" {
+		t.Errorf("Get() = %q, %v, want bob", value, found)
+	}
+}
+
+func heapInUse() uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapInuse
+}
+
+func TestLocalCache_MemoryIsBoundedUnderChurn(t *testing.T) {
+	if testing.Short() {
+		t.Skip("churns a million keys")
+	}
+	const sizeMB = 1
+	local := cache.NewLocalCacheService(testLogger(), sizeMB, cache.DefaultEncoder())
+
+	churn := func(round int) {
+		for i := range 250_000 {
+			local.Set(fmt.Sprintf("prefix%d", i%4), fmt.Sprintf("%d-%d", round, i), time.Minute, "value")
+		}
+		local.EvictByPrefix("prefix0")
+	}
+
+	// The first round fills the cache, later rounds must not grow the heap
+	churn(0)
+	before := heapInUse()
+	for round := 1; round < 4; round++ {
+		churn(round)
+	}
+	after := heapInUse()
+
+	// An index of the 750k keys written since would take tens of megabytes
+	if after > before && after-before > 4<<20 {
+		t.Errorf("heap grew by %d bytes churning keys through a %dMB cache", after-before, sizeMB)
+	}
+}
+
+func TestLocalCache_ManyPrefixesStayBounded(t *testing.T) {
+	local := cache.NewLocalCacheService(testLogger(), 1, cache.DefaultEncoder())
+	churn := func(offset int) {
+		for i := range 100_000 {
+			prefix := fmt.Sprintf("session:%d", offset+i)
+			local.Set(prefix, "token", time.Minute, "value")
+			local.EvictByPrefix(prefix)
+		}
+	}
+
+	churn(0)
+	before := heapInUse()
+	churn(100_000)
+	after := heapInUse()
+
+	if after > before && after-before > 4<<20 {
+		t.Errorf("heap grew by %d bytes evicting distinct prefixes", after-before)
+	}
+}
@@ -0,0 +1,237 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ouz/goboilerplate/pkg/cache"
+	redisCache "github.com/ouz/goboilerplate/pkg/cache/redis"
+	"github.com/redis/go-redis/v9"
+)
+
+func newRedisCache(t *testing.T) (cache.RedisCacheService, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return redisCache.NewRedisCacheService(client, cache.DefaultEncoder()), server
+}
+
+func TestRedisCache_MSetAndMGet(t *testing.T) {
+	c, server := newRedisCache(t)
+	ctx := context.Background()
+
+	err := c.MSet(ctx,
+		cache.Entry{Prefix: "user", Key: "1", TTL: time.Minute, Value: cachedUser{Name: "alice"}},
+		cache.Entry{Prefix: "user", Key: "2", TTL: time.Hour, Value: cachedUser{Name: "bob"}},
+	)
+	if err != nil {
+		t.Fatalf("MSet() error = %v", err)
+	}
+	if ttl := server.TTL("user:1"); ttl != time.Minute {
+		t.Errorf("TTL(user:1) = %v, want 1m", ttl)
+	}
+	if ttl := server.TTL("user:2"); ttl != time.Hour {
+		t.Errorf("TTL(user:2) = %v, want 1h", ttl)
+	}
+
+	results := []cachedUser{{}, {}, {}}
+	found, err := c.MGet(ctx, "user", []string{"1", "missing", "2"}, []any{&results[0], &results[1], &results[2]})
+	if err != nil {
+		t.Fatalf("MGet() error = %v", err)
+	}
+	if !found[0] || found[1] || !found[2] {
+		t.Errorf("MGet() found = %v, want [true false true]", found)
+	}
+	if results[0].Name != "alice" || results[2].Name != "bob" {
+		t.Errorf("MGet() results = %+v", results)
+	}
+}
+
+func TestRedisCache_MGetRejectsMismatchedResults(t *testing.T) {
+	c, _ := newRedisCache(t)
+	if _, err := c.MGet(context.Background(), "user", []string{"1", "2"}, []any{&cachedUser{}}); err == nil {
+		t.Error("MGet() error = nil, want an error for fewer results than keys")
+	}
+}
+
+func TestRedisCache_MSetWritesNothingOnEncodingError(t *testing.T) {
+	c, server := newRedisCache(t)
+
+	err := c.MSet(context.Background(),
+		cache.Entry{Prefix: "user", Key: "1", TTL: time.Minute, Value: "alice"},
+		cache.Entry{Prefix: "user", Key: "2", TTL: time.Minute, Value: make(chan int)},
+	)
+	if err == nil {
+		t.Fatal("MSet() error = nil, want an encoding error")
+	}
+	if server.Exists("user:1") {
+		t.Error("MSet() wrote part of the entries")
+	}
+}
+
+func TestRedisCache_SetNX(t *testing.T) {
+	c, _ := newRedisCache(t)
+	ctx := context.Background()
+
+	if set, err := c.SetNX(ctx, "lock", "job", time.Minute, "first"); err != nil || !set {
+		t.Fatalf("SetNX() = %v, %v, want true", set, err)
+	}
+	if set, err := c.SetNX(ctx, "lock", "job", time.Minute, "second"); err != nil || set {
+		t.Fatalf("SetNX() on an existing key = %v, %v, want false", set, err)
+	}
+
+	var value string
+	if _, err := c.Get(ctx, "lock", "job", &value); err != nil || value != "first" {
+		t.Errorf("Get() = %q, %v, want first", value, err)
+	}
+}
+
+func TestRedisCache_CompareAndSwap(t *testing.T) {
+	c, _ := newRedisCache(t)
+	ctx := context.Background()
+
+	if swapped, err := c.CompareAndSwap(ctx, "user", "1", time.Minute, nil, cachedUser{Name: "alice"}); err != nil || !swapped {
+		t.Fatalf("CompareAndSwap(nil) on a missing key = %v, %v, want true", swapped, err)
+	}
+	if swapped, _ := c.CompareAndSwap(ctx, "user", "1", time.Minute, nil, cachedUser{Name: "bob"}); swapped {
+		t.Error("CompareAndSwap(nil) replaced an existing key")
+	}
+	if swapped, _ := c.CompareAndSwap(ctx, "user", "1", time.Minute, cachedUser{Name: "carol"}, cachedUser{Name: "bob"}); swapped {
+		t.Error("CompareAndSwap() replaced a value that did not match")
+	}
+	if swapped, err := c.CompareAndSwap(ctx, "user", "1", time.Minute, cachedUser{Name: "alice"}, cachedUser{Name: "bob"}); err != nil || !swapped {
+		t.Fatalf("CompareAndSwap() = %v, %v, want true", swapped, err)
+	}
+
+	var got cachedUser
+	if _, err := c.Get(ctx, "user", "1", &got); err != nil || got.Name != "bob" {
+		t.Errorf("Get() = %+v, %v, want bob", got, err)
+	}
+}
+
+func TestRedisCache_CompareAndSwapConcurrent(t *testing.T) {
+	c, _ := newRedisCache(t)
+	ctx := context.Background()
+	if err := c.Set(ctx, "counter", "1", time.Minute, 0); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	var wins atomic.Int32
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			if swapped, err := c.CompareAndSwap(ctx, "counter", "1", time.Minute, 0, 1); err == nil && swapped {
+				wins.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+
+	if wins.Load() != 1 {
+		t.Errorf("%d swaps from the same value succeeded, want 1", wins.Load())
+	}
+}
+
+func TestRedisCache_IncrSetsTTLOnCreate(t *testing.T) {
+	c, server := newRedisCache(t)
+	ctx := context.Background()
+
+	for want := int64(1); want <= 3; want++ {
+		got, err := c.Incr(ctx, "attempts", "alice", time.Minute)
+		if err != nil || got != want {
+			t.Fatalf("Incr() = %d, %v, want %d", got, err, want)
+		}
+		server.FastForward(10 * time.Second)
+	}
+
+	// Later increments must not extend the window started by the first one
+	if ttl := server.TTL("attempts:alice"); ttl != 30*time.Second {
+		t.Errorf("TTL = %v, want 30s", ttl)
+	}
+}
+
+func TestRedisCache_Transaction(t *testing.T) {
+	c, server := newRedisCache(t)
+	ctx := context.Background()
+	if err := c.Set(ctx, "token", "old", time.Minute, 0); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	err := c.Transaction(ctx, func(batch cache.Batch) {
+		batch.Evict("token", "old")
+		batch.Set("token", "new", time.Minute, 0)
+		batch.SAdd("sessions", "alice", time.Hour, "new")
+		batch.Incr("logins", "alice", time.Hour)
+	})
+	if err != nil {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+
+	if server.Exists("token:old") || !server.Exists("token:new") {
+		t.Error("Transaction() did not replace the token")
+	}
+	if members, _ := c.SMembers(ctx, "sessions", "alice"); len(members) != 1 || members[0] != "new" {
+		t.Errorf("SMembers() = %v, want [new]", members)
+	}
+	if ttl := server.TTL("logins:alice"); ttl != time.Hour {
+		t.Errorf("TTL(logins:alice) = %v, want 1h", ttl)
+	}
+}
+
+func TestRedisCache_PipelineReportsErrors(t *testing.T) {
+	c, server := newRedisCache(t)
+	ctx := context.Background()
+	// A set operation on a string key fails inside the pipeline
+	server.Set("sessions:alice", "not a set")
+
+	err := c.Pipeline(ctx, func(batch cache.Batch) {
+		batch.Set("token", "1", time.Minute, 0)
+		batch.SAdd("sessions", "alice", 0, "1")
+	})
+	if err == nil {
+		t.Fatal("Pipeline() error = nil, want the failed command")
+	}
+	if !server.Exists("token:1") {
+		t.Error("Pipeline() did not apply the commands before the failure")
+	}
+}
+
+func TestTieredCache_BatchWritesInvalidateLocalCopies(t *testing.T) {
+	instances, _ := newInstances(t, 2)
+	ctx := context.Background()
+
+	for _, instance := range instances {
+		var got cachedUser
+		if err := instances[0].Set(ctx, "user", "1", time.Minute, cachedUser{Name: "alice"}); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+		_, _ = instance.Get(ctx, "user", "1", &got)
+	}
+
+	if err := instances[0].MSet(ctx, cache.Entry{Prefix: "user", Key: "1", TTL: time.Minute, Value: cachedUser{Name: "bob"}}); err != nil {
+		t.Fatalf("MSet() error = %v", err)
+	}
+	for i, instance := range instances {
+		var got cachedUser
+		if _, err := instance.Get(ctx, "user", "1", &got); err != nil || got.Name != "bob" {
+			t.Errorf("instance %d Get() after MSet = %+v, %v, want bob", i, got, err)
+		}
+	}
+
+	if err := instances[1].Transaction(ctx, func(batch cache.Batch) {
+		batch.Set("user", "1", time.Minute, cachedUser{Name: "carol"})
+	}); err != nil {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+	for i, instance := range instances {
+		var got cachedUser
+		if _, err := instance.Get(ctx, "user", "1", &got); err != nil || got.Name != "carol" {
+			t.Errorf("instance %d Get() after Transaction = %+v, %v, want carol", i, got, err)
+		}
+	}
+}
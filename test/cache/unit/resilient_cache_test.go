@@ -0,0 +1,220 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ouz/goboilerplate/pkg/cache"
+	redisCache "github.com/ouz/goboilerplate/pkg/cache/redis"
+	appErrors "github.com/ouz/goboilerplate/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+var resilienceOptions = cache.ResilienceOptions{
+	Timeout:          200 * time.Millisecond,
+	FailureThreshold: 3,
+	OpenDuration:     50 * time.Millisecond,
+	FailOpenPrefixes: []string{"user", "uat"},
+	IsFailure:        redisCache.IsConnectionError,
+}
+
+func newResilientCache(t *testing.T) (cache.ResilientCacheService, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+	return cache.NewResilientCacheService(testLogger(), redisCache.NewRedisCacheService(client, cache.DefaultEncoder()), resilienceOptions), server
+}
+
+// slowCache blocks every call until its context is done
+type slowCache struct {
+	cache.RedisCacheService
+}
+
+func (slowCache) Get(ctx context.Context, _, _ string, _ any) (bool, error) {
+	<-ctx.Done()
+	return false, ctx.Err()
+}
+
+func TestResilientCache_OpensAfterConsecutiveFailures(t *testing.T) {
+	c, server := newResilientCache(t)
+	ctx := context.Background()
+	server.Close()
+
+	for i := range resilienceOptions.FailureThreshold {
+		if c.State() != cache.CircuitClosed {
+			t.Fatalf("circuit %s after %d failures, want closed", c.State(), i)
+		}
+		if _, err := c.Exists(ctx, "session", "1"); !cache.IsUnavailable(err) {
+			t.Fatalf("Exists() error = %v, want unavailable", err)
+		}
+	}
+	if c.State() != cache.CircuitOpen {
+		t.Fatalf("circuit %s after %d failures, want open", c.State(), resilienceOptions.FailureThreshold)
+	}
+
+	_, err := c.Exists(ctx, "session", "1")
+	if !cache.IsUnavailable(err) || !appErrors.IsErrorCode(err, appErrors.ErrCodeServiceUnavailable) {
+		t.Errorf("Exists() on an open circuit error = %v, want a service unavailable error", err)
+	}
+}
+
+func TestResilientCache_FailOpenPrefixes(t *testing.T) {
+	c, server := newResilientCache(t)
+	ctx := context.Background()
+	server.Close()
+
+	var got cachedUser
+	if found, err := c.Get(ctx, "user", "1", &got); err != nil || found {
+		t.Errorf("Get() of a fail-open prefix = %v, %v, want a miss", found, err)
+	}
+	if err := c.Set(ctx, "user", "1", time.Minute, cachedUser{Name: "alice"}); err != nil {
+		t.Errorf("Set() of a fail-open prefix error = %v, want it skipped", err)
+	}
+	if found, err := c.MGet(ctx, "user", []string{"1", "2"}, []any{&got, &got}); err != nil || len(found) != 2 || found[0] {
+		t.Errorf("MGet() of a fail-open prefix = %v, %v, want misses", found, err)
+	}
+	if _, err := c.Exists(ctx, "uat:1:web", "token"); err != nil {
+		t.Errorf("Exists() below a fail-open prefix error = %v", err)
+	}
+
+	if _, err := c.Exists(ctx, "urt:1:web", "token"); !cache.IsUnavailable(err) {
+		t.Errorf("Exists() of a fail-closed prefix error = %v, want unavailable", err)
+	}
+	err := c.MSet(ctx,
+		cache.Entry{Prefix: "user", Key: "1", TTL: time.Minute, Value: 1},
+		cache.Entry{Prefix: "urt:1:web", Key: "token", TTL: time.Minute, Value: 0},
+	)
+	if !cache.IsUnavailable(err) {
+		t.Errorf("MSet() with a fail-closed entry error = %v, want unavailable", err)
+	}
+}
+
+func TestResilientCache_ReplaysFailedEvictions(t *testing.T) {
+	c, server := newResilientCache(t)
+	ctx := context.Background()
+	if err := c.Set(ctx, "user", "1", time.Minute, cachedUser{Name: "alice"}); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	server.Close()
+
+	if err := c.Evict(ctx, "user", "1"); !cache.IsUnavailable(err) {
+		t.Errorf("Evict() of a fail-open prefix error = %v, want unavailable", err)
+	}
+	if err := c.EvictByPrefix(ctx, "uat:1"); !cache.IsUnavailable(err) {
+		t.Errorf("EvictByPrefix() of a fail-open prefix error = %v, want unavailable", err)
+	}
+
+	if err := server.Restart(); err != nil {
+		t.Fatalf("Restart() error = %v", err)
+	}
+	time.Sleep(resilienceOptions.OpenDuration)
+	if err := c.Check(ctx); err != nil {
+		t.Fatalf("Check() after Valkey is back error = %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for server.Exists("user:1") {
+		if time.Now().After(deadline) {
+			t.Fatal("evicted key still cached after Valkey is back, want the eviction replayed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestResilientCache_RecoversAfterOpenDuration(t *testing.T) {
+	c, server := newResilientCache(t)
+	ctx := context.Background()
+	server.Close()
+
+	for range resilienceOptions.FailureThreshold {
+		_ = c.Check(ctx)
+	}
+	if c.State() != cache.CircuitOpen {
+		t.Fatalf("circuit %s, want open", c.State())
+	}
+
+	// A trial call while Valkey is still down opens the circuit again
+	time.Sleep(resilienceOptions.OpenDuration)
+	if err := c.Check(ctx); err == nil || c.State() != cache.CircuitOpen {
+		t.Fatalf("Check() = %v with circuit %s, want a failure and an open circuit", err, c.State())
+	}
+
+	if err := server.Restart(); err != nil {
+		t.Fatalf("Restart() error = %v", err)
+	}
+	if err := c.Check(ctx); err == nil {
+		t.Error("Check() before the open duration passed error = nil, want the call rejected")
+	}
+	time.Sleep(resilienceOptions.OpenDuration)
+	if err := c.Check(ctx); err != nil {
+		t.Fatalf("Check() after Valkey is back error = %v", err)
+	}
+	if c.State() != cache.CircuitClosed {
+		t.Errorf("circuit %s after a successful trial, want closed", c.State())
+	}
+}
+
+func TestResilientCache_ReplyErrorsKeepCircuitClosed(t *testing.T) {
+	c, server := newResilientCache(t)
+	ctx := context.Background()
+	server.Set("sessions:alice", "not a set")
+
+	for range resilienceOptions.FailureThreshold + 1 {
+		err := c.SAdd(ctx, "sessions", "alice", time.Minute, "1")
+		if err == nil || cache.IsUnavailable(err) {
+			t.Fatalf("SAdd() on a string key error = %v, want the reply error", err)
+		}
+	}
+	if c.State() != cache.CircuitClosed {
+		t.Errorf("circuit %s after reply errors, want closed", c.State())
+	}
+
+	// A node that is still loading its data cannot serve commands
+	server.SetError("LOADING Valkey is loading the dataset in memory")
+	for range resilienceOptions.FailureThreshold {
+		_ = c.Check(ctx)
+	}
+	if c.State() != cache.CircuitOpen {
+		t.Errorf("circuit %s while Valkey is loading, want open", c.State())
+	}
+}
+
+func TestResilientCache_TimeoutBoundsCalls(t *testing.T) {
+	c := cache.NewResilientCacheService(testLogger(), slowCache{}, cache.ResilienceOptions{
+		Timeout:          20 * time.Millisecond,
+		FailureThreshold: 1,
+		OpenDuration:     time.Minute,
+	})
+
+	start := time.Now()
+	if _, err := c.Get(context.Background(), "session", "1", new(string)); !errors.Is(err, context.DeadlineExceeded) || !cache.IsUnavailable(err) {
+		t.Errorf("Get() error = %v, want an unavailable deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Get() took %v, want it bounded by the timeout", elapsed)
+	}
+	if c.State() != cache.CircuitOpen {
+		t.Errorf("circuit %s after a timeout, want open", c.State())
+	}
+}
+
+func TestResilientCache_CallerCancellationIsNoFailure(t *testing.T) {
+	c := cache.NewResilientCacheService(testLogger(), slowCache{}, cache.ResilienceOptions{
+		Timeout:          time.Minute,
+		FailureThreshold: 1,
+		OpenDuration:     time.Minute,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.Get(ctx, "session", "1", new(string)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Get() error = %v, want the caller's deadline", err)
+	}
+	if c.State() != cache.CircuitClosed {
+		t.Errorf("circuit %s after the caller gave up, want closed", c.State())
+	}
+}
@@ -0,0 +1,291 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ouz/goboilerplate/pkg/cache"
+	"github.com/ouz/goboilerplate/pkg/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func testLogger() *log.Logger {
+	return log.NewLogger("test", slog.LevelError, slog.LevelError)
+}
+
+// remoteCache stands in for Valkey and counts reads
+type remoteCache struct {
+	cache.RedisCacheService
+	mu     sync.Mutex
+	values map[string][]byte
+	ttls   map[string]time.Duration
+	gets   int
+}
+
+func newRemoteCache() *remoteCache {
+	return &remoteCache{values: map[string][]byte{}, ttls: map[string]time.Duration{}}
+}
+
+func (r *remoteCache) Set(_ context.Context, prefix, key string, ttl time.Duration, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.values[prefix+":"+key] = data
+	r.ttls[prefix+":"+key] = ttl
+	return nil
+}
+
+func (r *remoteCache) Get(_ context.Context, prefix, key string, result any) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gets++
+	data, ok := r.values[prefix+":"+key]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(data, result)
+}
+
+func (r *remoteCache) Evict(_ context.Context, prefix, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.values, prefix+":"+key)
+	return nil
+}
+
+func (r *remoteCache) MSet(ctx context.Context, entries ...cache.Entry) error {
+	for _, entry := range entries {
+		if err := r.Set(ctx, entry.Prefix, entry.Key, entry.TTL, entry.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *remoteCache) Transaction(ctx context.Context, fn func(cache.Batch)) error {
+	fn(remoteBatch{ctx: ctx, remote: r})
+	return nil
+}
+
+// remoteBatch applies writes immediately, enough for callers that only check the outcome
+type remoteBatch struct {
+	cache.Batch
+	ctx    context.Context
+	remote *remoteCache
+}
+
+func (b remoteBatch) Set(prefix, key string, ttl time.Duration, value any) {
+	_ = b.remote.Set(b.ctx, prefix, key, ttl, value)
+}
+
+func (b remoteBatch) Evict(prefix, key string) {
+	_ = b.remote.Evict(b.ctx, prefix, key)
+}
+
+func (r *remoteCache) ttl(prefix, key string) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ttls[prefix+":"+key]
+}
+
+func (r *remoteCache) reads() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.gets
+}
+
+// memoryBus delivers invalidations synchronously to every subscriber
+type memoryBus struct {
+	mu          sync.Mutex
+	subscribers []func(cache.Invalidation)
+}
+
+func (b *memoryBus) Publish(_ context.Context, invalidation cache.Invalidation) error {
+	b.mu.Lock()
+	subscribers := append([]func(cache.Invalidation){}, b.subscribers...)
+	b.mu.Unlock()
+
+	for _, handler := range subscribers {
+		handler(invalidation)
+	}
+	return nil
+}
+
+func (b *memoryBus) Subscribe(ctx context.Context, handler func(cache.Invalidation)) error {
+	b.mu.Lock()
+	b.subscribers = append(b.subscribers, handler)
+	b.mu.Unlock()
+
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (b *memoryBus) waitForSubscribers(t *testing.T, count int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		b.mu.Lock()
+		n := len(b.subscribers)
+		b.mu.Unlock()
+		if n >= count {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d subscribers", count)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type instance struct {
+	cache.TieredCacheService
+}
+
+func newInstances(t *testing.T, count int) ([]instance, *remoteCache) {
+	t.Helper()
+	remote := newRemoteCache()
+	bus := &memoryBus{}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	instances := make([]instance, count)
+	for i := range instances {
+		local := cache.NewLocalCacheService(testLogger(), 10, cache.DefaultEncoder())
+		instances[i].TieredCacheService = cache.NewTieredCacheService(testLogger(), local, remote, bus, cache.TieredCacheOptions{
+			LocalTTL: time.Minute,
+			Prefixes: []string{"user"},
+		})
+		go func() { _ = instances[i].ListenInvalidations(ctx) }()
+	}
+	bus.waitForSubscribers(t, count)
+	return instances, remote
+}
+
+type cachedUser struct {
+	Name string `json:"name"`
+}
+
+func TestTieredCache_ServesFromLocalCache(t *testing.T) {
+	instances, remote := newInstances(t, 1)
+	ctx := context.Background()
+
+	if err := instances[0].Set(ctx, "user", "1", time.Minute, cachedUser{Name: "ada"}); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	for range 3 {
+		var u cachedUser
+		found, err := instances[0].Get(ctx, "user", "1", &u)
+		if err != nil || !found || u.Name != "ada" {
+			t.Fatalf("Get() = %v, %v, %+v", found, err, u)
+		}
+	}
+	if remote.reads() != 0 {
+		t.Errorf("Get() read Valkey %d times, want 0", remote.reads())
+	}
+}
+
+func TestTieredCache_PopulatesLocalCacheOnRemoteHit(t *testing.T) {
+	instances, remote := newInstances(t, 2)
+	ctx := context.Background()
+
+	_ = instances[0].Set(ctx, "user", "1", time.Minute, cachedUser{Name: "ada"})
+
+	var u cachedUser
+	for range 2 {
+		if found, _ := instances[1].Get(ctx, "user", "1", &u); !found {
+			t.Fatal("Get() on the second instance missed")
+		}
+	}
+	if remote.reads() != 1 {
+		t.Errorf("Get() read Valkey %d times, want 1", remote.reads())
+	}
+}
+
+func TestTieredCache_InvalidatesOtherInstances(t *testing.T) {
+	instances, _ := newInstances(t, 2)
+	ctx := context.Background()
+
+	_ = instances[0].Set(ctx, "user", "1", time.Minute, cachedUser{Name: "ada"})
+	var u cachedUser
+	_, _ = instances[1].Get(ctx, "user", "1", &u)
+
+	// An update on one instance must not leave the old value in the other's local cache
+	_ = instances[0].Set(ctx, "user", "1", time.Minute, cachedUser{Name: "grace"})
+	if found, _ := instances[1].Get(ctx, "user", "1", &u); !found || u.Name != "grace" {
+		t.Errorf("Get() after update = %+v, want grace", u)
+	}
+
+	if err := instances[1].Evict(ctx, "user", "1"); err != nil {
+		t.Fatalf("Evict() error = %v", err)
+	}
+	if found, _ := instances[0].Get(ctx, "user", "1", &u); found {
+		t.Error("Get() found a value evicted on another instance")
+	}
+}
+
+func TestTieredCache_OtherPrefixesSkipLocalCache(t *testing.T) {
+	instances, remote := newInstances(t, 1)
+	ctx := context.Background()
+
+	_ = instances[0].Set(ctx, "export:job", "1", time.Minute, cachedUser{Name: "ada"})
+	var u cachedUser
+	_, _ = instances[0].Get(ctx, "export:job", "1", &u)
+	_, _ = instances[0].Get(ctx, "export:job", "1", &u)
+
+	if remote.reads() != 2 {
+		t.Errorf("Get() read Valkey %d times, want 2", remote.reads())
+	}
+}
+
+func TestTieredCache_RecordsLookups(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	previous := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	t.Cleanup(func() { otel.SetMeterProvider(previous) })
+
+	instances, _ := newInstances(t, 2)
+	ctx := context.Background()
+	_ = instances[0].Set(ctx, "user", "1", time.Minute, cachedUser{Name: "ada"})
+
+	var u cachedUser
+	_, _ = instances[1].Get(ctx, "user", "1", &u) // local miss, redis hit
+	_, _ = instances[1].Get(ctx, "user", "1", &u) // local hit
+	_, _ = instances[1].Get(ctx, "user", "2", &u) // local miss, redis miss
+
+	var data metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &data); err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+
+	counts := map[string]int64{}
+	for _, scope := range data.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			if m.Name != "cache.lookups" {
+				continue
+			}
+			for _, point := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				tier, _ := point.Attributes.Value(attribute.Key("cache.tier"))
+				result, _ := point.Attributes.Value(attribute.Key("cache.result"))
+				counts[tier.AsString()+"/"+result.AsString()] += point.Value
+			}
+		}
+	}
+
+	want := map[string]int64{"local/hit": 1, "local/miss": 2, "redis/hit": 1, "redis/miss": 1}
+	for k, v := range want {
+		if counts[k] != v {
+			t.Errorf("lookups %s = %d, want %d (all: %v)", k, counts[k], v, counts)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ouz/goboilerplate/internal/domain/event"
+	"github.com/ouz/goboilerplate/pkg/stream"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func tracedContext(t *testing.T) (context.Context, trace.SpanContext) {
+	t.Helper()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	})
+	return trace.ContextWithSpanContext(context.Background(), spanContext), spanContext
+}
+
+func TestNewEnvelope(t *testing.T) {
+	ctx, spanContext := tracedContext(t)
+	registered := event.UserRegistered{UserID: "user-id", Email: "test@example.com"}
+
+	envelope, err := stream.NewEnvelope(ctx, registered.EventType(), registered.EventVersion(), registered)
+	if err != nil {
+		t.Fatalf("NewEnvelope() error = %v", err)
+	}
+
+	if envelope.ID == "" || envelope.OccurredAt.IsZero() {
+		t.Errorf("NewEnvelope() = %+v, want id and occurrence time", envelope)
+	}
+	if envelope.Type != event.TypeUserRegistered || envelope.Version != 1 {
+		t.Errorf("NewEnvelope() type = %s v%d, want %s v1", envelope.Type, envelope.Version, event.TypeUserRegistered)
+	}
+
+	var decoded event.UserRegistered
+	if err := envelope.Decode(&decoded); err != nil {
+		t.Fatalf("Envelope.Decode() error = %v", err)
+	}
+	if decoded != registered {
+		t.Errorf("Envelope.Decode() = %+v, want %+v", decoded, registered)
+	}
+
+	extracted := trace.SpanContextFromContext(envelope.Context(context.Background()))
+	if extracted.TraceID() != spanContext.TraceID() {
+		t.Errorf("Envelope.Context() trace id = %s, want %s", extracted.TraceID(), spanContext.TraceID())
+	}
+}
+
+func TestEnvelope_JSONRoundTrip(t *testing.T) {
+	envelope, err := stream.NewEnvelope(context.Background(), event.TypeSessionRevoked, 1, event.SessionRevoked{UserID: "user-id", Reason: event.RevocationReasonLogout})
+	if err != nil {
+		t.Fatalf("NewEnvelope() error = %v", err)
+	}
+
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	var decoded stream.Envelope
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if decoded.ID != envelope.ID || decoded.Type != envelope.Type || string(decoded.Data) != string(envelope.Data) {
+		t.Errorf("round trip = %+v, want %+v", decoded, envelope)
+	}
+}
+
+func TestNewRegistry_DropsEmailFromDeletedUsers(t *testing.T) {
+	envelope, err := stream.NewEnvelope(context.Background(), event.TypeUserDeleted, 1, map[string]any{"userId": "user-id", "email": "test@example.com", "byAdmin": true})
+	if err != nil {
+		t.Fatalf("NewEnvelope() error = %v", err)
+	}
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	decoded, err := event.NewRegistry().Decode(stream.Message{Data: data})
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if decoded.Version != 2 || strings.Contains(string(decoded.Data), "test@example.com") {
+		t.Errorf("Decode() = v%d %s, want v2 without the email", decoded.Version, decoded.Data)
+	}
+
+	var deleted event.UserDeleted
+	if err := decoded.Decode(&deleted); err != nil || deleted.UserID != "user-id" || !deleted.ByAdmin {
+		t.Errorf("Envelope.Decode() = %+v, %v, want the user id and byAdmin kept", deleted, err)
+	}
+}
+
+func TestNewRegistry_RegistersUserEvents(t *testing.T) {
+	registry := event.NewRegistry()
+	for _, e := range []event.Event{event.UserUpgraded{}, event.EmailChanged{}, event.UserConfirmed{}} {
+		if err := registry.Validate(e.EventType(), e.EventVersion()); err != nil {
+			t.Errorf("Validate(%s) error = %v", e.EventType(), err)
+		}
+	}
+}
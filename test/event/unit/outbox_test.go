@@ -0,0 +1,296 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	appEvent "github.com/ouz/goboilerplate/internal/application/event"
+	"github.com/ouz/goboilerplate/internal/config"
+	"github.com/ouz/goboilerplate/internal/domain/event"
+	"github.com/ouz/goboilerplate/pkg/log"
+	"github.com/ouz/goboilerplate/pkg/stream"
+)
+
+type memoryOutbox struct {
+	messages []event.OutboxMessage
+}
+
+func (m *memoryOutbox) Create(_ context.Context, message *event.OutboxMessage) error {
+	m.messages = append(m.messages, *message)
+	return nil
+}
+
+func (m *memoryOutbox) ClaimUnpublished(_ context.Context, now, leaseUntil time.Time, limit int) ([]event.OutboxMessage, error) {
+	var result []event.OutboxMessage
+	for i := range m.messages {
+		message := &m.messages[i]
+		if message.IsPublished() || message.ParkedAt != nil || len(result) >= limit {
+			continue
+		}
+		if message.ClaimedUntil != nil && message.ClaimedUntil.After(now) {
+			continue
+		}
+		message.ClaimedUntil = &leaseUntil
+		result = append(result, *message)
+	}
+	return result, nil
+}
+
+func (m *memoryOutbox) MarkPublished(_ context.Context, ids []string, at time.Time) error {
+	for _, id := range ids {
+		for i := range m.messages {
+			if m.messages[i].ID == id {
+				m.messages[i].PublishedAt = &at
+				m.messages[i].ClaimedUntil = nil
+			}
+		}
+	}
+	return nil
+}
+
+func (m *memoryOutbox) MarkFailed(_ context.Context, id string, reason string) error {
+	for i := range m.messages {
+		if m.messages[i].ID == id {
+			m.messages[i].Attempts++
+			m.messages[i].LastError = reason
+			m.messages[i].ClaimedUntil = nil
+		}
+	}
+	return nil
+}
+
+func (m *memoryOutbox) Park(_ context.Context, id string, reason string, at time.Time) error {
+	for i := range m.messages {
+		if m.messages[i].ID == id {
+			m.messages[i].Attempts++
+			m.messages[i].LastError = reason
+			m.messages[i].ParkedAt = &at
+			m.messages[i].ClaimedUntil = nil
+		}
+	}
+	return nil
+}
+
+func (m *memoryOutbox) Release(_ context.Context, ids []string) error {
+	for _, id := range ids {
+		for i := range m.messages {
+			if m.messages[i].ID == id {
+				m.messages[i].ClaimedUntil = nil
+			}
+		}
+	}
+	return nil
+}
+
+func (m *memoryOutbox) DeletePublishedBefore(_ context.Context, before time.Time, _ int) (int64, error) {
+	kept := m.messages[:0]
+	var deleted int64
+	for _, message := range m.messages {
+		if message.IsPublished() && message.PublishedAt.Before(before) {
+			deleted++
+			continue
+		}
+		kept = append(kept, message)
+	}
+	m.messages = kept
+	return deleted, nil
+}
+
+type recordingStream struct {
+	stream.StreamService
+	published []stream.Message
+	failAfter int
+}
+
+func (r *recordingStream) PublishMessage(_ context.Context, _ string, msg stream.Message) error {
+	if r.failAfter >= 0 && len(r.published) >= r.failAfter {
+		return fmt.Errorf("stream unavailable")
+	}
+	r.published = append(r.published, msg)
+	return nil
+}
+
+type immediateTx struct{}
+
+func (immediateTx) ExecuteInTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func newRelay(outbox *memoryOutbox, s *recordingStream) event.OutboxRelay {
+	return appEvent.NewOutboxRelay(log.NewLogger("test", slog.LevelError, slog.LevelError), outbox, s, immediateTx{}, config.OutboxConfig{
+		BatchSize:     2,
+		Retention:     time.Hour,
+		LeaseDuration: time.Minute,
+		MaxAttempts:   3,
+	})
+}
+
+func publishAll(t *testing.T, outbox *memoryOutbox, count int) {
+	t.Helper()
+	publisher := appEvent.NewOutboxPublisher(outbox, event.NewRegistry())
+	for i := 0; i < count; i++ {
+		if err := publisher.Publish(context.Background(), event.UserConfirmed{UserID: fmt.Sprintf("user-%d", i)}); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+}
+
+func TestOutboxPublisher_Publish(t *testing.T) {
+	outbox := &memoryOutbox{}
+	publishAll(t, outbox, 1)
+
+	if len(outbox.messages) != 1 {
+		t.Fatalf("Publish() stored %d messages, want 1", len(outbox.messages))
+	}
+
+	message := outbox.messages[0]
+	var envelope stream.Envelope
+	if err := json.Unmarshal(message.Payload, &envelope); err != nil {
+		t.Fatalf("payload is not an envelope: %v", err)
+	}
+	if message.ID != envelope.ID || message.Stream != event.UserEventsStream || message.EventType != event.TypeUserConfirmed {
+		t.Errorf("Publish() message = %+v, want id %s on %s", message, envelope.ID, event.UserEventsStream)
+	}
+}
+
+type unregisteredEvent struct{}
+
+func (unregisteredEvent) EventType() string { return "user.unknown" }
+func (unregisteredEvent) EventVersion() int { return 1 }
+
+func TestOutboxPublisher_RejectsUnknownEvent(t *testing.T) {
+	outbox := &memoryOutbox{}
+	publisher := appEvent.NewOutboxPublisher(outbox, event.NewRegistry())
+
+	if err := publisher.Publish(context.Background(), unregisteredEvent{}); err == nil {
+		t.Error("Publish() accepted an unregistered event type")
+	}
+	if len(outbox.messages) != 0 {
+		t.Errorf("Publish() stored %d messages, want 0", len(outbox.messages))
+	}
+}
+
+func TestOutboxRelay_Relay(t *testing.T) {
+	outbox := &memoryOutbox{}
+	publishAll(t, outbox, 5)
+	streamService := &recordingStream{failAfter: -1}
+
+	relayed, err := newRelay(outbox, streamService).Relay(context.Background())
+	if err != nil {
+		t.Fatalf("Relay() error = %v", err)
+	}
+	if relayed != 5 || len(streamService.published) != 5 {
+		t.Fatalf("Relay() relayed = %d published = %d, want 5", relayed, len(streamService.published))
+	}
+
+	for i, msg := range streamService.published {
+		if string(msg.Data) != string(outbox.messages[i].Payload) {
+			t.Errorf("Relay() message %d published out of order", i)
+		}
+		if msg.Type != event.TypeUserConfirmed || msg.Version != 1 || msg.ContentType != stream.ContentTypeJSON {
+			t.Errorf("Relay() message %d fields = %s v%d %s", i, msg.Type, msg.Version, msg.ContentType)
+		}
+		if !outbox.messages[i].IsPublished() {
+			t.Errorf("Relay() message %d not marked as published", i)
+		}
+	}
+
+	relayed, err = newRelay(outbox, streamService).Relay(context.Background())
+	if err != nil || relayed != 0 {
+		t.Errorf("Relay() on drained outbox = %d, %v, want 0", relayed, err)
+	}
+}
+
+func TestOutboxRelay_StopsOnFailure(t *testing.T) {
+	outbox := &memoryOutbox{}
+	publishAll(t, outbox, 3)
+	streamService := &recordingStream{failAfter: 1}
+
+	relayed, err := newRelay(outbox, streamService).Relay(context.Background())
+	if err != nil {
+		t.Fatalf("Relay() error = %v", err)
+	}
+	if relayed != 1 {
+		t.Fatalf("Relay() relayed = %d, want 1", relayed)
+	}
+
+	if outbox.messages[1].IsPublished() || outbox.messages[1].Attempts != 1 || outbox.messages[1].LastError == "" {
+		t.Errorf("Relay() failed message = %+v, want unpublished with one attempt", outbox.messages[1])
+	}
+	if outbox.messages[2].IsPublished() || outbox.messages[2].Attempts != 0 {
+		t.Errorf("Relay() must not publish past a failed message, got %+v", outbox.messages[2])
+	}
+
+	streamService.failAfter = -1
+	relayed, err = newRelay(outbox, streamService).Relay(context.Background())
+	if err != nil || relayed != 2 {
+		t.Errorf("Relay() retry = %d, %v, want 2", relayed, err)
+	}
+}
+
+// failingStream rejects the messages of one user and publishes every other
+type failingStream struct {
+	stream.StreamService
+	published []stream.Message
+	poisoned  string
+}
+
+func (f *failingStream) PublishMessage(_ context.Context, _ string, msg stream.Message) error {
+	if strings.Contains(string(msg.Data), f.poisoned) {
+		return fmt.Errorf("message rejected")
+	}
+	f.published = append(f.published, msg)
+	return nil
+}
+
+func TestOutboxRelay_ParksMessageAfterMaxAttempts(t *testing.T) {
+	outbox := &memoryOutbox{}
+	publishAll(t, outbox, 3)
+	streamService := &failingStream{poisoned: "user-0"}
+	relay := appEvent.NewOutboxRelay(log.NewLogger("test", slog.LevelError, slog.LevelError), outbox, streamService, immediateTx{}, config.OutboxConfig{
+		BatchSize:     2,
+		LeaseDuration: time.Minute,
+		MaxAttempts:   3,
+	})
+
+	for range 2 {
+		if relayed, err := relay.Relay(context.Background()); err != nil || relayed != 0 {
+			t.Fatalf("Relay() before parking = %d, %v, want 0", relayed, err)
+		}
+	}
+	if outbox.messages[0].ParkedAt != nil || outbox.messages[1].ClaimedUntil != nil {
+		t.Fatalf("Relay() before parking left %+v and %+v, want the first unparked and the second released", outbox.messages[0], outbox.messages[1])
+	}
+
+	relayed, err := relay.Relay(context.Background())
+	if err != nil || relayed != 2 {
+		t.Fatalf("Relay() at max attempts = %d, %v, want the 2 later messages", relayed, err)
+	}
+	if parked := outbox.messages[0]; parked.ParkedAt == nil || parked.Attempts != 3 || parked.IsPublished() {
+		t.Errorf("Relay() poisoned message = %+v, want parked after 3 attempts", parked)
+	}
+
+	if relayed, err := relay.Relay(context.Background()); err != nil || relayed != 0 || len(streamService.published) != 2 {
+		t.Errorf("Relay() after parking = %d, %v, want the parked message skipped", relayed, err)
+	}
+}
+
+func TestOutboxRelay_PurgePublished(t *testing.T) {
+	outbox := &memoryOutbox{}
+	publishAll(t, outbox, 2)
+	old := time.Now().Add(-2 * time.Hour)
+	outbox.messages[0].PublishedAt = &old
+
+	purged, err := newRelay(outbox, &recordingStream{failAfter: -1}).PurgePublished(context.Background())
+	if err != nil {
+		t.Fatalf("PurgePublished() error = %v", err)
+	}
+	if purged != 1 || len(outbox.messages) != 1 {
+		t.Errorf("PurgePublished() = %d, remaining %d, want 1 and 1", purged, len(outbox.messages))
+	}
+}
@@ -0,0 +1,314 @@
+package lock
+
+import (
+	"context"
+	errs "errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ouz/goboilerplate/pkg/lock"
+	redisLock "github.com/ouz/goboilerplate/pkg/lock/redis"
+	"github.com/ouz/goboilerplate/pkg/log"
+	"github.com/redis/go-redis/v9"
+)
+
+func testLogger() *log.Logger {
+	return log.NewLogger("test", slog.LevelError, slog.LevelError)
+}
+
+var options = lock.Options{RetryInterval: 5 * time.Millisecond}
+
+// stores runs test against every Store implementation. advance lets time pass for
+// TTLs, miniredis only expires keys when fast-forwarded
+func stores(t *testing.T, test func(t *testing.T, store lock.Store, advance func(time.Duration))) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, lock.NewMemoryStore(), time.Sleep)
+	})
+	t.Run("redis", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		t.Cleanup(func() { _ = client.Close() })
+		test(t, redisLock.NewRedisStore(client), server.FastForward)
+	})
+}
+
+// takenOverStore behaves as if another owner took every lock once it was acquired
+type takenOverStore struct {
+	lock.Store
+}
+
+func (takenOverStore) Extend(context.Context, string, string, time.Duration) (bool, error) {
+	return false, nil
+}
+
+func (takenOverStore) Release(context.Context, string, string) (bool, error) {
+	return false, nil
+}
+
+// unreachableStore fails every renewal, as during a Valkey outage
+type unreachableStore struct {
+	lock.Store
+}
+
+func (unreachableStore) Extend(context.Context, string, string, time.Duration) (bool, error) {
+	return false, errs.New("connection refused")
+}
+
+func TestLock_ExcludesOtherOwners(t *testing.T) {
+	stores(t, func(t *testing.T, store lock.Store, advance func(time.Duration)) {
+		locker := lock.NewLocker(testLogger(), store, options)
+		ctx := context.Background()
+
+		held, err := locker.TryAcquire(ctx, "sweeper", time.Second)
+		if err != nil {
+			t.Fatalf("TryAcquire() error = %v", err)
+		}
+		if _, err := locker.TryAcquire(ctx, "sweeper", time.Second); !lock.IsNotAcquired(err) {
+			t.Fatalf("second TryAcquire() error = %v, want not acquired", err)
+		}
+		if other, err := locker.TryAcquire(ctx, "migration", time.Second); err != nil {
+			t.Errorf("TryAcquire() of another name error = %v", err)
+		} else {
+			_ = other.Release(ctx)
+		}
+
+		if err := held.Release(ctx); err != nil {
+			t.Fatalf("Release() error = %v", err)
+		}
+		again, err := locker.TryAcquire(ctx, "sweeper", time.Second)
+		if err != nil {
+			t.Fatalf("TryAcquire() after Release error = %v", err)
+		}
+		_ = again.Release(ctx)
+	})
+}
+
+func TestLock_FencingTokensIncrease(t *testing.T) {
+	stores(t, func(t *testing.T, store lock.Store, advance func(time.Duration)) {
+		locker := lock.NewLocker(testLogger(), store, options)
+		ctx := context.Background()
+
+		var last int64
+		for range 3 {
+			held, err := locker.TryAcquire(ctx, "sweeper", time.Second)
+			if err != nil {
+				t.Fatalf("TryAcquire() error = %v", err)
+			}
+			if held.Token() <= last {
+				t.Errorf("Token() = %d, want more than %d", held.Token(), last)
+			}
+			last = held.Token()
+			_ = held.Release(ctx)
+		}
+	})
+}
+
+func TestLock_StaleOwnerCannotReleaseSuccessor(t *testing.T) {
+	stores(t, func(t *testing.T, store lock.Store, advance func(time.Duration)) {
+		ctx := context.Background()
+		if _, acquired, _ := store.Acquire(ctx, "sweeper", "first", 20*time.Millisecond); !acquired {
+			t.Fatal("Acquire() = false, want true")
+		}
+		advance(30 * time.Millisecond)
+
+		if _, acquired, _ := store.Acquire(ctx, "sweeper", "second", time.Minute); !acquired {
+			t.Fatal("Acquire() after expiry = false, want true")
+		}
+		if released, _ := store.Release(ctx, "sweeper", "first"); released {
+			t.Error("expired owner released its successor's lock")
+		}
+		if extended, _ := store.Extend(ctx, "sweeper", "first", time.Minute); extended {
+			t.Error("expired owner extended its successor's lock")
+		}
+		if _, acquired, _ := store.Acquire(ctx, "sweeper", "third", time.Minute); acquired {
+			t.Error("Acquire() took a held lock")
+		}
+	})
+}
+
+func TestLock_RenewsWhileHeld(t *testing.T) {
+	stores(t, func(t *testing.T, store lock.Store, advance func(time.Duration)) {
+		locker := lock.NewLocker(testLogger(), store, options)
+		ctx := context.Background()
+
+		held, err := locker.TryAcquire(ctx, "sweeper", 150*time.Millisecond)
+		if err != nil {
+			t.Fatalf("TryAcquire() error = %v", err)
+		}
+		time.Sleep(400 * time.Millisecond)
+
+		if _, err := locker.TryAcquire(ctx, "sweeper", time.Second); !lock.IsNotAcquired(err) {
+			t.Errorf("TryAcquire() past the TTL error = %v, want not acquired", err)
+		}
+		if held.Context().Err() != nil {
+			t.Errorf("lock context error = %v, want a live context", held.Context().Err())
+		}
+		if err := held.Release(ctx); err != nil {
+			t.Errorf("Release() error = %v", err)
+		}
+		if held.Context().Err() == nil {
+			t.Error("lock context is still live after Release")
+		}
+	})
+}
+
+func TestLock_LostLockCancelsContext(t *testing.T) {
+	tests := []struct {
+		name  string
+		store lock.Store
+	}{
+		{name: "TakenOver", store: takenOverStore{Store: lock.NewMemoryStore()}},
+		{name: "RenewalFailsPastTTL", store: unreachableStore{Store: lock.NewMemoryStore()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			locker := lock.NewLocker(testLogger(), tt.store, options)
+			held, err := locker.TryAcquire(context.Background(), "sweeper", 60*time.Millisecond)
+			if err != nil {
+				t.Fatalf("TryAcquire() error = %v", err)
+			}
+
+			select {
+			case <-held.Context().Done():
+			case <-time.After(time.Second):
+				t.Fatal("lock context was not cancelled after the lock was lost")
+			}
+			if cause := context.Cause(held.Context()); !errs.Is(cause, lock.ErrLockLost) {
+				t.Errorf("context cause = %v, want ErrLockLost", cause)
+			}
+			if err := held.Release(context.Background()); !errs.Is(err, lock.ErrLockLost) {
+				t.Errorf("Release() error = %v, want ErrLockLost", err)
+			}
+		})
+	}
+}
+
+func TestLock_SurvivesBriefRenewalFailures(t *testing.T) {
+	locker := lock.NewLocker(testLogger(), unreachableStore{Store: lock.NewMemoryStore()}, options)
+	held, err := locker.TryAcquire(context.Background(), "sweeper", 300*time.Millisecond)
+	if err != nil {
+		t.Fatalf("TryAcquire() error = %v", err)
+	}
+	defer held.Release(context.Background())
+
+	// The first renewal fails after 100ms, the lock is only lost once the TTL passed
+	time.Sleep(150 * time.Millisecond)
+	if err := held.Context().Err(); err != nil {
+		t.Errorf("lock context error = %v after one failed renewal, want a live context", err)
+	}
+}
+
+func TestLock_ParentContextCancelsLock(t *testing.T) {
+	locker := lock.NewMemoryLocker(testLogger(), options)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	held, err := locker.TryAcquire(ctx, "sweeper", time.Second)
+	if err != nil {
+		t.Fatalf("TryAcquire() error = %v", err)
+	}
+	cancel()
+
+	if held.Context().Err() == nil {
+		t.Error("lock context is live after its parent was cancelled")
+	}
+	if err := held.Release(context.Background()); err != nil {
+		t.Errorf("Release() error = %v", err)
+	}
+	again, err := locker.TryAcquire(context.Background(), "sweeper", time.Second)
+	if err != nil {
+		t.Fatalf("TryAcquire() after Release error = %v", err)
+	}
+	_ = again.Release(context.Background())
+}
+
+func TestLock_AcquireWaitsForRelease(t *testing.T) {
+	stores(t, func(t *testing.T, store lock.Store, advance func(time.Duration)) {
+		locker := lock.NewLocker(testLogger(), store, options)
+		ctx := context.Background()
+
+		held, err := locker.TryAcquire(ctx, "sweeper", time.Second)
+		if err != nil {
+			t.Fatalf("TryAcquire() error = %v", err)
+		}
+		time.AfterFunc(50*time.Millisecond, func() { _ = held.Release(ctx) })
+
+		waited, err := locker.Acquire(ctx, "sweeper", time.Second)
+		if err != nil {
+			t.Fatalf("Acquire() error = %v", err)
+		}
+		if waited.Token() <= held.Token() {
+			t.Errorf("Token() = %d, want more than %d", waited.Token(), held.Token())
+		}
+		_ = waited.Release(ctx)
+	})
+}
+
+func TestLock_AcquireStopsWithContext(t *testing.T) {
+	stores(t, func(t *testing.T, store lock.Store, advance func(time.Duration)) {
+		locker := lock.NewLocker(testLogger(), store, options)
+		held, err := locker.TryAcquire(context.Background(), "sweeper", time.Second)
+		if err != nil {
+			t.Fatalf("TryAcquire() error = %v", err)
+		}
+		defer held.Release(context.Background())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+		defer cancel()
+		if _, err := locker.Acquire(ctx, "sweeper", time.Second); !errs.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Acquire() error = %v, want deadline exceeded", err)
+		}
+	})
+}
+
+func TestWithLock_RunsOneHolderAtATime(t *testing.T) {
+	stores(t, func(t *testing.T, store lock.Store, advance func(time.Duration)) {
+		locker := lock.NewLocker(testLogger(), store, options)
+		var running, maxRunning, ran, skipped atomic.Int32
+
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Go(func() {
+				err := lock.WithLock(context.Background(), locker, "sweeper", time.Second, func(context.Context) error {
+					if n := running.Add(1); n > maxRunning.Load() {
+						maxRunning.Store(n)
+					}
+					time.Sleep(20 * time.Millisecond)
+					running.Add(-1)
+					ran.Add(1)
+					return nil
+				})
+				if lock.IsNotAcquired(err) {
+					skipped.Add(1)
+				} else if err != nil {
+					t.Errorf("WithLock() error = %v", err)
+				}
+			})
+		}
+		wg.Wait()
+
+		if maxRunning.Load() != 1 {
+			t.Errorf("%d holders ran at once, want 1", maxRunning.Load())
+		}
+		if ran.Load()+skipped.Load() != 10 || ran.Load() == 0 {
+			t.Errorf("ran %d and skipped %d of 10", ran.Load(), skipped.Load())
+		}
+	})
+}
+
+func TestWithLock_ReturnsFunctionError(t *testing.T) {
+	locker := lock.NewMemoryLocker(testLogger(), options)
+	want := errs.New("sweep failed")
+
+	if err := lock.WithLock(context.Background(), locker, "sweeper", time.Second, func(context.Context) error { return want }); !errs.Is(err, want) {
+		t.Errorf("WithLock() error = %v, want %v", err, want)
+	}
+	// The lock was released despite the error
+	if err := lock.WithLock(context.Background(), locker, "sweeper", time.Second, func(context.Context) error { return nil }); err != nil {
+		t.Errorf("WithLock() after a failed run error = %v", err)
+	}
+}
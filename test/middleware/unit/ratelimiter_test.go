@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ouz/goboilerplate/internal/adapters/api/middleware"
+	"github.com/ouz/goboilerplate/pkg/log"
+	"github.com/redis/go-redis/v9"
+)
+
+func testLogger() *log.Logger {
+	return log.NewLogger("test", slog.LevelError, slog.LevelError)
+}
+
+func newRedisRateLimiter(t *testing.T, server *miniredis.Miniredis, fallback middleware.RateLimiter) *middleware.RedisRateLimiter {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+	return middleware.NewRedisRateLimiter(testLogger(), client, middleware.RedisRateLimiterOptions{
+		Rate:       1,
+		BucketSize: 3,
+		Timeout:    100 * time.Millisecond,
+		Fallback:   fallback,
+	})
+}
+
+func allowed(limiter middleware.RateLimiter, key string, requests int) int {
+	count := 0
+	for range requests {
+		if limiter.Allow(key) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestTokenBucket_LimitsBursts(t *testing.T) {
+	limiter := middleware.NewTokenBucket(1, 3)
+	defer limiter.Stop()
+
+	if got := allowed(limiter, "10.0.0.1", 5); got != 3 {
+		t.Errorf("allowed %d of 5 requests, want the burst of 3", got)
+	}
+	if !limiter.Allow("10.0.0.2") {
+		t.Error("Allow() of another key = false, want buckets per key")
+	}
+}
+
+func TestRedisRateLimiter_SharesBucketsBetweenInstances(t *testing.T) {
+	server := miniredis.RunT(t)
+	now := time.Now()
+	server.SetTime(now)
+	first := newRedisRateLimiter(t, server, nil)
+	second := newRedisRateLimiter(t, server, nil)
+
+	if got := allowed(first, "10.0.0.1", 2) + allowed(second, "10.0.0.1", 2); got != 3 {
+		t.Errorf("allowed %d of 4 requests across instances, want the burst of 3", got)
+	}
+	if !second.Allow("10.0.0.2") {
+		t.Error("Allow() of another key = false, want buckets per key")
+	}
+
+	// One token is back after a second at a rate of 1 per second
+	server.SetTime(now.Add(time.Second))
+	if got := allowed(first, "10.0.0.1", 2); got != 1 {
+		t.Errorf("allowed %d requests after a second, want 1", got)
+	}
+
+	if ttl := server.TTL("ratelimit:10.0.0.1"); ttl <= 0 || ttl > 3*time.Second {
+		t.Errorf("bucket TTL = %v, want it to expire once the bucket is full again", ttl)
+	}
+}
+
+func TestRedisRateLimiter_FallsBackWhileValkeyIsDown(t *testing.T) {
+	server := miniredis.RunT(t)
+	fallback := middleware.NewTokenBucket(0.001, 2)
+	defer fallback.Stop()
+	limiter := newRedisRateLimiter(t, server, fallback)
+	withoutFallback := newRedisRateLimiter(t, server, nil)
+	server.Close()
+
+	if got := allowed(limiter, "10.0.0.1", 4); got != 2 {
+		t.Errorf("allowed %d of 4 requests with Valkey down, want the fallback burst of 2", got)
+	}
+
+	if got := allowed(withoutFallback, "10.0.0.1", 4); got != 4 {
+		t.Errorf("allowed %d of 4 requests with Valkey down and no fallback, want all", got)
+	}
+}
+
+func TestRateLimitMiddleware_RejectsWithTooManyRequests(t *testing.T) {
+	limiter := middleware.NewTokenBucket(1, 1)
+	defer limiter.Stop()
+	handler := middleware.RateLimitMiddleware(limiter, nil)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	codes := make([]int, 2)
+	for i := range codes {
+		request := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/", nil)
+		request.RemoteAddr = "10.0.0.1:1234"
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		codes[i] = recorder.Code
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("status codes = %v, want 200 then 429", codes)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		realIP     string
+		want       string
+	}{
+		{name: "direct client", remoteAddr: "203.0.113.7:1234", want: "203.0.113.7"},
+		{name: "spoofed forwarded for from untrusted peer", remoteAddr: "203.0.113.7:1234", forwarded: "198.51.100.1", want: "203.0.113.7"},
+		{name: "spoofed real ip from untrusted peer", remoteAddr: "203.0.113.7:1234", realIP: "198.51.100.1", want: "203.0.113.7"},
+		{name: "forwarded for from trusted proxy", remoteAddr: "10.0.0.2:1234", forwarded: "198.51.100.1", want: "198.51.100.1"},
+		{name: "client prepended hops are ignored", remoteAddr: "10.0.0.2:1234", forwarded: "192.0.2.9, 198.51.100.1, 10.0.0.3", want: "198.51.100.1"},
+		{name: "malformed hop", remoteAddr: "10.0.0.2:1234", forwarded: "198.51.100.1, unknown", want: "10.0.0.2"},
+		{name: "real ip from trusted proxy", remoteAddr: "10.0.0.2:1234", realIP: "198.51.100.1", want: "198.51.100.1"},
+		{name: "trusted proxy without headers", remoteAddr: "10.0.0.2:1234", want: "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/", nil)
+			request.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				request.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if tt.realIP != "" {
+				request.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			ip, err := middleware.ClientIP(request, trusted)
+			if err != nil || ip.String() != tt.want {
+				t.Errorf("ClientIP() = %v, %v, want %s", ip, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddleware_SeparatesClientsBehindTrustedProxy(t *testing.T) {
+	limiter := middleware.NewTokenBucket(1, 1)
+	defer limiter.Stop()
+	handler := middleware.RateLimitMiddleware(limiter, []netip.Prefix{netip.MustParsePrefix("10.0.0.1/32")})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, client := range []string{"198.51.100.1", "198.51.100.2"} {
+		request := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/", nil)
+		request.RemoteAddr = "10.0.0.1:1234"
+		request.Header.Set("X-Forwarded-For", client)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusOK {
+			t.Errorf("status for %s = %d, want 200 from its own bucket", client, recorder.Code)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/ouz/goboilerplate/internal/adapters/api/middleware"
+	"github.com/ouz/goboilerplate/internal/adapters/api/util"
+)
+
+func TestRequestInfo_ResolvesClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.1/32")}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		want       string
+	}{
+		{name: "spoofed headers from untrusted peer are ignored", remoteAddr: "203.0.113.7:1234", want: "203.0.113.7"},
+		{name: "headers from trusted proxy are used", remoteAddr: "10.0.0.1:1234", want: "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var info util.RequestInfo
+			handler := middleware.RequestInfo(trusted)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				info = util.GetRequestInfo(r.Context())
+			}))
+
+			request := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/", nil)
+			request.RemoteAddr = tt.remoteAddr
+			request.Header.Set("X-Forwarded-For", "198.51.100.1")
+			request.Header.Set("X-Real-IP", "198.51.100.2")
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+
+			if info.IP != tt.want {
+				t.Errorf("RequestInfo().IP = %q, want %q", info.IP, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package policy
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/ouz/goboilerplate/pkg/policy"
+)
+
+func TestAuthorize(t *testing.T) {
+	policies, err := policy.LoadFile("../../../config/policies.yaml")
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	authorizer := policy.NewAuthorizer(nil, policies...)
+
+	admin := policy.Subject{ID: "admin-id", Roles: []string{"ADMIN"}}
+	regular := policy.Subject{ID: "user-id", Roles: []string{"USER"}}
+
+	tests := []struct {
+		name     string
+		request  policy.Request
+		want     bool
+		wantRule string
+	}{
+		{
+			name:     "Admin can disable another user",
+			request:  policy.Request{Subject: admin, Action: "disable", Resource: policy.Resource{Type: "user", OwnerID: "user-id"}},
+			want:     true,
+			wantRule: "admin-manage-users",
+		},
+		{
+			name:     "Admin cannot disable themselves",
+			request:  policy.Request{Subject: admin, Action: "disable", Resource: policy.Resource{Type: "user", OwnerID: "admin-id"}},
+			want:     false,
+			wantRule: "admin-no-self-lockout",
+		},
+		{
+			name:     "Owner can read own user",
+			request:  policy.Request{Subject: regular, Action: "read", Resource: policy.Resource{Type: "user", OwnerID: "user-id"}},
+			want:     true,
+			wantRule: "owner-read-user",
+		},
+		{
+			name:     "Owner can update own user",
+			request:  policy.Request{Subject: regular, Action: "update", Resource: policy.Resource{Type: "user", OwnerID: "user-id"}},
+			want:     true,
+			wantRule: "owner-read-user",
+		},
+		{
+			name:    "User cannot update other users",
+			request: policy.Request{Subject: regular, Action: "update", Resource: policy.Resource{Type: "user", OwnerID: "other-id"}},
+			want:    false,
+		},
+		{
+			name:    "User cannot read other users",
+			request: policy.Request{Subject: regular, Action: "read", Resource: policy.Resource{Type: "user", OwnerID: "other-id"}},
+			want:    false,
+		},
+		{
+			name:    "Unknown resource is denied",
+			request: policy.Request{Subject: admin, Action: "read", Resource: policy.Resource{Type: "invoice"}},
+			want:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := authorizer.Authorize(context.Background(), tt.request)
+			if got.Allowed != tt.want {
+				t.Errorf("Authorize().Allowed = %v, want %v", got.Allowed, tt.want)
+			}
+			if got.Policy != tt.wantRule {
+				t.Errorf("Authorize().Policy = %v, want %v", got.Policy, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestPolicyFunc(t *testing.T) {
+	authorizer := policy.NewAuthorizer(nil, policy.NewPolicyFunc("published-only", func(_ context.Context, r policy.Request) policy.Effect {
+		if r.Resource.Attributes["published"] == true {
+			return policy.ALLOW
+		}
+		return policy.NOT_APPLICABLE
+	}))
+
+	published := policy.Request{Action: "read", Resource: policy.Resource{Type: "post", Attributes: map[string]any{"published": true}}}
+	if !authorizer.Authorize(context.Background(), published).Allowed {
+		t.Error("Authorize() should allow published resource")
+	}
+
+	draft := policy.Request{Action: "read", Resource: policy.Resource{Type: "post", Attributes: map[string]any{"published": false}}}
+	if authorizer.Authorize(context.Background(), draft).Allowed {
+		t.Error("Authorize() should deny draft resource")
+	}
+}
+
+func TestRegisterWhileAuthorizing(t *testing.T) {
+	authorizer := policy.NewAuthorizer(nil)
+	allow := policy.NewPolicyFunc("allow-all", func(context.Context, policy.Request) policy.Effect {
+		return policy.ALLOW
+	})
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		for range 100 {
+			authorizer.Register(allow)
+		}
+	})
+	for range 100 {
+		authorizer.Authorize(context.Background(), policy.Request{Action: "read"})
+	}
+	wg.Wait()
+
+	if !authorizer.Authorize(context.Background(), policy.Request{Action: "read"}).Allowed {
+		t.Error("Authorize() should allow once the policy is registered")
+	}
+}
+
+func TestNewRulePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    policy.Rule
+		wantErr bool
+	}{
+		{
+			name:    "Valid rule",
+			rule:    policy.Rule{Name: "r", Effect: policy.ALLOW, Resource: "user", Actions: []string{"read"}},
+			wantErr: false,
+		},
+		{
+			name:    "Unsupported effect",
+			rule:    policy.Rule{Name: "r", Effect: "maybe", Resource: "user", Actions: []string{"read"}},
+			wantErr: true,
+		},
+		{
+			name:    "Missing actions",
+			rule:    policy.Rule{Name: "r", Effect: policy.DENY, Resource: "user"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := policy.NewRulePolicy(tt.rule)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewRulePolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
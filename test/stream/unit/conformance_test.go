@@ -0,0 +1,51 @@
+package stream
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ouz/goboilerplate/pkg/log"
+	"github.com/ouz/goboilerplate/pkg/stream"
+	redisStream "github.com/ouz/goboilerplate/pkg/stream/redis"
+	"github.com/ouz/goboilerplate/pkg/stream/streamtest"
+	"github.com/redis/go-redis/v9"
+)
+
+func testLogger() *log.Logger {
+	return log.NewLogger("test", slog.LevelError, slog.LevelError)
+}
+
+func TestMemoryStreamService_Conformance(t *testing.T) {
+	streamtest.Run(t, func(t *testing.T, options stream.ConsumerOptions) stream.StreamService {
+		return stream.NewMemoryStreamService(testLogger(), options)
+	})
+}
+
+// TestRedisStreamService_Conformance runs against miniredis, or against the
+// Valkey instance at STREAM_TEST_VALKEY_ADDR, e.g. localhost:6379 after `make dev`
+func TestRedisStreamService_Conformance(t *testing.T) {
+	client := newRedisClient(t)
+
+	streamtest.Run(t, func(t *testing.T, options stream.ConsumerOptions) stream.StreamService {
+		return redisStream.NewRedisStreamService(testLogger(), client, options)
+	})
+}
+
+func newRedisClient(t *testing.T) *redis.Client {
+	t.Helper()
+
+	addr := os.Getenv("STREAM_TEST_VALKEY_ADDR")
+	if addr == "" {
+		addr = miniredis.RunT(t).Addr()
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		t.Fatalf("failed to connect to %s: %v", addr, err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
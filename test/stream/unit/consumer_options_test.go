@@ -0,0 +1,34 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/ouz/goboilerplate/pkg/stream"
+)
+
+func TestConsumerOptions_ShouldDeadLetter(t *testing.T) {
+	options := stream.DefaultConsumerOptions()
+	options.MaxDeliveries = 3
+
+	tests := []struct {
+		deliveries int64
+		want       bool
+	}{
+		{deliveries: 1, want: false},
+		{deliveries: 2, want: false},
+		{deliveries: 3, want: true},
+		{deliveries: 4, want: true},
+	}
+
+	for _, tt := range tests {
+		if got := options.ShouldDeadLetter(tt.deliveries); got != tt.want {
+			t.Errorf("ShouldDeadLetter(%d) = %v, want %v", tt.deliveries, got, tt.want)
+		}
+	}
+}
+
+func TestDeadLetterStream(t *testing.T) {
+	if got := stream.DeadLetterStream("user-events"); got != "user-events:dlq" {
+		t.Errorf("DeadLetterStream() = %q, want %q", got, "user-events:dlq")
+	}
+}
@@ -0,0 +1,205 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ouz/goboilerplate/pkg/stream"
+	redisStream "github.com/ouz/goboilerplate/pkg/stream/redis"
+	"github.com/ouz/goboilerplate/pkg/stream/streamtest"
+	"github.com/redis/go-redis/v9"
+)
+
+// abandon publishes count messages and reads them as a consumer that dies
+// without acknowledging, delivered times each
+func abandon(t *testing.T, client *redis.Client, streamKey, group string, count int, delivered int) {
+	t.Helper()
+	ctx := context.Background()
+
+	service := redisStream.NewRedisStreamService(testLogger(), client, streamtest.Options())
+	if err := service.CreateGroup(ctx, streamKey, group); err != nil {
+		t.Fatalf("CreateGroup() error = %v", err)
+	}
+	for i := range count {
+		if err := service.PublishMessage(ctx, streamKey, stream.Message{Data: fmt.Appendf(nil, `{"n":%d}`, i)}); err != nil {
+			t.Fatalf("PublishMessage() error = %v", err)
+		}
+	}
+
+	read, err := client.XReadGroup(ctx, &redis.XReadGroupArgs{Group: group, Consumer: "dead", Streams: []string{streamKey, ">"}, Count: int64(count)}).Result()
+	if err != nil || len(read[0].Messages) != count {
+		t.Fatalf("XReadGroup() = %v, %v, want %d messages", read, err, count)
+	}
+	ids := make([]string, 0, count)
+	for _, msg := range read[0].Messages {
+		ids = append(ids, msg.ID)
+	}
+	// Every claim is another delivery to a consumer that dies again
+	for range delivered - 1 {
+		if err := client.XClaim(ctx, &redis.XClaimArgs{Stream: streamKey, Group: group, Consumer: "dead", Messages: ids}).Err(); err != nil {
+			t.Fatalf("XClaim() error = %v", err)
+		}
+	}
+}
+
+func consumeInBackground(t *testing.T, service stream.StreamService, streamKey, group string, handler stream.MessageHandlerFunc) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = service.ConsumeMessages(ctx, streamKey, group, "alive", nil, handler)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func waitUntil(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func pendingCount(t *testing.T, client *redis.Client, streamKey, group string) int64 {
+	t.Helper()
+	pending, err := client.XPending(context.Background(), streamKey, group).Result()
+	if err != nil {
+		t.Fatalf("XPending() error = %v", err)
+	}
+	return pending.Count
+}
+
+func TestRedisStreamService_TrimsEntriesPastRetention(t *testing.T) {
+	// Valkey only trims whole nodes of a stream, miniredis trims exactly
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	ctx := context.Background()
+
+	old := fmt.Sprintf("%d-0", time.Now().Add(-2*time.Hour).UnixMilli())
+	if err := client.XAdd(ctx, &redis.XAddArgs{Stream: "retained", ID: old, Values: map[string]any{"data": "{}"}}).Err(); err != nil {
+		t.Fatalf("XAdd() error = %v", err)
+	}
+
+	options := streamtest.Options()
+	options.Retention = time.Hour
+	service := redisStream.NewRedisStreamService(testLogger(), client, options)
+	if err := service.PublishMessage(ctx, "retained", stream.Message{Data: []byte(`{"n":1}`)}); err != nil {
+		t.Fatalf("PublishMessage() error = %v", err)
+	}
+
+	entries := client.XRange(ctx, "retained", "-", "+").Val()
+	if len(entries) != 1 || entries[0].ID == old {
+		t.Errorf("stream entries = %v, want only the new entry", entries)
+	}
+}
+
+func TestRedisStreamService_ReclaimsFromDeadConsumer(t *testing.T) {
+	client := newRedisClient(t)
+	streamKey := "reclaim:" + t.Name()
+	options := streamtest.Options()
+	// Smaller than the number of abandoned messages so reclaiming pages
+	options.BatchSize = 2
+	abandon(t, client, streamKey, "group", 5, 1)
+
+	var mu sync.Mutex
+	handled := map[string]int{}
+	consumeInBackground(t, redisStream.NewRedisStreamService(testLogger(), client, options), streamKey, "group", func(_ context.Context, msg stream.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		handled[string(msg.Data)]++
+		return nil
+	})
+
+	waitUntil(t, "the abandoned messages to be acked", func() bool { return pendingCount(t, client, streamKey, "group") == 0 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(handled) != 5 {
+		t.Errorf("handled %v, want the 5 abandoned messages", handled)
+	}
+	for data, count := range handled {
+		if count != 1 {
+			t.Errorf("message %s handled %d times, want once", data, count)
+		}
+	}
+}
+
+func TestRedisStreamService_DeadLettersAbandonedMessages(t *testing.T) {
+	client := newRedisClient(t)
+	streamKey := "abandoned:" + t.Name()
+	options := streamtest.Options()
+	// The dead consumer already used up every delivery
+	abandon(t, client, streamKey, "group", 1, int(options.MaxDeliveries))
+
+	var mu sync.Mutex
+	calls := 0
+	consumeInBackground(t, redisStream.NewRedisStreamService(testLogger(), client, options), streamKey, "group", func(context.Context, stream.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		return nil
+	})
+
+	dlq := stream.DeadLetterStream(streamKey)
+	waitUntil(t, "the dead-lettered message", func() bool { return client.XLen(context.Background(), dlq).Val() == 1 })
+
+	entries, err := client.XRange(context.Background(), dlq, "-", "+").Result()
+	if err != nil {
+		t.Fatalf("XRange() error = %v", err)
+	}
+	values := entries[0].Values
+	if values["data"] != `{"n":0}` || values["deliveries"] != fmt.Sprint(options.MaxDeliveries+1) || values["error"] != "exceeded maximum deliveries without acknowledgement" {
+		t.Errorf("dead-lettered entry = %v, want the payload after %d deliveries", values, options.MaxDeliveries+1)
+	}
+	if pendingCount(t, client, streamKey, "group") != 0 {
+		t.Error("dead-lettered message is still pending")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 0 {
+		t.Errorf("handler called %d times, want 0 for a message past its deliveries", calls)
+	}
+}
+
+func TestRedisStreamService_DeadLettersWithDeliveryCount(t *testing.T) {
+	client := newRedisClient(t)
+	streamKey := "failing:" + t.Name()
+	options := streamtest.Options()
+	abandon(t, client, streamKey, "group", 1, 1)
+
+	var mu sync.Mutex
+	calls := 0
+	consumeInBackground(t, redisStream.NewRedisStreamService(testLogger(), client, options), streamKey, "group", func(context.Context, stream.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		return fmt.Errorf("permanent failure")
+	})
+
+	dlq := stream.DeadLetterStream(streamKey)
+	waitUntil(t, "the dead-lettered message", func() bool { return client.XLen(context.Background(), dlq).Val() == 1 })
+
+	values := client.XRange(context.Background(), dlq, "-", "+").Val()[0].Values
+	if values["deliveries"] != fmt.Sprint(options.MaxDeliveries) || values["error"] != "permanent failure" || values["originalId"] == "" {
+		t.Errorf("dead-lettered entry = %v, want the last error after %d deliveries", values, options.MaxDeliveries)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// The first delivery went to the dead consumer, every reclaim is one call
+	if calls != int(options.MaxDeliveries)-1 {
+		t.Errorf("handler called %d times, want %d", calls, options.MaxDeliveries-1)
+	}
+}
@@ -0,0 +1,231 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ouz/goboilerplate/pkg/stream"
+)
+
+type orderPlaced struct {
+	OrderID string `json:"orderId"`
+	Total   int    `json:"total"`
+	Channel string `json:"channel"`
+}
+
+func (orderPlaced) EventType() string { return "order.placed" }
+func (orderPlaced) EventVersion() int { return 3 }
+
+type orderShipped struct {
+	OrderID string `json:"orderId"`
+}
+
+func (orderShipped) EventType() string { return "order.shipped" }
+func (orderShipped) EventVersion() int { return 1 }
+
+type orderPlacedV2 struct{}
+
+func (orderPlacedV2) EventType() string { return "order.placed" }
+func (orderPlacedV2) EventVersion() int { return 2 }
+
+// v1 called the total "amount", v2 added the sales channel
+func newOrderRegistry(t *testing.T) *stream.Registry {
+	t.Helper()
+	registry := stream.NewRegistry()
+	stream.MustRegister[orderPlaced](registry)
+	stream.MustRegister[orderShipped](registry)
+
+	err := registry.RegisterUpcaster("order.placed", 1, func(data json.RawMessage) (json.RawMessage, error) {
+		var v1 map[string]any
+		if err := json.Unmarshal(data, &v1); err != nil {
+			return nil, err
+		}
+		v1["total"] = v1["amount"]
+		delete(v1, "amount")
+		return json.Marshal(v1)
+	})
+	if err != nil {
+		t.Fatalf("RegisterUpcaster() error = %v", err)
+	}
+	err = registry.RegisterUpcaster("order.placed", 2, func(data json.RawMessage) (json.RawMessage, error) {
+		var v2 map[string]any
+		if err := json.Unmarshal(data, &v2); err != nil {
+			return nil, err
+		}
+		v2["channel"] = "web"
+		return json.Marshal(v2)
+	})
+	if err != nil {
+		t.Fatalf("RegisterUpcaster() error = %v", err)
+	}
+	return registry
+}
+
+func envelopeMessage(t *testing.T, eventType string, version int, data any) stream.Message {
+	t.Helper()
+	envelope, err := stream.NewEnvelope(context.Background(), eventType, version, data)
+	if err != nil {
+		t.Fatalf("NewEnvelope() error = %v", err)
+	}
+	payload, _ := json.Marshal(envelope)
+	msg, err := stream.EnvelopeMessage(payload)
+	if err != nil {
+		t.Fatalf("EnvelopeMessage() error = %v", err)
+	}
+	return msg
+}
+
+func TestRegister_RejectsConflictingVersion(t *testing.T) {
+	registry := newOrderRegistry(t)
+
+	if err := stream.Register[orderPlaced](registry); err != nil {
+		t.Errorf("Register() same version error = %v", err)
+	}
+	if err := stream.Register[orderPlacedV2](registry); err == nil {
+		t.Error("Register() with a different version succeeded")
+	}
+}
+
+func TestRegistry_Validate(t *testing.T) {
+	registry := newOrderRegistry(t)
+
+	if err := registry.Validate("order.placed", 3); err != nil {
+		t.Errorf("Validate() current version error = %v", err)
+	}
+	if err := registry.Validate("order.placed", 2); err == nil {
+		t.Error("Validate() accepted an outdated version")
+	}
+	if err := registry.Validate("order.cancelled", 1); err == nil {
+		t.Error("Validate() accepted an unknown type")
+	}
+}
+
+func TestRegistry_DecodeUpcastsOldVersions(t *testing.T) {
+	registry := newOrderRegistry(t)
+	msg := envelopeMessage(t, "order.placed", 1, map[string]any{"orderId": "o-1", "amount": 42})
+
+	envelope, err := registry.Decode(msg)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if envelope.Version != 3 {
+		t.Errorf("Decode() version = %d, want 3", envelope.Version)
+	}
+
+	var event orderPlaced
+	if err := envelope.Decode(&event); err != nil {
+		t.Fatalf("Envelope.Decode() error = %v", err)
+	}
+	want := orderPlaced{OrderID: "o-1", Total: 42, Channel: "web"}
+	if event != want {
+		t.Errorf("upcast event = %+v, want %+v", event, want)
+	}
+}
+
+func TestRegistry_DecodeRejects(t *testing.T) {
+	registry := newOrderRegistry(t)
+
+	legacy := envelopeMessage(t, "order.placed", 3, orderPlaced{OrderID: "o-1"})
+	legacy.Type, legacy.Version, legacy.ContentType = "", 0, ""
+	if _, err := registry.Decode(legacy); err != nil {
+		t.Errorf("Decode() of an entry without type fields error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		msg  stream.Message
+	}{
+		{name: "unknown type", msg: envelopeMessage(t, "order.cancelled", 1, orderShipped{})},
+		{name: "newer version", msg: envelopeMessage(t, "order.shipped", 2, orderShipped{})},
+		{name: "unsupported content type", msg: stream.Message{Type: "order.shipped", Version: 1, ContentType: "application/xml", Data: []byte("<order/>")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := registry.Decode(tt.msg); err == nil {
+				t.Error("Decode() succeeded, want error")
+			}
+		})
+	}
+}
+
+type messageLog struct {
+	stream.StreamService
+	messages []stream.Message
+}
+
+func (m *messageLog) PublishMessage(_ context.Context, _ string, msg stream.Message) error {
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+func (m *messageLog) ConsumeMessages(ctx context.Context, _, _, _ string, _ stream.KeyFunc, handler stream.MessageHandlerFunc) error {
+	for _, msg := range m.messages {
+		if err := handler(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	registry := newOrderRegistry(t)
+	log := &messageLog{}
+	ctx := context.Background()
+
+	if err := stream.Publish(ctx, log, registry, "orders", orderShipped{OrderID: "o-1"}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if err := stream.Publish(ctx, log, registry, "orders", orderPlaced{OrderID: "o-2", Total: 10}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if err := stream.Publish(ctx, log, registry, "orders", orderPlacedV2{}); err == nil {
+		t.Error("Publish() accepted an outdated version")
+	}
+
+	if msg := log.messages[0]; msg.Type != "order.shipped" || msg.Version != 1 || msg.ContentType != stream.ContentTypeJSON {
+		t.Errorf("Publish() message fields = %s v%d %s", msg.Type, msg.Version, msg.ContentType)
+	}
+
+	var received []orderShipped
+	err := stream.Subscribe(ctx, log, registry, "orders", "group", "consumer", func(_ context.Context, envelope stream.Envelope, event orderShipped) error {
+		if envelope.Type != "order.shipped" {
+			t.Errorf("handler envelope type = %s", envelope.Type)
+		}
+		received = append(received, event)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if len(received) != 1 || received[0].OrderID != "o-1" {
+		t.Errorf("Subscribe() received %+v, want only the shipped event", received)
+	}
+}
+
+func TestSubscribeEnvelopes(t *testing.T) {
+	registry := newOrderRegistry(t)
+	log := &messageLog{messages: []stream.Message{
+		envelopeMessage(t, "order.placed", 1, map[string]any{"orderId": "o-1", "amount": 42}),
+		envelopeMessage(t, "order.shipped", 1, orderShipped{OrderID: "o-1"}),
+	}}
+
+	var received []stream.Envelope
+	err := stream.SubscribeEnvelopes(context.Background(), log, registry, "orders", "group", "consumer", func(_ context.Context, envelope stream.Envelope) error {
+		received = append(received, envelope)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("SubscribeEnvelopes() error = %v", err)
+	}
+	if len(received) != 2 || received[0].Version != 3 || received[1].Type != "order.shipped" {
+		t.Errorf("SubscribeEnvelopes() received %+v, want both events at their current version", received)
+	}
+
+	log.messages = append(log.messages, envelopeMessage(t, "order.cancelled", 1, orderShipped{}))
+	err = stream.SubscribeEnvelopes(context.Background(), log, registry, "orders", "group", "consumer", func(context.Context, stream.Envelope) error { return nil })
+	if err == nil {
+		t.Error("SubscribeEnvelopes() handled an unknown event type, want it to fail")
+	}
+}
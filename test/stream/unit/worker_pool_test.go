@@ -0,0 +1,104 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ouz/goboilerplate/pkg/stream"
+)
+
+func TestWorkerPool_LimitsConcurrency(t *testing.T) {
+	pool := stream.NewWorkerPool(3, false)
+
+	var running, peak atomic.Int32
+	for range 12 {
+		err := pool.Submit(context.Background(), "", func() {
+			n := running.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			running.Add(-1)
+		})
+		if err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+	}
+	pool.Close()
+
+	if got := peak.Load(); got != 3 {
+		t.Errorf("peak concurrency = %d, want 3", got)
+	}
+}
+
+func TestWorkerPool_OrdersByKey(t *testing.T) {
+	pool := stream.NewWorkerPool(4, true)
+
+	var mu sync.Mutex
+	seen := map[string][]int{}
+	for i := range 50 {
+		key := fmt.Sprintf("user-%d", i%5)
+		err := pool.Submit(context.Background(), key, func() {
+			// Later messages finish faster, an unordered pool would reorder them
+			time.Sleep(time.Duration(50-i) * 50 * time.Microsecond)
+			mu.Lock()
+			seen[key] = append(seen[key], i)
+			mu.Unlock()
+		})
+		if err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+	}
+	pool.Close()
+
+	for key, order := range seen {
+		for j := 1; j < len(order); j++ {
+			if order[j] < order[j-1] {
+				t.Errorf("messages for %s handled out of order: %v", key, order)
+				break
+			}
+		}
+	}
+}
+
+func TestWorkerPool_CloseDrainsInFlight(t *testing.T) {
+	pool := stream.NewWorkerPool(2, false)
+
+	var done atomic.Int32
+	for range 2 {
+		_ = pool.Submit(context.Background(), "", func() {
+			time.Sleep(20 * time.Millisecond)
+			done.Add(1)
+		})
+	}
+	pool.Close()
+
+	if got := done.Load(); got != 2 {
+		t.Errorf("Close() returned with %d of 2 tasks finished", got)
+	}
+}
+
+func TestWorkerPool_SubmitStopsOnCancel(t *testing.T) {
+	pool := stream.NewWorkerPool(1, false)
+	release := make(chan struct{})
+	_ = pool.Submit(context.Background(), "", func() { <-release })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// The only worker is busy, so the pool applies backpressure until ctx is done
+	if err := pool.Submit(ctx, "", func() {}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Submit() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(release)
+	pool.Close()
+}
@@ -0,0 +1,118 @@
+package user
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	appUser "github.com/ouz/goboilerplate/internal/application/user"
+	"github.com/ouz/goboilerplate/internal/domain/audit"
+	"github.com/ouz/goboilerplate/internal/domain/auth"
+	"github.com/ouz/goboilerplate/internal/domain/event"
+	vo "github.com/ouz/goboilerplate/internal/domain/shared"
+	"github.com/ouz/goboilerplate/internal/domain/user"
+	"github.com/ouz/goboilerplate/pkg/cache"
+	redisCache "github.com/ouz/goboilerplate/pkg/cache/redis"
+	"github.com/ouz/goboilerplate/pkg/errors"
+	"github.com/ouz/goboilerplate/pkg/log"
+	"github.com/redis/go-redis/v9"
+)
+
+// memoryUserRepository keeps the users needed to delete and purge an account
+type memoryUserRepository struct {
+	user.UserRepository
+	users map[string]user.User
+}
+
+func (m *memoryUserRepository) FindByIdWithDetails(_ context.Context, id string) (*user.User, error) {
+	u, ok := m.users[id]
+	if !ok || u.DeletedAt.Valid {
+		return nil, errors.NotFoundError("User not found", nil)
+	}
+	return &u, nil
+}
+
+func (m *memoryUserRepository) FindDeletedById(_ context.Context, id string) (*user.User, error) {
+	u, ok := m.users[id]
+	if !ok || !u.DeletedAt.Valid {
+		return nil, errors.NotFoundError("User not found", nil)
+	}
+	return &u, nil
+}
+
+func (m *memoryUserRepository) SoftDelete(_ context.Context, u *user.User) error {
+	m.users[u.ID] = *u
+	return nil
+}
+
+func (m *memoryUserRepository) FindIDsDueForPurge(_ context.Context, before time.Time, limit int) ([]string, error) {
+	var ids []string
+	for id, u := range m.users {
+		if u.DeletedAt.Valid && u.PurgedAt == nil && u.PurgeAfter != nil && !u.PurgeAfter.After(before) && len(ids) < limit {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (m *memoryUserRepository) Anonymize(_ context.Context, u *user.User) error {
+	m.users[u.ID] = *u
+	return nil
+}
+
+type immediateTx struct{}
+
+func (immediateTx) ExecuteInTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+type discardPublisher struct{}
+
+func (discardPublisher) Publish(context.Context, event.Event) error { return nil }
+
+type discardAudit struct{ audit.AuditService }
+
+func (discardAudit) Record(context.Context, *audit.Event) {}
+
+type logoutAuth struct{ auth.AuthService }
+
+func (logoutAuth) LogoutAll(context.Context, string) error { return nil }
+
+func newTestCache(t *testing.T) cache.RedisCacheService {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return redisCache.NewRedisCacheService(client, cache.NewEncoder(cache.EncoderOptions{}))
+}
+
+func TestAdminUserService_DeletedUserIsPurged(t *testing.T) {
+	logger := log.NewLogger("test", slog.LevelError, slog.LevelError)
+	u, err := user.NewUser("testuser", "validpass123", vo.Email{Address: "test@example.com"})
+	if err != nil {
+		t.Fatalf("NewUser() error = %v", err)
+	}
+	repo := &memoryUserRepository{users: map[string]user.User{u.ID: *u}}
+	rc := newTestCache(t)
+
+	admin := appUser.NewAdminUserService(logger, repo, logoutAuth{}, rc, immediateTx{}, discardPublisher{}, discardAudit{})
+	if err := admin.DeleteUser(context.Background(), u.ID); err != nil {
+		t.Fatalf("DeleteUser() error = %v", err)
+	}
+	if deleted := repo.users[u.ID]; deleted.IsPendingDeletion() {
+		t.Error("DeleteUser() left the account restorable by the user")
+	}
+
+	users := appUser.NewUserService(logger, repo, rc, immediateTx{}, nil, discardAudit{}, discardPublisher{})
+	purged, err := users.PurgeDeletedAccounts(context.Background())
+	if err != nil || purged != 1 {
+		t.Fatalf("PurgeDeletedAccounts() = %d, %v, want the admin-deleted user", purged, err)
+	}
+
+	anonymized := repo.users[u.ID]
+	if anonymized.PurgedAt == nil || anonymized.Email == u.Email || !strings.HasPrefix(anonymized.Username, "deleted-") || len(anonymized.Credentials) != 0 {
+		t.Errorf("PurgeDeletedAccounts() left %+v, want the personal data removed", anonymized)
+	}
+}
@@ -33,6 +33,22 @@ func TestNewCredential(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "Valid device secret credential",
+			args: args{
+				credentialType: user.CredentialTypeDeviceSecret,
+				secret:         "q1ZqK0Zr3s9Xb7Y2nV8wLp4TgHc6Jd5Ue0Rf1Ai9Ok8",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Low entropy device secret",
+			args: args{
+				credentialType: user.CredentialTypeDeviceSecret,
+				secret:         "short",
+			},
+			wantErr: true,
+		},
 		{
 			name: "Empty password",
 			args: args{
@@ -132,3 +148,25 @@ func TestCredential_IsPasswordValid(t *testing.T) {
 		})
 	}
 }
+
+func TestCredential_IsDeviceSecretValid(t *testing.T) {
+	secret, err := user.NewDeviceSecret()
+	if err != nil {
+		t.Fatalf("NewDeviceSecret() error = %v", err)
+	}
+
+	c, err := user.NewCredential(user.CredentialTypeDeviceSecret, secret)
+	if err != nil {
+		t.Fatalf("Failed to create test credential: %v", err)
+	}
+
+	if !c.IsDeviceSecretValid(secret) {
+		t.Error("Credential.IsDeviceSecretValid() = false, want true")
+	}
+	if c.IsDeviceSecretValid(secret + "x") {
+		t.Error("Credential.IsDeviceSecretValid() accepted a wrong secret")
+	}
+	if c.IsPasswordValid(secret) {
+		t.Error("Credential.IsPasswordValid() accepted a device secret credential")
+	}
+}
@@ -0,0 +1,85 @@
+package user
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ouz/goboilerplate/internal/domain/audit"
+	vo "github.com/ouz/goboilerplate/internal/domain/shared"
+	"github.com/ouz/goboilerplate/internal/domain/user"
+	"gorm.io/gorm"
+)
+
+func TestNewDataExport(t *testing.T) {
+	u, err := user.NewUser("testuser", "validpass123", vo.Email{Address: "test@example.com"})
+	if err != nil {
+		t.Fatalf("NewUser() error = %v", err)
+	}
+
+	confirmedAt := time.Now()
+	u.Confirmations[0].DeletedAt = gorm.DeletedAt{Time: confirmedAt, Valid: true}
+	sessions := []user.ExportedSession{{ID: "jti", ClientType: "WEB"}}
+
+	auditEvents := []audit.Event{*audit.Success(audit.ActionLogin).WithActor(u.ID)}
+
+	export := user.NewDataExport(u, sessions, auditEvents)
+
+	if export.User.ID != u.ID || export.User.Email != u.Email {
+		t.Errorf("NewDataExport() user = %+v, want id %s and email %s", export.User, u.ID, u.Email)
+	}
+	if len(export.Roles) != len(u.Roles) {
+		t.Errorf("NewDataExport() roles = %d, want %d", len(export.Roles), len(u.Roles))
+	}
+	if len(export.Credentials) != 1 || export.Credentials[0].Type != string(user.CredentialTypePassword) {
+		t.Errorf("NewDataExport() credentials = %+v, want one password credential", export.Credentials)
+	}
+	if len(export.Confirmations) != 1 || export.Confirmations[0].ConfirmedAt == nil {
+		t.Errorf("NewDataExport() confirmations = %+v, want one confirmed entry", export.Confirmations)
+	}
+	if len(export.Sessions) != 1 {
+		t.Errorf("NewDataExport() sessions = %d, want 1", len(export.Sessions))
+	}
+	if len(export.AuditEvents) != 1 || export.AuditEvents[0].Action != string(audit.ActionLogin) {
+		t.Errorf("NewDataExport() audit events = %+v, want one login event", export.AuditEvents)
+	}
+
+	archive, err := json.Marshal(export)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if strings.Contains(string(archive), u.Credentials[0].Hash) {
+		t.Error("NewDataExport() archive must not contain credential hashes")
+	}
+}
+
+func TestNewDataExport_NoSessions(t *testing.T) {
+	u, _, err := user.NewAnonymousUser()
+	if err != nil {
+		t.Fatalf("NewAnonymousUser() error = %v", err)
+	}
+
+	export := user.NewDataExport(u, nil, nil)
+	if export.Sessions == nil {
+		t.Error("NewDataExport() sessions = nil, want empty slice")
+	}
+}
+
+func TestDataExportJob_Lifecycle(t *testing.T) {
+	job := user.NewDataExportJob("user-id")
+	if !job.IsPending() || job.ID == "" {
+		t.Fatalf("NewDataExportJob() = %+v, want pending job with id", job)
+	}
+
+	job.Complete()
+	if job.Status != user.DataExportStatusCompleted || job.CompletedAt == nil {
+		t.Errorf("DataExportJob.Complete() = %+v", job)
+	}
+
+	failed := user.NewDataExportJob("user-id")
+	failed.Fail("boom")
+	if failed.Status != user.DataExportStatusFailed || failed.Error != "boom" {
+		t.Errorf("DataExportJob.Fail() = %+v", failed)
+	}
+}
@@ -0,0 +1,100 @@
+package user
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	vo "github.com/ouz/goboilerplate/internal/domain/shared"
+	"github.com/ouz/goboilerplate/internal/domain/user"
+)
+
+func TestUser_ScheduleDeletion(t *testing.T) {
+	u, err := user.NewUser("testuser", "validpass123", vo.Email{Address: "test@example.com"})
+	if err != nil {
+		t.Fatalf("NewUser() error = %v", err)
+	}
+
+	if err := u.ScheduleDeletion(time.Hour); err != nil {
+		t.Fatalf("User.ScheduleDeletion() error = %v", err)
+	}
+	if !u.DeletedAt.Valid || u.PurgeAfter == nil {
+		t.Fatal("User.ScheduleDeletion() should soft delete and set a purge time")
+	}
+	if !u.IsPendingDeletion() {
+		t.Error("User.IsPendingDeletion() = false, want true")
+	}
+	if err := u.ScheduleDeletion(time.Hour); err == nil {
+		t.Error("User.ScheduleDeletion() twice error = nil, want error")
+	}
+
+	if err := u.Restore(); err != nil {
+		t.Fatalf("User.Restore() error = %v", err)
+	}
+	if u.DeletedAt.Valid || u.PurgeAfter != nil || u.IsPendingDeletion() {
+		t.Error("User.Restore() should clear the deletion state")
+	}
+}
+
+func TestUser_Restore(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(u *user.User)
+		wantErr bool
+	}{
+		{
+			name:    "Not deleted",
+			setup:   func(u *user.User) {},
+			wantErr: true,
+		},
+		{
+			name: "Grace period over",
+			setup: func(u *user.User) {
+				_ = u.ScheduleDeletion(time.Hour)
+				past := time.Now().Add(-time.Minute)
+				u.PurgeAfter = &past
+			},
+			wantErr: true,
+		},
+		{
+			name: "Within grace period",
+			setup: func(u *user.User) {
+				_ = u.ScheduleDeletion(time.Hour)
+			},
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &user.User{ID: "user-id"}
+			tt.setup(u)
+			if err := u.Restore(); (err != nil) != tt.wantErr {
+				t.Errorf("User.Restore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUser_Anonymize(t *testing.T) {
+	u, err := user.NewUser("testuser", "validpass123", vo.Email{Address: "test@example.com"})
+	if err != nil {
+		t.Fatalf("NewUser() error = %v", err)
+	}
+	u.DisplayName = "Test User"
+	id := u.ID
+
+	u.Anonymize()
+
+	if u.ID != id {
+		t.Errorf("User.Anonymize().ID = %v, want %v", u.ID, id)
+	}
+	if strings.Contains(u.Email, "test@example.com") || strings.Contains(u.Username, "testuser") || u.DisplayName != "" {
+		t.Error("User.Anonymize() should remove personal data")
+	}
+	if len(u.Credentials) != 0 || len(u.Roles) != 0 || len(u.Confirmations) != 0 {
+		t.Error("User.Anonymize() should drop credentials, roles and confirmations")
+	}
+	if u.PurgedAt == nil {
+		t.Error("User.Anonymize().PurgedAt is nil")
+	}
+}
@@ -0,0 +1,102 @@
+package user
+
+import (
+	"testing"
+
+	vo "github.com/ouz/goboilerplate/internal/domain/shared"
+	"github.com/ouz/goboilerplate/internal/domain/user"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestUser_UpdateProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		update  user.ProfileUpdate
+		want    user.User
+		wantErr bool
+	}{
+		{
+			name: "Update all fields",
+			update: user.ProfileUpdate{
+				Username:    strPtr("newname"),
+				DisplayName: strPtr("  New Name "),
+				Locale:      strPtr("tr-tr"),
+				TimeZone:    strPtr("Europe/Istanbul"),
+			},
+			want: user.User{Username: "newname", DisplayName: "New Name", Locale: "tr-TR", TimeZone: "Europe/Istanbul"},
+		},
+		{
+			name:   "Nil fields are left untouched",
+			update: user.ProfileUpdate{DisplayName: strPtr("Only Name")},
+			want:   user.User{Username: "testuser", DisplayName: "Only Name"},
+		},
+		{
+			name:    "Too short username",
+			update:  user.ProfileUpdate{Username: strPtr("ab")},
+			wantErr: true,
+		},
+		{
+			name:    "Invalid locale",
+			update:  user.ProfileUpdate{Locale: strPtr("not a locale")},
+			wantErr: true,
+		},
+		{
+			name:    "Invalid time zone",
+			update:  user.ProfileUpdate{TimeZone: strPtr("Mars/Olympus")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &user.User{Username: "testuser"}
+			err := u.UpdateProfile(tt.update)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("User.UpdateProfile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if u.Username != "testuser" {
+					t.Error("User.UpdateProfile() should not modify the user on failure")
+				}
+				return
+			}
+			if u.Username != tt.want.Username || u.DisplayName != tt.want.DisplayName ||
+				u.Locale != tt.want.Locale || u.TimeZone != tt.want.TimeZone {
+				t.Errorf("User.UpdateProfile() = %+v, want %+v", *u, tt.want)
+			}
+		})
+	}
+}
+
+func TestUser_RequestEmailChange(t *testing.T) {
+	u, err := user.NewUser("testuser", "validpass123", vo.Email{Address: "test@example.com"})
+	if err != nil {
+		t.Fatalf("NewUser() error = %v", err)
+	}
+
+	confirmation, err := u.RequestEmailChange(vo.Email{Address: "new@example.com"})
+	if err != nil {
+		t.Fatalf("User.RequestEmailChange() error = %v", err)
+	}
+	if confirmation.NewEmail != "new@example.com" {
+		t.Errorf("User.RequestEmailChange().NewEmail = %v, want new@example.com", confirmation.NewEmail)
+	}
+	if u.Email != "test@example.com" {
+		t.Error("User.RequestEmailChange() should not switch the email before confirmation")
+	}
+
+	if _, err := u.RequestEmailChange(vo.Email{Address: "TEST@example.com"}); err == nil {
+		t.Error("User.RequestEmailChange() with the current email error = nil, want error")
+	}
+
+	anonymous, _, err := user.NewAnonymousUser()
+	if err != nil {
+		t.Fatalf("NewAnonymousUser() error = %v", err)
+	}
+	if _, err := anonymous.RequestEmailChange(vo.Email{Address: "new@example.com"}); err == nil {
+		t.Error("User.RequestEmailChange() for anonymous user error = nil, want error")
+	}
+}
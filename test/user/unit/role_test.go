@@ -34,6 +34,14 @@ func TestNewUserRole(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "Valid admin role",
+			args: args{
+				userID: uuid.New().String(),
+				name:   user.UserRoleAdmin,
+			},
+			wantErr: false,
+		},
 		{
 			name: "Invalid role name",
 			args: args{
@@ -102,7 +102,7 @@ func TestNewAnonymousUser(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := user.NewAnonymousUser()
+			got, deviceSecret, err := user.NewAnonymousUser()
 			if (err != nil) != tt.wantErr {
 				t.Errorf("NewAnonymousUser() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -124,6 +124,12 @@ func TestNewAnonymousUser(t *testing.T) {
 				if len(got.Roles) != 1 || got.Roles[0].Name != user.UserRoleAnonymous {
 					t.Error("NewAnonymousUser() should have exactly one ANONYMOUS role")
 				}
+				if !got.IsDeviceSecretValid(deviceSecret) {
+					t.Error("NewAnonymousUser() device secret should be valid")
+				}
+				if got.IsDeviceSecretValid(got.Email) {
+					t.Error("NewAnonymousUser() email should not be accepted as device secret")
+				}
 			}
 		})
 	}
@@ -294,6 +300,27 @@ func TestUser_HasRole(t *testing.T) {
 	}
 }
 
+func TestUser_GrantRole(t *testing.T) {
+	u := &user.User{ID: uuid.New().String()}
+
+	role, err := u.GrantRole(user.UserRoleAdmin)
+	if err != nil || role == nil || role.UserID != u.ID || role.Name != user.UserRoleAdmin {
+		t.Fatalf("User.GrantRole() = %+v, %v, want a new ADMIN role", role, err)
+	}
+	if !u.HasRole(user.UserRoleAdmin) {
+		t.Error("User.GrantRole() did not add the role to the user")
+	}
+
+	role, err = u.GrantRole(user.UserRoleAdmin)
+	if err != nil || role != nil || len(u.Roles) != 1 {
+		t.Errorf("User.GrantRole() again = %+v, %v with %d roles, want nothing to store", role, err, len(u.Roles))
+	}
+
+	if _, err := u.GrantRole("ROOT"); err == nil {
+		t.Error("User.GrantRole() accepted an unsupported role")
+	}
+}
+
 func TestUser_Confirm(t *testing.T) {
 	tests := []struct {
 		name string
@@ -320,3 +347,72 @@ func TestUser_Confirm(t *testing.T) {
 		})
 	}
 }
+
+func TestUser_VerifyKeepsDisabledUserDisabled(t *testing.T) {
+	u := &user.User{ID: uuid.New().String(), Enabled: false, Verified: false}
+
+	u.Verify()
+	if !u.Verified {
+		t.Error("User.Verify() did not verify user")
+	}
+	if u.Enabled {
+		t.Error("User.Verify() enabled a disabled user")
+	}
+}
+
+func TestUser_Upgrade(t *testing.T) {
+	email := vo.Email{Address: "upgraded@example.com"}
+
+	t.Run("Anonymous user keeps its ID", func(t *testing.T) {
+		u, _, err := user.NewAnonymousUser()
+		if err != nil {
+			t.Fatalf("NewAnonymousUser() error = %v", err)
+		}
+		id := u.ID
+
+		if err := u.Upgrade("upgraded", "validpass123", email); err != nil {
+			t.Fatalf("Upgrade() error = %v", err)
+		}
+		if u.ID != id {
+			t.Errorf("Upgrade().ID = %v, want %v", u.ID, id)
+		}
+		if u.Anonymous || u.Verified || u.Enabled {
+			t.Error("Upgrade() should leave an unverified, non-anonymous account")
+		}
+		if u.Email != email.Address || u.Username != "upgraded" {
+			t.Errorf("Upgrade() = %v/%v, want %v/%v", u.Email, u.Username, email.Address, "upgraded")
+		}
+		if !u.HasRole(user.UserRoleUser) || u.HasRole(user.UserRoleAnonymous) {
+			t.Error("Upgrade() should swap ANONYMOUS role for USER")
+		}
+		if !u.IsPasswordValid("validpass123") {
+			t.Error("Upgrade() should add a password credential")
+		}
+		if u.LatestConfirmation() == nil {
+			t.Error("Upgrade() should add a confirmation")
+		}
+	})
+
+	t.Run("Regular user cannot be upgraded", func(t *testing.T) {
+		u, err := user.NewUser("testuser", "validpass123", vo.Email{Address: "test@example.com"})
+		if err != nil {
+			t.Fatalf("NewUser() error = %v", err)
+		}
+		if err := u.Upgrade("upgraded", "validpass123", email); err == nil {
+			t.Error("Upgrade() error = nil, want error")
+		}
+	})
+
+	t.Run("Invalid password is rejected", func(t *testing.T) {
+		u, _, err := user.NewAnonymousUser()
+		if err != nil {
+			t.Fatalf("NewAnonymousUser() error = %v", err)
+		}
+		if err := u.Upgrade("upgraded", "short", email); err == nil {
+			t.Error("Upgrade() error = nil, want error")
+		}
+		if !u.Anonymous {
+			t.Error("Upgrade() should not modify the user on failure")
+		}
+	})
+}
@@ -0,0 +1,309 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	appWebhook "github.com/ouz/goboilerplate/internal/application/webhook"
+	"github.com/ouz/goboilerplate/internal/config"
+	"github.com/ouz/goboilerplate/internal/domain/event"
+	"github.com/ouz/goboilerplate/internal/domain/webhook"
+	"github.com/ouz/goboilerplate/pkg/auth"
+	"github.com/ouz/goboilerplate/pkg/log"
+	"github.com/ouz/goboilerplate/pkg/stream"
+)
+
+type memoryWebhooks struct {
+	webhook.WebhookRepository
+	subscriptions []webhook.Subscription
+	deliveries    []webhook.Delivery
+	attempts      []webhook.DeliveryAttempt
+	leases        []time.Duration
+}
+
+func (m *memoryWebhooks) FindSubscriptionsForEvent(_ context.Context, clientType auth.ClientType, eventType string) ([]webhook.Subscription, error) {
+	var result []webhook.Subscription
+	for _, s := range m.subscriptions {
+		if s.ClientType == clientType && s.Accepts(eventType) {
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
+
+func (m *memoryWebhooks) CreateDeliveries(_ context.Context, deliveries []webhook.Delivery) error {
+	for _, d := range deliveries {
+		duplicate := false
+		for _, existing := range m.deliveries {
+			if existing.SubscriptionID == d.SubscriptionID && existing.EventID == d.EventID {
+				duplicate = true
+			}
+		}
+		if !duplicate {
+			d.ID = strconv.Itoa(len(m.deliveries) + 1)
+			m.deliveries = append(m.deliveries, d)
+		}
+	}
+	return nil
+}
+
+func (m *memoryWebhooks) ClaimDueDeliveries(_ context.Context, now, leaseUntil time.Time, limit int) ([]webhook.Delivery, error) {
+	m.leases = append(m.leases, leaseUntil.Sub(now))
+	var claimed []webhook.Delivery
+	for i := range m.deliveries {
+		d := &m.deliveries[i]
+		if d.Status != webhook.DeliveryStatusPending || d.NextAttemptAt.After(now) || len(claimed) >= limit {
+			continue
+		}
+		d.NextAttemptAt = leaseUntil
+		copied := *d
+		for _, s := range m.subscriptions {
+			if s.ID == d.SubscriptionID {
+				copied.Subscription = s
+			}
+		}
+		claimed = append(claimed, copied)
+	}
+	return claimed, nil
+}
+
+func (m *memoryWebhooks) UpdateDelivery(_ context.Context, delivery *webhook.Delivery) error {
+	for i := range m.deliveries {
+		if m.deliveries[i].ID == delivery.ID {
+			updated := *delivery
+			updated.Subscription = webhook.Subscription{}
+			m.deliveries[i] = updated
+		}
+	}
+	return nil
+}
+
+func (m *memoryWebhooks) CreateAttempt(_ context.Context, attempt *webhook.DeliveryAttempt) error {
+	m.attempts = append(m.attempts, *attempt)
+	return nil
+}
+
+type replayStream struct {
+	stream.StreamService
+	messages [][]byte
+}
+
+func (r *replayStream) ConsumeMessages(ctx context.Context, _, _, _ string, _ stream.KeyFunc, handler stream.MessageHandlerFunc) error {
+	for i, payload := range r.messages {
+		message, err := stream.EnvelopeMessage(payload)
+		if err != nil {
+			return err
+		}
+		message.ID = strconv.Itoa(i)
+		if err := handler(ctx, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type immediateTx struct{}
+
+func (immediateTx) ExecuteInTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+type receiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []receivedRequest
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, receivedRequest{header: req.Header.Clone(), body: body})
+	w.WriteHeader(r.status)
+}
+
+func setup(t *testing.T, status int, maxAttempts int) (*memoryWebhooks, *receiver, webhook.Dispatcher) {
+	t.Helper()
+	return setupWithNetworks(t, status, maxAttempts, true)
+}
+
+func setupWithNetworks(t *testing.T, status int, maxAttempts int, allowPrivateNetworks bool) (*memoryWebhooks, *receiver, webhook.Dispatcher) {
+	t.Helper()
+
+	recv := &receiver{status: status}
+	server := httptest.NewServer(recv)
+	t.Cleanup(server.Close)
+
+	subscription, err := webhook.NewSubscription(auth.WEB, "https://partner.example.com/hooks", []string{event.TypeUserConfirmed})
+	if err != nil {
+		t.Fatalf("NewSubscription() error = %v", err)
+	}
+	subscription.ID = "sub-1"
+	// The test receiver is a plain http server on loopback
+	subscription.URL = server.URL
+
+	envelope, err := stream.NewEnvelope(context.Background(), event.TypeUserConfirmed, 1, event.UserConfirmed{UserID: "user-id", Email: "test@example.com", ClientType: string(auth.WEB)})
+	if err != nil {
+		t.Fatalf("NewEnvelope() error = %v", err)
+	}
+	payload, _ := json.Marshal(envelope)
+	ignored, _ := stream.NewEnvelope(context.Background(), event.TypeUserLoggedIn, 1, event.UserLoggedIn{UserID: "user-id"})
+	ignoredPayload, _ := json.Marshal(ignored)
+
+	repo := &memoryWebhooks{subscriptions: []webhook.Subscription{*subscription}}
+	// The confirmed event is delivered twice by the stream to prove deliveries are idempotent
+	streamService := &replayStream{messages: [][]byte{payload, ignoredPayload, payload}}
+
+	dispatcher := appWebhook.NewDispatcher(log.NewLogger("test", slog.LevelError, slog.LevelError), repo, streamService, event.NewRegistry(), immediateTx{}, config.WebhookConfig{
+		Timeout:              time.Second,
+		MaxAttempts:          maxAttempts,
+		InitialBackoff:       time.Minute,
+		MaxBackoff:           time.Hour,
+		BatchSize:            10,
+		AllowPrivateNetworks: allowPrivateNetworks,
+	})
+
+	if err := dispatcher.ConsumeEvents(context.Background(), "test"); err != nil {
+		t.Fatalf("ConsumeEvents() error = %v", err)
+	}
+	return repo, recv, dispatcher
+}
+
+func TestDispatcher_DeliversSignedPayload(t *testing.T) {
+	repo, recv, dispatcher := setup(t, http.StatusNoContent, 3)
+
+	if len(repo.deliveries) != 1 {
+		t.Fatalf("ConsumeEvents() created %d deliveries, want 1", len(repo.deliveries))
+	}
+
+	dispatched, err := dispatcher.Dispatch(context.Background())
+	if err != nil || dispatched != 1 {
+		t.Fatalf("Dispatch() = %d, %v, want 1", dispatched, err)
+	}
+
+	if len(recv.requests) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(recv.requests))
+	}
+	request := recv.requests[0]
+	timestamp, err := strconv.ParseInt(request.header.Get(webhook.HeaderTimestamp), 10, 64)
+	if err != nil {
+		t.Fatalf("invalid timestamp header: %v", err)
+	}
+	if !webhook.VerifySignature(repo.subscriptions[0].Secret, request.header.Get(webhook.HeaderSignature), timestamp, request.body) {
+		t.Error("receiver could not verify the signature")
+	}
+	if request.header.Get(webhook.HeaderEvent) != event.TypeUserConfirmed || request.header.Get(webhook.HeaderID) != repo.deliveries[0].EventID {
+		t.Errorf("unexpected headers %v", request.header)
+	}
+
+	delivery := repo.deliveries[0]
+	if delivery.Status != webhook.DeliveryStatusSucceeded || delivery.LastStatusCode != http.StatusNoContent || delivery.DeliveredAt == nil {
+		t.Errorf("delivery = %+v, want succeeded", delivery)
+	}
+	if len(repo.attempts) != 1 || repo.attempts[0].StatusCode != http.StatusNoContent {
+		t.Errorf("attempt log = %+v, want one successful attempt", repo.attempts)
+	}
+
+	dispatched, _ = dispatcher.Dispatch(context.Background())
+	if dispatched != 0 || len(recv.requests) != 1 {
+		t.Error("Dispatch() must not resend a succeeded delivery")
+	}
+	// A batch of 10 is sent sequentially with a 1s timeout each
+	if len(repo.leases) == 0 || repo.leases[0] < 10*time.Second {
+		t.Errorf("Dispatch() leases = %v, want at least a timeout per delivery of the batch", repo.leases)
+	}
+}
+
+func TestDispatcher_RetriesWithBackoff(t *testing.T) {
+	repo, recv, dispatcher := setup(t, http.StatusInternalServerError, 3)
+
+	before := time.Now()
+	if _, err := dispatcher.Dispatch(context.Background()); err != nil {
+		t.Fatalf("Dispatch() error = %v", err)
+	}
+
+	delivery := repo.deliveries[0]
+	if delivery.Status != webhook.DeliveryStatusPending || delivery.Attempts != 1 || delivery.LastStatusCode != http.StatusInternalServerError {
+		t.Fatalf("delivery = %+v, want pending after one failed attempt", delivery)
+	}
+	if delivery.NextAttemptAt.Before(before.Add(time.Minute)) {
+		t.Errorf("next attempt at %v, want at least a minute later", delivery.NextAttemptAt)
+	}
+
+	dispatched, _ := dispatcher.Dispatch(context.Background())
+	if dispatched != 0 || len(recv.requests) != 1 {
+		t.Error("Dispatch() must wait for the backoff before retrying")
+	}
+	if len(repo.attempts) != 1 || repo.attempts[0].Error == "" {
+		t.Errorf("attempt log = %+v, want one failed attempt", repo.attempts)
+	}
+}
+
+func TestDispatcher_DeadLettersAfterMaxAttempts(t *testing.T) {
+	repo, _, dispatcher := setup(t, http.StatusBadGateway, 1)
+
+	if _, err := dispatcher.Dispatch(context.Background()); err != nil {
+		t.Fatalf("Dispatch() error = %v", err)
+	}
+
+	if !repo.deliveries[0].IsDead() {
+		t.Errorf("delivery status = %s, want DEAD", repo.deliveries[0].Status)
+	}
+}
+
+func TestDispatcher_OnlyDeliversToTheUsersClient(t *testing.T) {
+	subscription, err := webhook.NewSubscription(auth.WEB, "https://example.com/hooks", []string{event.TypeUserConfirmed})
+	if err != nil {
+		t.Fatalf("NewSubscription() error = %v", err)
+	}
+	subscription.ID = "sub-1"
+	repo := &memoryWebhooks{subscriptions: []webhook.Subscription{*subscription}}
+
+	var messages [][]byte
+	for _, clientType := range []auth.ClientType{auth.IOS, ""} {
+		envelope, _ := stream.NewEnvelope(context.Background(), event.TypeUserConfirmed, 1, event.UserConfirmed{UserID: "user-id", Email: "test@example.com", ClientType: string(clientType)})
+		payload, _ := json.Marshal(envelope)
+		messages = append(messages, payload)
+	}
+
+	dispatcher := appWebhook.NewDispatcher(log.NewLogger("test", slog.LevelError, slog.LevelError), repo, &replayStream{messages: messages}, event.NewRegistry(), immediateTx{}, config.WebhookConfig{
+		Timeout:   time.Second,
+		BatchSize: 10,
+	})
+	if err := dispatcher.ConsumeEvents(context.Background(), "test"); err != nil {
+		t.Fatalf("ConsumeEvents() error = %v", err)
+	}
+
+	if len(repo.deliveries) != 0 {
+		t.Errorf("ConsumeEvents() created %d deliveries for users of other or no clients, want 0", len(repo.deliveries))
+	}
+}
+
+func TestDispatcher_RefusesPrivateReceivers(t *testing.T) {
+	repo, recv, dispatcher := setupWithNetworks(t, http.StatusNoContent, 3, false)
+
+	if _, err := dispatcher.Dispatch(context.Background()); err != nil {
+		t.Fatalf("Dispatch() error = %v", err)
+	}
+
+	if len(recv.requests) != 0 {
+		t.Fatalf("receiver on loopback got %d requests, want 0", len(recv.requests))
+	}
+	if delivery := repo.deliveries[0]; delivery.Status != webhook.DeliveryStatusPending || !strings.Contains(delivery.LastError, "not public") {
+		t.Errorf("delivery = %+v, want a failed attempt refused at dial time", delivery)
+	}
+}
@@ -0,0 +1,105 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ouz/goboilerplate/internal/domain/event"
+	"github.com/ouz/goboilerplate/internal/domain/webhook"
+	"github.com/ouz/goboilerplate/pkg/auth"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	signature := webhook.Sign("secret", 1700000000, body)
+
+	if !webhook.VerifySignature("secret", signature, 1700000000, body) {
+		t.Error("VerifySignature() = false for a valid signature")
+	}
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      []byte
+	}{
+		{name: "wrong secret", secret: "other", timestamp: 1700000000, body: body},
+		{name: "replayed timestamp", secret: "secret", timestamp: 1700000001, body: body},
+		{name: "tampered body", secret: "secret", timestamp: 1700000000, body: []byte(`{"id":"2"}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if webhook.VerifySignature(tt.secret, signature, tt.timestamp, tt.body) {
+				t.Error("VerifySignature() = true, want false")
+			}
+		})
+	}
+}
+
+func TestNewSubscription(t *testing.T) {
+	tests := []struct {
+		name       string
+		url        string
+		eventTypes []string
+		wantErr    bool
+	}{
+		{name: "valid", url: "https://partner.example.com/hooks", eventTypes: []string{event.TypeUserConfirmed, event.TypeUserDeleted}},
+		{name: "relative url", url: "/hooks", eventTypes: []string{event.TypeUserConfirmed}, wantErr: true},
+		{name: "unsupported scheme", url: "ftp://partner.example.com", eventTypes: []string{event.TypeUserConfirmed}, wantErr: true},
+		{name: "plain http", url: "http://partner.example.com", eventTypes: []string{event.TypeUserConfirmed}, wantErr: true},
+		{name: "localhost", url: "https://localhost:8443", eventTypes: []string{event.TypeUserConfirmed}, wantErr: true},
+		{name: "private address", url: "https://10.0.0.5/hooks", eventTypes: []string{event.TypeUserConfirmed}, wantErr: true},
+		{name: "metadata address", url: "https://169.254.169.254/latest", eventTypes: []string{event.TypeUserConfirmed}, wantErr: true},
+		{name: "loopback ipv6", url: "https://[::1]/hooks", eventTypes: []string{event.TypeUserConfirmed}, wantErr: true},
+		{name: "no event types", url: "https://partner.example.com", wantErr: true},
+		{name: "unsupported event type", url: "https://partner.example.com", eventTypes: []string{event.TypeUserLoggedIn}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subscription, err := webhook.NewSubscription(auth.WEB, tt.url, tt.eventTypes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewSubscription() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if subscription.Secret == "" || !subscription.Accepts(event.TypeUserDeleted) || subscription.Accepts(event.TypeUserLoggedIn) {
+				t.Errorf("NewSubscription() = %+v", subscription)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := webhook.RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Second, MaxBackoff: 10 * time.Second}
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, expected := range want {
+		if got := policy.Backoff(i + 1); got != expected {
+			t.Errorf("Backoff(%d) = %v, want %v", i+1, got, expected)
+		}
+	}
+}
+
+func TestDelivery_RecordFailure(t *testing.T) {
+	policy := webhook.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Minute, MaxBackoff: time.Hour}
+	delivery := webhook.NewDelivery(webhook.Subscription{ID: "sub"}, "event", event.TypeUserConfirmed, []byte(`{}`))
+	now := time.Now()
+
+	delivery.RecordFailure(500, "boom", policy, now)
+	if delivery.IsDead() || !delivery.NextAttemptAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("RecordFailure() first attempt = %+v, want retry in a minute", delivery)
+	}
+
+	delivery.RecordFailure(500, "boom", policy, now)
+	if !delivery.IsDead() {
+		t.Fatalf("RecordFailure() after max attempts status = %s, want DEAD", delivery.Status)
+	}
+
+	delivery.Requeue(now)
+	if delivery.Status != webhook.DeliveryStatusPending || delivery.Attempts != 0 {
+		t.Errorf("Requeue() = %+v, want pending with no attempts", delivery)
+	}
+}